@@ -0,0 +1,187 @@
+package espresso;
+
+import java.applet.Applet;
+import java.applet.AppletContext;
+import java.applet.AppletStub;
+import java.applet.AudioClip;
+import java.awt.BorderLayout;
+import java.awt.Desktop;
+import java.awt.Dimension;
+import java.awt.Frame;
+import java.awt.Image;
+import java.awt.Toolkit;
+import java.awt.event.WindowAdapter;
+import java.awt.event.WindowEvent;
+import java.io.InputStream;
+import java.net.URL;
+import java.util.Collections;
+import java.util.Enumeration;
+import java.util.HashMap;
+import java.util.Iterator;
+import java.util.LinkedHashMap;
+import java.util.Map;
+
+/**
+ * AppletRunner runs the applet of an applet-desc in a frame, like the AppletViewer of the JDK did.
+ *
+ * Arguments: main-class width height document-base code-base name [param-name=param-value ...]
+ */
+public class AppletRunner implements AppletStub, AppletContext {
+
+    private final URL documentBase;
+    private final URL codeBase;
+    private final Map<String, String> params = new HashMap<String, String>();
+    private final Map<String, InputStream> streams = new LinkedHashMap<String, InputStream>();
+    private Applet applet;
+    private Frame frame;
+    private boolean active;
+
+    private AppletRunner(URL documentBase, URL codeBase) {
+        this.documentBase = documentBase;
+        this.codeBase = codeBase;
+    }
+
+    public static void main(String[] args) throws Exception {
+        if (args.length < 6) {
+            System.err.println("usage: AppletRunner main-class width height document-base code-base name [name=value ...]");
+            System.exit(1);
+        }
+
+        AppletRunner runner = new AppletRunner(new URL(args[3]), new URL(args[4]));
+
+        for (int i = 6; i < args.length; i++) {
+            int p = args[i].indexOf('=');
+            if (p > 0) {
+                // applet params are case insensitive
+                runner.params.put(args[i].substring(0, p).toLowerCase(), args[i].substring(p + 1));
+            }
+        }
+
+        runner.run(args[0], Integer.parseInt(args[1]), Integer.parseInt(args[2]), args[5]);
+    }
+
+    private void run(String mainClass, int width, int height, String name) throws Exception {
+        applet = (Applet) Class.forName(mainClass).getDeclaredConstructor().newInstance();
+        applet.setStub(this);
+        applet.setPreferredSize(new Dimension(width, height));
+        applet.setSize(width, height);
+
+        frame = new Frame(name);
+        frame.setLayout(new BorderLayout());
+        frame.add(applet, BorderLayout.CENTER);
+        frame.addWindowListener(new WindowAdapter() {
+            @Override
+            public void windowClosing(WindowEvent e) {
+                active = false;
+                applet.stop();
+                applet.destroy();
+                frame.dispose();
+                System.exit(0);
+            }
+        });
+
+        applet.init();
+
+        frame.pack();
+        frame.setLocationRelativeTo(null);
+        frame.setVisible(true);
+
+        active = true;
+        applet.start();
+    }
+
+    // AppletStub
+
+    @Override
+    public boolean isActive() {
+        return active;
+    }
+
+    @Override
+    public URL getDocumentBase() {
+        return documentBase;
+    }
+
+    @Override
+    public URL getCodeBase() {
+        return codeBase;
+    }
+
+    @Override
+    public String getParameter(String name) {
+        return name == null ? null : params.get(name.toLowerCase());
+    }
+
+    @Override
+    public AppletContext getAppletContext() {
+        return this;
+    }
+
+    @Override
+    public void appletResize(int width, int height) {
+        applet.setPreferredSize(new Dimension(width, height));
+        frame.pack();
+    }
+
+    // AppletContext
+
+    @Override
+    public AudioClip getAudioClip(URL url) {
+        return Applet.newAudioClip(url);
+    }
+
+    @Override
+    public Image getImage(URL url) {
+        return Toolkit.getDefaultToolkit().getImage(url);
+    }
+
+    @Override
+    public Applet getApplet(String name) {
+        return null;
+    }
+
+    @Override
+    public Enumeration<Applet> getApplets() {
+        return Collections.enumeration(Collections.singletonList(applet));
+    }
+
+    @Override
+    public void showDocument(URL url) {
+        showDocument(url, "_self");
+    }
+
+    @Override
+    public void showDocument(URL url, String target) {
+        try {
+            if (Desktop.isDesktopSupported()) {
+                Desktop.getDesktop().browse(url.toURI());
+            }
+        } catch (Exception e) {
+            System.err.println("Cannot show document " + url + ": " + e);
+        }
+    }
+
+    @Override
+    public void showStatus(String status) {
+        System.out.println(status);
+    }
+
+    @Override
+    public void setStream(String key, InputStream stream) {
+        if (stream == null) {
+            streams.remove(key);
+        } else {
+            streams.put(key, stream);
+        }
+    }
+
+    @Override
+    public InputStream getStream(String key) {
+        return streams.get(key);
+    }
+
+    @Override
+    public Iterator<String> getStreamKeys() {
+        return streams.keySet().iterator();
+    }
+}
@@ -0,0 +1,18 @@
+package javax.jnlp;
+
+import java.net.URL;
+
+/**
+ * DownloadServiceListener is the interface of the JNLP API which progress classes implement. It is provided for JREs
+ * without the JNLP API of Java Web Start.
+ */
+public interface DownloadServiceListener {
+
+    void progress(URL url, String version, long readSoFar, long total, int overallPercent);
+
+    void validating(URL url, String version, long entry, long total, int overallPercent);
+
+    void upgradingArchive(URL url, String version, int patchPercent, int overallPercent);
+
+    void downloadFailed(URL url, String version);
+}
@@ -0,0 +1,72 @@
+package espresso;
+
+import java.awt.Window;
+import java.io.BufferedReader;
+import java.io.InputStreamReader;
+import java.lang.reflect.Constructor;
+import java.net.URL;
+import javax.jnlp.DownloadServiceListener;
+
+/**
+ * ProgressRunner shows the downloads of espresso with the progress-class of a JNLP file, like Java Web Start did.
+ *
+ * Arguments: progress-class
+ *
+ * espresso feeds the progress as tab separated lines to stdin, an empty version is passed as null:
+ *
+ * progress url version read-so-far total overall-percent
+ * failed url version
+ * done
+ */
+public class ProgressRunner {
+
+    public static void main(String[] args) throws Exception {
+        if (args.length != 1) {
+            System.err.println("usage: ProgressRunner progress-class");
+            System.exit(1);
+        }
+
+        DownloadServiceListener listener = create(args[0]);
+
+        BufferedReader reader = new BufferedReader(new InputStreamReader(System.in, "UTF-8"));
+
+        String line;
+        while ((line = reader.readLine()) != null && !line.equals("done")) {
+            String[] fields = line.split("\t", -1);
+
+            try {
+                if (fields[0].equals("progress") && fields.length == 6) {
+                    listener.progress(new URL(fields[1]), version(fields[2]), Long.parseLong(fields[3]), Long.parseLong(fields[4]), Integer.parseInt(fields[5]));
+                } else if (fields[0].equals("failed") && fields.length == 3) {
+                    listener.downloadFailed(new URL(fields[1]), version(fields[2]));
+                }
+            } catch (Exception e) {
+                System.err.println("Cannot process progress " + line + ": " + e);
+            }
+        }
+
+        // the app shows its own windows, the ones of the progress class end with the downloads
+        for (Window window : Window.getWindows()) {
+            window.dispose();
+        }
+
+        System.exit(0);
+    }
+
+    // create instantiates the progress class by its no-arg constructor, otherwise by the one with the applet container
+    private static DownloadServiceListener create(String progressClass) throws Exception {
+        Class<?> clazz = Class.forName(progressClass);
+
+        try {
+            return (DownloadServiceListener) clazz.getConstructor().newInstance();
+        } catch (NoSuchMethodException e) {
+            Constructor<?> constructor = clazz.getConstructor(Object.class);
+
+            return (DownloadServiceListener) constructor.newInstance(new Object[]{null});
+        }
+    }
+
+    private static String version(String version) {
+        return version.isEmpty() ? null : version;
+    }
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// adminConfigPath returns the path of the cached admin config, the signature is stored next to it with suffix ".sig"
+func adminConfigPath() string {
+	return filepath.Join(*cache, "admin-config.json")
+}
+
+// fetchURL loads the content of the given URL
+func fetchURL(address string) ([]byte, error) {
+	response, err := httpRequest(http.MethodGet, address)
+	if err != nil {
+		return nil, explainTLSError(err)
+	}
+
+	// care about the final close of the response body
+	defer func() {
+		common.Error(response.Body.Close())
+	}()
+
+	checkClockSkew(response)
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot load %s: %s", address, response.Status)
+	}
+
+	return io.ReadAll(response.Body)
+}
+
+// adminPublicKey returns the ed25519 public key of the -admin-config-key parameter
+func adminPublicKey() (ed25519.PublicKey, error) {
+	if *adminKey == "" {
+		return nil, fmt.Errorf("the admin config cannot be verified, use -admin-config-key")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(*adminKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid admin config key")
+	}
+
+	return key, nil
+}
+
+// verifyAdminConfig checks the base64 encoded ed25519 signature of the admin config
+func verifyAdminConfig(content []byte, signature []byte) error {
+	key, err := adminPublicKey()
+	if err != nil {
+		return err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("invalid admin config signature: %w", err)
+	}
+
+	if !ed25519.Verify(key, content, sig) {
+		logEvent(eventSecurityRejection, fmt.Sprintf("admin config %s rejected due to an invalid signature", *adminURL))
+
+		return fmt.Errorf("the signature of the admin config is invalid")
+	}
+
+	return nil
+}
+
+// readCachedAdminConfig reads and verifies the cached admin config
+func readCachedAdminConfig() ([]byte, error) {
+	content, err := storage.ReadFile(adminConfigPath())
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := storage.ReadFile(adminConfigPath() + ".sig")
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyAdminConfig(content, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return content, nil
+}
+
+// loadAdminConfig returns the signed admin config, fetched from the admin config URL or taken from the cache within its TTL
+func loadAdminConfig() ([]byte, error) {
+	if *adminURL == "" {
+		return nil, nil
+	}
+
+	info, err := os.Stat(adminConfigPath())
+	if err == nil && time.Since(info.ModTime()) < *adminTTL {
+		content, err := readCachedAdminConfig()
+		if err == nil {
+			return content, nil
+		}
+
+		common.Warn(fmt.Sprintf("Cached admin config is not usable: %v", err))
+	}
+
+	content, err := fetchURL(*adminURL)
+	if err == nil {
+		var signature []byte
+
+		signature, err = fetchURL(*adminURL + ".sig")
+		if err == nil {
+			err = verifyAdminConfig(content, signature)
+		}
+
+		if err == nil {
+			err = storage.WriteFile(adminConfigPath(), content)
+			if err != nil {
+				return nil, err
+			}
+
+			err = storage.WriteFile(adminConfigPath()+".sig", signature)
+			if err != nil {
+				return nil, err
+			}
+
+			return content, nil
+		}
+	}
+
+	// an outdated admin config is still better than none
+	cached, cachedErr := readCachedAdminConfig()
+	if cachedErr != nil {
+		return nil, fmt.Errorf("cannot load the admin config %s: %w", *adminURL, err)
+	}
+
+	common.Warn(fmt.Sprintf("Cannot load the admin config %s, using the cached one: %v", *adminURL, err))
+
+	return cached, nil
+}
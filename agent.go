@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"sort"
+	"time"
+)
+
+// configPollInterval is the interval in which the agent checks the config file and the admin config for changes
+const configPollInterval = 10 * time.Second
+
+// configChanges returns the names of the settings which differ between the configs, sorted by name. The values are
+// not returned, they may contain secrets.
+func configChanges(old *Config, cfg *Config) ([]string, error) {
+	settings := make([]map[string]json.RawMessage, 2)
+
+	for i, c := range []*Config{old, cfg} {
+		ba, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(ba, &settings[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var changes []string
+
+	for name, value := range settings[1] {
+		if !bytes.Equal(settings[0][name], value) {
+			changes = append(changes, name)
+		}
+	}
+
+	sort.Strings(changes)
+
+	return changes, nil
+}
+
+// configStamp identifies the state of the config file and of the cached admin config
+func configStamp() string {
+	stamp := ""
+
+	for _, filename := range []string{configPath(), adminConfigPath()} {
+		if info, err := os.Stat(filename); err == nil {
+			stamp += fmt.Sprintf("%s:%d:%d;", filename, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+
+	return stamp
+}
+
+// reloadConfig loads the config again and applies its changes, an invalid config is reported and the old one is kept
+func reloadConfig(old *Config) *Config {
+	cfg, err := loadConfig()
+	if err == nil {
+		err = applyConfig(cfg)
+		if err != nil {
+			common.Error(applyConfig(old))
+		}
+	}
+
+	if err != nil {
+		common.Warn(fmt.Sprintf("Agent: the changed config is not applied, the former one is kept: %v", err))
+
+		return old
+	}
+
+	changes, err := configChanges(old, cfg)
+	if common.Error(err) {
+		return cfg
+	}
+
+	for _, change := range changes {
+		common.Info(fmt.Sprintf("Agent: applied the change of the config setting %q", change))
+	}
+
+	return cfg
+}
+
+// updateApps downloads the updates of the apps of the config like a background update, the cache quota evicts the
+// least recently launched apps
+func updateApps(cfg *Config) {
+	for _, app := range cfg.Apps {
+		if app.URL == "" {
+			continue
+		}
+
+		l := NewLaunch(cfg, app.URL)
+		l.forceUpdate = true
+
+		_, err := l.resolve()
+		if err == nil {
+			err = l.download()
+		}
+
+		if err == nil {
+			err = l.enforceCacheQuota()
+		}
+
+		if err != nil {
+			common.Warn(fmt.Sprintf("Agent: the update of %s failed: %v", app.URL, err))
+
+			continue
+		}
+
+		common.Debug(fmt.Sprintf("Agent: %s is up to date", app.URL))
+	}
+}
+
+// runAgent keeps the apps of the config up to date in the cache until espresso is ended. The config file and the
+// admin config are watched, their changes are applied without a restart, like the HTTPS policy, the cache quota and
+// the apps to update. The admin config is fetched again after -admin-config-ttl.
+func runAgent(cfg *Config) error {
+	if *agentInterval <= 0 {
+		return fmt.Errorf("invalid agent interval %v", *agentInterval)
+	}
+
+	common.Info(fmt.Sprintf("Agent: updating %d apps every %v", len(cfg.Apps), *agentInterval))
+
+	stamp := configStamp()
+	loaded := time.Now()
+	next := time.Now()
+
+	for {
+		if !time.Now().Before(next) {
+			updateApps(cfg)
+
+			next = time.Now().Add(*agentInterval)
+		}
+
+		time.Sleep(min(configPollInterval, time.Until(next)))
+
+		// the updates run in this goroutine, so a reload never changes the settings of a running update
+		if configStamp() != stamp || (*adminURL != "" && time.Since(loaded) >= *adminTTL) {
+			cfg = reloadConfig(cfg)
+
+			stamp = configStamp()
+			loaded = time.Now()
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/mpetavy/common"
+	"slices"
+	"testing"
+)
+
+func TestConfigChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		old  Config
+		cfg  Config
+		want []string
+	}{
+		{"unchanged", Config{CacheQuota: "1GB"}, Config{CacheQuota: "1GB"}, nil},
+		{"quota", Config{CacheQuota: "1GB"}, Config{CacheQuota: "2GB"}, []string{"cache-quota"}},
+		{"nested", Config{}, Config{Security: SecurityConfig{RequireHTTPS: "true"}}, []string{"security"}},
+		{"several", Config{}, Config{Ring: "canary", Apps: []AppConfig{{URL: "https://example.com/app.jnlp"}}}, []string{"apps", "ring"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := configChanges(&test.old, &test.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(changes, test.want) {
+				t.Errorf("configChanges() = %v, want %v", changes, test.want)
+			}
+		})
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	useMemoryStorage(t)
+
+	savedConfig := *config
+	*config = configPath()
+
+	t.Cleanup(func() {
+		*config = savedConfig
+
+		common.Error(setHTTPSPolicy(""))
+	})
+
+	err := writeFileAtomic(*config, []byte(`{"security": {"require-https": "true"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := reloadConfig(&Config{})
+	if cfg.Security.RequireHTTPS != "true" || httpsPolicy != httpsRequire {
+		t.Fatalf("the HTTPS policy of the changed config is not applied: %q", httpsPolicy)
+	}
+
+	err = writeFileAtomic(*config, []byte(`{"security": {"require-https": "sometimes"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reloadConfig(cfg) != cfg || httpsPolicy != httpsRequire {
+		t.Fatalf("an invalid config is applied")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// maxErrorExamples is the max. number of example errors reported per root cause
+const maxErrorExamples = 2
+
+// StatusError reports an unexpected HTTP status of a resource request
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: unexpected HTTP status %s", e.URL, e.Status)
+}
+
+// ErrorAggregator collects the errors of concurrent resource operations and groups them by their root cause
+type ErrorAggregator struct {
+	mu     sync.Mutex
+	causes []string
+	groups map[string][]error
+}
+
+// newErrorAggregator creates an empty ErrorAggregator
+func newErrorAggregator() *ErrorAggregator {
+	return &ErrorAggregator{
+		groups: make(map[string][]error),
+	}
+}
+
+// Set adds an error
+func (a *ErrorAggregator) Set(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	cause := errorCause(err)
+
+	if _, ok := a.groups[cause]; !ok {
+		a.causes = append(a.causes, cause)
+	}
+
+	a.groups[cause] = append(a.groups[cause], err)
+}
+
+// IsSet checks if any error has been added
+func (a *ErrorAggregator) IsSet() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.causes) > 0
+}
+
+// Get returns a single error which reports each distinct root cause once with the number of affected resources and examples
+func (a *ErrorAggregator) Get() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.causes) == 0 {
+		return nil
+	}
+
+	// a single failure is reported as it is
+	if len(a.causes) == 1 && len(a.groups[a.causes[0]]) == 1 {
+		return a.groups[a.causes[0]][0]
+	}
+
+	var lines []string
+
+	for _, cause := range a.causes {
+		list := a.groups[cause]
+
+		var examples []string
+		for i := 0; i < len(list) && i < maxErrorExamples; i++ {
+			examples = append(examples, list[i].Error())
+		}
+
+		if len(list) == 1 {
+			lines = append(lines, list[0].Error())
+
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("%d resources failed: %s (e.g. %s)", len(list), cause, strings.Join(examples, "; ")))
+	}
+
+	return errors.New(strings.Join(lines, "\n"))
+}
+
+// errorHost returns the host of the request which caused the error
+func errorHost(err error) string {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		u, err := url.Parse(statusErr.URL)
+		if err == nil {
+			return u.Host
+		}
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		u, err := url.Parse(urlErr.URL)
+		if err == nil {
+			return u.Host
+		}
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.Name
+	}
+
+	return "unknown"
+}
+
+// errorCause classifies the error by its root cause, errors which cannot be classified are their own cause
+func errorCause(err error) string {
+	host := errorHost(err)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return fmt.Sprintf("HTTP %s from host %s", statusErr.Status, host)
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return fmt.Sprintf("DNS lookup of host %s failed", host)
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Sprintf("connection refused to host %s", host)
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) {
+		return fmt.Sprintf("connection reset by host %s", host)
+	}
+
+	var certInvalidErr x509.CertificateInvalidError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordHeaderErr tls.RecordHeaderError
+	if errors.As(err, &certInvalidErr) || errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &recordHeaderErr) {
+		return fmt.Sprintf("TLS failure with host %s", host)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Sprintf("timeout connecting to host %s", host)
+	}
+
+	return err.Error()
+}
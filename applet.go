@@ -0,0 +1,248 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// appletRunnerSource is the AppletViewer-style runner which hosts the applets of applet-desc JNLP files
+//
+//go:embed AppletRunner.java
+var appletRunnerSource []byte
+
+// appletRunnerClass is the main class of the applet runner
+const appletRunnerClass = "espresso.AppletRunner"
+
+// default size of applets without width and height
+const (
+	defaultAppletWidth  = 800
+	defaultAppletHeight = 600
+)
+
+// javacExecutable returns the Java compiler of the JDK of the launch, otherwise of an installed JDK
+func (l *Launch) javacExecutable(purpose string) (string, error) {
+	javac := "javac"
+	if runtime.GOOS == "windows" {
+		javac += ".exe"
+	}
+
+	var homes []string
+
+	if home, err := l.jreHome(); err == nil {
+		homes = append(homes, home)
+	}
+
+	for _, jre := range installedJres() {
+		homes = append(homes, jre.Home)
+	}
+
+	for _, home := range homes {
+		if path := filepath.Join(home, "bin", javac); common.FileExists(path) {
+			return path, nil
+		}
+	}
+
+	path, err := exec.LookPath(javac)
+	if err != nil {
+		return "", fmt.Errorf("the %s needs a JDK to be built once, but there is no javac: %w", purpose, err)
+	}
+
+	return path, nil
+}
+
+// appletRunnerJar returns the jar of the applet runner, which is shared by all applets
+func (l *Launch) appletRunnerJar() (string, error) {
+	return l.runnerJar("applet runner", appletRunnerClass, map[string][]byte{"AppletRunner.java": appletRunnerSource})
+}
+
+// runnerJar returns the jar of a Java helper of espresso. It is built once per version of its sources with the javac of
+// a JDK.
+func (l *Launch) runnerJar(purpose string, mainClass string, sources map[string][]byte) (string, error) {
+	names := slices.Sorted(maps.Keys(sources))
+
+	hash := sha256.New()
+
+	for _, name := range names {
+		hash.Write(sources[name])
+	}
+
+	name := strings.ReplaceAll(purpose, " ", "-")
+
+	jar := filepath.Join(*cache, name, hex.EncodeToString(hash.Sum(nil))[:12], name+".jar")
+
+	// concurrent launches build the jar only once
+	unlock, err := lockFile(jar)
+	if err != nil {
+		return "", err
+	}
+
+	defer unlock()
+
+	if common.FileExists(jar) {
+		return jar, nil
+	}
+
+	javac, err := l.javacExecutable(purpose)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.MkdirTemp(filepath.Dir(jar), "build-")
+	if err != nil {
+		return "", err
+	}
+
+	// the sources and classes are only needed for the build
+	defer func() {
+		common.Error(os.RemoveAll(tmp))
+	}()
+
+	classes := filepath.Join(tmp, "classes")
+
+	// Java 8 bytecode runs on all JREs, also the ones which still have the applet API
+	args := []string{"-nowarn", "-source", "8", "-target", "8", "-encoding", "UTF-8", "-d", classes}
+
+	for _, name := range names {
+		source := filepath.Join(tmp, name)
+
+		err = os.WriteFile(source, sources[name], common.DefaultFileMode)
+		if err != nil {
+			return "", err
+		}
+
+		args = append(args, source)
+	}
+
+	ba, err := exec.Command(javac, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("cannot build the %s with %s: %w\n%s", purpose, javac, err, string(ba))
+	}
+
+	l.logf("%s is built with %s", strings.ToUpper(purpose[:1])+purpose[1:], javac)
+
+	return jar, writeClassesJar(classes, jar, mainClass)
+}
+
+// writeClassesJar packs the class files of the directory into a jar, the jar is replaced atomically
+func writeClassesJar(classes string, jar string, mainClass string) error {
+	f, err := os.CreateTemp(filepath.Dir(jar), filepath.Base(jar)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	w := zip.NewWriter(f)
+
+	err = func() error {
+		manifest, err := w.Create("META-INF/MANIFEST.MF")
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(manifest, "Manifest-Version: 1.0\r\nMain-Class: %s\r\n\r\n", mainClass)
+		if err != nil {
+			return err
+		}
+
+		return filepath.WalkDir(classes, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			rel, err := filepath.Rel(classes, path)
+			if err != nil {
+				return err
+			}
+
+			ba, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			entry, err := w.Create(filepath.ToSlash(rel))
+			if err != nil {
+				return err
+			}
+
+			_, err = entry.Write(ba)
+
+			return err
+		})
+	}()
+
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), jar)
+	}
+
+	if err != nil {
+		common.Error(os.Remove(f.Name()))
+	}
+
+	return err
+}
+
+// appletArguments returns the arguments of the applet runner: main class, size, document base, code base, name and
+// the params of the applet-desc
+func (l *Launch) appletArguments(applet AppletDesc, values map[string]string) ([]string, error) {
+	codebase, err := url.Parse(strings.TrimSuffix(l.codebase, "/") + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	documentBase := codebase
+
+	if applet.DocumentBase != "" {
+		documentBase, err = codebase.Parse(applet.DocumentBase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid documentbase %q of the applet-desc: %w", applet.DocumentBase, err)
+		}
+	}
+
+	size := func(value string, def int) string {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return value
+		}
+
+		return strconv.Itoa(def)
+	}
+
+	name := applet.Name
+	if name == "" {
+		name = l.title
+	}
+
+	if name == "" {
+		name = applet.MainClass
+	}
+
+	args := []string{applet.MainClass, size(applet.Width, defaultAppletWidth), size(applet.Height, defaultAppletHeight), documentBase.String(), codebase.String(), name}
+
+	for _, param := range applet.Params {
+		if param.Name != "" {
+			args = append(args, param.Name+"="+expandVariables(param.Value, values))
+		}
+	}
+
+	return args, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/mpetavy/common"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Association element of the information element
+type Association struct {
+	Extensions  string `xml:"extensions,attr"`
+	MimeType    string `xml:"mime-type,attr"`
+	Description string `xml:"description"`
+}
+
+// FileAssociation is a file association which launches espresso with the JNLP and the file
+type FileAssociation struct {
+	Name        string
+	Extensions  []string
+	MimeType    string
+	Description string
+	Executable  string
+	Args        []string
+	Icon        string
+}
+
+// associationMarkerPath returns the file which records the registration of the file associations of the app
+func associationMarkerPath(address string) (string, error) {
+	appPath, err := appCachePath(address)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appPath, "associations.registered"), nil
+}
+
+// registerAssociations registers the file associations of the JNLP with the OS once
+func (l *Launch) registerAssociations(information Information) error {
+	if !*associations || len(information.Associations) == 0 {
+		return nil
+	}
+
+	marker, err := associationMarkerPath(l.Address)
+	if err != nil {
+		return err
+	}
+
+	if common.FileExists(marker) {
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	for _, association := range information.Associations {
+		var extensions []string
+
+		for _, extension := range strings.Fields(strings.ReplaceAll(association.Extensions, ",", " ")) {
+			extensions = append(extensions, strings.TrimPrefix(extension, "."))
+		}
+
+		if len(extensions) == 0 {
+			continue
+		}
+
+		description := association.Description
+		if description == "" {
+			description = information.Title
+		}
+
+		err := registerAssociation(FileAssociation{
+			Name:        sanitizeName(shortcutName(information.Title)),
+			Extensions:  extensions,
+			MimeType:    association.MimeType,
+			Description: description,
+			Executable:  executable,
+			Args:        []string{"-url", l.Address},
+			Icon:        l.iconpath,
+		})
+		if err != nil {
+			return err
+		}
+
+		l.logf("Registered the file association %s", strings.Join(extensions, ", "))
+	}
+
+	return os.WriteFile(marker, []byte(time.Now().Format(time.RFC3339)), common.DefaultFileMode)
+}
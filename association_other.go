@@ -0,0 +1,92 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// registerAssociation registers the file extensions in the shared MIME database of the user and assigns them a
+// .desktop file which starts espresso
+func registerAssociation(association FileAssociation) error {
+	if runtime.GOOS == "darwin" {
+		// macOS hands documents to apps by Apple events of registered app bundles, not by the command line
+		common.Warn("File associations are not supported on macOS")
+
+		return nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	mimeType := association.MimeType
+	if mimeType == "" {
+		mimeType = "application/x-espresso-" + strings.ToLower(association.Name)
+	}
+
+	var globs strings.Builder
+	for _, extension := range association.Extensions {
+		fmt.Fprintf(&globs, "    <glob pattern=\"*.%s\"/>\n", xmlEscape(extension))
+	}
+
+	mimeXML := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<mime-info xmlns="http://www.freedesktop.org/standards/shared-mime-info">
+  <mime-type type="%s">
+    <comment>%s</comment>
+%s  </mime-type>
+</mime-info>
+`, xmlEscape(mimeType), xmlEscape(association.Description), globs.String())
+
+	mimePath := filepath.Join(home, ".local", "share", "mime")
+
+	err = os.MkdirAll(filepath.Join(mimePath, "packages"), common.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(mimePath, "packages", "espresso-"+association.Name+".xml"), []byte(mimeXML), common.DefaultFileMode)
+	if err != nil {
+		return err
+	}
+
+	args := []string{desktopQuote(association.Executable)}
+	for _, arg := range association.Args {
+		args = append(args, desktopQuote(arg))
+	}
+
+	desktopFile := "espresso-" + association.Name + "-open.desktop"
+
+	content := fmt.Sprintf("[Desktop Entry]\nType=Application\nName=%s\nExec=%s -open %%f\nIcon=%s\nMimeType=%s;\nNoDisplay=true\nTerminal=false\n",
+		association.Description, strings.Join(args, " "), association.Icon, mimeType)
+
+	applications := filepath.Join(home, ".local", "share", "applications")
+
+	err = os.MkdirAll(applications, common.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(applications, desktopFile), []byte(content), 0755)
+	if err != nil {
+		return err
+	}
+
+	// the databases are refreshed if the tools are available
+	_ = exec.Command("update-mime-database", mimePath).Run()
+	_ = exec.Command("update-desktop-database", applications).Run()
+
+	ba, err := exec.Command("xdg-mime", "default", desktopFile, mimeType).CombinedOutput()
+	if err != nil {
+		common.Warn(fmt.Sprintf("Cannot set %s as default for %s: %v %s", desktopFile, mimeType, err, strings.TrimSpace(string(ba))))
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// classesKey is the registry key of the file associations of the current user
+const classesKey = `Software\Classes\`
+
+const (
+	shcneAssocChanged = 0x08000000
+	shcnfIDList       = 0x0000
+)
+
+var (
+	shell32            = windows.NewLazySystemDLL("shell32.dll")
+	procSHChangeNotify = shell32.NewProc("SHChangeNotify")
+)
+
+// setRegistryValue creates the key below HKCU\Software\Classes and sets its value
+func setRegistryValue(path string, name string, value string) error {
+	key, _, err := registry.CreateKey(registry.CURRENT_USER, classesKey+path, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = key.Close()
+	}()
+
+	return key.SetStringValue(name, value)
+}
+
+// registerAssociation registers the file extensions for the current user with a ProgID which starts espresso
+func registerAssociation(association FileAssociation) error {
+	progID := "espresso." + association.Name
+
+	args := []string{syscall.EscapeArg(association.Executable)}
+	for _, arg := range association.Args {
+		args = append(args, syscall.EscapeArg(arg))
+	}
+
+	command := strings.Join(append(args, "-open", `"%1"`), " ")
+
+	icon := association.Executable
+	if strings.EqualFold(filepath.Ext(association.Icon), ".ico") {
+		icon = association.Icon
+	}
+
+	for _, value := range []struct {
+		path  string
+		name  string
+		value string
+	}{
+		{progID, "", association.Description},
+		{progID + `\DefaultIcon`, "", icon},
+		{progID + `\shell\open\command`, "", command},
+	} {
+		err := setRegistryValue(value.path, value.name, value.value)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, extension := range association.Extensions {
+		err := setRegistryValue("."+extension, "", progID)
+		if err != nil {
+			return err
+		}
+
+		err = setRegistryValue("."+extension+`\OpenWithProgids`, progID, "")
+		if err != nil {
+			return err
+		}
+
+		if association.MimeType != "" {
+			err = setRegistryValue("."+extension, "Content Type", association.MimeType)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// let the explorer pick up the new association
+	err := procSHChangeNotify.Find()
+	if err != nil {
+		return err
+	}
+
+	_, _, _ = procSHChangeNotify.Call(shcneAssocChanged, shcnfIDList, 0, 0)
+
+	return nil
+}
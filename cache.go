@@ -0,0 +1,580 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// matchesResource reports if the resource path relative to the app directory matches the glob pattern. Patterns
+// without a slash match the file name in any directory.
+func matchesResource(pattern string, rel string) (bool, error) {
+	if !strings.Contains(pattern, "/") {
+		rel = path.Base(rel)
+	}
+
+	return path.Match(pattern, rel)
+}
+
+// invalidateResources removes the cached resources of the app matching the glob pattern together with their cache
+// index entries, so the next launch downloads them again
+func invalidateResources(address string, pattern string) ([]string, error) {
+	// reject an invalid pattern before anything is removed
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	appPath, err := appCachePath(address)
+	if err != nil {
+		return nil, err
+	}
+
+	resourcePath := filepath.Join(appPath, "app")
+
+	var removed []string
+
+	err = filepath.WalkDir(resourcePath, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(resourcePath, filename)
+		if err != nil {
+			return err
+		}
+
+		ok, err := matchesResource(pattern, filepath.ToSlash(rel))
+		if err != nil || !ok {
+			return err
+		}
+
+		err = os.Remove(longPath(filename))
+		if err != nil {
+			return err
+		}
+
+		removed = append(removed, filename)
+
+		return nil
+	})
+	if err != nil {
+		return removed, err
+	}
+
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	// the validators of the removed files must not be reused
+	err = updateCacheIndex(func(index *CacheIndex) error {
+		for _, filename := range removed {
+			if key, ok := cacheKey(filename); ok {
+				delete(index.Entries, key)
+			}
+		}
+
+		return nil
+	})
+
+	return removed, err
+}
+
+// sharedCacheDirs are the directories of the cache which are used by all apps
+var sharedCacheDirs = []string{"natives", "javafx", "fonts", "applet-runner", "progress-runner"}
+
+// keptCacheFiles are the files of an app directory which are kept by "cache clean" and "cache purge": the user data,
+// which cannot be downloaded again, and the PID registry
+var keptCacheFiles = []string{"prefs.json", "muffins", "pin.json", "instances", "shortcuts.created", "associations.registered", "installers.json"}
+
+// CacheDir describes a directory of the cache
+type CacheDir struct {
+	Name     string
+	Apps     []string
+	Size     int64
+	Files    int
+	LastUsed time.Time
+}
+
+// cacheDirApps returns the JNLP URLs of the apps per app directory of the cache. The apps are known by the config, the
+// cache index and the replay bundles of their last launch, apps of the same host share their directory.
+func cacheDirApps(cfg *Config, index *CacheIndex) map[string][]string {
+	apps := make(map[string][]string)
+
+	add := func(dir string, address string) {
+		if !slices.Contains(apps[dir], address) {
+			apps[dir] = append(apps[dir], address)
+		}
+	}
+
+	for _, app := range cfg.Apps {
+		appPath, err := appCachePath(app.URL)
+		if err == nil && common.FileExists(appPath) {
+			add(filepath.Base(appPath), app.URL)
+		}
+	}
+
+	for key, entry := range index.Entries {
+		dir, _, _ := strings.Cut(key, "/")
+
+		for _, address := range entry.References {
+			add(dir, address)
+		}
+	}
+
+	bundles, err := filepath.Glob(filepath.Join(*cache, "*", "replay.zip"))
+	if err == nil {
+		for _, bundle := range bundles {
+			if replay, err := loadReplay(bundle); err == nil && replay.URL != "" {
+				add(filepath.Base(filepath.Dir(bundle)), replay.URL)
+			}
+		}
+	}
+
+	for dir := range apps {
+		slices.Sort(apps[dir])
+	}
+
+	return apps
+}
+
+// scanCacheDir returns the size, number of files and the time of the last modification of the directory
+func scanCacheDir(path string) (int64, int, time.Time, error) {
+	var size int64
+	var files int
+	var modified time.Time
+
+	err := filepath.WalkDir(path, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		size += info.Size()
+		files++
+
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+
+		return nil
+	})
+
+	return size, files, modified, err
+}
+
+// cacheDirs returns the directories of the cache with their apps, the size and the last use of their resources
+// recorded by the cache index. Directories without indexed resources have the time of their last modification.
+func cacheDirs(cfg *Config) ([]CacheDir, error) {
+	index, err := readCacheIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	apps := cacheDirApps(cfg, index)
+
+	entries, err := os.ReadDir(*cache)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var dirs []CacheDir
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		size, files, used := indexedSize(index, entry.Name())
+
+		if used.IsZero() {
+			info, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+
+			used = info.ModTime()
+		}
+
+		dirs = append(dirs, CacheDir{Name: entry.Name(), Apps: apps[entry.Name()], Size: size, Files: files, LastUsed: used})
+	}
+
+	return dirs, nil
+}
+
+// formatTime formats the time of the cache listings, an unknown time as "-"
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Format(time.DateTime)
+}
+
+// appLabel returns the alias and the URL of the app
+func appLabel(cfg *Config, address string) string {
+	if alias := cfg.App(address).Alias; alias != "" {
+		return fmt.Sprintf("%s (%s)", alias, address)
+	}
+
+	return address
+}
+
+// listCache writes the directories of the cache with the apps using them
+func listCache(cfg *Config, w io.Writer) error {
+	dirs, err := cacheDirs(cfg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Cache %s\n\n", *cache)
+
+	// IDN hosts are sorted by their unicode form
+	slices.SortFunc(dirs, func(a, b CacheDir) int {
+		return strings.Compare(strings.ToLower(displayHost(a.Name)), strings.ToLower(displayHost(b.Name)))
+	})
+
+	var total int64
+
+	for _, dir := range dirs {
+		total += dir.Size
+
+		var apps []string
+		for _, address := range dir.Apps {
+			apps = append(apps, appLabel(cfg, address))
+		}
+
+		switch {
+		case slices.Contains(sharedCacheDirs, dir.Name):
+			apps = []string{"(shared by all apps)"}
+		case len(apps) == 0:
+			apps = []string{"(unknown app)"}
+		}
+
+		name := dir.Name
+		if display := displayHost(dir.Name); display != dir.Name {
+			name = fmt.Sprintf("%s (%s)", dir.Name, display)
+		}
+
+		fmt.Fprintf(w, "%-30s %10s %-19s %s\n", name, formatBytes(uint64(dir.Size)), formatTime(dir.LastUsed), strings.Join(apps, ", "))
+	}
+
+	fmt.Fprintf(w, "\n%d directories, %s\n", len(dirs), formatBytes(uint64(total)))
+
+	quota, err := cacheQuota(cfg)
+	if err != nil {
+		return err
+	}
+
+	if quota > 0 {
+		fmt.Fprintf(w, "Cache quota %s\n", formatBytes(uint64(quota)))
+	}
+
+	return nil
+}
+
+// cacheInfo writes the cache directory of the app, the apps sharing it, its resources and state
+func cacheInfo(cfg *Config, name string, w io.Writer) error {
+	address := cfg.App(name).URL
+
+	appPath, err := appCachePath(address)
+	if err != nil {
+		return err
+	}
+
+	if !common.FileExists(appPath) {
+		return fmt.Errorf("%s is not cached", name)
+	}
+
+	index, err := readCacheIndex()
+	if err != nil {
+		return err
+	}
+
+	size, files, _ := indexedSize(index, filepath.Base(appPath))
+
+	fmt.Fprintf(w, "App         %s\n", appLabel(cfg, address))
+	fmt.Fprintf(w, "Directory   %s\n", appPath)
+	fmt.Fprintf(w, "Size        %s in %d resources\n", formatBytes(uint64(size)), files)
+
+	for _, other := range cacheDirApps(cfg, index)[filepath.Base(appPath)] {
+		if other != address {
+			fmt.Fprintf(w, "Shared with %s\n", appLabel(cfg, other))
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(appPath, "replay.zip")); err == nil {
+		fmt.Fprintf(w, "Last launch %s\n", info.ModTime().Format(time.DateTime))
+	}
+
+	if path, err := pinStatePath(address); err == nil && common.FileExists(path) {
+		fmt.Fprintf(w, "Pinned      yes\n")
+	}
+
+	pids, err := runningInstances(address)
+	if err != nil {
+		return err
+	}
+
+	if len(pids) > 0 {
+		fmt.Fprintf(w, "Running     PID %v\n", pids)
+	}
+
+	var keys []string
+	for key, entry := range index.Entries {
+		if slices.Contains(entry.References, address) {
+			keys = append(keys, key)
+		}
+	}
+
+	slices.Sort(keys)
+
+	fmt.Fprintf(w, "\n%d resources\n\n", len(keys))
+
+	for _, key := range keys {
+		entry := index.Entries[key]
+
+		fmt.Fprintf(w, "%10s %-19s %s\n", formatBytes(uint64(entry.Size)), formatTime(entry.LastUsed), key)
+	}
+
+	return nil
+}
+
+// cleanCacheDir removes the content of the app directory except the user data and lock files, together with the cache
+// index entries of the directory. The freed disk space is the one of the removed entries. The apps of the directory
+// must not be running.
+func cleanCacheDir(appPath string) (int64, error) {
+	pids, err := livingInstances(filepath.Join(appPath, "instances"))
+	if err != nil {
+		return 0, err
+	}
+
+	if len(pids) > 0 {
+		return 0, fmt.Errorf("%s is in use by the running app instances with PID %v", appPath, pids)
+	}
+
+	entries, err := os.ReadDir(appPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed []string
+
+	for _, entry := range entries {
+		if slices.Contains(keptCacheFiles, entry.Name()) || strings.HasSuffix(entry.Name(), lockSuffix) {
+			continue
+		}
+
+		filename := filepath.Join(appPath, entry.Name())
+
+		err = storage.RemoveAll(filename)
+		if err != nil {
+			break
+		}
+
+		removed = append(removed, filename)
+	}
+
+	var freed int64
+
+	// the validators of the removed files must not be reused
+	indexErr := updateCacheIndex(func(index *CacheIndex) error {
+		for key, entry := range index.Entries {
+			filename := filepath.Join(*cache, filepath.FromSlash(key))
+
+			if slices.ContainsFunc(removed, func(dir string) bool {
+				return filename == dir || strings.HasPrefix(filename, dir+string(filepath.Separator))
+			}) {
+				freed += entry.Size + entry.Extracted
+
+				delete(index.Entries, key)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return freed, err
+	}
+
+	return freed, indexErr
+}
+
+// cleanCache removes the cached resources and launch state of the app, the user data is kept
+func cleanCache(cfg *Config, name string, w io.Writer) error {
+	address := cfg.App(name).URL
+
+	appPath, err := appCachePath(address)
+	if err != nil {
+		return err
+	}
+
+	if !common.FileExists(appPath) {
+		return fmt.Errorf("%s is not cached", name)
+	}
+
+	index, err := readCacheIndex()
+	if err != nil {
+		return err
+	}
+
+	freed, err := cleanCacheDir(appPath)
+	if err != nil {
+		return err
+	}
+
+	// the natives of the app are freed if no other app links them
+	released, err := gcNativeStore()
+	if err != nil {
+		return err
+	}
+
+	freed += released
+
+	fmt.Fprintf(w, "Cleaned %s, %s freed\n", appPath, formatBytes(uint64(freed)))
+
+	// the apps of the same host share their cache directory
+	for _, other := range cacheDirApps(cfg, index)[filepath.Base(appPath)] {
+		if other != address {
+			fmt.Fprintf(w, "Cleaned as well %s, it shares the directory\n", appLabel(cfg, other))
+		}
+	}
+
+	return nil
+}
+
+// purgeCache removes all cached resources, the shared directories and the cache index. The config files, the key of
+// the cache encryption and the user data of the apps are kept.
+func purgeCache(w io.Writer) error {
+	entries, err := os.ReadDir(*cache)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	// nothing is removed while an app is running
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		pids, err := livingInstances(filepath.Join(*cache, entry.Name(), "instances"))
+		if err != nil {
+			return err
+		}
+
+		if len(pids) > 0 {
+			return fmt.Errorf("the cache is in use by the running app instances with PID %v", pids)
+		}
+	}
+
+	var freed int64
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		filename := filepath.Join(*cache, entry.Name())
+
+		if slices.Contains(sharedCacheDirs, entry.Name()) {
+			size, _, _, err := scanCacheDir(filename)
+			if err != nil {
+				return err
+			}
+
+			err = storage.RemoveAll(filename)
+			if err != nil {
+				return err
+			}
+
+			freed += size
+
+			continue
+		}
+
+		size, err := cleanCacheDir(filename)
+		freed += size
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, filename := range []string{cacheIndexPath(), cacheIndexBackup()} {
+		err = os.Remove(longPath(filename))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	fmt.Fprintf(w, "Purged %s, %s freed\n", *cache, formatBytes(uint64(freed)))
+
+	return nil
+}
+
+// runCache executes the cache subcommands
+func runCache(cfg *Config, args []string, w io.Writer) error {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		return listCache(cfg, w)
+	case len(args) == 2 && args[0] == "info":
+		return cacheInfo(cfg, args[1], w)
+	case len(args) == 2 && args[0] == "clean":
+		return cleanCache(cfg, args[1], w)
+	case len(args) == 1 && args[0] == "purge":
+		return purgeCache(w)
+	case len(args) == 2 && args[0] == "invalidate":
+		if *pattern == "" {
+			return fmt.Errorf("usage: espresso cache invalidate <alias> -pattern <glob>")
+		}
+
+		removed, err := invalidateResources(cfg.App(args[1]).URL, *pattern)
+
+		for _, filename := range removed {
+			fmt.Fprintf(w, "Invalidated %s\n", filename)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(removed) == 0 {
+			common.Warn(fmt.Sprintf("No cached resource of %s matches %q", args[1], *pattern))
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("usage: espresso cache list|info <alias>|clean <alias>|purge|invalidate <alias> -pattern <glob>")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+	"net"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// sanitizeName replaces all characters which are not safe in file names
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("._-", r) {
+			return r
+		}
+
+		return '_'
+	}, name)
+}
+
+// normalizeHost returns the host in its ASCII form in lower case, so an IDN host given in unicode, in punycode or
+// percent-encoded is always the same host. Hosts which are no valid IDN are returned in NFC and lower case.
+func normalizeHost(host string) string {
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname, port = host, ""
+	}
+
+	// percent-encoded hosts of URLs which were not parsed
+	if unescaped, err := url.PathUnescape(hostname); err == nil {
+		hostname = unescaped
+	}
+
+	hostname = norm.NFC.String(hostname)
+
+	if ascii, err := idna.Lookup.ToASCII(hostname); err == nil {
+		hostname = ascii
+	}
+
+	hostname = strings.ToLower(hostname)
+
+	if port != "" {
+		return net.JoinHostPort(hostname, port)
+	}
+
+	return hostname
+}
+
+// hostDirName returns the name of the cache directory of the host, IDN hosts are named by their punycode form
+func hostDirName(host string) string {
+	return common.Trim4Path(normalizeHost(host))
+}
+
+// displayHost returns the unicode form of a punycode host for the output
+func displayHost(host string) string {
+	if unicode, err := idna.Display.ToUnicode(host); err == nil {
+		return unicode
+	}
+
+	return host
+}
+
+// normalizePath returns the path in NFC, so the names composed on one platform and decomposed on another (like HFS+
+// on macOS) are the same name
+func normalizePath(p string) string {
+	return norm.NFC.String(p)
+}
+
+// normalizeQuery returns the query with its non-ASCII characters in NFC and percent-encoded, so a query given with
+// unicode characters or percent-encoded is the same query. The ASCII characters and their escapes are kept as they are.
+func normalizeQuery(query string) string {
+	sb := strings.Builder{}
+
+	var run []byte
+
+	flush := func() {
+		for _, b := range []byte(norm.NFC.String(string(run))) {
+			if b >= utf8.RuneSelf {
+				fmt.Fprintf(&sb, "%%%02X", b)
+			} else {
+				sb.WriteByte(b)
+			}
+		}
+
+		run = run[:0]
+	}
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		// letters are part of the run, since combining characters are composed with them
+		if c >= utf8.RuneSelf || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			run = append(run, c)
+
+			continue
+		}
+
+		if c == '%' && i+2 < len(query) {
+			if b, err := strconv.ParseUint(query[i+1:i+3], 16, 8); err == nil && b >= utf8.RuneSelf {
+				run = append(run, byte(b))
+				i += 2
+
+				continue
+			}
+		}
+
+		flush()
+		sb.WriteByte(c)
+	}
+
+	flush()
+
+	return sb.String()
+}
+
+// hrefPath returns the relative cache path of a resource href. The cache is keyed by the original href and
+// never by a redirected final URL or a Content-Disposition name, so cache entries stay stable across CDNs.
+func hrefPath(href string) string {
+	// the tokens of signed URLs change with every JNLP file
+	href = stripTokens(href)
+
+	u, err := url.Parse(href)
+	if err != nil {
+		return filepath.FromSlash(path.Clean("/" + href))[1:]
+	}
+
+	name := normalizePath(u.Path)
+
+	// absolute hrefs are kept apart by their host
+	if u.Host != "" {
+		name = sanitizeName(normalizeHost(u.Host)) + "/" + name
+	}
+
+	// hrefs which differ only by their query like download.jsp?file=a.jar are different resources
+	if u.RawQuery != "" {
+		name += "_" + sanitizeName(normalizeQuery(u.RawQuery))
+	}
+
+	return filepath.FromSlash(strings.TrimPrefix(path.Clean("/"+name), "/"))
+}
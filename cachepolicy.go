@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+)
+
+// cachePolicyEnv is the environment variable which pins the cache path
+const cachePolicyEnv = "ESPRESSO_CACHE"
+
+// cachePinned reports if the cache path is pinned by a policy
+var cachePinned bool
+
+// cachePolicy returns the cache path pinned by the machine policy and its source, empty if there is none.
+// The OS policy (Windows GPO registry key, /etc/espresso/policy.json) takes precedence over the environment.
+func cachePolicy() (string, string, error) {
+	path, source, err := osCachePolicy()
+	if err != nil {
+		return "", "", err
+	}
+
+	if path == "" {
+		path = os.Getenv(cachePolicyEnv)
+		source = cachePolicyEnv
+	}
+
+	if path == "" {
+		return "", "", nil
+	}
+
+	return os.ExpandEnv(path), source, nil
+}
+
+// applyCachePolicy replaces the cache path by the one pinned by the policy, a -cache parameter cannot override it
+func applyCachePolicy() error {
+	path, source, err := cachePolicy()
+	if err != nil || path == "" {
+		return err
+	}
+
+	if isFlagSet("cache") && *cache != path {
+		common.Warn(fmt.Sprintf("The cache path is pinned to %s by %s, -cache %s is ignored", path, source, *cache))
+	}
+
+	*cache = path
+	cachePinned = true
+
+	return nil
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// cachePolicyFile is the machine policy file of espresso
+const cachePolicyFile = "/etc/espresso/policy.json"
+
+// CachePolicy is the content of the machine policy file
+type CachePolicy struct {
+	Cache string `json:"cache"`
+}
+
+// osCachePolicy returns the cache path of the machine policy file
+func osCachePolicy() (string, string, error) {
+	ba, err := os.ReadFile(cachePolicyFile)
+	if os.IsNotExist(err) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	policy := CachePolicy{}
+
+	err = json.Unmarshal(ba, &policy)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid policy file %s: %w", cachePolicyFile, err)
+	}
+
+	return policy.Cache, cachePolicyFile, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+// cachePolicyKey is the registry key of the espresso group policy
+const cachePolicyKey = `SOFTWARE\Policies\espresso`
+
+// osCachePolicy returns the cache path of the group policy, machine settings take precedence over user settings
+func osCachePolicy() (string, string, error) {
+	for _, root := range []struct {
+		key  registry.Key
+		name string
+	}{
+		{registry.LOCAL_MACHINE, `HKLM\`},
+		{registry.CURRENT_USER, `HKCU\`},
+	} {
+		key, err := registry.OpenKey(root.key, cachePolicyKey, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+
+		path, _, err := key.GetStringValue("Cache")
+
+		_ = key.Close()
+
+		if err == nil && path != "" {
+			return path, root.name + cachePolicyKey, nil
+		}
+	}
+
+	return "", "", nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mpetavy/common"
+	"net/url"
+)
+
+// canonicalJnlp re-fetches the JNLP file from the location of its href attribute like Java Web Start did. The
+// canonical JNLP file is used for the launch, if it cannot be loaded the initially loaded one is used.
+func (l *Launch) canonicalJnlp(location string, content []byte) (string, []byte) {
+	jnlp, err := parseJnlp(content)
+	if err != nil || jnlp.Href == "" {
+		return location, content
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return location, content
+	}
+
+	canonical, err := resolveHref(u, jnlpCodebase(jnlp, location), jnlp.Href)
+	if err != nil {
+		common.Warn(fmt.Sprintf("Invalid href %q of the JNLP file %s: %v", jnlp.Href, location, err))
+
+		return location, content
+	}
+
+	if canonical.String() == location {
+		return location, content
+	}
+
+	canonicalContent, err := l.fetchJnlp(canonical.String())
+	if err != nil {
+		common.Warn(fmt.Sprintf("The canonical JNLP file %s cannot be loaded, %s is used: %v", canonical, location, err))
+
+		return location, content
+	}
+
+	if !bytes.Equal(canonicalContent, content) {
+		common.Info(fmt.Sprintf("The canonical JNLP file %s differs from %s and is used", canonical, location))
+	}
+
+	l.logf("Canonical JNLP file %s is used", canonical)
+
+	return canonical.String(), canonicalContent
+}
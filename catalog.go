@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// CatalogApp is an app of the catalog of the IT department
+type CatalogApp struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	URL         string   `json:"url"`
+	Icon        string   `json:"icon"`
+	Categories  []string `json:"categories"`
+}
+
+// Catalog is the JSON index of the JNLP apps offered by a server
+type Catalog struct {
+	Apps []CatalogApp `json:"apps"`
+}
+
+// fetchCatalog loads the catalog, relative URLs of the apps and icons are resolved against the catalog URL
+func fetchCatalog(address string) (*Catalog, error) {
+	if address == "" {
+		return nil, fmt.Errorf("no catalog defined, use -catalog <url> or \"catalog\" of the config")
+	}
+
+	base, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := httpRequest(http.MethodGet, address)
+	if err != nil {
+		return nil, explainTLSError(err)
+	}
+
+	// care about the final close of the response body
+	defer func() {
+		common.Error(response.Body.Close())
+	}()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, &StatusError{URL: address, StatusCode: response.StatusCode, Status: response.Status}
+	}
+
+	catalog := &Catalog{}
+
+	err = json.NewDecoder(response.Body).Decode(catalog)
+	if err != nil {
+		return nil, fmt.Errorf("invalid catalog %s: %w", address, err)
+	}
+
+	for i := range catalog.Apps {
+		for _, href := range []*string{&catalog.Apps[i].URL, &catalog.Apps[i].Icon} {
+			if *href == "" {
+				continue
+			}
+
+			u, err := base.Parse(*href)
+			if err != nil {
+				return nil, fmt.Errorf("invalid URL %q of the catalog app %s: %w", *href, catalog.Apps[i].ID, err)
+			}
+
+			*href = u.String()
+		}
+	}
+
+	return catalog, nil
+}
+
+// matches reports if the id, title, description or a category of the app contains the text
+func (app *CatalogApp) matches(text string) bool {
+	text = strings.ToLower(text)
+
+	return slices.ContainsFunc(append([]string{app.ID, app.Title, app.Description}, app.Categories...), func(s string) bool {
+		return strings.Contains(strings.ToLower(s), text)
+	})
+}
+
+// printCatalogApps prints the apps of the catalog as a table
+func printCatalogApps(w io.Writer, apps []CatalogApp) {
+	for _, app := range apps {
+		fmt.Fprintf(w, "%-20s %-40s %s\n", app.ID, app.Title, strings.Join(app.Categories, ", "))
+	}
+}
+
+// registerApp adds the app with its alias to the local config file or updates its URL, all other settings of the
+// config file are kept as they are
+func registerApp(alias string, address string) error {
+	local := make(map[string]any)
+
+	filename := configPath()
+
+	if common.FileExists(filename) {
+		ba, err := storage.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		err = json.Unmarshal(ba, &local)
+		if err != nil {
+			return fmt.Errorf("invalid config file %s: %w", filename, err)
+		}
+	}
+
+	apps, _ := local["apps"].([]any)
+
+	registered := false
+
+	for _, app := range apps {
+		if settings, ok := app.(map[string]any); ok && settings["alias"] == alias {
+			settings["url"] = address
+			registered = true
+		}
+	}
+
+	if !registered {
+		apps = append(apps, map[string]any{"alias": alias, "url": address})
+	}
+
+	local["apps"] = apps
+
+	ba, err := json.MarshalIndent(local, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return storage.WriteFile(filename, ba)
+}
+
+// runCatalog lists, searches or installs the apps of the catalog
+func runCatalog(cfg *Config, args []string, w io.Writer) error {
+	usage := fmt.Errorf("usage: espresso catalog list|search <text>|install <id>")
+
+	if len(args) == 0 {
+		return usage
+	}
+
+	address := cfg.Catalog
+	if *catalogURL != "" {
+		address = *catalogURL
+	}
+
+	catalog, err := fetchCatalog(address)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		printCatalogApps(w, catalog.Apps)
+
+		return nil
+	case args[0] == "search" && len(args) == 2:
+		var found []CatalogApp
+
+		for _, app := range catalog.Apps {
+			if app.matches(args[1]) {
+				found = append(found, app)
+			}
+		}
+
+		printCatalogApps(w, found)
+
+		return nil
+	case args[0] == "install" && len(args) == 2:
+		i := slices.IndexFunc(catalog.Apps, func(app CatalogApp) bool {
+			return app.ID == args[1]
+		})
+
+		if i == -1 {
+			return fmt.Errorf("the catalog %s has no app %q", address, args[1])
+		}
+
+		app := catalog.Apps[i]
+
+		if app.URL == "" {
+			return fmt.Errorf("the catalog app %s has no url", app.ID)
+		}
+
+		err := registerApp(app.ID, app.URL)
+		if err != nil {
+			return err
+		}
+
+		title := app.Title
+		if title == "" {
+			title = app.ID
+		}
+
+		fmt.Fprintf(w, "%s is installed, launch it with \"espresso run %s\"\n", title, app.ID)
+
+		return nil
+	default:
+		return usage
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// hash algorithms of the checksums, recognized by the length of the hex encoded hash
+const (
+	checksumSHA256 = "SHA-256"
+	checksumSHA1   = "SHA-1"
+)
+
+// sidecarSuffix is appended to the path of the resource URL for its checksum file
+const sidecarSuffix = ".sha256"
+
+// ChecksumsConfig defines further sources of the checksums of resources beside the sha256 and sha1 attributes of the
+// JNLP file
+type ChecksumsConfig struct {
+	// Sidecar fetches the SHA-256 of a downloaded resource from "<url>.sha256"
+	Sidecar bool `json:"sidecar"`
+	// Manifest is a local file in the format of sha256sum or sha1sum, the names are the hrefs or file names
+	Manifest string `json:"manifest"`
+}
+
+// Checksum is the expected hash of a resource with its source
+type Checksum struct {
+	Algorithm string
+	Hash      string
+	Source    string
+}
+
+// newChecksum returns the checksum of the hex encoded hash, the algorithm is recognized by its length
+func newChecksum(hash string, source string) (*Checksum, error) {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+
+	_, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checksum %q of %s", hash, source)
+	}
+
+	switch len(hash) {
+	case 64:
+		return &Checksum{Algorithm: checksumSHA256, Hash: hash, Source: source}, nil
+	case 40:
+		return &Checksum{Algorithm: checksumSHA1, Hash: hash, Source: source}, nil
+	default:
+		return nil, fmt.Errorf("invalid checksum %q of %s, neither SHA-256 nor SHA-1", hash, source)
+	}
+}
+
+// declaredChecksum returns the checksum of the sha256 or sha1 attribute of a JNLP element
+func declaredChecksum(sha256 string, sha1 string) string {
+	if sha256 != "" {
+		return sha256
+	}
+
+	return sha1
+}
+
+// readChecksumManifest reads the checksums of a manifest in the format of sha256sum or sha1sum, keyed by name
+func readChecksumManifest(filename string) (map[string]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// care about closing the manifest
+	defer func() {
+		common.Error(f.Close())
+	}()
+
+	checksums := make(map[string]string)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, name, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid line %q of the checksum manifest %s", line, filename)
+		}
+
+		// the binary mode of sha256sum marks the name with "*"
+		checksums[strings.TrimPrefix(strings.TrimSpace(name), "*")] = hash
+	}
+
+	return checksums, scanner.Err()
+}
+
+// fetchSidecarChecksum fetches the SHA-256 of the resource from its sidecar file, resources without one have none
+func fetchSidecarChecksum(href string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+
+	u.Path += sidecarSuffix
+	u.RawPath = ""
+
+	response, err := httpRequest(http.MethodGet, u.String())
+	if err != nil {
+		return "", err
+	}
+
+	// care about closing the response body
+	defer func() {
+		common.Error(response.Body.Close())
+	}()
+
+	if response.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return "", &StatusError{URL: stripTokens(u.String()), StatusCode: response.StatusCode, Status: response.Status}
+	}
+
+	ba, err := io.ReadAll(io.LimitReader(response.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+
+	// the format of sha256sum or the plain hash
+	fields := strings.Fields(string(ba))
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	return fields[0], nil
+}
+
+// expectedChecksum returns the checksum of the resource by the JNLP file, the checksum manifest or the sidecar file,
+// nil if there is none. The sidecar file is only fetched for downloaded resources.
+func (l *Launch) expectedChecksum(task Task, downloaded bool) (*Checksum, error) {
+	if task.Checksum != "" {
+		return newChecksum(task.Checksum, "the JNLP file")
+	}
+
+	settings := l.Config.Checksums
+
+	if settings.Manifest != "" {
+		l.mu.Lock()
+		if l.checksumManifest == nil {
+			l.checksumManifest, l.checksumManifestErr = readChecksumManifest(settings.Manifest)
+		}
+		manifest, err := l.checksumManifest, l.checksumManifestErr
+		l.mu.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+
+		u, err := url.Parse(task.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range []string{stripTokens(task.Href), path.Base(u.Path)} {
+			if hash, ok := manifest[name]; ok && name != "" {
+				return newChecksum(hash, "the checksum manifest "+settings.Manifest)
+			}
+		}
+	}
+
+	if settings.Sidecar && downloaded {
+		hash, err := fetchSidecarChecksum(task.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		if hash != "" {
+			return newChecksum(hash, "the sidecar file")
+		}
+	}
+
+	return nil, nil
+}
+
+// actualChecksum returns the hash of the resource. The SHA-256 is the one of the cache index, which is computed while
+// the download is streamed, so also encrypted resources are checked. SHA-1 hashes are computed for downloaded resources
+// only, the empty string is returned for cached ones.
+func actualChecksum(filename string, algorithm string, downloaded bool) (string, error) {
+	if algorithm == checksumSHA256 {
+		entry, err := lookupCacheEntry(filename)
+		if err != nil {
+			return "", err
+		}
+
+		if entry != nil && entry.SHA256 != "" {
+			return entry.SHA256, nil
+		}
+
+		if isEncrypted(filename) {
+			return "", nil
+		}
+
+		return fileHash(filename)
+	}
+
+	if !downloaded {
+		return "", nil
+	}
+
+	// downloads of encrypted caches are written encrypted
+	if isEncrypted(filename) {
+		plain, err := readPlain(filename)
+		if err != nil {
+			return "", err
+		}
+
+		hash := sha1.Sum(plain)
+
+		return hex.EncodeToString(hash[:]), nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+
+	// care about closing the file
+	defer func() {
+		common.Error(f.Close())
+	}()
+
+	hash := sha1.New()
+
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifyChecksum checks the resource against its checksum, a corrupted resource is downloaded again once before the
+// launch fails
+func (l *Launch) verifyChecksum(ctx context.Context, task Task, start time.Time) error {
+	downloaded := downloadedSize(task.Path, start) > 0
+
+	for attempt := 1; ; attempt++ {
+		expected, err := l.expectedChecksum(task, downloaded)
+		if err != nil || expected == nil {
+			return err
+		}
+
+		actual, err := actualChecksum(task.Path, expected.Algorithm, downloaded)
+		if err != nil || actual == "" {
+			return err
+		}
+
+		if actual == expected.Hash {
+			l.logf("Checksum: %s matches the %s of %s", stripTokens(task.URL), expected.Algorithm, expected.Source)
+
+			return nil
+		}
+
+		message := fmt.Sprintf("%s has the %s %s, but %s declares %s", stripTokens(task.URL), expected.Algorithm, actual, expected.Source, expected.Hash)
+
+		if attempt > 1 {
+			logEvent(eventSecurityRejection, message)
+
+			return fmt.Errorf("corrupted download: %s", message)
+		}
+
+		common.Warn(fmt.Sprintf("Corrupted download, downloaded again: %s", message))
+		l.logf("Checksum: %s, downloaded again", message)
+
+		err = os.Remove(task.Path)
+		if err != nil {
+			return err
+		}
+
+		start = time.Now()
+
+		err = l.downloadRefreshing(ctx, task)
+		if err != nil {
+			return err
+		}
+
+		downloaded = true
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// precedence of conflicting versions of a library on the classpath
+const (
+	// precedenceFirst keeps the version which comes first on the classpath
+	precedenceFirst = "first"
+	// precedenceHighest keeps the highest version
+	precedenceHighest = "highest"
+	// precedenceApp keeps the version of the app JNLP before the ones of its extensions, otherwise the first one
+	precedenceApp = "app"
+)
+
+// handling of conflicting versions of a library on the classpath
+const (
+	conflictsWarn   = "warn"
+	conflictsStrict = "strict"
+)
+
+// ClasspathConfig defines the handling of libraries which are contributed several times to the classpath
+type ClasspathConfig struct {
+	// Precedence decides which version of a library with conflicting versions stays on the classpath: "first",
+	// "highest" or "app". By default all versions stay on the classpath like Java Web Start did.
+	Precedence string `json:"precedence"`
+	// Conflicts is "warn" (default) or "strict", which refuses the launch of an app with conflicting versions
+	Conflicts string `json:"conflicts"`
+}
+
+// classpathEntry is a jar of the classpath with the library it contains
+type classpathEntry struct {
+	index   int
+	jar     string
+	origin  string
+	library Library
+}
+
+// libraryKey identifies the library of the jar regardless of its version, jars identified by their file name have no
+// group, so only the artifact is used
+func libraryKey(library Library) string {
+	return library.Artifact
+}
+
+// winner returns the entry which stays on the classpath due to the precedence
+func winner(entries []classpathEntry, precedence string, app string) classpathEntry {
+	best := entries[0]
+
+	for _, entry := range entries[1:] {
+		switch precedence {
+		case precedenceHighest:
+			if compareLibraryVersions(entry.library.Version, best.library.Version) > 0 {
+				best = entry
+			}
+		case precedenceApp:
+			if entry.origin == app && best.origin != app {
+				best = entry
+			}
+		}
+	}
+
+	return best
+}
+
+// describeEntries lists the jars of the library with their versions and the JNLP files which contribute them
+func describeEntries(entries []classpathEntry) string {
+	var s []string
+
+	for _, entry := range entries {
+		s = append(s, fmt.Sprintf("%s %s of %s", filepath.Base(entry.jar), entry.library.Version, entry.origin))
+	}
+
+	return strings.Join(s, ", ")
+}
+
+// jarClasses returns the class files of the jar, without the module descriptor and the versions of multi-release jars
+func jarClasses(jar string) ([]string, error) {
+	r, err := zip.OpenReader(jar)
+	if err != nil {
+		return nil, err
+	}
+
+	// care about closing the jar
+	defer func() {
+		common.Error(r.Close())
+	}()
+
+	var classes []string
+
+	for _, f := range r.File {
+		if !strings.HasSuffix(f.Name, ".class") || strings.HasPrefix(f.Name, "META-INF/") || strings.HasSuffix(f.Name, "module-info.class") {
+			continue
+		}
+
+		classes = append(classes, f.Name)
+	}
+
+	return classes, nil
+}
+
+// checkClasspath removes duplicate jars from the classpath and detects conflicting versions of libraries contributed
+// by the app and its extensions. The conflicts are reported, resolved by the classpath precedence of the app config or
+// refused. Classes contained in several jars of different libraries are reported as well.
+func (l *Launch) checkClasspath() error {
+	settings := l.App.Classpath
+
+	switch settings.Precedence {
+	case "", precedenceFirst, precedenceHighest, precedenceApp:
+	default:
+		return fmt.Errorf("invalid classpath precedence %q, use %s, %s or %s", settings.Precedence, precedenceFirst, precedenceHighest, precedenceApp)
+	}
+
+	switch settings.Conflicts {
+	case "", conflictsWarn, conflictsStrict:
+	default:
+		return fmt.Errorf("invalid classpath conflicts %q, use %s or %s", settings.Conflicts, conflictsWarn, conflictsStrict)
+	}
+
+	// the removed jars with the jar which replaces them
+	removed := make(map[int]int)
+
+	// the same jar contributed by several extensions
+	seen := make(map[string]int)
+	sizes := make(map[int64][]int)
+
+	for i, jar := range l.jars {
+		if first, ok := seen[jar]; ok {
+			l.logf("Classpath: %s of %s is already contributed by %s", filepath.Base(jar), l.jarOrigins[i], l.jarOrigins[first])
+
+			removed[i] = first
+
+			continue
+		}
+
+		seen[jar] = i
+
+		info, err := os.Stat(jar)
+		if err != nil {
+			return err
+		}
+
+		sizes[info.Size()] = append(sizes[info.Size()], i)
+	}
+
+	// the same content by another name or URL, only jars of the same size are hashed
+	for _, indices := range sizes {
+		if len(indices) < 2 {
+			continue
+		}
+
+		hashes := make(map[string]int)
+
+		for _, i := range indices {
+			sum, err := fileHash(l.jars[i])
+			if err != nil {
+				return err
+			}
+
+			if first, ok := hashes[sum]; ok {
+				l.logf("Classpath: %s of %s is identical to %s of %s and removed", filepath.Base(l.jars[i]), l.jarOrigins[i], filepath.Base(l.jars[first]), l.jarOrigins[first])
+
+				removed[i] = first
+
+				continue
+			}
+
+			hashes[sum] = i
+		}
+	}
+
+	// the versions of each library, shaded jars with several libraries are left alone
+	libraries := make(map[string][]classpathEntry)
+	owners := make(map[int]string)
+
+	var keys []string
+
+	for i, jar := range l.jars {
+		if _, ok := removed[i]; ok {
+			continue
+		}
+
+		found, err := jarLibraries(jar)
+		if err != nil {
+			common.Warn(fmt.Sprintf("Cannot identify the library of %s: %v", jar, err))
+
+			continue
+		}
+
+		if len(found) != 1 {
+			continue
+		}
+
+		key := libraryKey(found[0])
+		owners[i] = key
+
+		if _, ok := libraries[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		libraries[key] = append(libraries[key], classpathEntry{index: i, jar: jar, origin: l.jarOrigins[i], library: found[0]})
+	}
+
+	conflicts := 0
+
+	for _, key := range keys {
+		entries := libraries[key]
+		if len(entries) < 2 {
+			continue
+		}
+
+		conflicting := slices.ContainsFunc(entries[1:], func(entry classpathEntry) bool {
+			return compareLibraryVersions(entry.library.Version, entries[0].library.Version) != 0
+		})
+
+		if !conflicting {
+			// the same version by different names, the first one stays
+			l.logf("Classpath: %s is contributed several times (%s), only the first one stays", key, describeEntries(entries))
+
+			for _, entry := range entries[1:] {
+				removed[entry.index] = entries[0].index
+			}
+
+			continue
+		}
+
+		conflicts++
+
+		message := fmt.Sprintf("Classpath: conflicting versions of %s: %s", key, describeEntries(entries))
+
+		if settings.Precedence == "" {
+			common.Warn(message + ". The classes of the first one win, which may cause NoSuchMethodError or NoClassDefFoundError. Define the \"classpath\" \"precedence\" of the app config to keep a single version")
+			l.logf("%s", message)
+
+			continue
+		}
+
+		keep := winner(entries, settings.Precedence, l.Address)
+
+		common.Warn(fmt.Sprintf("%s. Due to the precedence %q %s %s stays on the classpath", message, settings.Precedence, filepath.Base(keep.jar), keep.library.Version))
+		l.logf("%s, %s %s stays", message, filepath.Base(keep.jar), keep.library.Version)
+
+		for _, entry := range entries {
+			if entry.index != keep.index {
+				removed[entry.index] = keep.index
+			}
+		}
+	}
+
+	if conflicts > 0 && settings.Conflicts == conflictsStrict {
+		return fmt.Errorf("%s has %d libraries with conflicting versions on its classpath, the launch is refused", l.Address, conflicts)
+	}
+
+	// classes of different libraries with the same names, e.g. repackaged or shaded libraries
+	// the versions of a library are already reported
+	locations := make(map[string]int)
+	shared := make(map[[2]int][]string)
+
+	var pairs [][2]int
+
+	for i, jar := range l.jars {
+		if _, ok := removed[i]; ok {
+			continue
+		}
+
+		classes, err := jarClasses(jar)
+		if err != nil {
+			return err
+		}
+
+		for _, class := range classes {
+			owner, ok := locations[class]
+			if !ok {
+				locations[class] = i
+
+				continue
+			}
+
+			if key, ok := owners[i]; ok && owners[owner] == key {
+				continue
+			}
+
+			pair := [2]int{owner, i}
+
+			if _, ok := shared[pair]; !ok {
+				pairs = append(pairs, pair)
+			}
+
+			shared[pair] = append(shared[pair], class)
+		}
+	}
+
+	for _, pair := range pairs {
+		classes := shared[pair]
+
+		common.Warn(fmt.Sprintf("Classpath: %s and %s contain %d classes with the same names like %s, the ones of %s win", filepath.Base(l.jars[pair[0]]), filepath.Base(l.jars[pair[1]]), len(classes), strings.TrimSuffix(classes[0], ".class"), filepath.Base(l.jars[pair[0]])))
+	}
+
+	if len(removed) == 0 {
+		return nil
+	}
+
+	var jars, origins []string
+
+	for i, jar := range l.jars {
+		if _, ok := removed[i]; !ok {
+			jars = append(jars, jar)
+			origins = append(origins, l.jarOrigins[i])
+		}
+	}
+
+	// the main jar is replaced by the jar which stays, duplicates are replaced by duplicates first
+	if i := slices.Index(l.jars, l.mainJar); i != -1 {
+		for {
+			kept, ok := removed[i]
+			if !ok {
+				break
+			}
+
+			i = kept
+		}
+
+		l.mainJar = l.jars[i]
+	}
+
+	l.logf("Classpath: %d of %d jars are removed", len(l.jars)-len(jars), len(l.jars))
+
+	l.jars = jars
+	l.jarOrigins = origins
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/mpetavy/common"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	clockSkew      time.Duration
+	clockSkewMutex sync.Mutex
+	clockSkewOnce  sync.Once
+)
+
+// checkClockSkew measures the difference between the local clock and the server clock by the HTTP Date header
+func checkClockSkew(response *http.Response) {
+	date, err := http.ParseTime(response.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+
+	diff := time.Now().Sub(date)
+
+	clockSkewMutex.Lock()
+	clockSkew = diff
+	clockSkewMutex.Unlock()
+
+	if diff.Abs() > *skew {
+		clockSkewOnce.Do(func() {
+			common.Warn(fmt.Sprintf("!!! The local clock differs by %v from the server clock %s. TLS and signature validation may fail, please check the system time !!!", diff.Round(time.Second), response.Request.URL.Host))
+		})
+	}
+}
+
+// measuredClockSkew returns the last measured difference between the local clock and the server clock
+func measuredClockSkew() time.Duration {
+	clockSkewMutex.Lock()
+	defer clockSkewMutex.Unlock()
+
+	return clockSkew
+}
+
+// validAt reports if the validity period contains the current time, tolerating the bounded clock skew
+func validAt(notBefore time.Time, notAfter time.Time) bool {
+	now := time.Now()
+
+	return !now.Before(notBefore.Add(-*skew)) && !now.After(notAfter.Add(*skew))
+}
+
+// explainTLSError enriches certificate validity errors with a hint about the local clock
+func explainTLSError(err error) error {
+	var certErr x509.CertificateInvalidError
+
+	if errors.As(err, &certErr) && certErr.Reason == x509.Expired {
+		return fmt.Errorf("%w: the certificate is not valid at the local time %s (measured clock skew %v), please check the system time", err, time.Now().Format(time.RFC3339), measuredClockSkew().Round(time.Second))
+	}
+
+	return err
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"path/filepath"
+	"slices"
+)
+
+// AppConfig defines the per-app settings
+type AppConfig struct {
+	Alias         string            `json:"alias"`
+	URL           string            `json:"url"`
+	Console       bool              `json:"console"`
+	Wait          bool              `json:"wait"`
+	Mounts        []Mount           `json:"mounts"`
+	PrivateJre    string            `json:"private-jre"`
+	JFR           JFR               `json:"jfr"`
+	MaxInstances  int               `json:"max-instances"`
+	JarLaunch     bool              `json:"jar-launch"`
+	Requires      []string          `json:"requires"`
+	Ready         Probe             `json:"ready"`
+	Rollback      Rollback          `json:"rollback"`
+	ResourceTypes map[string]string `json:"resource-types"`
+	PrefetchLazy  bool              `json:"prefetch-lazy"`
+	Graphics      Graphics          `json:"graphics"`
+	Trust         bool              `json:"trust"`
+	Fonts         FontsConfig       `json:"fonts"`
+	Classpath     ClasspathConfig   `json:"classpath"`
+	Watchdog      WatchdogConfig    `json:"watchdog"`
+}
+
+// Config defines the content of the espresso config file
+type Config struct {
+	Apps            []AppConfig       `json:"apps"`
+	EventSeverities map[string]string `json:"event-severities"`
+	Maven           MavenConfig       `json:"maven"`
+	Security        SecurityConfig    `json:"security"`
+	Ring            string            `json:"ring"`
+	Encryption      EncryptionConfig  `json:"encryption"`
+	Catalog         string            `json:"catalog"`
+	JavaFX          JavaFXConfig      `json:"javafx"`
+	SignedURLs      SignedURLsConfig  `json:"signed-urls"`
+	Checksums       ChecksumsConfig   `json:"checksums"`
+	CacheQuota      string            `json:"cache-quota"`
+	Jre             JreConfig         `json:"jre"`
+}
+
+// SecurityConfig defines the security policies
+type SecurityConfig struct {
+	// RequireHTTPS defines the handling of plain HTTP URLs: "true" refuses them, "upgrade" upgrades them to HTTPS, "allow" accepts them
+	RequireHTTPS string `json:"require-https"`
+	// Policies decide about launches by expressions, the first matching policy applies
+	Policies []Policy `json:"policies"`
+	// PolicyDefault is the action if no policy matches: "deny" (default) or "allow"
+	PolicyDefault string `json:"policy-default"`
+	// Executables defines the check of downloaded executables before they are run: "off", "warn" or "strict"
+	Executables string `json:"executables"`
+	// ExecutableAllowlist are the SHA-256 hashes of known executables
+	ExecutableAllowlist []string `json:"executable-allowlist"`
+	// ReputationURL is the URL of the reputation service, "{sha256}" is replaced by the hash of the executable
+	ReputationURL string `json:"reputation-url"`
+	// ReputationKey is sent as "x-apikey" header to the reputation service
+	ReputationKey string `json:"reputation-key"`
+	// JnlpChanges defines the handling of risky changes of JNLP files: "warn", "confirm" or "refuse"
+	JnlpChanges string `json:"jnlp-changes"`
+	// Vulnerabilities defines the check of the classpath against known vulnerable libraries: "off", "warn" or "strict"
+	Vulnerabilities string `json:"vulnerabilities"`
+	// AdvisoryDatabase is a file of OSV advisories which are checked in addition to the bundled ones
+	AdvisoryDatabase string `json:"advisory-database"`
+}
+
+// configPath returns the path of the espresso config file
+func configPath() string {
+	if *config != "" {
+		return *config
+	}
+
+	return filepath.Join(*cache, "espresso.json")
+}
+
+// loadConfig reads the espresso config file merged over the admin config, a missing file results in an empty config
+func loadConfig() (*Config, error) {
+	admin, err := loadAdminConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var local []byte
+
+	filename := configPath()
+
+	if common.FileExists(filename) {
+		local, err = storage.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mergeConfig(admin, local)
+}
+
+// applyConfig applies the process-wide settings of the config, the parameters take precedence over the config
+func applyConfig(cfg *Config) error {
+	policy := cfg.Security.RequireHTTPS
+	if *requireHTTPS != "" {
+		policy = *requireHTTPS
+	}
+
+	err := setHTTPSPolicy(policy)
+	if err != nil {
+		return err
+	}
+
+	// an invalid quota is reported before anything is downloaded
+	_, err = cacheQuota(cfg)
+	if err != nil {
+		return err
+	}
+
+	setEventSeverities(cfg.EventSeverities)
+	setTokenParams(cfg.SignedURLs.TokenParams)
+
+	return registerMavenCredentials(cfg.Maven)
+}
+
+// mergeConfig applies the local config on top of the admin config, settings missing locally are taken from the admin config
+func mergeConfig(admin []byte, local []byte) (*Config, error) {
+	cfg := &Config{}
+
+	if len(admin) > 0 {
+		err := json.Unmarshal(admin, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid admin config: %w", err)
+		}
+	}
+
+	if len(local) == 0 {
+		return cfg, nil
+	}
+
+	// the local config must not decode into the apps of the admin config, they are merged setting by setting below
+	apps := cfg.Apps
+	cfg.Apps = nil
+
+	err := json.Unmarshal(local, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", configPath(), err)
+	}
+
+	// the apps are merged setting by setting
+	var raw struct {
+		Apps []json.RawMessage `json:"apps"`
+	}
+
+	err = json.Unmarshal(local, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rawApp := range raw.Apps {
+		app := AppConfig{}
+
+		err := json.Unmarshal(rawApp, &app)
+		if err != nil {
+			return nil, err
+		}
+
+		i := slices.IndexFunc(apps, func(a AppConfig) bool {
+			return a.URL == app.URL
+		})
+
+		if i == -1 {
+			apps = append(apps, app)
+
+			continue
+		}
+
+		err = json.Unmarshal(rawApp, &apps[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.Apps = apps
+
+	return cfg, nil
+}
+
+// App returns the settings of the app with the given JNLP URL or alias, empty settings if there are none
+func (cfg *Config) App(address string) *AppConfig {
+	for i := range cfg.Apps {
+		if cfg.Apps[i].URL == address || (cfg.Apps[i].Alias != "" && cfg.Apps[i].Alias == address) {
+			return &cfg.Apps[i]
+		}
+	}
+
+	return &AppConfig{URL: address}
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// content of a config archive
+const (
+	configArchiveVersion   = 1
+	configArchiveManifest  = "manifest.json"
+	configArchiveSignature = "manifest.json.sig"
+	configArchiveConfig    = "espresso.json"
+	configArchivePrefs     = "prefs/"
+)
+
+// secretSettings are the settings of the config file which stay on the machine, given by their nested keys
+var secretSettings = [][]string{{"maven", "password"}, {"security", "reputation-key"}}
+
+// ConfigArchiveManifest lists the files of a config archive with their SHA-256 hashes, the manifest is signed
+type ConfigArchiveManifest struct {
+	Version  int               `json:"version"`
+	Created  time.Time         `json:"created"`
+	Hostname string            `json:"hostname"`
+	Files    map[string]string `json:"files"`
+}
+
+// loadSigningKey reads the ed25519 private key, either PEM encoded (PKCS #8, e.g. by "openssl genpkey -algorithm
+// ed25519") or the base64 encoded seed or private key
+func loadSigningKey(filename string) (ed25519.PrivateKey, error) {
+	if filename == "" {
+		return nil, fmt.Errorf("the config archive must be signed, use -sign-key <file>")
+	}
+
+	ba, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if block, _ := pem.Decode(ba); block != nil {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key %s: %w", filename, err)
+		}
+
+		privateKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("the signing key %s is not an ed25519 key", filename)
+		}
+
+		return privateKey, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(ba)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key %s: %w", filename, err)
+	}
+
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("the signing key %s is not an ed25519 key", filename)
+	}
+}
+
+// removeSetting removes the nested setting of the config and returns its value
+func removeSetting(settings map[string]any, keys []string) (any, bool) {
+	for _, key := range keys[:len(keys)-1] {
+		nested, ok := settings[key].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+
+		settings = nested
+	}
+
+	value, ok := settings[keys[len(keys)-1]]
+	delete(settings, keys[len(keys)-1])
+
+	return value, ok
+}
+
+// setSetting sets the nested setting of the config
+func setSetting(settings map[string]any, keys []string, value any) {
+	for _, key := range keys[:len(keys)-1] {
+		nested, ok := settings[key].(map[string]any)
+		if !ok {
+			nested = make(map[string]any)
+			settings[key] = nested
+		}
+
+		settings = nested
+	}
+
+	settings[keys[len(keys)-1]] = value
+}
+
+// readLocalConfig reads the local config file as generic JSON, which keeps settings unknown to this version
+func readLocalConfig() (map[string]any, error) {
+	local := make(map[string]any)
+
+	ba, err := storage.ReadFile(configPath())
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(ba, &local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", configPath(), err)
+	}
+
+	return local, nil
+}
+
+// runExportConfig exports the config file without its secrets and the user preferences of the apps into a signed
+// archive for the setup of further machines
+func runExportConfig(cfg *Config, filename string, w io.Writer) error {
+	key, err := loadSigningKey(*signKey)
+	if err != nil {
+		return err
+	}
+
+	local, err := readLocalConfig()
+	if err != nil {
+		return err
+	}
+
+	for _, keys := range secretSettings {
+		if _, ok := removeSetting(local, keys); ok {
+			fmt.Fprintf(w, "%s is a secret and not exported\n", strings.Join(keys, "."))
+		}
+	}
+
+	files := make(map[string][]byte)
+
+	files[configArchiveConfig], err = json.MarshalIndent(local, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	// the preferences of the apps, e.g. their JRE, are kept per server like in the cache
+	for _, app := range cfg.Apps {
+		path, err := prefsPath(app.URL)
+		if err != nil || !common.FileExists(path) {
+			continue
+		}
+
+		ba, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		files[configArchivePrefs+filepath.Base(filepath.Dir(path))+".json"] = ba
+	}
+
+	hostname, _ := os.Hostname()
+
+	manifest := ConfigArchiveManifest{
+		Version:  configArchiveVersion,
+		Created:  time.Now(),
+		Hostname: hostname,
+		Files:    make(map[string]string),
+	}
+
+	for name, content := range files {
+		manifest.Files[name] = sha256Hex(content)
+	}
+
+	files[configArchiveManifest], err = json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	files[configArchiveSignature] = []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, files[configArchiveManifest])))
+
+	buf := &bytes.Buffer{}
+
+	zw := zip.NewWriter(buf)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+
+		_, err = f.Write(files[name])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(filename, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Config with %d apps exported to %s\n", len(cfg.Apps), filename)
+
+	return nil
+}
+
+// readConfigArchive reads the files of the config archive and verifies them by the signed manifest
+func readConfigArchive(filename string) (map[string][]byte, error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// care about closing the archive
+	defer func() {
+		common.Error(r.Close())
+	}()
+
+	files := make(map[string][]byte)
+
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		ba, err := io.ReadAll(rc)
+
+		common.Error(rc.Close())
+
+		if err != nil {
+			return nil, err
+		}
+
+		files[f.Name] = ba
+	}
+
+	if *adminKey == "" {
+		return nil, fmt.Errorf("the config archive cannot be verified, use -admin-config-key")
+	}
+
+	key, err := adminPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(files[configArchiveSignature])))
+	if err != nil || !ed25519.Verify(key, files[configArchiveManifest], sig) {
+		logEvent(eventSecurityRejection, fmt.Sprintf("config archive %s rejected due to an invalid signature", filename))
+
+		return nil, fmt.Errorf("the signature of the config archive %s is invalid", filename)
+	}
+
+	manifest := &ConfigArchiveManifest{}
+
+	err = json.Unmarshal(files[configArchiveManifest], manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest.Version != configArchiveVersion {
+		return nil, fmt.Errorf("unsupported version %d of the config archive %s", manifest.Version, filename)
+	}
+
+	delete(files, configArchiveManifest)
+	delete(files, configArchiveSignature)
+
+	for name, content := range files {
+		if manifest.Files[name] != sha256Hex(content) {
+			return nil, fmt.Errorf("the file %s of the config archive %s is not covered by its signature", name, filename)
+		}
+	}
+
+	for name := range manifest.Files {
+		if _, ok := files[name]; !ok {
+			return nil, fmt.Errorf("the file %s of the config archive %s is missing", name, filename)
+		}
+	}
+
+	return files, nil
+}
+
+// runImportConfig imports the signed config archive, the secrets of an existing config file are kept
+func runImportConfig(filename string, w io.Writer) error {
+	files, err := readConfigArchive(filename)
+	if err != nil {
+		return err
+	}
+
+	imported := make(map[string]any)
+
+	err = json.Unmarshal(files[configArchiveConfig], &imported)
+	if err != nil {
+		return fmt.Errorf("invalid config of the config archive %s: %w", filename, err)
+	}
+
+	// refuse an archive whose config cannot be used
+	_, err = mergeConfig(nil, files[configArchiveConfig])
+	if err != nil {
+		return err
+	}
+
+	if common.FileExists(configPath()) {
+		local, err := readLocalConfig()
+		if err != nil {
+			return err
+		}
+
+		for _, keys := range secretSettings {
+			if value, ok := removeSetting(local, keys); ok {
+				setSetting(imported, keys, value)
+			}
+		}
+	}
+
+	ba, err := json.MarshalIndent(imported, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(configPath()), common.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(configPath(), ba)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Config imported to %s\n", configPath())
+
+	for name, content := range files {
+		host, ok := strings.CutPrefix(name, configArchivePrefs)
+		if !ok {
+			continue
+		}
+
+		host = strings.TrimSuffix(host, ".json")
+
+		// the name must not escape the cache
+		if host == "" || path.Base(host) != host || host == ".." || strings.ContainsAny(host, `\/`) {
+			return fmt.Errorf("invalid file %s of the config archive %s", name, filename)
+		}
+
+		err := importPrefs(filepath.Join(*cache, host, "prefs.json"), content)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "Preferences of the apps of %s imported\n", host)
+	}
+
+	return nil
+}
+
+// importPrefs replaces the user preferences of the apps of a server
+func importPrefs(path string, content []byte) error {
+	prefs := &Prefs{}
+
+	err := json.Unmarshal(content, prefs)
+	if err != nil {
+		return fmt.Errorf("invalid preferences %s: %w", path, err)
+	}
+
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	return writeFileAtomic(path, content)
+}
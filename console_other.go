@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// attachConsole is a no-op, outside of Windows espresso always runs with the console of its caller
+func attachConsole() error {
+	return nil
+}
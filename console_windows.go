@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	kernel32             = syscall.NewLazyDLL("kernel32.dll")
+	procGetConsoleWindow = kernel32.NewProc("GetConsoleWindow")
+	procAttachConsole    = kernel32.NewProc("AttachConsole")
+	procAllocConsole     = kernel32.NewProc("AllocConsole")
+)
+
+// attachParentProcess is the (DWORD)-1 value of ATTACH_PARENT_PROCESS
+const attachParentProcess = ^uint32(0)
+
+// attachConsole attaches espresso to the console of the parent process or allocates a new one
+func attachConsole() error {
+	// already running with a console?
+	hwnd, _, _ := procGetConsoleWindow.Call()
+	if hwnd != 0 {
+		return nil
+	}
+
+	r, _, _ := procAttachConsole.Call(uintptr(attachParentProcess))
+	if r == 0 {
+		r, _, err := procAllocConsole.Call()
+		if r == 0 {
+			return err
+		}
+	}
+
+	// the std handles of a GUI process are invalid, so reopen them on the new console
+	conin, err := os.OpenFile("CONIN$", os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+
+	conout, err := os.OpenFile("CONOUT$", os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+
+	os.Stdin = conin
+	os.Stdout = conout
+	os.Stderr = conout
+
+	return nil
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// encryptedMagic marks an encrypted cache file
+var encryptedMagic = []byte("ESPENC1\n")
+
+// encryptionOverhead is the size of the magic, the nonce and the GCM tag of an encrypted cache file
+const encryptionOverhead = 8 + 12 + 16
+
+// EncryptionConfig defines the encryption at rest of the cached jars
+type EncryptionConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// keychainKey returns the named 256 bit key, it is created on first use and protected by the OS
+func keychainKey(name string) ([]byte, error) {
+	key, err := loadKeychainKey(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil {
+		key = make([]byte, 32)
+
+		_, err = rand.Read(key)
+		if err != nil {
+			return nil, err
+		}
+
+		err = storeKeychainKey(name, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid %s key", name)
+	}
+
+	return key, nil
+}
+
+// encryptionKey returns the AES-256 key of the cache
+func encryptionKey() ([]byte, error) {
+	return storage.Key("cache")
+}
+
+// newGCM creates the AES-GCM cipher with the cache key
+func newGCM() (cipher.AEAD, error) {
+	key, err := encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// isEncrypted checks if the cache file is encrypted
+func isEncrypted(filename string) bool {
+	f, err := os.Open(longPath(filename))
+	if err != nil {
+		return false
+	}
+
+	// care about closing the file
+	defer func() {
+		common.Error(f.Close())
+	}()
+
+	header := make([]byte, len(encryptedMagic))
+
+	_, err = io.ReadFull(f, header)
+
+	return err == nil && bytes.Equal(header, encryptedMagic)
+}
+
+// plainSize returns the size of the content of a cache file, encrypted or not
+func plainSize(filename string) (int64, error) {
+	size, err := common.FileSize(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	if isEncrypted(filename) {
+		size -= encryptionOverhead
+	}
+
+	return size, nil
+}
+
+// seal returns the encrypted content of a cache file
+func seal(plain []byte) ([]byte, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append(append([]byte{}, encryptedMagic...), nonce...), gcm.Seal(nil, nonce, plain, nil)...), nil
+}
+
+// storeEncrypted encrypts the content of the reader in memory and replaces the file by it
+func storeEncrypted(filename string, r io.Reader) error {
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	content, err := seal(plain)
+	if err != nil {
+		return err
+	}
+
+	return storage.WriteFile(filename, content)
+}
+
+// encryptFile encrypts the cache file in place, already encrypted files are left untouched
+func encryptFile(filename string) error {
+	if isEncrypted(filename) {
+		return nil
+	}
+
+	plain, err := storage.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	content, err := seal(plain)
+	if err != nil {
+		return err
+	}
+
+	return storage.WriteFile(filename, content)
+}
+
+// readPlain returns the content of the cache file, encrypted files are decrypted
+func readPlain(filename string) ([]byte, error) {
+	content, err := storage.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(content, encryptedMagic) {
+		return content, nil
+	}
+
+	plain, err := unseal(content)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt %s: %w", filename, err)
+	}
+
+	return plain, nil
+}
+
+// unseal returns the plain content of sealed content
+func unseal(content []byte) ([]byte, error) {
+	if len(content) < encryptionOverhead || !bytes.HasPrefix(content, encryptedMagic) {
+		return nil, fmt.Errorf("no encrypted content")
+	}
+
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+
+	content = content[len(encryptedMagic):]
+
+	return gcm.Open(nil, content[:gcm.NonceSize()], content[gcm.NonceSize():], nil)
+}
+
+// decryptFile writes the decrypted content of the cache file to dest
+func decryptFile(filename string, dest string) error {
+	if !isEncrypted(filename) {
+		return fmt.Errorf("%s is not an encrypted cache file", filename)
+	}
+
+	plain, err := readPlain(filename)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(longPath(dest), plain, 0600)
+}
+
+// stagingPrefix starts the names of the staging directories, it is followed by the PID of the owning espresso
+const stagingPrefix = "espresso-"
+
+// stagingBase returns the directory for the decrypted jars, a tmpfs is preferred so they never reach the disk
+func stagingBase() string {
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return "/dev/shm"
+	}
+
+	return os.TempDir()
+}
+
+// newStagingDir creates a private staging directory owned by this espresso
+func newStagingDir(kind string) (string, error) {
+	return os.MkdirTemp(stagingBase(), fmt.Sprintf("%s%d-%s", stagingPrefix, os.Getpid(), kind))
+}
+
+// purgeStaging removes the staging directories of ended espresso processes, which have been killed or crashed before
+// they removed their decrypted jars or ephemeral cache
+func purgeStaging() {
+	matches, err := filepath.Glob(filepath.Join(stagingBase(), stagingPrefix+"*"))
+	if common.Error(err) {
+		return
+	}
+
+	for _, match := range matches {
+		owner, _, ok := strings.Cut(strings.TrimPrefix(filepath.Base(match), stagingPrefix), "-")
+		if !ok {
+			continue
+		}
+
+		pid, err := strconv.Atoi(owner)
+		if err != nil || pid == os.Getpid() || processAlive(pid) {
+			continue
+		}
+
+		// the staging directories of other users are left to them
+		err = os.RemoveAll(match)
+		if err != nil {
+			common.Debug(fmt.Sprintf("Cannot remove the stale staging directory %s: %v", match, err))
+		}
+	}
+}
+
+// stageDecrypted decrypts the encrypted jars into a private staging directory and uses them for the launch. The lazy
+// jars are staged as well, since they are encrypted in the cache while the app is running. Lazy jars which are not
+// cached yet are staged after their prefetch.
+func (l *Launch) stageDecrypted() error {
+	if !l.Config.Encryption.Enabled {
+		return nil
+	}
+
+	stage, err := newStagingDir("jars-")
+	if err != nil {
+		return err
+	}
+
+	l.staging = stage
+
+	staged := make(map[string]string)
+
+	lazy := make(map[string]bool)
+	for _, task := range l.lazyTasks {
+		lazy[task.Path] = true
+	}
+
+	for i, jar := range l.jars {
+		if !isEncrypted(jar) && !lazy[jar] {
+			continue
+		}
+
+		dest, ok := staged[jar]
+		if !ok {
+			dest = filepath.Join(stage, fmt.Sprintf("%d-%s", i, filepath.Base(jar)))
+
+			err := stageJar(jar, dest)
+			if err != nil {
+				return err
+			}
+
+			staged[jar] = dest
+		}
+
+		l.jars[i] = dest
+	}
+
+	l.mu.Lock()
+	l.stagedJars = staged
+	l.mu.Unlock()
+
+	if dest, ok := staged[l.mainJar]; ok {
+		l.mainJar = dest
+	}
+
+	l.logf("Decrypted %d jars into %s", len(staged), stage)
+
+	return nil
+}
+
+// stageJar writes the plain content of the cache file to the staging file, a jar which is not cached yet is skipped
+func stageJar(jar string, dest string) error {
+	if !common.FileExists(jar) {
+		return nil
+	}
+
+	plain, err := readPlain(jar)
+	if err != nil {
+		return err
+	}
+
+	// the app never sees a partially written jar
+	tmp := longPath(dest + ".stage")
+
+	err = os.WriteFile(tmp, plain, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, longPath(dest))
+}
+
+// stageLazyJar stages a lazy jar prefetched while the app is running, a staged file possibly in use by the app is kept
+func (l *Launch) stageLazyJar(jar string) error {
+	l.mu.Lock()
+	dest, ok := l.stagedJars[jar]
+	l.mu.Unlock()
+
+	if !ok || common.FileExists(dest) {
+		return nil
+	}
+
+	return stageJar(jar, dest)
+}
+
+// removeStaging removes the decrypted jars after the end of the app
+func (l *Launch) removeStaging() {
+	if l.staging == "" || !strings.HasPrefix(filepath.Base(l.staging), stagingPrefix) {
+		return
+	}
+
+	common.Error(os.RemoveAll(l.staging))
+
+	l.staging = ""
+}
@@ -0,0 +1,92 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// securityItemNotFound is the exit code of the macOS security tool if the keychain has no such item
+const securityItemNotFound = 44
+
+// loadKeychainKey returns the named key, like the cache key, from the OS keychain, nil if there is none yet. Any other
+// failure, like a locked keychain or a missing tool, is an error, since a new key would make the encrypted cache
+// unreadable.
+func loadKeychainKey(name string) ([]byte, error) {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", "espresso", "-a", name+"-key", "-w")
+	default:
+		cmd = exec.Command("secret-tool", "lookup", "application", "espresso", "key", name)
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	ba, err := cmd.Output()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		msg := strings.TrimSpace(stderr.String())
+
+		// secret-tool fails silently if there is no such secret, but reports the errors of the secret service
+		notFound := exitErr.ExitCode() == securityItemNotFound
+		if runtime.GOOS != "darwin" {
+			notFound = exitErr.ExitCode() == 1 && msg == ""
+		}
+
+		if notFound {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("cannot read the %s key from the keychain: %v %s", name, err, msg)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the %s key from the keychain: %w", name, err)
+	}
+
+	if strings.TrimSpace(string(ba)) == "" {
+		return nil, nil
+	}
+
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(ba)))
+}
+
+// storeKeychainKey stores the named key in the OS keychain
+func storeKeychainKey(name string, key []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	var cmd *exec.Cmd
+
+	// the key is passed on stdin, the arguments of a process are visible to other users
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -s espresso -a %s-key -w %s\n", name, encoded))
+	default:
+		cmd = exec.Command("secret-tool", "store", "--label=espresso "+name+" key", "application", "espresso", "key", name)
+		cmd.Stdin = strings.NewReader(encoded)
+	}
+
+	ba, err := cmd.CombinedOutput()
+
+	// the interactive mode of the security tool reports the failures of its commands by their output only
+	if err == nil && runtime.GOOS == "darwin" && len(bytes.TrimSpace(ba)) > 0 {
+		err = fmt.Errorf("add-generic-password failed")
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot store the %s key in the keychain: %v %s", name, err, strings.TrimSpace(string(ba)))
+	}
+
+	return nil
+}
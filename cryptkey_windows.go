@@ -0,0 +1,55 @@
+package main
+
+import (
+	"golang.org/x/sys/windows"
+	"os"
+	"path/filepath"
+	"unsafe"
+)
+
+// keychainKeyPath returns the file of the DPAPI protected key with the given name, like "cache.key"
+func keychainKeyPath(name string) string {
+	return filepath.Join(*cache, name+".key")
+}
+
+// loadKeychainKey returns the named key unprotected by DPAPI, nil if there is none yet
+func loadKeychainKey(name string) ([]byte, error) {
+	protected, err := os.ReadFile(keychainKeyPath(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	in := windows.DataBlob{Size: uint32(len(protected)), Data: &protected[0]}
+	var out windows.DataBlob
+
+	err = windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_, _ = windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	}()
+
+	return append([]byte{}, unsafe.Slice(out.Data, out.Size)...), nil
+}
+
+// storeKeychainKey protects the named key by DPAPI for the current user and stores it in the cache
+func storeKeychainKey(name string, key []byte) error {
+	in := windows.DataBlob{Size: uint32(len(key)), Data: &key[0]}
+	var out windows.DataBlob
+
+	err := windows.CryptProtectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_, _ = windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	}()
+
+	return os.WriteFile(keychainKeyPath(name), unsafe.Slice(out.Data, out.Size), 0600)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// maxExtensionDepth is the max. nesting depth of extension JNLP files
+const maxExtensionDepth = 16
+
+// descriptor is a JNLP file which is fetched in the background
+type descriptor struct {
+	done    chan struct{}
+	content []byte
+	err     error
+}
+
+// extensionURLs returns the URLs of the extensions of the resources selected for this platform
+func (l *Launch) extensionURLs(jnlp *Jnlp, u *url.URL, codebase string) ([]string, error) {
+	var urls []string
+
+	for _, resource := range jnlp.Resources {
+		if !l.isSelected(resource.Os, resource.Arch) {
+			continue
+		}
+
+		for _, extension := range resource.Extensions {
+			extensionURL, err := u.Parse(codebase + "/" + extension.Href)
+			if err != nil {
+				return nil, err
+			}
+
+			urls = append(urls, extensionURL.String())
+		}
+	}
+
+	return urls, nil
+}
+
+// prefetchExtensions fetches the extension JNLP files of the tree concurrently, so the resolve in document order
+// does not wait for one descriptor after the other. Each descriptor is fetched only once, which also stops cycles.
+func (l *Launch) prefetchExtensions(jnlp *Jnlp, u *url.URL, codebase string, depth int) {
+	if depth > maxExtensionDepth {
+		return
+	}
+
+	urls, err := l.extensionURLs(jnlp, u, codebase)
+	if err != nil {
+		// reported by the resolve
+		return
+	}
+
+	for _, address := range urls {
+		l.mu.Lock()
+		_, ok := l.descriptors[address]
+		if !ok {
+			l.descriptors[address] = &descriptor{done: make(chan struct{})}
+			l.descriptorsTotal++
+		}
+		d := l.descriptors[address]
+		l.mu.Unlock()
+
+		if ok {
+			continue
+		}
+
+		l.resolveProgress()
+
+		go func(address string, d *descriptor) {
+			d.content, d.err = l.fetchJnlp(address)
+
+			close(d.done)
+
+			l.mu.Lock()
+			l.descriptorsDone++
+			l.mu.Unlock()
+
+			l.resolveProgress()
+
+			if d.err != nil {
+				return
+			}
+
+			child, err := parseJnlp(d.content)
+			if err != nil {
+				return
+			}
+
+			childURL, err := url.Parse(address)
+			if err != nil {
+				return
+			}
+
+			l.prefetchExtensions(child, childURL, jnlpCodebase(child, address), depth+1)
+		}(address, d)
+	}
+}
+
+// extensionDescriptor returns the content of the extension JNLP file, fetched by the prefetch if possible
+func (l *Launch) extensionDescriptor(address string) ([]byte, error) {
+	l.mu.Lock()
+	d, ok := l.descriptors[address]
+	l.mu.Unlock()
+
+	if !ok {
+		return l.fetchJnlp(address)
+	}
+
+	<-d.done
+
+	return d.content, d.err
+}
+
+// checkExtensionChain refuses extension cycles and too deep extension hierarchies
+func checkExtensionChain(chain []string, address string) error {
+	for i, link := range chain {
+		if link == address {
+			return fmt.Errorf("extension cycle: %s", strings.Join(append(chain[i:], address), " -> "))
+		}
+	}
+
+	if len(chain) > maxExtensionDepth {
+		return fmt.Errorf("extension hierarchy deeper than %d: %s", maxExtensionDepth, strings.Join(append(chain, address), " -> "))
+	}
+
+	return nil
+}
+
+// resolveProgress reports the progress of the descriptor fetches separately from the downloads
+func (l *Launch) resolveProgress() {
+	l.mu.Lock()
+	done, total := l.descriptorsDone, l.descriptorsTotal
+
+	// late prefetches of unused descriptors must not reset the state of the launch
+	if strings.HasPrefix(l.state, "resolving") {
+		l.state = fmt.Sprintf("resolving %d of %d descriptors", done, total)
+	}
+	l.mu.Unlock()
+
+	l.emitEvent(JSONEvent{Event: jsonEventResolveProgress, Done: done, Total: total})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/mpetavy/common"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// address families of the connections to the servers
+const (
+	// ipFamilyAuto uses the order of the DNS resolution with the Happy Eyeballs fallback to the other family
+	ipFamilyAuto = "auto"
+	// ipFamilyPreferIPv4 tries IPv4 first and falls back to IPv6 after the fallback delay
+	ipFamilyPreferIPv4 = "prefer-ipv4"
+	// ipFamilyPreferIPv6 tries IPv6 first and falls back to IPv4 after the fallback delay
+	ipFamilyPreferIPv6 = "prefer-ipv6"
+	// ipFamilyIPv4 connects via IPv4 only
+	ipFamilyIPv4 = "ipv4"
+	// ipFamilyIPv6 connects via IPv6 only
+	ipFamilyIPv6 = "ipv6"
+)
+
+// defaultFallbackDelay is the delay of the Happy Eyeballs fallback of the Go dialer
+const defaultFallbackDelay = 300 * time.Millisecond
+
+var (
+	// netDialer establishes all connections to the servers
+	netDialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	// ipFamily is the address family used by the dialer
+	ipFamily = ipFamilyAuto
+)
+
+// configureDialer sets the address family and the fallback delay for all HTTP connections
+func configureDialer(family string, fallbackDelay time.Duration) error {
+	switch family {
+	case ipFamilyAuto, ipFamilyPreferIPv4, ipFamilyPreferIPv6, ipFamilyIPv4, ipFamilyIPv6:
+	default:
+		return fmt.Errorf("invalid IP family %q, use %s, %s, %s, %s or %s", family, ipFamilyAuto, ipFamilyPreferIPv4, ipFamilyPreferIPv6, ipFamilyIPv4, ipFamilyIPv6)
+	}
+
+	ipFamily = family
+	netDialer.FallbackDelay = fallbackDelay
+
+	// all HTTP clients of espresso use the default transport
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport.DialContext = dialContext
+	}
+
+	return nil
+}
+
+// familyNetwork returns the network restricted to the IP version, like "tcp4" for "tcp"
+func familyNetwork(network string, version string) string {
+	if strings.HasSuffix(network, "4") || strings.HasSuffix(network, "6") {
+		return network
+	}
+
+	return network + version
+}
+
+// dialContext connects to the address due to the configured address family
+func dialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	switch ipFamily {
+	case ipFamilyIPv4:
+		return netDialer.DialContext(ctx, familyNetwork(network, "4"), address)
+	case ipFamilyIPv6:
+		return netDialer.DialContext(ctx, familyNetwork(network, "6"), address)
+	case ipFamilyPreferIPv4:
+		return dialPreferred(ctx, network, address, "4", "6")
+	case ipFamilyPreferIPv6:
+		return dialPreferred(ctx, network, address, "6", "4")
+	default:
+		return netDialer.DialContext(ctx, network, address)
+	}
+}
+
+// dialTimeout connects to the address with a timeout due to the configured address family
+func dialTimeout(network string, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return dialContext(ctx, network, address)
+}
+
+// dialPreferred races the connections of both address families like Happy Eyeballs (RFC 8305), the other family is
+// tried after the fallback delay or as soon as the preferred one has failed
+func dialPreferred(ctx context.Context, network string, address string, preferred string, other string) (net.Conn, error) {
+	// literal addresses have a single family
+	if host, _, err := net.SplitHostPort(address); err == nil && net.ParseIP(host) != nil {
+		return netDialer.DialContext(ctx, network, address)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+
+	results := make(chan result, 2)
+
+	dial := func(version string) {
+		conn, err := netDialer.DialContext(ctx, familyNetwork(network, version), address)
+
+		results <- result{conn: conn, err: err}
+	}
+
+	go dial(preferred)
+
+	delay := netDialer.FallbackDelay
+	if delay == 0 {
+		delay = defaultFallbackDelay
+	}
+
+	// a negative delay disables the fallback
+	if delay < 0 {
+		r := <-results
+
+		return r.conn, r.err
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	pending := 1
+	fallback := false
+
+	var firstErr error
+
+	for {
+		select {
+		case <-timer.C:
+			if !fallback {
+				fallback = true
+				pending++
+
+				go dial(other)
+			}
+		case r := <-results:
+			pending--
+
+			if r.err == nil {
+				// the slower connection is not needed anymore
+				if pending > 0 {
+					go func() {
+						if r := <-results; r.conn != nil {
+							common.Error(r.conn.Close())
+						}
+					}()
+				}
+
+				return r.conn, nil
+			}
+
+			if firstErr == nil {
+				firstErr = r.err
+			}
+
+			if !fallback {
+				fallback = true
+				pending++
+
+				go dial(other)
+
+				continue
+			}
+
+			if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// requiredDiskSpace returns the number of bytes needed on disk to download and extract the given resource
+func requiredDiskSpace(task Task) (uint64, error) {
+	response, err := httpRequest(http.MethodHead, task.URL)
+	if err != nil {
+		return 0, explainTLSError(err)
+	}
+
+	// care about the final close of the response body
+	defer func() {
+		common.Error(response.Body.Close())
+	}()
+
+	contentLength, err := strconv.ParseInt(response.Header.Get("Content-Length"), 10, 64)
+	if err != nil || contentLength < 0 {
+		return 0, nil
+	}
+
+	// an unchanged resource needs no additional space
+	if common.FileExists(task.Path) {
+		size, err := common.FileSize(task.Path)
+		if err == nil && size == contentLength {
+			return 0, nil
+		}
+	}
+
+	if task.Unzip || task.Extract {
+		return uint64(float64(contentLength) * (1 + *extractFactor)), nil
+	}
+
+	return uint64(contentLength), nil
+}
+
+// checkDiskSpace fails if the resources to download and extract do not fit into the cache volume
+func checkDiskSpace(list []Task) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var required uint64
+
+	for _, task := range list {
+		wg.Add(1)
+
+		go func(task Task) {
+			defer wg.Done()
+
+			// a failing request is reported by the download itself
+			size, err := requiredDiskSpace(task)
+			if err != nil {
+				common.Debug(fmt.Sprintf("Disk space check of %s failed: %v", task.URL, err))
+				return
+			}
+
+			mu.Lock()
+			required += size
+			mu.Unlock()
+		}(task)
+	}
+
+	wg.Wait()
+
+	if required == 0 {
+		return nil
+	}
+
+	available, err := freeDiskSpace(*cache)
+	if err != nil {
+		return err
+	}
+
+	common.Debug(fmt.Sprintf("Disk space required: %d bytes, available: %d bytes", required, available))
+
+	if required > available {
+		return fmt.Errorf("not enough disk space in the cache %s: %s required, %s available. Free disk space or use -cache to point to another location", *cache, formatBytes(required), formatBytes(available))
+	}
+
+	return nil
+}
+
+// formatBytes formats a number of bytes human readable
+func formatBytes(bytes uint64) string {
+	const unit = 1024
+
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	div, exp := uint64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// doctorTimeout is the timeout of the connection checks of the doctor command
+const doctorTimeout = 5 * time.Second
+
+// localAddresses returns the global unicast addresses of the network interfaces of one IP version
+func localAddresses(v6 bool) ([]string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || !ipnet.IP.IsGlobalUnicast() || (ipnet.IP.To4() == nil) != v6 {
+			continue
+		}
+
+		addresses = append(addresses, ipnet.IP.String())
+	}
+
+	return addresses, nil
+}
+
+// checkLocalAddresses reports the IPv4 and IPv6 addresses of the machine
+func (c *Conformance) checkLocalAddresses() {
+	for _, v6 := range []bool{false, true} {
+		name := "IPv4 address"
+		if v6 {
+			name = "IPv6 address"
+		}
+
+		addresses, err := localAddresses(v6)
+
+		switch {
+		case err != nil:
+			c.add(name, checkFail, "%v", err)
+		case len(addresses) == 0:
+			c.add(name, checkWarn, "no address, the machine has no %s", strings.TrimSuffix(name, " address"))
+		default:
+			c.add(name, checkPass, "%s", strings.Join(addresses, ", "))
+		}
+	}
+}
+
+// checkResolution reports the IPv4 and IPv6 addresses of the host and returns if there are any per IP version
+func (c *Conformance) checkResolution(host string) (bool, bool) {
+	if ip := net.ParseIP(host); ip != nil {
+		c.add("DNS", checkPass, "%s is a literal address", host)
+
+		return ip.To4() != nil, ip.To4() == nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		c.add("DNS", checkFail, "%s cannot be resolved: %v", host, err)
+
+		return false, false
+	}
+
+	var v4, v6 []string
+
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			v4 = append(v4, addr.IP.String())
+		} else {
+			v6 = append(v6, addr.IP.String())
+		}
+	}
+
+	c.add("DNS", checkPass, "%s has A records [%s] and AAAA records [%s]", host, strings.Join(v4, ", "), strings.Join(v6, ", "))
+
+	return len(v4) > 0, len(v6) > 0
+}
+
+// checkConnect connects to the address with one IP version and returns if it succeeded
+func (c *Conformance) checkConnect(dialer *net.Dialer, address string, version string) bool {
+	name := "IPv" + version + " connect"
+
+	start := time.Now()
+
+	conn, err := dialer.DialContext(context.Background(), "tcp"+version, address)
+	if err != nil {
+		c.add(name, checkWarn, "%s: %v", address, err)
+
+		return false
+	}
+
+	common.Error(conn.Close())
+
+	c.add(name, checkPass, "%s connected in %v via %s", address, time.Since(start).Round(time.Millisecond), conn.RemoteAddr())
+
+	return true
+}
+
+// checkHTTP requests the JNLP file with the configured dialer
+func (c *Conformance) checkHTTP(address string) {
+	start := time.Now()
+
+	response, err := httpRequest(http.MethodHead, address)
+	if err != nil {
+		c.add("HTTP", checkFail, "%v", explainTLSError(err))
+
+		return
+	}
+
+	common.Error(response.Body.Close())
+
+	c.add("HTTP", checkPass, "%s in %v", response.Status, time.Since(start).Round(time.Millisecond))
+}
+
+// runDoctor diagnoses the network of the machine and the connections to the server of the app
+func runDoctor(cfg *Config, name string, w io.Writer) error {
+	c := &Conformance{}
+
+	fmt.Fprintf(w, "IP family %s, fallback delay %v\n\n", ipFamily, netDialer.FallbackDelay)
+
+	c.checkLocalAddresses()
+
+	if name != "" {
+		u, err := url.Parse(cfg.App(name).URL)
+		if err != nil {
+			return err
+		}
+
+		address, err := hostAddress(u.String())
+		if err != nil {
+			return err
+		}
+
+		hasV4, hasV6 := c.checkResolution(u.Hostname())
+
+		// both IP versions are diagnosed regardless of the configured family
+		dialer := *netDialer
+		dialer.Timeout = doctorTimeout
+
+		v4, v6 := false, false
+
+		if hasV4 {
+			v4 = c.checkConnect(&dialer, address, "4")
+		} else {
+			c.add("IPv4 connect", checkSkipped, "no A record")
+		}
+
+		if hasV6 {
+			v6 = c.checkConnect(&dialer, address, "6")
+		} else {
+			c.add("IPv6 connect", checkSkipped, "no AAAA record")
+		}
+
+		switch {
+		case (hasV4 || hasV6) && !v4 && !v6:
+			c.add("Connect", checkFail, "%s is not reachable via IPv4 or IPv6", address)
+		case hasV4 && hasV6 && v4 && !v6 && ipFamily != ipFamilyIPv4 && ipFamily != ipFamilyPreferIPv4:
+			c.add("Dual stack", checkWarn, "the IPv6 route is broken, use -ip-family %s", ipFamilyPreferIPv4)
+		case hasV4 && hasV6 && !v4 && v6 && ipFamily != ipFamilyIPv6 && ipFamily != ipFamilyPreferIPv6:
+			c.add("Dual stack", checkWarn, "the IPv4 route is broken, use -ip-family %s", ipFamilyPreferIPv6)
+		case !v4 && v6 && ipFamily == ipFamilyIPv4:
+			c.add("IP family", checkFail, "the server is reachable via IPv6 only, but -ip-family is %s", ipFamilyIPv4)
+		case v4 && !v6 && ipFamily == ipFamilyIPv6:
+			c.add("IP family", checkFail, "the server is reachable via IPv4 only, but -ip-family is %s", ipFamilyIPv6)
+		}
+
+		c.checkHTTP(u.String())
+	}
+
+	for _, check := range c.Checks {
+		fmt.Fprintf(w, "%-12s %-18s %s\n", check.Result, check.Name, check.Detail)
+	}
+
+	if c.failed() > 0 {
+		return fmt.Errorf("the network diagnosis found %d problems", c.failed())
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"strings"
+	"sync"
+)
+
+// launch events which are reported to the OS logging facility
+const (
+	eventLaunchStart       = "launch-start"
+	eventLaunchSuccess     = "launch-success"
+	eventLaunchFailure     = "launch-failure"
+	eventSecurityRejection = "security-rejection"
+	eventUpdateApplied     = "update-applied"
+	eventRollback          = "rollback"
+	eventJnlpChange        = "jnlp-change"
+	eventVulnerableLibrary = "vulnerable-library"
+	eventHungStartup       = "hung-startup"
+)
+
+// severities of the events
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityInfo    = "info"
+)
+
+// eventIds are the event IDs of the Windows event log
+var eventIds = map[string]uint32{
+	eventLaunchStart:       1,
+	eventLaunchSuccess:     2,
+	eventLaunchFailure:     3,
+	eventSecurityRejection: 4,
+	eventUpdateApplied:     5,
+	eventRollback:          6,
+	eventJnlpChange:        7,
+	eventVulnerableLibrary: 8,
+	eventHungStartup:       9,
+}
+
+// defaultSeverities maps the events to their default severities
+var defaultSeverities = map[string]string{
+	eventLaunchStart:       severityInfo,
+	eventLaunchSuccess:     severityInfo,
+	eventLaunchFailure:     severityError,
+	eventSecurityRejection: severityWarning,
+	eventUpdateApplied:     severityInfo,
+	eventRollback:          severityWarning,
+	eventJnlpChange:        severityWarning,
+	eventVulnerableLibrary: severityWarning,
+	eventHungStartup:       severityWarning,
+}
+
+// eventLogger writes to the native OS logging facility
+type eventLogger interface {
+	Log(id uint32, severity string, message string) error
+}
+
+var (
+	eventSeverities map[string]string
+	eventLog        eventLogger
+	eventLogOnce    sync.Once
+	eventLogMutex   sync.Mutex
+)
+
+// setEventSeverities configures the severities of the events, unknown events or severities are ignored
+func setEventSeverities(severities map[string]string) {
+	eventLogMutex.Lock()
+	defer eventLogMutex.Unlock()
+
+	eventSeverities = make(map[string]string)
+
+	for event, severity := range severities {
+		severity = strings.ToLower(severity)
+
+		switch severity {
+		case severityError, severityWarning, severityInfo:
+			eventSeverities[event] = severity
+		default:
+			common.Warn(fmt.Sprintf("Unknown severity %s for event %s", severity, event))
+		}
+	}
+}
+
+// logEvent reports an event to the native OS logging facility (Windows event log, syslog/journald)
+func logEvent(event string, message string) {
+	if !*osEventLog {
+		return
+	}
+
+	eventLogOnce.Do(func() {
+		var err error
+
+		eventLog, err = openEventLog()
+		if err != nil {
+			common.Warn(fmt.Sprintf("Cannot open the OS event log: %v", err))
+		}
+	})
+
+	if eventLog == nil {
+		return
+	}
+
+	eventLogMutex.Lock()
+	defer eventLogMutex.Unlock()
+
+	severity, ok := eventSeverities[event]
+	if !ok {
+		severity = defaultSeverities[event]
+	}
+
+	common.Error(eventLog.Log(eventIds[event], severity, fmt.Sprintf("%s: %s", event, message)))
+}
@@ -0,0 +1,33 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"log/syslog"
+)
+
+// syslogEventLog writes to the syslog, which is also collected by journald
+type syslogEventLog struct {
+	writer *syslog.Writer
+}
+
+// openEventLog opens the local syslog with tag "espresso"
+func openEventLog() (eventLogger, error) {
+	writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, "espresso")
+	if err != nil {
+		return nil, err
+	}
+
+	return &syslogEventLog{writer: writer}, nil
+}
+
+func (s *syslogEventLog) Log(id uint32, severity string, message string) error {
+	switch severity {
+	case severityError:
+		return s.writer.Err(message)
+	case severityWarning:
+		return s.writer.Warning(message)
+	default:
+		return s.writer.Info(message)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// windowsEventLog writes to the Windows event log
+type windowsEventLog struct {
+	log *eventlog.Log
+}
+
+// openEventLog opens the Windows event log with source "espresso"
+func openEventLog() (eventLogger, error) {
+	log, err := eventlog.Open("espresso")
+	if err != nil {
+		return nil, err
+	}
+
+	return &windowsEventLog{log: log}, nil
+}
+
+func (w *windowsEventLog) Log(id uint32, severity string, message string) error {
+	switch severity {
+	case severityError:
+		return w.log.Error(id, message)
+	case severityWarning:
+		return w.log.Warning(id, message)
+	default:
+		return w.log.Info(id, message)
+	}
+}
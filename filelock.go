@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"path/filepath"
+)
+
+// lockSuffix is appended to the name of a shared state file for the name of its lock file
+const lockSuffix = ".lock"
+
+// lockFile acquires the exclusive advisory lock of the shared state file or directory, concurrent espresso processes
+// wait until the returned unlock func is called. The lock is held on a separate lock file, so the state file itself
+// can be replaced atomically.
+func lockFile(filename string) (func(), error) {
+	filename = longPath(filename)
+
+	err := os.MkdirAll(filepath.Dir(filename), common.DefaultDirMode)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filename+lockSuffix, os.O_CREATE|os.O_RDWR, common.DefaultFileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockExclusive(f)
+	if err != nil {
+		common.Error(f.Close())
+
+		return nil, fmt.Errorf("cannot lock %s: %w", filename, err)
+	}
+
+	return func() {
+		common.Error(unlockExclusive(f))
+		common.Error(f.Close())
+	}, nil
+}
+
+// writeFileAtomic replaces the file by the content through the storage of the cache, concurrent readers see either
+// the old or the new content but never a partially written file
+func writeFileAtomic(filename string, content []byte) error {
+	return storage.WriteFile(filename, content)
+}
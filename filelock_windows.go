@@ -0,0 +1,16 @@
+package main
+
+import (
+	"golang.org/x/sys/windows"
+	"os"
+)
+
+// lockExclusive blocks until the exclusive lock of the first byte of the file is acquired
+func lockExclusive(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &windows.Overlapped{})
+}
+
+// unlockExclusive releases the lock of the first byte of the file
+func unlockExclusive(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
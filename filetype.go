@@ -0,0 +1,165 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// resource types which decide how a downloaded resource is processed
+const (
+	fileTypeZip     = "zip"
+	fileTypeExe     = "exe"
+	fileTypeGzip    = "gzip"
+	fileTypeUnknown = ""
+)
+
+// sniffFileType detects the type of the file by its magic bytes
+func sniffFileType(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+
+	// care about closing the file
+	defer func() {
+		common.Error(f.Close())
+	}()
+
+	header := make([]byte, 4)
+
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		return fileTypeZip, nil
+	case bytes.HasPrefix(header, []byte("MZ")):
+		return fileTypeExe, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return fileTypeGzip, nil
+	}
+
+	return fileTypeUnknown, nil
+}
+
+// resourceType returns the type of a resource: the config override by the name of the resource, otherwise for
+// archives the sniffed content type, otherwise the type derived from the requested processing
+func (l *Launch) resourceType(href string, filename string, doUnzip bool, doExtract bool) (string, error) {
+	name := href
+	if u, err := url.Parse(href); err == nil {
+		name = path.Base(u.Path)
+	}
+
+	for pattern, fileType := range l.App.ResourceTypes {
+		if ok, _ := path.Match(pattern, name); ok {
+			return fileType, nil
+		}
+	}
+
+	// resources which are not archives are used as they are
+	if !doUnzip && !doExtract {
+		return fileTypeUnknown, nil
+	}
+
+	fileType, err := sniffFileType(filename)
+	if err != nil {
+		return "", err
+	}
+
+	if fileType != fileTypeUnknown {
+		return fileType, nil
+	}
+
+	if doUnzip {
+		return fileTypeZip, nil
+	}
+
+	return fileTypeExe, nil
+}
+
+// runUntar extracts the tar.gz file into the path
+func runUntar(filename string, dest string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+
+	// care about closing the file
+	defer func() {
+		common.Error(f.Close())
+	}()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(gz)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if strings.Contains(header.Name, "..") {
+			continue
+		}
+
+		target := longPath(filepath.Join(dest, filepath.FromSlash(header.Name)))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, common.DefaultDirMode)
+		case tar.TypeReg:
+			err = os.MkdirAll(filepath.Dir(target), common.DefaultDirMode)
+			if err == nil {
+				err = writeFile(target, tr, os.FileMode(header.Mode).Perm())
+			}
+		case tar.TypeSymlink:
+			err = os.MkdirAll(filepath.Dir(target), common.DefaultDirMode)
+			if err == nil {
+				_ = os.Remove(target)
+
+				err = os.Symlink(header.Linkname, target)
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("cannot extract %s from %s: %w", header.Name, filename, err)
+		}
+	}
+}
+
+// writeFile writes the content into the file with the given permissions
+func writeFile(filename string, r io.Reader, perm os.FileMode) error {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		common.Error(f.Close())
+
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// handling of the font and locale preflight
+const (
+	fontCheckOff     = "off"
+	fontCheckWarn    = "warn"
+	fontCheckInstall = "install"
+)
+
+// fontExtensions are the font formats used by Java2D
+var fontExtensions = []string{".ttf", ".ttc", ".otf", ".pfb", ".pfa"}
+
+// errFontFound ends the walk over the font directories at the first font
+var errFontFound = errors.New("font found")
+
+// FontsConfig defines the preflight of the fonts and the locale which Swing apps need to show any text
+type FontsConfig struct {
+	// Check is the preflight mode: "off", "warn" or "install"
+	Check string `json:"check"`
+	// URL of a zip or tar.gz archive of fallback fonts like DejaVu, which are installed for the app with "install"
+	URL string `json:"url"`
+}
+
+// FontProblem is a finding of the preflight with its remediation
+type FontProblem struct {
+	Problem     string
+	Remediation string
+}
+
+// fontDirs returns the directories fontconfig searches for fonts by default
+func fontDirs() []string {
+	dirs := []string{"/usr/share/fonts", "/usr/local/share/fonts"}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".fonts"), filepath.Join(home, ".local", "share", "fonts"))
+	}
+
+	if data := os.Getenv("XDG_DATA_HOME"); data != "" {
+		dirs = append(dirs, filepath.Join(data, "fonts"))
+	}
+
+	return dirs
+}
+
+// hasFonts reports if one of the directories contains a font usable by Java2D
+func hasFonts(dirs []string) bool {
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+
+			if !d.IsDir() && slices.Contains(fontExtensions, strings.ToLower(filepath.Ext(path))) {
+				return errFontFound
+			}
+
+			return nil
+		})
+
+		if errors.Is(err, errFontFound) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasFontconfig reports if the fontconfig library, which Java2D uses on Linux to find fonts, is installed
+func hasFontconfig() bool {
+	for _, pattern := range []string{"/lib*/libfontconfig.so*", "/usr/lib*/libfontconfig.so*", "/lib/*/libfontconfig.so*", "/usr/lib/*/libfontconfig.so*", "/usr/local/lib/libfontconfig.so*"} {
+		if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isHeadlessJre reports if the JRE in home ships only the headless AWT, like the JRE packages for servers
+func isHeadlessJre(home string) bool {
+	found := func(name string) bool {
+		for _, pattern := range []string{"lib", "lib/*", "jre/lib/*"} {
+			if matches, _ := filepath.Glob(filepath.Join(home, filepath.FromSlash(pattern), name)); len(matches) > 0 {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return found("libawt_headless.so") && !found("libawt_xawt.so")
+}
+
+// currentLocale returns the locale of the character handling like the C library determines it
+func currentLocale() string {
+	for _, env := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if value := os.Getenv(env); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// normalizeLocale returns the locale in the form of "locale -a", e.g. "en_US.utf8" for "en_US.UTF-8"
+func normalizeLocale(locale string) string {
+	name, codeset, ok := strings.Cut(locale, ".")
+	if !ok {
+		return locale
+	}
+
+	return name + "." + strings.ReplaceAll(strings.ToLower(codeset), "-", "")
+}
+
+// installedLocales returns the normalized locales of the machine, nil if they cannot be determined
+func installedLocales() map[string]bool {
+	ba, err := exec.Command("locale", "-a").Output()
+	if err != nil {
+		return nil
+	}
+
+	locales := make(map[string]bool)
+
+	for _, line := range strings.Fields(string(ba)) {
+		locales[normalizeLocale(line)] = true
+	}
+
+	return locales
+}
+
+// packageHint returns the package installation of the fonts for the common Linux distributions
+func packageHint(packages string) string {
+	return fmt.Sprintf("install %s, e.g. \"apt-get install fontconfig fonts-dejavu-core\" (Debian/Ubuntu), \"dnf install fontconfig dejavu-sans-fonts\" (RHEL/Fedora) or \"apk add fontconfig ttf-dejavu\" (Alpine)", packages)
+}
+
+// fontProblems checks the machine and the JRE for the fonts and the locale which Swing apps need to show text. Only
+// Linux and the BSDs are checked, Windows and macOS always have system fonts.
+func (l *Launch) fontProblems() []FontProblem {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return nil
+	}
+
+	var problems []FontProblem
+
+	if home, err := l.jreHome(); err == nil && isHeadlessJre(home) {
+		problems = append(problems, FontProblem{
+			Problem:     fmt.Sprintf("the JRE in %s is headless and cannot show any window", home),
+			Remediation: "use a JRE with the desktop AWT, e.g. the package openjdk-17-jre instead of openjdk-17-jre-headless",
+		})
+	}
+
+	if !hasFontconfig() {
+		problems = append(problems, FontProblem{
+			Problem:     "the fontconfig library is missing, Java finds no fonts and fails with \"Fontconfig head is null\"",
+			Remediation: packageHint("fontconfig"),
+		})
+	}
+
+	if !hasFonts(fontDirs()) {
+		problems = append(problems, FontProblem{
+			Problem:     "no TrueType, OpenType or Type 1 fonts are installed, Swing apps show blank text",
+			Remediation: packageHint("fonts") + ", or define fallback fonts by \"fonts\" \"url\" of the app config with \"check\" \"install\"",
+		})
+	}
+
+	locale := currentLocale()
+
+	switch {
+	case locale == "" || locale == "C" || locale == "POSIX":
+		problems = append(problems, FontProblem{
+			Problem:     fmt.Sprintf("the locale is %q, Java uses ASCII for the text and file names of the app", locale),
+			Remediation: "set LANG to a UTF-8 locale, e.g. \"export LANG=C.UTF-8\"",
+		})
+	default:
+		if locales := installedLocales(); locales != nil && !locales[normalizeLocale(locale)] {
+			problems = append(problems, FontProblem{
+				Problem:     fmt.Sprintf("the locale %q is not installed, Java falls back to ASCII", locale),
+				Remediation: fmt.Sprintf("generate the locale, e.g. \"locale-gen %s\", or set LANG to an installed one", locale),
+			})
+		}
+	}
+
+	return problems
+}
+
+// fontCheckMode returns the preflight mode of the -font-check parameter or of the app config
+func (l *Launch) fontCheckMode() (string, error) {
+	mode := l.App.Fonts.Check
+	if *fontCheck != "" {
+		mode = *fontCheck
+	}
+
+	switch mode {
+	case "", fontCheckOff:
+		return fontCheckOff, nil
+	case fontCheckWarn, fontCheckInstall:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid font check %q, use %s, %s or %s", mode, fontCheckOff, fontCheckWarn, fontCheckInstall)
+	}
+}
+
+// preflightFonts checks the fonts and the locale before the launch. With "install" missing fonts are replaced by the
+// fallback fonts of the app config, which are registered for the app only, and a missing locale by C.UTF-8.
+func (l *Launch) preflightFonts() error {
+	mode, err := l.fontCheckMode()
+	if err != nil || mode == fontCheckOff {
+		return err
+	}
+
+	problems := l.fontProblems()
+
+	for _, problem := range problems {
+		common.Warn(fmt.Sprintf("Preflight: %s. Remediation: %s", problem.Problem, problem.Remediation))
+		l.logf("Preflight: %s. Remediation: %s", problem.Problem, problem.Remediation)
+	}
+
+	if mode != fontCheckInstall || len(problems) == 0 {
+		return nil
+	}
+
+	// the archive is extracted beside itself, its format is sniffed
+	if l.App.Fonts.URL != "" && !hasFonts(fontDirs()) {
+		hash := sha256.Sum256([]byte(l.App.Fonts.URL))
+
+		l.fontsPath = filepath.Join(*cache, "fonts", hex.EncodeToString(hash[:])[:12])
+
+		l.logf("Preflight: fallback fonts of %s are installed for the app", l.App.Fonts.URL)
+
+		l.addTask(Task{URL: l.App.Fonts.URL, Path: filepath.Join(l.fontsPath, filepath.Base(hrefPath(l.App.Fonts.URL))), Unzip: true})
+	}
+
+	if locale := currentLocale(); locale == "" || locale == "C" || locale == "POSIX" {
+		if locales := installedLocales(); locales == nil || locales["C.utf8"] {
+			l.logf("Preflight: the app runs with the locale C.UTF-8")
+
+			l.fontsEnv = append(l.fontsEnv, "LC_ALL=C.UTF-8")
+		}
+	}
+
+	return nil
+}
+
+// fontsEnvironment returns the environment variables of the JVM which register the fallback fonts for fontconfig
+func (l *Launch) fontsEnvironment() ([]string, error) {
+	env := l.fontsEnv
+
+	if l.fontsPath == "" {
+		return env, nil
+	}
+
+	conf := filepath.Join(l.fontsPath, "fonts.conf")
+
+	// the fonts of the system remain available beside the fallback fonts
+	content := fmt.Sprintf(`<?xml version="1.0"?>
+<!DOCTYPE fontconfig SYSTEM "fonts.dtd">
+<fontconfig>
+    <dir>%s</dir>
+    <cachedir>%s</cachedir>
+    <include ignore_missing="yes">/etc/fonts/fonts.conf</include>
+</fontconfig>
+`, l.fontsPath, filepath.Join(l.fontsPath, "cache"))
+
+	err := writeFileAtomic(conf, []byte(content))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(env, "FONTCONFIG_FILE="+conf), nil
+}
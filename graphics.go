@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	gpuHighPerformance = "high-performance"
+	gpuPowerSaving     = "power-saving"
+)
+
+// Graphics defines the graphics switches of an app
+type Graphics struct {
+	// D3D enables or disables the Direct3D pipeline of Java2D on Windows
+	D3D *bool `json:"d3d"`
+	// OpenGL enables or disables the OpenGL pipeline of Java2D
+	OpenGL *bool `json:"opengl"`
+	// UIScale defines the HiDPI scale factor of Java2D, e.g. "1.0"
+	UIScale string `json:"ui-scale"`
+	// GPU selects the preferred GPU on hybrid-GPU machines: "high-performance" or "power-saving"
+	GPU string `json:"gpu"`
+	// Options are further JVM options, e.g. "-Dsun.java2d.noddraw=true"
+	Options []string `json:"options"`
+}
+
+// graphicsOptions returns the JVM options of the graphics switches
+func (l *Launch) graphicsOptions() []string {
+	g := l.App.Graphics
+
+	var options []string
+
+	if g.D3D != nil {
+		options = append(options, "-Dsun.java2d.d3d="+strconv.FormatBool(*g.D3D))
+	}
+
+	if g.OpenGL != nil {
+		options = append(options, "-Dsun.java2d.opengl="+strconv.FormatBool(*g.OpenGL))
+	}
+
+	if g.UIScale != "" {
+		options = append(options, "-Dsun.java2d.uiScale="+g.UIScale)
+	}
+
+	return append(options, g.Options...)
+}
+
+// gpuPreference applies the GPU preference of the app and returns additional environment variables for the JVM
+func (l *Launch) gpuPreference() ([]string, error) {
+	gpu := l.App.Graphics.GPU
+
+	switch gpu {
+	case "":
+		return nil, nil
+	case gpuHighPerformance, gpuPowerSaving:
+	default:
+		return nil, fmt.Errorf("unknown GPU preference %q, use %q or %q", gpu, gpuHighPerformance, gpuPowerSaving)
+	}
+
+	// the OS registers the preference by the absolute path of the executable
+	jre, err := exec.LookPath(l.Jre)
+	if err != nil {
+		return nil, err
+	}
+
+	jre, err = filepath.Abs(jre)
+	if err != nil {
+		return nil, err
+	}
+
+	return applyGPUPreference(jre, gpu)
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import (
+	"github.com/mpetavy/common"
+	"runtime"
+)
+
+// applyGPUPreference selects the GPU by the PRIME render offload variables of Mesa and the NVIDIA driver
+func applyGPUPreference(executable string, gpu string) ([]string, error) {
+	if runtime.GOOS == "darwin" {
+		// macOS switches the GPU by itself, apps which need the discrete GPU declare it in their bundle
+		common.Warn("GPU preference is not supported on macOS")
+
+		return nil, nil
+	}
+
+	if gpu == gpuPowerSaving {
+		return []string{"DRI_PRIME=0"}, nil
+	}
+
+	return []string{"DRI_PRIME=1", "__NV_PRIME_RENDER_OFFLOAD=1", "__GLX_VENDOR_LIBRARY_NAME=nvidia"}, nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+// applyGPUPreference registers the GPU preference of the executable like the Windows graphics settings do
+func applyGPUPreference(executable string, gpu string) ([]string, error) {
+	key, _, err := registry.CreateKey(registry.CURRENT_USER, `Software\Microsoft\DirectX\UserGpuPreferences`, registry.SET_VALUE)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = key.Close()
+	}()
+
+	preference := "GpuPreference=2;"
+	if gpu == gpuPowerSaving {
+		preference = "GpuPreference=1;"
+	}
+
+	return nil, key.SetStringValue(executable, preference)
+}
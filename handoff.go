@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/mpetavy/common"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// handoffParam is the query parameter of protocol handler URLs with the document which is passed to the app
+const handoffParam = "espresso-open"
+
+// protocolURL maps the jnlp:// and jnlps:// URLs of browser protocol handlers to http:// and https:// URLs. A document
+// in the espresso-open query parameter is taken as the file which is opened by the app.
+func protocolURL(address string) (string, error) {
+	scheme, rest, ok := strings.Cut(address, "://")
+	if !ok {
+		return address, nil
+	}
+
+	switch strings.ToLower(scheme) {
+	case "jnlp":
+		scheme = "http"
+	case "jnlps":
+		scheme = "https"
+	default:
+		return address, nil
+	}
+
+	u, err := url.Parse(scheme + "://" + rest)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+
+	if document := query.Get(handoffParam); document != "" {
+		if *openFile == "" {
+			*openFile = document
+		}
+
+		query.Del(handoffParam)
+		u.RawQuery = query.Encode()
+	}
+
+	return u.String(), nil
+}
+
+// decodeDataURL returns the file name and content of a data URL like "data:application/pdf;base64,..."
+func decodeDataURL(dataURL string) (string, []byte, error) {
+	header, data, ok := strings.Cut(strings.TrimPrefix(dataURL, "data:"), ",")
+	if !ok {
+		return "", nil, fmt.Errorf("invalid data URL")
+	}
+
+	params := strings.Split(header, ";")
+	mediatype := params[0]
+
+	name := ""
+	isBase64 := false
+
+	for _, param := range params[1:] {
+		if param == "base64" {
+			isBase64 = true
+
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(param, "name="); ok {
+			name, _ = url.PathUnescape(value)
+		}
+	}
+
+	var content []byte
+	var err error
+
+	if isBase64 {
+		content, err = base64.StdEncoding.DecodeString(data)
+	} else {
+		var text string
+
+		text, err = url.PathUnescape(data)
+		content = []byte(text)
+	}
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	if name == "" {
+		name = "document.bin"
+
+		if extensions, err := mime.ExtensionsByType(mediatype); err == nil && len(extensions) > 0 {
+			name = "document" + extensions[0]
+		}
+	}
+
+	return sanitizeName(filepath.Base(name)), content, nil
+}
+
+// isTempFile reports if the file is located in the temp directory, where browsers store downloaded documents
+func isTempFile(path string) bool {
+	rel, err := filepath.Rel(os.TempDir(), path)
+
+	return err == nil && !strings.HasPrefix(rel, "..")
+}
+
+// stageOpenFile copies the document of a protocol handler launch into the app cache directory, so it survives the
+// browser which removes its temp files. The staged document is removed after the end of the app.
+func (l *Launch) stageOpenFile() error {
+	document := *openFile
+
+	if strings.HasPrefix(document, "file:") {
+		u, err := url.Parse(document)
+		if err != nil {
+			return err
+		}
+
+		document = u.Path
+
+		// file:///C:/docs/a.pdf has the path /C:/docs/a.pdf
+		if len(document) > 2 && document[0] == '/' && document[2] == ':' {
+			document = document[1:]
+		}
+
+		document = filepath.FromSlash(document)
+	}
+
+	isData := strings.HasPrefix(document, "data:")
+
+	if document == "" || (!isData && !isTempFile(document)) {
+		l.openPath = document
+
+		return nil
+	}
+
+	var name string
+	var content []byte
+	var err error
+
+	if isData {
+		name, content, err = decodeDataURL(document)
+	} else {
+		name = filepath.Base(document)
+		content, err = os.ReadFile(document)
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot take over the document of the browser: %w", err)
+	}
+
+	appPath, err := appCachePath(l.Address)
+	if err != nil {
+		return err
+	}
+
+	l.handoff = filepath.Join(appPath, "handoff", l.ID)
+
+	err = os.MkdirAll(l.handoff, common.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
+	l.openPath = filepath.Join(l.handoff, name)
+
+	err = os.WriteFile(l.openPath, content, common.DefaultFileMode)
+	if err != nil {
+		return err
+	}
+
+	// espresso waits for the end of the app to remove the document
+	l.Wait = true
+
+	l.logf("Staged the document %s for the app", l.openPath)
+
+	return nil
+}
+
+// removeHandoff removes the staged document after the end of the app
+func (l *Launch) removeHandoff() {
+	if l.handoff == "" {
+		return
+	}
+
+	common.Error(os.RemoveAll(l.handoff))
+
+	l.handoff = ""
+}
+
+// openOptions returns the app arguments for the file the app is launched with
+func (l *Launch) openOptions() []string {
+	path := l.openPath
+	if path == "" {
+		path = *openFile
+	}
+
+	if path == "" {
+		return nil
+	}
+
+	return []string{"-open", path}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Credentials are the basic auth credentials of a host
+type Credentials struct {
+	Username string
+	Password string
+}
+
+var (
+	credentials      = make(map[string]Credentials)
+	credentialsMutex sync.Mutex
+)
+
+// registerCredentials registers the basic auth credentials for the host of the given URL
+func registerCredentials(address string, username string, password string) error {
+	u, err := url.Parse(address)
+	if err != nil {
+		return err
+	}
+
+	credentialsMutex.Lock()
+	defer credentialsMutex.Unlock()
+
+	credentials[u.Host] = Credentials{
+		Username: username,
+		Password: password,
+	}
+
+	return nil
+}
+
+// httpRequest sends a request, credentials registered for the host are provided via basic auth
+func httpRequest(method string, href string) (*http.Response, error) {
+	return httpRequestBody(method, href, nil)
+}
+
+// httpRequestBody sends a request with the given body, credentials registered for the host are provided via basic auth
+func httpRequestBody(method string, href string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, href, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return httpDo(req)
+}
+
+// httpRequestHeader sends a request with the given additional headers
+func httpRequestHeader(method string, href string, header http.Header) (*http.Response, error) {
+	return httpRequestContext(context.Background(), method, href, header)
+}
+
+// httpRequestContext sends a request with the given additional headers within the context
+func httpRequestContext(ctx context.Context, method string, href string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, href, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	return httpDo(req)
+}
+
+// maxRedirects is the max. number of redirects of a request, like the one of the default HTTP client
+const maxRedirects = 10
+
+// httpClient sends all requests of espresso. It uses the default transport, which has the dialer of configureDialer,
+// and applies the network and HTTPS policies to the targets of redirects as well.
+var httpClient = &http.Client{CheckRedirect: checkRedirect}
+
+// checkRequestURL refuses the URL due to the network policy, plain HTTP URLs are refused or upgraded due to the HTTPS
+// policy
+func checkRequestURL(u *url.URL) error {
+	err := checkNetworkAllowed(u.String())
+	if err != nil {
+		return err
+	}
+
+	return applyHTTPSPolicy(u)
+}
+
+// checkRedirect applies the policies to the target of a redirect, so a redirect from HTTPS to HTTP cannot bypass them
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+
+	err := checkRequestURL(req.URL)
+	if err != nil {
+		return err
+	}
+
+	recordRedirect(req.URL.String())
+
+	return nil
+}
+
+// httpDo sends the request due to the network and HTTPS policies, credentials registered for the host are provided
+// via basic auth
+func httpDo(req *http.Request) (*http.Response, error) {
+	err := checkRequestURL(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialsMutex.Lock()
+	c, ok := credentials[req.URL.Host]
+	credentialsMutex.Unlock()
+
+	if ok {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	return httpClient.Do(req)
+}
+
+// policies for plain HTTP URLs
+const (
+	httpsAllow   = "allow"
+	httpsRequire = "true"
+	httpsUpgrade = "upgrade"
+)
+
+var (
+	httpsPolicy = httpsAllow
+	// upgradedHosts remembers the hosts whose HTTPS support has been verified
+	upgradedHosts = make(map[string]bool)
+	upgradeMutex  sync.Mutex
+)
+
+// setHTTPSPolicy defines how plain HTTP URLs are handled
+func setHTTPSPolicy(policy string) error {
+	switch policy {
+	case "":
+		httpsPolicy = httpsAllow
+	case httpsAllow, httpsRequire, httpsUpgrade:
+		httpsPolicy = policy
+	default:
+		return fmt.Errorf("invalid require-https policy %s, expected true, upgrade or allow", policy)
+	}
+
+	return nil
+}
+
+// applyHTTPSPolicy refuses or upgrades plain HTTP URLs due to the HTTPS policy
+func applyHTTPSPolicy(u *url.URL) error {
+	if u.Scheme != "http" || httpsPolicy == httpsAllow {
+		return nil
+	}
+
+	if httpsPolicy == httpsRequire {
+		logEvent(eventSecurityRejection, fmt.Sprintf("plain HTTP URL %s refused", u))
+
+		return fmt.Errorf("the plain HTTP URL %s is refused, the security policy requires HTTPS", u)
+	}
+
+	upgradeMutex.Lock()
+	defer upgradeMutex.Unlock()
+
+	if !upgradedHosts[u.Host] {
+		// verify that the host supports HTTPS with a valid certificate
+		probe := *u
+		probe.Scheme = "https"
+
+		// the probe follows no redirects, the policy applies to the probed host only
+		client := &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+
+		response, err := client.Head(probe.String())
+		if err != nil {
+			logEvent(eventSecurityRejection, fmt.Sprintf("plain HTTP URL %s refused, HTTPS is not supported", u))
+
+			return fmt.Errorf("the plain HTTP URL %s cannot be upgraded to HTTPS, the security policy requires HTTPS: %w", u, explainTLSError(err))
+		}
+
+		common.Error(response.Body.Close())
+
+		common.Debug(fmt.Sprintf("Host %s is upgraded to HTTPS", u.Host))
+
+		upgradedHosts[u.Host] = true
+	}
+
+	u.Scheme = "https"
+
+	return nil
+}
@@ -0,0 +1,567 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheIndexVersion is the format version of the cache index
+const cacheIndexVersion = 1
+
+// indexMu serializes the transactions on the cache index of this process, the lock file of the index serializes them
+// with other espresso processes
+var indexMu sync.Mutex
+
+// indexBatch collects the index updates of a launch. They are applied to the index read at the start of the batch, so
+// the lookups of the launch see them, and stored in one transaction at its end instead of one per resource.
+var indexBatch struct {
+	sync.Mutex
+	depth   int
+	index   *CacheIndex
+	updates []func(index *CacheIndex) error
+}
+
+// indexKeyWarning reports the missing index key once
+var indexKeyWarning sync.Once
+
+// CacheEntry describes a cached resource
+type CacheEntry struct {
+	URL          string    `json:"url"`
+	FinalURL     string    `json:"final-url,omitempty"`
+	Disposition  string    `json:"content-disposition,omitempty"`
+	Version      string    `json:"version,omitempty"`
+	VersionID    string    `json:"version-id,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last-modified,omitempty"`
+	SHA256       string    `json:"sha256"`
+	Size         int64     `json:"size"`
+	Extracted    int64     `json:"extracted,omitempty"`
+	Downloaded   time.Time `json:"downloaded"`
+	LastUsed     time.Time `json:"last-used"`
+	References   []string  `json:"references,omitempty"`
+}
+
+// CacheIndex is the metadata of all cached resources, keyed by their path relative to the cache directory
+type CacheIndex struct {
+	Version  int                    `json:"version"`
+	Entries  map[string]*CacheEntry `json:"entries"`
+	Checksum string                 `json:"checksum"`
+}
+
+// cacheIndexPath returns the path of the cache index
+func cacheIndexPath() string {
+	return filepath.Join(*cache, "index.json")
+}
+
+// cacheKey returns the index key of a file, files outside of the cache are not indexed
+func cacheKey(filename string) (string, bool) {
+	rel, err := filepath.Rel(*cache, filename)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return filepath.ToSlash(rel), true
+}
+
+// indexKey returns the key of the index signature of the storage, nil if there is no keychain
+func indexKey() []byte {
+	key, err := storage.Key("index")
+	if err != nil {
+		indexKeyWarning.Do(func() {
+			common.Warn(fmt.Sprintf("The cache index is checksummed, but not signed: %v", err))
+		})
+
+		return nil
+	}
+
+	return key
+}
+
+// checksum returns the HMAC-SHA256 over the entries with the index key, which detects a damaged or manually edited
+// index. Without a keychain it is the plain SHA-256, which detects a damaged index only.
+func (index *CacheIndex) checksum() (string, error) {
+	ba, err := json.Marshal(index.Entries)
+	if err != nil {
+		return "", err
+	}
+
+	key := indexKey()
+	if key == nil {
+		hash := sha256.Sum256(ba)
+
+		return hex.EncodeToString(hash[:]), nil
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(ba)
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// readCacheIndex reads the cache index, a missing or damaged index results in an empty one
+func readCacheIndex() (*CacheIndex, error) {
+	index := &CacheIndex{
+		Version: cacheIndexVersion,
+		Entries: make(map[string]*CacheEntry),
+	}
+
+	ba, err := storage.ReadFile(cacheIndexPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+
+		return nil, err
+	}
+
+	stored := &CacheIndex{}
+
+	err = json.Unmarshal(ba, stored)
+	if err == nil && stored.Version != cacheIndexVersion {
+		err = fmt.Errorf("unsupported version %d", stored.Version)
+	}
+
+	if err == nil {
+		var sum string
+
+		sum, err = stored.checksum()
+		if err == nil && !hmac.Equal([]byte(sum), []byte(stored.Checksum)) {
+			err = fmt.Errorf("checksum mismatch")
+		}
+	}
+
+	if err != nil {
+		common.Warn(fmt.Sprintf("Cache index %s is discarded: %v", cacheIndexPath(), err))
+
+		return index, nil
+	}
+
+	if stored.Entries != nil {
+		index.Entries = stored.Entries
+	}
+
+	return index, nil
+}
+
+// writeCacheIndex stores the cache index atomically, readers see either the old or the new index
+func writeCacheIndex(index *CacheIndex) error {
+	sum, err := index.checksum()
+	if err != nil {
+		return err
+	}
+
+	index.Version = cacheIndexVersion
+	index.Checksum = sum
+
+	ba, err := json.MarshalIndent(index, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(cacheIndexPath(), ba)
+}
+
+// updateCacheIndex runs fn as a transaction on the cache index, the index is only stored if fn succeeds
+func updateCacheIndex(fn func(index *CacheIndex) error) error {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	unlock, err := lockFile(cacheIndexPath())
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	index, err := readCacheIndex()
+	if err != nil {
+		return err
+	}
+
+	err = fn(index)
+	if err != nil {
+		return err
+	}
+
+	return writeCacheIndex(index)
+}
+
+// beginIndexBatch starts to collect the index updates, batches may be nested
+func beginIndexBatch() error {
+	indexBatch.Lock()
+	defer indexBatch.Unlock()
+
+	if indexBatch.depth == 0 {
+		index, err := readCacheIndex()
+		if err != nil {
+			return err
+		}
+
+		indexBatch.index = index
+	}
+
+	indexBatch.depth++
+
+	return nil
+}
+
+// endIndexBatch stores the collected index updates in one transaction at the end of the outermost batch. The updates
+// are applied again to the current index, so the changes of other espresso processes are kept.
+func endIndexBatch() error {
+	indexBatch.Lock()
+
+	indexBatch.depth--
+	if indexBatch.depth > 0 {
+		indexBatch.Unlock()
+
+		return nil
+	}
+
+	updates := indexBatch.updates
+
+	indexBatch.index = nil
+	indexBatch.updates = nil
+
+	indexBatch.Unlock()
+
+	if len(updates) == 0 {
+		return nil
+	}
+
+	return updateCacheIndex(func(index *CacheIndex) error {
+		for _, fn := range updates {
+			err := fn(index)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// batchCacheIndex runs fn on the cache index, within a batch it is stored at the end of the batch
+func batchCacheIndex(fn func(index *CacheIndex) error) error {
+	indexBatch.Lock()
+
+	if indexBatch.index == nil {
+		indexBatch.Unlock()
+
+		return updateCacheIndex(fn)
+	}
+
+	defer indexBatch.Unlock()
+
+	err := fn(indexBatch.index)
+	if err != nil {
+		return err
+	}
+
+	indexBatch.updates = append(indexBatch.updates, fn)
+
+	return nil
+}
+
+// lookupCacheEntry returns a copy of the cache index entry of the file, nil if the file is not indexed
+func lookupCacheEntry(filename string) (*CacheEntry, error) {
+	key, ok := cacheKey(filename)
+	if !ok {
+		return nil, nil
+	}
+
+	// the entries of a batch are the current ones
+	indexBatch.Lock()
+	batched := indexBatch.index != nil
+	var entry *CacheEntry
+	if batched {
+		entry = copyEntry(indexBatch.index.Entries[key])
+	}
+	indexBatch.Unlock()
+
+	if batched {
+		return entry, nil
+	}
+
+	index, err := readCacheIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	return index.Entries[key], nil
+}
+
+// copyEntry returns a copy of the entry, so it is not changed by the updates of the batch
+func copyEntry(entry *CacheEntry) *CacheEntry {
+	if entry == nil {
+		return nil
+	}
+
+	c := *entry
+	c.References = slices.Clone(entry.References)
+
+	return &c
+}
+
+// fileHash returns the hex encoded SHA-256 of the file
+func fileHash(filename string) (string, error) {
+	f, err := os.Open(longPath(filename))
+	if err != nil {
+		return "", err
+	}
+
+	// care about closing the file
+	defer func() {
+		common.Error(f.Close())
+	}()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// indexDownload records a downloaded resource with its validators and the SHA-256 computed while downloading
+// in the cache index
+func indexDownload(href string, filename string, response *http.Response, sum string) error {
+	key, ok := cacheKey(filename)
+	if !ok {
+		return nil
+	}
+
+	size, err := common.FileSize(filename)
+	if err != nil {
+		return err
+	}
+
+	return batchCacheIndex(func(index *CacheIndex) error {
+		entry, ok := index.Entries[key]
+		if !ok {
+			entry = &CacheEntry{}
+			index.Entries[key] = entry
+		}
+
+		now := time.Now()
+
+		// the tokens of signed URLs expire and are not kept
+		entry.URL = stripTokens(href)
+		entry.FinalURL = ""
+		entry.Disposition = ""
+
+		// the entry is keyed by the original href, the redirected URL and the server file name are kept for reference
+		if response.Request != nil && response.Request.URL.String() != href {
+			entry.FinalURL = stripTokens(response.Request.URL.String())
+		}
+
+		if _, params, err := mime.ParseMediaType(response.Header.Get("Content-Disposition")); err == nil {
+			entry.Disposition = params["filename"]
+		}
+		entry.ETag = response.Header.Get("ETag")
+		entry.LastModified = response.Header.Get("Last-Modified")
+		entry.Version = ""
+		if u, err := url.Parse(href); err == nil {
+			entry.Version = u.Query().Get("version-id")
+		}
+		entry.VersionID = response.Header.Get(versionIDHeader)
+		entry.SHA256 = sum
+		entry.Size = size
+		entry.Extracted = 0
+		entry.Downloaded = now
+		entry.LastUsed = now
+
+		return nil
+	})
+}
+
+// cachedValidators returns the conditional request headers of a cached resource by the ETag and Last-Modified of the
+// cache index. False is returned for resources without validators or whose entry belongs to another URL. A file which
+// differs from its entry in size, e.g. after an interrupted copy, gets no headers and is downloaded again.
+func cachedValidators(href string, filename string) (http.Header, bool) {
+	header := http.Header{}
+
+	entry, err := lookupCacheEntry(filename)
+	if common.Error(err) || entry == nil || stripTokens(entry.URL) != stripTokens(href) || (entry.ETag == "" && entry.LastModified == "") {
+		return header, false
+	}
+
+	size, err := plainSize(filename)
+	if err != nil || size != entry.Size {
+		return header, true
+	}
+
+	if entry.ETag != "" {
+		header.Set("If-None-Match", entry.ETag)
+	}
+
+	if entry.LastModified != "" {
+		header.Set("If-Modified-Since", entry.LastModified)
+	}
+
+	return header, true
+}
+
+// indexRevalidation records the validators of a 304 response, which may update them, in the cache index
+func indexRevalidation(filename string, response *http.Response) error {
+	key, ok := cacheKey(filename)
+	if !ok {
+		return nil
+	}
+
+	return batchCacheIndex(func(index *CacheIndex) error {
+		entry, ok := index.Entries[key]
+		if !ok {
+			return nil
+		}
+
+		if etag := response.Header.Get("ETag"); etag != "" {
+			entry.ETag = etag
+		}
+
+		if lastModified := response.Header.Get("Last-Modified"); lastModified != "" {
+			entry.LastModified = lastModified
+		}
+
+		return nil
+	})
+}
+
+// indexUsage records the use of a cached resource by the app
+func indexUsage(filename string, address string) error {
+	key, ok := cacheKey(filename)
+	if !ok {
+		return nil
+	}
+
+	return batchCacheIndex(func(index *CacheIndex) error {
+		entry, ok := index.Entries[key]
+		if !ok {
+			return nil
+		}
+
+		entry.LastUsed = time.Now()
+
+		if !slices.Contains(entry.References, address) {
+			entry.References = append(entry.References, address)
+		}
+
+		return nil
+	})
+}
+
+// indexBlob records a file of the content-addressed store, its name is its SHA-256
+func indexBlob(blob string) error {
+	key, ok := cacheKey(blob)
+	if !ok {
+		return nil
+	}
+
+	size, err := common.FileSize(blob)
+	if err != nil {
+		return err
+	}
+
+	return batchCacheIndex(func(index *CacheIndex) error {
+		now := time.Now()
+
+		index.Entries[key] = &CacheEntry{
+			SHA256:     filepath.Base(blob),
+			Size:       size,
+			Downloaded: now,
+			LastUsed:   now,
+		}
+
+		return nil
+	})
+}
+
+// indexExtraction records the disk space used by the extracted content of the archive in its entry
+func indexExtraction(filename string, extracted int64) error {
+	key, ok := cacheKey(filename)
+	if !ok {
+		return nil
+	}
+
+	return batchCacheIndex(func(index *CacheIndex) error {
+		if entry, ok := index.Entries[key]; ok {
+			entry.Extracted = extracted
+		}
+
+		return nil
+	})
+}
+
+// indexedSize returns the disk space, the number of resources and the last use of the indexed resources in the
+// directory of the cache
+func indexedSize(index *CacheIndex, dir string) (int64, int, time.Time) {
+	var size int64
+	var files int
+	var used time.Time
+
+	for key, entry := range index.Entries {
+		if !strings.HasPrefix(key, dir+"/") {
+			continue
+		}
+
+		size += entry.Size + entry.Extracted
+		files++
+
+		if entry.LastUsed.After(used) {
+			used = entry.LastUsed
+		}
+	}
+
+	return size, files, used
+}
+
+// measureExtraction extracts the archive into dest. The disk space added by the extraction, which is not known in
+// advance, is recorded once per download in the entry of the archive.
+func measureExtraction(filename string, dest string, extract func() error) error {
+	entry, err := lookupCacheEntry(filename)
+	if err != nil || entry == nil || entry.Extracted > 0 {
+		return extract()
+	}
+
+	before, err := extractedSize(dest)
+	if err != nil {
+		return err
+	}
+
+	err = extract()
+	if err != nil {
+		return err
+	}
+
+	after, err := extractedSize(dest)
+	if err != nil || after <= before {
+		return err
+	}
+
+	return indexExtraction(filename, after-before)
+}
+
+// extractedSize returns the size of the files in the directory, 0 if it does not exist yet
+func extractedSize(dir string) (int64, error) {
+	size, _, _, err := scanCacheDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	return size, err
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+)
+
+// localeMatch returns how well the locale attribute of an information element matches the locale of the user:
+// 0 for an element without locale, 1 for a matching language, 2 for a matching language and country and -1 otherwise
+func localeMatch(locales string, locale string) int {
+	if strings.TrimSpace(locales) == "" {
+		return 0
+	}
+
+	language, _, _ := strings.Cut(locale, "_")
+
+	match := -1
+
+	// the locale attribute is a list like "de_DE de_AT"
+	for _, candidate := range strings.FieldsFunc(locales, func(r rune) bool {
+		return r == ' ' || r == ','
+	}) {
+		candidate = localeOf(candidate)
+
+		switch {
+		case strings.EqualFold(candidate, locale):
+			return 2
+		case strings.EqualFold(candidate, language):
+			match = 1
+		}
+	}
+
+	return match
+}
+
+// mergeInformation overrides the settings of the information with the ones of the more specific element
+func mergeInformation(information *Information, element Information) {
+	if element.Title != "" {
+		information.Title = element.Title
+	}
+
+	if element.Vendor != "" {
+		information.Vendor = element.Vendor
+	}
+
+	if element.Homepage != "" {
+		information.Homepage = element.Homepage
+	}
+
+	if element.Description != "" {
+		information.Description = element.Description
+	}
+
+	if len(element.Icons) > 0 {
+		information.Icons = element.Icons
+	}
+
+	if element.Shortcut != nil {
+		information.Shortcut = element.Shortcut
+	}
+
+	if len(element.Associations) > 0 {
+		information.Associations = element.Associations
+	}
+
+	if element.OfflineAllowed != nil {
+		information.OfflineAllowed = element.OfflineAllowed
+	}
+}
+
+// localizedInformation merges the information elements of the JNLP file for the locale of the user like Java Web
+// Start: the elements without locale are the defaults, overridden by the ones matching the language and then by the
+// ones matching language and country. Elements of other locales are ignored.
+func localizedInformation(elements []Information, locale string) Information {
+	information := Information{}
+	merged := false
+
+	for level := 0; level <= 2; level++ {
+		for _, element := range elements {
+			if localeMatch(element.Locale, locale) == level {
+				mergeInformation(&information, element)
+
+				merged = true
+			}
+		}
+	}
+
+	// a JNLP file with information elements of other locales only is shown with the first one
+	if !merged && len(elements) > 0 {
+		mergeInformation(&information, elements[0])
+	}
+
+	return information
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// InstallerDesc element of an installer extension
+type InstallerDesc struct {
+	MainClass string `xml:"main-class,attr"`
+}
+
+// Installer is an installer extension of the app
+type Installer struct {
+	URL         string    `json:"url"`
+	Fingerprint string    `json:"fingerprint"`
+	MainClass   string    `json:"mainClass"`
+	Jars        []string  `json:"jars"`
+	Jre         string    `json:"jre"`
+	Installed   time.Time `json:"installed"`
+}
+
+// installerStatePath returns the file which records the executed installers of the app
+func installerStatePath(address string) (string, error) {
+	appPath, err := appCachePath(address)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appPath, "installers.json"), nil
+}
+
+// readInstallers returns the executed installers of the app by their URL
+func readInstallers(address string) (map[string]Installer, error) {
+	installers := make(map[string]Installer)
+
+	path, err := installerStatePath(address)
+	if err != nil {
+		return nil, err
+	}
+
+	ba, err := storage.ReadFile(path)
+	if os.IsNotExist(err) {
+		return installers, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(ba, &installers)
+	if err != nil {
+		return nil, err
+	}
+
+	return installers, nil
+}
+
+// writeInstallers records the executed installers of the app
+func writeInstallers(address string, installers map[string]Installer) error {
+	path, err := installerStatePath(address)
+	if err != nil {
+		return err
+	}
+
+	ba, err := json.MarshalIndent(installers, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, ba)
+}
+
+// lockInstallers serializes the execution of installers and the updates of their records with concurrent launches
+// of the app
+func lockInstallers(address string) (func(), error) {
+	path, err := installerStatePath(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return lockFile(path)
+}
+
+// addInstaller registers the installer extension, its jars are downloaded only if it has not been executed in this version
+func (l *Launch) addInstaller(address string, content []byte, jnlp *Jnlp, u *url.URL, codebase string, appPath string) error {
+	hash := sha256.Sum256(content)
+
+	installer := Installer{
+		URL:         address,
+		Fingerprint: hex.EncodeToString(hash[:]),
+		MainClass:   jnlp.InstallerDesc.MainClass,
+	}
+
+	installed, err := readInstallers(l.Address)
+	if err != nil {
+		return err
+	}
+
+	done := installed[address].Fingerprint == installer.Fingerprint
+
+	for _, resource := range jnlp.Resources {
+		if !l.isSelected(resource.Os, resource.Arch) {
+			continue
+		}
+
+		for _, jar := range resource.Jars {
+			jar.Path = filepath.Join(appPath, hrefPath(jar.Href))
+			jar.URL, err = u.Parse(codebase + "/" + jar.Href)
+			if err != nil {
+				return err
+			}
+
+			l.applyVersionID(&jar)
+
+			installer.Jars = append(installer.Jars, jar.Path)
+
+			if !done {
+				l.addTask(Task{URL: jar.URL.String(), Path: jar.Path})
+			}
+		}
+	}
+
+	if done {
+		l.explain(Decision{Kind: decisionExtension, Href: address, Origin: l.Address, Reason: fmt.Sprintf("installer extension, already executed at %s", installed[address].Installed.Format(time.DateTime))})
+
+		return nil
+	}
+
+	l.explain(Decision{Kind: decisionExtension, Href: address, Origin: l.Address, Included: true, Reason: "installer extension, its main class is executed once with -install before the launch"})
+
+	l.mu.Lock()
+	l.installers = append(l.installers, installer)
+	l.mu.Unlock()
+
+	return nil
+}
+
+// runInstaller executes the main class of the installer with the given argument
+func (l *Launch) runInstaller(installer Installer, jre string, arg string) error {
+	jars := installer.Jars
+
+	// encrypted jars are executed from the staging area
+	if l.staging != "" {
+		jars = nil
+
+		for i, jar := range installer.Jars {
+			if !isEncrypted(jar) {
+				jars = append(jars, jar)
+
+				continue
+			}
+
+			dest := filepath.Join(l.staging, fmt.Sprintf("installer-%d-%s", i, filepath.Base(jar)))
+
+			err := decryptFile(jar, dest)
+			if err != nil {
+				return err
+			}
+
+			jars = append(jars, dest)
+		}
+	}
+
+	mainClass := installer.MainClass
+	if mainClass == "" && len(jars) > 0 {
+		var err error
+
+		mainClass, err = manifestMainClass(jars[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command(jre, fmt.Sprintf("-D%s=%s", launchIDProperty, l.ID), "-cp", strings.Join(jars, string(filepath.ListSeparator)), mainClass, arg)
+
+	l.logf("Installer %s %s", installer.URL, arg)
+
+	ba, err := cmd.CombinedOutput()
+
+	l.logf("Installer output:\n%s", string(ba))
+
+	if err != nil {
+		return fmt.Errorf("installer %s %s failed: %w", installer.URL, arg, err)
+	}
+
+	return nil
+}
+
+// runInstallers executes the pending installers before the launch and records their execution
+func (l *Launch) runInstallers() error {
+	if len(l.installers) == 0 {
+		return nil
+	}
+
+	unlock, err := lockInstallers(l.Address)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	installed, err := readInstallers(l.Address)
+	if err != nil {
+		return err
+	}
+
+	for _, installer := range l.installers {
+		// a concurrent launch of the app may have executed the installer meanwhile
+		if installed[installer.URL].Fingerprint == installer.Fingerprint {
+			continue
+		}
+
+		l.setState("installing")
+
+		err := l.runInstaller(installer, l.Jre, "-install")
+		if err != nil {
+			return err
+		}
+
+		installer.Jre = l.Jre
+		installer.Installed = time.Now()
+
+		installed[installer.URL] = installer
+
+		err = writeInstallers(l.Address, installed)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runUninstall executes the recorded installers of the app with -uninstall
+func runUninstall(cfg *Config, name string) error {
+	l := NewLaunch(cfg, name)
+
+	unlock, err := lockInstallers(l.Address)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	installed, err := readInstallers(l.Address)
+	if err != nil {
+		return err
+	}
+
+	if len(installed) == 0 {
+		return fmt.Errorf("%s has no executed installers", name)
+	}
+
+	err = l.openLogs()
+	if err != nil {
+		return err
+	}
+
+	defer l.closeLogs()
+
+	for address, installer := range installed {
+		err := l.runInstaller(installer, installer.Jre, "-uninstall")
+		if err != nil {
+			return err
+		}
+
+		delete(installed, address)
+
+		err = writeInstallers(l.Address, installed)
+		if err != nil {
+			return err
+		}
+
+		common.Info(fmt.Sprintf("Installer %s is uninstalled", address))
+	}
+
+	return nil
+}
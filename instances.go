@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// instancesPath returns the PID registry directory of the app, each running instance is registered by a file named by its PID
+func instancesPath(address string) (string, error) {
+	appPath, err := appCachePath(address)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appPath, "instances"), nil
+}
+
+// runningInstances returns the PIDs of the running instances of the app, entries of ended processes are removed
+func runningInstances(address string) ([]int, error) {
+	path, err := instancesPath(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return livingInstances(path)
+}
+
+// livingInstances returns the PIDs of the running instances of the PID registry directory, entries of ended processes
+// are removed
+func livingInstances(path string) ([]int, error) {
+	// the removal of stale entries must not race with the registration by a concurrent launch
+	unlock, err := lockFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var pids []int
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		if !processAlive(pid) {
+			common.Debug(fmt.Sprintf("Remove stale instance PID %d", pid))
+
+			common.Error(os.Remove(filepath.Join(path, entry.Name())))
+
+			continue
+		}
+
+		pids = append(pids, pid)
+	}
+
+	return pids, nil
+}
+
+// registerInstance registers the PID of a started instance of the app
+func registerInstance(address string, pid int) error {
+	path, err := instancesPath(address)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	err = os.MkdirAll(path, common.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(path, strconv.Itoa(pid)), nil, common.DefaultFileMode)
+}
+
+// unregisterInstance removes the PID of an ended instance of the app
+func unregisterInstance(address string, pid int) error {
+	path, err := instancesPath(address)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	err = os.Remove(filepath.Join(path, strconv.Itoa(pid)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// checkMaxInstances refuses the launch if the app already runs with its maximum number of concurrent instances
+func (l *Launch) checkMaxInstances() error {
+	if l.App.MaxInstances <= 0 {
+		return nil
+	}
+
+	pids, err := runningInstances(l.Address)
+	if err != nil {
+		return err
+	}
+
+	if len(pids) >= l.App.MaxInstances {
+		return fmt.Errorf("%s is already running with %d of max. %d instances (PID %v)", l.Address, len(pids), l.App.MaxInstances, pids)
+	}
+
+	return nil
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"github.com/mpetavy/common"
+	"hash"
+	"io"
+	"math/big"
+	"path"
+	"strings"
+	"time"
+)
+
+// PKCS#7 structures of the signature block files of signed jars
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue     `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue     `asn1:"optional,tag:1"`
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+type pkcs7IssuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type pkcs7SignerInfo struct {
+	Version                   int
+	IssuerAndSerial           pkcs7IssuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type pkcs7Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+var (
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	// digestOIDs are the supported digest algorithms of the signature blocks
+	digestOIDs = map[string]crypto.Hash{
+		"1.3.14.3.2.26":          crypto.SHA1,
+		"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+		"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+		"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+	}
+)
+
+// manifestDigests are the digest attributes of manifest and signature files by their name prefix
+var manifestDigests = map[string]func() hash.Hash{
+	"SHA-512": sha512.New,
+	"SHA-384": sha512.New384,
+	"SHA-256": sha256.New,
+	"SHA-1":   sha1.New,
+	"SHA1":    sha1.New,
+}
+
+// manifestSection is a section of a manifest or signature file with its raw bytes
+type manifestSection struct {
+	raw        []byte
+	attributes map[string]string
+}
+
+// parseManifestSections splits the manifest into its sections, the raw bytes include the terminating empty line
+func parseManifestSections(content []byte) []manifestSection {
+	var sections []manifestSection
+
+	current := manifestSection{attributes: make(map[string]string)}
+	start := 0
+	key := ""
+
+	for pos := 0; pos < len(content); {
+		end := bytes.IndexByte(content[pos:], '\n')
+		if end == -1 {
+			end = len(content)
+		} else {
+			end += pos + 1
+		}
+
+		line := strings.TrimRight(string(content[pos:end]), "\r\n")
+		pos = end
+
+		switch {
+		case line == "":
+			current.raw = content[start:pos]
+			sections = append(sections, current)
+
+			current = manifestSection{attributes: make(map[string]string)}
+			start = pos
+			key = ""
+		case strings.HasPrefix(line, " ") && key != "":
+			current.attributes[key] += line[1:]
+		default:
+			name, value, _ := strings.Cut(line, ":")
+
+			key = strings.TrimSpace(name)
+			current.attributes[key] = strings.TrimSpace(value)
+		}
+	}
+
+	if start < len(content) {
+		current.raw = content[start:]
+		sections = append(sections, current)
+	}
+
+	return sections
+}
+
+// checkDigests checks the digest attributes of the section against the content, at least one digest must be present
+func checkDigests(attributes map[string]string, suffix string, content []byte) (bool, error) {
+	found := false
+
+	for name, newHash := range manifestDigests {
+		value, ok := attributes[name+suffix]
+		if !ok {
+			continue
+		}
+
+		expected, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return false, err
+		}
+
+		h := newHash()
+		h.Write(content)
+
+		if !bytes.Equal(h.Sum(nil), expected) {
+			return false, nil
+		}
+
+		found = true
+	}
+
+	return found, nil
+}
+
+// verifySignatureBlock verifies the PKCS#7 signature block of the signature file and returns the signer certificates
+func verifySignatureBlock(block []byte, sf []byte) ([]*x509.Certificate, error) {
+	info := pkcs7ContentInfo{}
+
+	_, err := asn1.Unmarshal(block, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	signedData := pkcs7SignedData{}
+
+	_, err = asn1.Unmarshal(info.Content.Bytes, &signedData)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := x509.ParseCertificates(signedData.Certificates.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(signedData.SignerInfos) == 0 {
+		return nil, fmt.Errorf("no signer")
+	}
+
+	signer := signedData.SignerInfos[0]
+
+	var leaf *x509.Certificate
+
+	for _, cert := range certs {
+		if cert.SerialNumber.Cmp(signer.IssuerAndSerial.SerialNumber) == 0 && bytes.Equal(cert.RawIssuer, signer.IssuerAndSerial.Issuer.FullBytes) {
+			leaf = cert
+		}
+	}
+
+	if leaf == nil {
+		return nil, fmt.Errorf("the certificate of the signer is missing")
+	}
+
+	digest, ok := digestOIDs[signer.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported digest algorithm %s", signer.DigestAlgorithm.Algorithm)
+	}
+
+	signed := sf
+
+	// with authenticated attributes the signature covers the attributes, which contain the digest of the signature file
+	if len(signer.AuthenticatedAttributes.FullBytes) > 0 {
+		var attributes []pkcs7Attribute
+
+		_, err = asn1.UnmarshalWithParams(signer.AuthenticatedAttributes.FullBytes, &attributes, "set,tag:0")
+		if err != nil {
+			return nil, err
+		}
+
+		h := digest.New()
+		h.Write(sf)
+
+		matched := false
+
+		for _, attribute := range attributes {
+			if !attribute.Type.Equal(oidMessageDigest) {
+				continue
+			}
+
+			var value []byte
+
+			_, err = asn1.Unmarshal(attribute.Values.Bytes, &value)
+			if err != nil {
+				return nil, err
+			}
+
+			matched = bytes.Equal(value, h.Sum(nil))
+		}
+
+		if !matched {
+			return nil, fmt.Errorf("the signature file does not match its signature")
+		}
+
+		signed = append([]byte{}, signer.AuthenticatedAttributes.FullBytes...)
+		signed[0] = 0x31 // the signature is calculated over the attributes tagged as SET
+	}
+
+	algorithm, err := signatureAlgorithm(leaf.PublicKeyAlgorithm, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	err = leaf.CheckSignature(algorithm, signed, signer.EncryptedDigest)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]*x509.Certificate{leaf}, certs...), nil
+}
+
+// signatureAlgorithm returns the x509 signature algorithm of the key and digest
+func signatureAlgorithm(key x509.PublicKeyAlgorithm, digest crypto.Hash) (x509.SignatureAlgorithm, error) {
+	algorithms := map[x509.PublicKeyAlgorithm]map[crypto.Hash]x509.SignatureAlgorithm{
+		x509.RSA: {
+			crypto.SHA1:   x509.SHA1WithRSA,
+			crypto.SHA256: x509.SHA256WithRSA,
+			crypto.SHA384: x509.SHA384WithRSA,
+			crypto.SHA512: x509.SHA512WithRSA,
+		},
+		x509.ECDSA: {
+			crypto.SHA1:   x509.ECDSAWithSHA1,
+			crypto.SHA256: x509.ECDSAWithSHA256,
+			crypto.SHA384: x509.ECDSAWithSHA384,
+			crypto.SHA512: x509.ECDSAWithSHA512,
+		},
+	}
+
+	algorithm, ok := algorithms[key][digest]
+	if !ok {
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signature algorithm %v with %v", key, digest)
+	}
+
+	return algorithm, nil
+}
+
+// verifyCertificate checks the validity of the signer certificate, tolerating the clock skew, and its chain
+// to a code signing root of the OS
+func verifyCertificate(certs []*x509.Certificate) error {
+	leaf := certs[0]
+
+	if !validAt(leaf.NotBefore, leaf.NotAfter) {
+		return fmt.Errorf("the certificate of %q is valid from %s to %s only", leaf.Subject.CommonName, leaf.NotBefore.Format(time.DateOnly), leaf.NotAfter.Format(time.DateOnly))
+	}
+
+	// the chain is verified at a time the leaf is valid, the clock skew is already tolerated above
+	at := time.Now()
+	if at.Before(leaf.NotBefore) {
+		at = leaf.NotBefore
+	}
+	if at.After(leaf.NotAfter) {
+		at = leaf.NotAfter
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return fmt.Errorf("the certificate of %q is not trusted: %w", leaf.Subject.CommonName, err)
+	}
+
+	return nil
+}
+
+// isSignatureFile reports if the jar entry belongs to the signature and is not covered by it
+func isSignatureFile(name string) bool {
+	upper := strings.ToUpper(name)
+
+	if upper == manifestName {
+		return true
+	}
+
+	if !strings.HasPrefix(upper, "META-INF/") || strings.Contains(upper[len("META-INF/"):], "/") {
+		return false
+	}
+
+	switch path.Ext(upper) {
+	case ".SF", ".RSA", ".DSA", ".EC":
+		return true
+	}
+
+	return strings.HasPrefix(upper, "META-INF/SIG-")
+}
+
+// verifyJar verifies the signature of the jar: every entry must be covered by the manifest digests, the manifest
+// by the signature file and the signature file by the signature block of a trusted certificate.
+// The certificate of the signer is returned.
+func verifyJar(filename string) (*x509.Certificate, error) {
+	content, err := readPlain(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range r.File {
+		files[strings.ToUpper(f.Name)] = f
+	}
+
+	read := func(f *zip.File) ([]byte, error) {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		defer func() {
+			common.Error(rc.Close())
+		}()
+
+		return io.ReadAll(rc)
+	}
+
+	mf, ok := files[manifestName]
+	if !ok {
+		return nil, fmt.Errorf("%s is not signed", filename)
+	}
+
+	manifest, err := read(mf)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := parseManifestSections(manifest)
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("%s is not signed", filename)
+	}
+
+	// the digests of the manifest entries
+	entries := make(map[string]manifestSection)
+	for _, section := range sections {
+		if name, ok := section.attributes["Name"]; ok {
+			entries[name] = section
+		}
+	}
+
+	var signer []*x509.Certificate
+
+	// the manifest entries covered by the signature file, nil if it covers the whole manifest
+	var covered map[string]bool
+
+	for name, f := range files {
+		if !strings.HasPrefix(name, "META-INF/") || path.Ext(name) != ".SF" || signer != nil {
+			continue
+		}
+
+		sf, err := read(f)
+		if err != nil {
+			return nil, err
+		}
+
+		base := strings.TrimSuffix(name, ".SF")
+
+		var block *zip.File
+		for _, ext := range []string{".RSA", ".EC", ".DSA"} {
+			if b, ok := files[base+ext]; ok {
+				block = b
+			}
+		}
+
+		if block == nil {
+			return nil, fmt.Errorf("%s: the signature block of %s is missing", filename, f.Name)
+		}
+
+		ba, err := read(block)
+		if err != nil {
+			return nil, err
+		}
+
+		certs, err := verifySignatureBlock(ba, sf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid signature %s: %w", filename, block.Name, err)
+		}
+
+		sfSections := parseManifestSections(sf)
+		if len(sfSections) == 0 {
+			return nil, fmt.Errorf("%s: %s is empty", filename, f.Name)
+		}
+
+		// the signature file covers the whole manifest or each of its sections
+		ok, err := checkDigests(sfSections[0].attributes, "-Digest-Manifest", manifest)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			// the main attributes like Permissions or Trusted-Library must be signed as well
+			ok, err := checkDigests(sfSections[0].attributes, "-Digest-Manifest-Main-Attributes", sections[0].raw)
+			if err != nil {
+				return nil, err
+			}
+
+			if !ok {
+				return nil, fmt.Errorf("%s: the main attributes of the manifest are not signed or were modified after signing", filename)
+			}
+
+			raw := make(map[string][]byte)
+			for _, section := range sections {
+				if name, ok := section.attributes["Name"]; ok {
+					raw[name] = section.raw
+				}
+			}
+
+			covered = make(map[string]bool)
+
+			for _, section := range sfSections[1:] {
+				name := section.attributes["Name"]
+
+				ok, err := checkDigests(section.attributes, "-Digest", raw[name])
+				if err != nil {
+					return nil, err
+				}
+
+				if !ok {
+					return nil, fmt.Errorf("%s: the manifest entry of %s was modified after signing", filename, name)
+				}
+
+				covered[name] = true
+			}
+		}
+
+		signer = certs
+	}
+
+	if signer == nil {
+		return nil, fmt.Errorf("%s is not signed", filename)
+	}
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || isSignatureFile(f.Name) {
+			continue
+		}
+
+		section, ok := entries[f.Name]
+		if !ok || (covered != nil && !covered[f.Name]) {
+			return nil, fmt.Errorf("%s: %s is not signed", filename, f.Name)
+		}
+
+		ba, err := read(f)
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err = checkDigests(section.attributes, "-Digest", ba)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("%s: %s was modified after signing", filename, f.Name)
+		}
+	}
+
+	err = verifyCertificate(signer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	return signer[0], nil
+}
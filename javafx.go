@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// OpenJFX SDKs which run on the JRE of the launch, the latest ones require Java 17
+const (
+	javafxVersionJava11 = "17.0.13"
+	javafxVersionJava17 = "21.0.5"
+)
+
+// defaultJavaFXURL is the download of the OpenJFX SDKs by Gluon
+const defaultJavaFXURL = "https://download2.gluonhq.com/openjfx/{version}/openjfx-{version}_{os}-{arch}_bin-sdk.zip"
+
+// JavaFXConfig defines the OpenJFX SDK used for JavaFX apps on JREs without JavaFX
+type JavaFXConfig struct {
+	// Version of the OpenJFX SDK, by default the latest one supported by the JRE
+	Version string `json:"version"`
+	// URL of the SDK archive, "{version}", "{os}" and "{arch}" are replaced. A mirror of the IT department may be used.
+	URL string `json:"url"`
+	// Modules are added with --add-modules, by default all modules of the SDK
+	Modules []string `json:"modules"`
+}
+
+// JavafxRuntime element of the JavaFX extension (jfx:javafx-runtime) which requires the JavaFX runtime
+type JavafxRuntime struct {
+	Version string `xml:"version,attr"`
+	Href    string `xml:"href,attr"`
+}
+
+// JavafxDesc element of the JavaFX extension (jfx:javafx-desc) which describes a JavaFX app
+type JavafxDesc struct {
+	MainClass      string `xml:"main-class,attr"`
+	PreloaderClass string `xml:"preloader-class,attr"`
+	Name           string `xml:"name,attr"`
+}
+
+// javafxPlatform returns the OS and architecture names of the OpenJFX SDKs for this machine
+func javafxPlatform() (string, string, error) {
+	var osName, archName string
+
+	switch runtime.GOOS {
+	case "linux":
+		osName = "linux"
+	case "darwin":
+		osName = "osx"
+	case "windows":
+		osName = "windows"
+	}
+
+	switch runtime.GOARCH {
+	case "amd64":
+		archName = "x64"
+	case "arm64":
+		archName = "aarch64"
+	case "386":
+		if runtime.GOOS == "windows" {
+			archName = "x86"
+		}
+	}
+
+	if osName == "" || archName == "" {
+		return "", "", fmt.Errorf("there is no OpenJFX SDK for %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+
+	return osName, archName, nil
+}
+
+// jreHasJavaFX reports if the JRE in home ships JavaFX, like Oracle Java 8 or the "full" builds of Liberica and Zulu
+func jreHasJavaFX(home string) bool {
+	if common.FileExists(filepath.Join(home, "lib", "jfxrt.jar")) || common.FileExists(filepath.Join(home, "lib", "ext", "jfxrt.jar")) || common.FileExists(filepath.Join(home, "jre", "lib", "ext", "jfxrt.jar")) {
+		return true
+	}
+
+	f, err := os.Open(filepath.Join(home, "release"))
+	if err != nil {
+		return false
+	}
+
+	defer func() {
+		common.Error(f.Close())
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "MODULES="); ok {
+			return strings.Contains(value, "javafx.base")
+		}
+	}
+
+	return false
+}
+
+// requiresJavaFX reports if the JNLP declares a JavaFX runtime or describes a JavaFX app
+func (l *Launch) requiresJavaFX(jnlp *Jnlp) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.javafxRuntime != "" || jnlp.JavafxDesc != nil
+}
+
+// resolveJavaFX registers the download of the OpenJFX SDK if the app needs JavaFX and the JRE does not ship it. The
+// JRE of a private JRE is not downloaded yet, so its JavaFX is checked again for the command line.
+func (l *Launch) resolveJavaFX(jnlp *Jnlp) error {
+	if !l.requiresJavaFX(jnlp) {
+		return nil
+	}
+
+	href := l.javafxRuntime
+	if href == "" {
+		href = "javafx-desc"
+	}
+
+	home, err := l.jreHome()
+	if err == nil && jreHasJavaFX(home) {
+		l.explain(Decision{Kind: decisionJavaFX, Href: href, Origin: l.Address, Reason: fmt.Sprintf("the JRE in %s ships JavaFX", home)})
+
+		return nil
+	}
+
+	version := l.Config.JavaFX.Version
+	if version == "" {
+		version = javafxVersionJava11
+
+		if major, err := l.jreMajorVersion(); err == nil {
+			if major < 11 {
+				return fmt.Errorf("%s is a JavaFX app, but the JRE %s has version %d without JavaFX. Use a JRE with JavaFX or Java 11 and later", l.Address, l.Jre, major)
+			}
+
+			if major >= 17 {
+				version = javafxVersionJava17
+			}
+		}
+	}
+
+	osName, archName, err := javafxPlatform()
+	if err != nil {
+		return err
+	}
+
+	address := l.Config.JavaFX.URL
+	if address == "" {
+		address = defaultJavaFXURL
+	}
+
+	address = strings.NewReplacer("{version}", version, "{os}", osName, "{arch}", archName).Replace(address)
+
+	dir := filepath.Join(*cache, "javafx", version, osName+"-"+archName)
+
+	l.mu.Lock()
+	l.javafxPath = dir
+	l.mu.Unlock()
+
+	l.explain(Decision{Kind: decisionJavaFX, Href: address, Origin: l.Address, Path: dir, Included: true, Reason: fmt.Sprintf("the app requires JavaFX %s, which the JRE does not ship", l.javafxRuntime)})
+	l.logf("JavaFX runtime: OpenJFX SDK %s of %s", version, address)
+
+	// the SDK is shared by all JavaFX apps
+	l.addTask(Task{URL: address, Path: filepath.Join(dir, filepath.Base(hrefPath(address))), Unzip: true})
+
+	return nil
+}
+
+// javafxOptions returns the JVM options which add the modules of the downloaded OpenJFX SDK
+func (l *Launch) javafxOptions() ([]string, error) {
+	if l.javafxPath == "" {
+		return nil, nil
+	}
+
+	// a private JRE may ship JavaFX itself
+	if home, err := l.jreHome(); err == nil && jreHasJavaFX(home) {
+		return nil, nil
+	}
+
+	// the archive contains the directory "javafx-sdk-<version>"
+	matches, err := filepath.Glob(filepath.Join(l.javafxPath, "*", "lib", "javafx.base.jar"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("the OpenJFX SDK in %s has no JavaFX modules", l.javafxPath)
+	}
+
+	modules := "ALL-MODULE-PATH"
+	if len(l.Config.JavaFX.Modules) > 0 {
+		modules = strings.Join(l.Config.JavaFX.Modules, ",")
+	}
+
+	return []string{"--module-path", filepath.Dir(matches[0]), "--add-modules", modules}, nil
+}
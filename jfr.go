@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// JFR defines the Java Flight Recorder settings of an app
+type JFR struct {
+	Enabled bool `json:"enabled"`
+	// Settings is the JFR settings file like "default" or "profile"
+	Settings string `json:"settings"`
+	// UploadURL receives the recording via HTTP PUT after the app has ended in wait mode
+	UploadURL string `json:"upload-url"`
+}
+
+// jfrOptions returns the JVM options which start the flight recording into the app log directory
+func (l *Launch) jfrOptions() ([]string, error) {
+	if !l.JFR && !l.App.JFR.Enabled {
+		return nil, nil
+	}
+
+	logPath, err := appLogPath(l.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(logPath, common.DefaultDirMode)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := l.App.JFR.Settings
+	if settings == "" {
+		settings = "default"
+	}
+
+	l.jfrRecording = filepath.Join(logPath, fmt.Sprintf("recording-%s.jfr", time.Now().Format("20060102-150405")))
+
+	if l.App.JFR.UploadURL != "" && !l.Wait && !l.Console {
+		common.Warn("The JFR recording is only uploaded in wait mode")
+	}
+
+	return []string{fmt.Sprintf("-XX:StartFlightRecording=filename=%s,settings=%s,dumponexit=true", l.jfrRecording, settings)}, nil
+}
+
+// uploadRecording uploads the JFR recording to the configured URL
+func (l *Launch) uploadRecording() error {
+	if l.jfrRecording == "" || l.App.JFR.UploadURL == "" || !common.FileExists(l.jfrRecording) {
+		return nil
+	}
+
+	err := l.checkOffline(l.App.JFR.UploadURL)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(l.jfrRecording)
+	if err != nil {
+		return err
+	}
+
+	// care about closing the recording file
+	defer func() {
+		common.Error(f.Close())
+	}()
+
+	href := l.App.JFR.UploadURL + "/" + filepath.Base(l.jfrRecording)
+
+	common.Debug(fmt.Sprintf("Upload JFR recording %s --> %s", l.jfrRecording, href))
+
+	response, err := httpRequestBody(http.MethodPut, href, f)
+	if err != nil {
+		return err
+	}
+
+	common.Error(response.Body.Close())
+
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("cannot upload JFR recording to %s: %s", href, response.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// handling of risky changes of JNLP files
+const (
+	jnlpChangesWarn    = "warn"
+	jnlpChangesConfirm = "confirm"
+	jnlpChangesRefuse  = "refuse"
+)
+
+// jnlpHistoryPath returns the directory of the historical versions of the JNLP file in the app cache directory
+func jnlpHistoryPath(app string, address string) (string, error) {
+	appPath, err := appCachePath(app)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appPath, "history", sanitizeName(address)), nil
+}
+
+// jnlpHistory returns the files of the historical versions of the JNLP file, the oldest first
+func jnlpHistory(path string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(path, "*.jnlp"))
+	if err != nil {
+		return nil, err
+	}
+
+	// the names start with the timestamp
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// codebaseHost returns the scheme and host of the codebase of the JNLP file
+func codebaseHost(jnlp *Jnlp, location string) (string, string) {
+	u, err := url.Parse(jnlpCodebase(jnlp, location))
+	if err != nil {
+		return "", ""
+	}
+
+	return u.Scheme, u.Hostname()
+}
+
+// mainClass returns the main class of the application, JavaFX app or applet
+func mainClass(jnlp *Jnlp) string {
+	if jnlp.ApplicationDesc.MainClass != "" {
+		return jnlp.ApplicationDesc.MainClass
+	}
+
+	if jnlp.JavafxDesc != nil && jnlp.JavafxDesc.MainClass != "" {
+		return jnlp.JavafxDesc.MainClass
+	}
+
+	return jnlp.AppletDesc.MainClass
+}
+
+// riskyChanges returns the changes of the JNLP file which a compromised deployment server would make
+func riskyChanges(previous *Jnlp, current *Jnlp, location string) []string {
+	var changes []string
+
+	if mainClass(previous) != mainClass(current) {
+		changes = append(changes, fmt.Sprintf("the main class has changed from %q to %q", mainClass(previous), mainClass(current)))
+	}
+
+	previousScheme, previousHost := codebaseHost(previous, location)
+	currentScheme, currentHost := codebaseHost(current, location)
+
+	if normalizeHost(previousHost) != normalizeHost(currentHost) {
+		changes = append(changes, fmt.Sprintf("the codebase host has changed from %q to %q", previousHost, currentHost))
+	}
+
+	if previousScheme == "https" && currentScheme == "http" {
+		changes = append(changes, "the codebase has changed from HTTPS to plain HTTP")
+	}
+
+	if !requestsPermissions(previous) && requestsPermissions(current) {
+		changes = append(changes, "the app requests all-permissions instead of the sandbox")
+	}
+
+	return changes
+}
+
+// checkJnlpHistory compares the JNLP file with its last version and keeps it in the history. Risky changes are
+// reported, confirmed or refused due to security.jnlp-changes of the config.
+func (l *Launch) checkJnlpHistory(address string, location string, content []byte, jnlp *Jnlp) error {
+	if l.replay != nil || !l.offline || *jnlpHistoryMax <= 0 {
+		return nil
+	}
+
+	path, err := jnlpHistoryPath(l.Address, address)
+	if err != nil {
+		return err
+	}
+
+	files, err := jnlpHistory(path)
+	if err != nil {
+		return err
+	}
+
+	if len(files) > 0 {
+		last := files[len(files)-1]
+
+		ba, err := storage.ReadFile(last)
+		if err != nil {
+			return err
+		}
+
+		if string(ba) == string(content) {
+			return nil
+		}
+
+		previous, err := parseJnlp(ba)
+		if err != nil {
+			common.Warn(fmt.Sprintf("Invalid historical JNLP file %s: %v", last, err))
+		} else if changes := riskyChanges(previous, jnlp, location); len(changes) > 0 {
+			err = l.acceptJnlpChanges(address, changes)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = os.MkdirAll(path, common.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
+	// concurrent launches of the app record and prune the history one after the other
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	name := fmt.Sprintf("%s-%s.jnlp", time.Now().UTC().Format("20060102T150405.000000000"), sha256Hex(content)[:8])
+
+	err = writeFileAtomic(filepath.Join(path, name), content)
+	if err != nil {
+		return err
+	}
+
+	// only the last versions are kept, including the ones recorded meanwhile by other launches
+	files, err = jnlpHistory(path)
+	if err != nil {
+		return err
+	}
+
+	for len(files) > *jnlpHistoryMax {
+		common.Error(os.Remove(files[0]))
+
+		files = files[1:]
+	}
+
+	return nil
+}
+
+// acceptJnlpChanges reports the risky changes of the JNLP file and asks for a confirmation or refuses them
+func (l *Launch) acceptJnlpChanges(address string, changes []string) error {
+	message := fmt.Sprintf("The JNLP file %s has changed in a risky way: %s", address, strings.Join(changes, ", "))
+
+	logEvent(eventJnlpChange, message)
+	l.logf("%s", message)
+
+	switch mode := l.Config.Security.JnlpChanges; mode {
+	case "", jnlpChangesWarn:
+		common.Warn(message)
+
+		return nil
+	case jnlpChangesConfirm:
+		ok, err := confirm("espresso", message+". Do you want to launch the changed app?")
+		if err != nil {
+			return fmt.Errorf("%s, but it cannot be confirmed: %w", message, err)
+		}
+
+		if !ok {
+			return fmt.Errorf("%s, the launch has been cancelled", message)
+		}
+
+		return nil
+	case jnlpChangesRefuse:
+		logEvent(eventSecurityRejection, message)
+
+		return fmt.Errorf("%s, the launch is refused", message)
+	default:
+		return fmt.Errorf("invalid security.jnlp-changes %q, use %s, %s or %s", mode, jnlpChangesWarn, jnlpChangesConfirm, jnlpChangesRefuse)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// jreResolverTimeout is the max. time of the JRE resolver command
+const jreResolverTimeout = 30 * time.Second
+
+// JreConfig defines the selection of the JRE of apps without a private JRE and without -jre
+type JreConfig struct {
+	// ResolverCmd is the command which returns the java executable for the j2se requirements of the app
+	ResolverCmd string `json:"resolver-cmd"`
+}
+
+// JreRequest are the j2se requirements of the app which are passed to the JRE resolver command as JSON
+type JreRequest struct {
+	URL        string   `json:"url"`
+	OS         string   `json:"os"`
+	Arch       string   `json:"arch"`
+	Versions   []string `json:"versions"`
+	Executable string   `json:"executable"`
+}
+
+// runJreResolver asks the JRE resolver command of the config once for the java executable, true is returned if the
+// resolver selected it. A failed resolver or one which returns nothing leaves the selection to the installed JREs.
+func (l *Launch) runJreResolver(versions []string) bool {
+	command := strings.Fields(l.Config.Jre.ResolverCmd)
+	if len(command) == 0 || l.jreResolved {
+		return false
+	}
+
+	l.jreResolved = true
+
+	java, err := l.resolveJre(command, versions)
+	if err != nil {
+		common.Warn(fmt.Sprintf("JRE resolver %s failed, the installed JREs are used: %v", command[0], err))
+
+		return false
+	}
+
+	if java == "" {
+		common.Debug(fmt.Sprintf("JRE resolver %s returned no JRE for the j2se versions %q", command[0], strings.Join(versions, ", ")))
+
+		return false
+	}
+
+	reason := fmt.Sprintf("selected by the JRE resolver %s", command[0])
+
+	// a JRE of another version than requested is used as the organization decided, but reported
+	if len(versions) > 0 {
+		version, err := jreVersion(filepath.Dir(filepath.Dir(java)))
+
+		switch {
+		case err != nil:
+		case !matchesJ2seVersion(version, strings.Join(versions, " ")):
+			common.Warn(fmt.Sprintf("The JRE %s of the JRE resolver has the version %s which does not match the j2se versions %q", java, version, strings.Join(versions, ", ")))
+		default:
+			reason = fmt.Sprintf("JRE %s selected by the JRE resolver %s for the j2se version %q", version, command[0], strings.Join(versions, ", "))
+		}
+	}
+
+	l.setJre(java, reason)
+
+	return true
+}
+
+// resolveJre runs the JRE resolver command with the requirements as JSON on stdin. The resolver writes the path of
+// the java executable or of the JRE home directory to stdout, nothing if it has no JRE.
+func (l *Launch) resolveJre(command []string, versions []string) (string, error) {
+	request, err := json.Marshal(JreRequest{
+		URL:        l.Address,
+		OS:         l.OS,
+		Arch:       l.Arch,
+		Versions:   append([]string{}, versions...),
+		Executable: javaExecutable(l.Console),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jreResolverTimeout)
+	defer cancel()
+
+	stderr := &bytes.Buffer{}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stderr = stderr
+
+	ba, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+
+		return "", err
+	}
+
+	java, _, _ := strings.Cut(strings.TrimSpace(string(ba)), "\n")
+	java = strings.TrimSpace(java)
+
+	if java == "" {
+		return "", nil
+	}
+
+	// a JRE home directory is resolved to its java executable
+	if info, err := os.Stat(java); err == nil && info.IsDir() {
+		java = filepath.Join(java, "bin", javaExecutable(l.Console))
+	}
+
+	_, err = exec.LookPath(java)
+	if err != nil {
+		return "", fmt.Errorf("the returned java executable %s is not usable: %w", java, err)
+	}
+
+	return java, nil
+}
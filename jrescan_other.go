@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import (
+	"path/filepath"
+)
+
+// osJreHomes returns the homes of the JREs installed at the default locations of Linux and macOS
+func osJreHomes() []string {
+	var homes []string
+
+	for _, pattern := range []string{"/usr/lib/jvm/*", "/usr/java/*", "/Library/Java/JavaVirtualMachines/*/Contents/Home"} {
+		matches, _ := filepath.Glob(pattern)
+
+		homes = append(homes, matches...)
+	}
+
+	return homes
+}
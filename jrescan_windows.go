@@ -0,0 +1,37 @@
+package main
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+// osJreHomes returns the homes of the JREs registered in the Windows registry
+func osJreHomes() []string {
+	var homes []string
+
+	for _, name := range []string{"Java Runtime Environment", "JRE", "Java Development Kit", "JDK"} {
+		key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\JavaSoft\`+name, registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
+		}
+
+		versions, _ := key.ReadSubKeyNames(-1)
+
+		_ = key.Close()
+
+		for _, version := range versions {
+			sub, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\JavaSoft\`+name+`\`+version, registry.QUERY_VALUE)
+			if err != nil {
+				continue
+			}
+
+			home, _, err := sub.GetStringValue("JavaHome")
+			if err == nil && home != "" {
+				homes = append(homes, home)
+			}
+
+			_ = sub.Close()
+		}
+	}
+
+	return homes
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// InstalledJre is a JRE found on the machine
+type InstalledJre struct {
+	Home    string
+	Version string
+}
+
+// versionOutput matches the version in the output of "java -version"
+var versionOutput = regexp.MustCompile(`version "([^"]+)"`)
+
+// matchesJ2seRange checks the version against a single range of a JNLP version string: "1.8" and "1.8*" match
+// all versions starting with 1.8, "1.8+" matches 1.8 and all later versions, "a&b" must match a and b
+func matchesJ2seRange(version string, spec string) bool {
+	for _, part := range strings.Split(spec, "&") {
+		if part == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasSuffix(part, "+"):
+			if compareVersions(version, strings.TrimSuffix(part, "+")) < 0 {
+				return false
+			}
+		default:
+			prefix := splitVersion(strings.TrimSuffix(part, "*"))
+			parts := splitVersion(version)
+
+			if len(prefix) == 0 || len(parts) < len(prefix) {
+				return false
+			}
+
+			if compareVersions(strings.Join(parts[:len(prefix)], "."), strings.Join(prefix, ".")) != 0 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// matchesJ2seVersion checks the version against a JNLP version string like "1.8+ 11", one of the ranges must match
+func matchesJ2seVersion(version string, spec string) bool {
+	for _, r := range strings.Fields(spec) {
+		if matchesJ2seRange(version, r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jreVersion returns the version of the JRE in home, taken from its "release" file or by running "java -version"
+func jreVersion(home string) (string, error) {
+	f, err := os.Open(filepath.Join(home, "release"))
+	if err == nil {
+		defer func() {
+			common.Error(f.Close())
+		}()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if value, ok := strings.CutPrefix(scanner.Text(), "JAVA_VERSION="); ok {
+				return strings.Trim(value, `"`), nil
+			}
+		}
+	}
+
+	ba, err := exec.Command(filepath.Join(home, "bin", "java"), "-version").CombinedOutput()
+	if err != nil {
+		return "", err
+	}
+
+	match := versionOutput.FindStringSubmatch(string(ba))
+	if match == nil {
+		return "", fmt.Errorf("cannot determine the version of the JRE in %s", home)
+	}
+
+	return match[1], nil
+}
+
+// installedJres returns the JREs of the machine found by JAVA_HOME, the PATH and the OS specific locations
+func installedJres() []InstalledJre {
+	var homes []string
+
+	if home := os.Getenv("JAVA_HOME"); home != "" {
+		homes = append(homes, home)
+	}
+
+	if java, err := exec.LookPath("java"); err == nil {
+		if java, err = filepath.EvalSymlinks(java); err == nil {
+			homes = append(homes, filepath.Dir(filepath.Dir(java)))
+		}
+	}
+
+	homes = append(homes, osJreHomes()...)
+
+	var jres []InstalledJre
+
+	found := make(map[string]bool)
+
+	for _, home := range homes {
+		home = filepath.Clean(home)
+
+		if found[home] || !common.FileExists(filepath.Join(home, "bin")) {
+			continue
+		}
+
+		found[home] = true
+
+		version, err := jreVersion(home)
+		if err != nil {
+			common.Debug(fmt.Sprintf("Skip JRE %s: %v", home, err))
+
+			continue
+		}
+
+		jres = append(jres, InstalledJre{Home: home, Version: version})
+	}
+
+	// the latest matching version is preferred
+	sort.SliceStable(jres, func(i, j int) bool {
+		return compareVersions(jres[i].Version, jres[j].Version) > 0
+	})
+
+	return jres
+}
+
+// selectInstalledJre picks the installed JRE which satisfies the j2se versions of the JNLP, in their order of preference.
+// A private JRE or the -jre parameter take precedence.
+func (l *Launch) selectInstalledJre() {
+	if !l.jreFallback {
+		return
+	}
+
+	// the JRE management of the organization decides before the installed JREs
+	if l.runJreResolver(l.j2seVersions) || len(l.j2seVersions) == 0 {
+		return
+	}
+
+	jres := installedJres()
+
+	for _, spec := range l.j2seVersions {
+		for _, jre := range jres {
+			if matchesJ2seVersion(jre.Version, spec) {
+				l.setJre(filepath.Join(jre.Home, "bin", javaExecutable(l.Console)), fmt.Sprintf("installed JRE %s in %s matches the j2se version %q", jre.Version, jre.Home, spec))
+
+				return
+			}
+		}
+	}
+
+	common.Warn(fmt.Sprintf("No installed JRE matches the j2se versions %q, the default java executable of the PATH is used", strings.Join(l.j2seVersions, ", ")))
+}
+
+// selectJ2se returns the j2se element whose nested resources apply: the one matching the version of the JRE given by
+// -jre, otherwise the first one matching an installed JRE. With a private JRE, whose version is not known before its
+// download, the first j2se element applies.
+func (l *Launch) selectJ2se(jnlp *Jnlp) *J2se {
+	var candidates []*J2se
+
+	nested := false
+
+	for i := range jnlp.Resources {
+		resource := &jnlp.Resources[i]
+
+		if !l.isSelected(resource.Os, resource.Arch) {
+			continue
+		}
+
+		for j := range resource.J2se {
+			candidates = append(candidates, &resource.J2se[j])
+			nested = nested || len(resource.J2se[j].Resources) > 0
+		}
+
+		for j := range resource.Java {
+			candidates = append(candidates, &resource.Java[j])
+			nested = nested || len(resource.Java[j].Resources) > 0
+		}
+	}
+
+	if !nested {
+		return nil
+	}
+
+	privateJre := l.App.PrivateJre != ""
+	for _, jre := range jnlp.PrivateJres {
+		privateJre = privateJre || l.isSelected(jre.Os, jre.Arch)
+	}
+
+	// the JRE resolver decides before the nested resources are selected by the version of its JRE
+	if !privateJre && l.jreFallback {
+		var requested []string
+		for _, candidate := range candidates {
+			if candidate.Version != "" {
+				requested = append(requested, candidate.Version)
+			}
+		}
+
+		l.runJreResolver(requested)
+	}
+
+	var versions []string
+
+	switch {
+	case privateJre:
+	case !l.jreFallback:
+		// the version of the JRE given by -jre or the JRE resolver
+		if java, err := exec.LookPath(l.Jre); err == nil {
+			if java, err = filepath.EvalSymlinks(java); err == nil {
+				if version, err := jreVersion(filepath.Dir(filepath.Dir(java))); err == nil {
+					versions = append(versions, version)
+				}
+			}
+		}
+	default:
+		for _, jre := range installedJres() {
+			versions = append(versions, jre.Version)
+		}
+	}
+
+	for _, candidate := range candidates {
+		for _, version := range versions {
+			if matchesJ2seVersion(version, candidate.Version) {
+				return candidate
+			}
+		}
+	}
+
+	return candidates[0]
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/mpetavy/common"
+	"os"
+	"sync"
+	"time"
+)
+
+// JSON events which report the state of the launch
+const (
+	jsonEventResolveStart     = "resolve-start"
+	jsonEventResolveProgress  = "resolve-progress"
+	jsonEventResourceProgress = "resource-progress"
+	jsonEventExtraction       = "extraction"
+	jsonEventLaunch           = "launch"
+	jsonEventWindow           = "window"
+	jsonEventExit             = "exit"
+	jsonEventError            = "error"
+	jsonEventVulnerability    = "vulnerability"
+)
+
+// JSONEvent is a single line of the JSON event stream
+type JSONEvent struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	Address  string    `json:"address,omitempty"`
+	LaunchID string    `json:"launchId,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Done     int       `json:"done,omitempty"`
+	Total    int       `json:"total,omitempty"`
+	PID      int       `json:"pid,omitempty"`
+	ExitCode *int      `json:"exitCode,omitempty"`
+	Message  string    `json:"message,omitempty"`
+}
+
+// jsonEventMu serializes the lines of the JSON event stream
+var jsonEventMu sync.Mutex
+
+// emitEvent writes the event as newline-delimited JSON to stdout if the JSON event stream is enabled
+func (l *Launch) emitEvent(event JSONEvent) {
+	if !*jsonEvents {
+		return
+	}
+
+	event.Time = time.Now()
+	event.Address = l.Address
+	event.LaunchID = l.ID
+
+	jsonEventMu.Lock()
+	defer jsonEventMu.Unlock()
+
+	common.Error(json.NewEncoder(os.Stdout).Encode(event))
+}
+
+// appEnded reports the end of the app
+func (l *Launch) appEnded(state *os.ProcessState) {
+	l.logf("App ended: %s", state)
+
+	exitCode := state.ExitCode()
+
+	l.emitEvent(JSONEvent{Event: jsonEventExit, ExitCode: &exitCode})
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lockfileSuffix is the file name suffix of lockfiles
+const lockfileSuffix = ".lock.json"
+
+// Lockfile pins an app to its JNLP files and resources by their SHA-256 hashes
+type Lockfile struct {
+	URL         string            `json:"url"`
+	Created     time.Time         `json:"created"`
+	Descriptors map[string]string `json:"descriptors"`
+	Resources   map[string]string `json:"resources"`
+	// Redirects are the targets of the redirects of the JNLP files and resources, like the URLs of a CDN
+	Redirects []string `json:"redirects,omitempty"`
+	// Jre is the URL of the private JRE the app is locked with, it cannot be replaced
+	Jre string `json:"jre,omitempty"`
+}
+
+var (
+	// allowedURLs restricts all requests to these URLs without their tokens, nil allows all
+	allowedURLs map[string]bool
+	// redirects collects the targets of redirects while a lockfile is written, nil collects none
+	redirects     map[string]bool
+	allowedURLsMu sync.Mutex
+)
+
+// restrictNetwork allows requests only to the given URLs
+func restrictNetwork(urls []string) {
+	allowedURLsMu.Lock()
+	defer allowedURLsMu.Unlock()
+
+	allowedURLs = make(map[string]bool)
+
+	for _, u := range urls {
+		allowedURLs[stripTokens(u)] = true
+	}
+}
+
+// recordRedirects starts collecting the targets of redirects, the returned func stops it and returns the targets
+func recordRedirects() func() []string {
+	allowedURLsMu.Lock()
+	defer allowedURLsMu.Unlock()
+
+	redirects = make(map[string]bool)
+
+	return func() []string {
+		allowedURLsMu.Lock()
+		defer allowedURLsMu.Unlock()
+
+		var targets []string
+		for target := range redirects {
+			targets = append(targets, target)
+		}
+
+		sort.Strings(targets)
+
+		redirects = nil
+
+		return targets
+	}
+}
+
+// recordRedirect remembers the target of a redirect for the lockfile, the tokens of signed URLs expire and are not kept
+func recordRedirect(href string) {
+	allowedURLsMu.Lock()
+	defer allowedURLsMu.Unlock()
+
+	if redirects != nil {
+		redirects[stripTokens(href)] = true
+	}
+}
+
+// checkNetworkAllowed refuses requests to URLs which are not allowed, the tokens of signed URLs are not compared
+func checkNetworkAllowed(href string) error {
+	allowedURLsMu.Lock()
+	defer allowedURLsMu.Unlock()
+
+	if allowedURLs != nil && !allowedURLs[stripTokens(href)] {
+		logEvent(eventSecurityRejection, fmt.Sprintf("request to %s refused in kiosk mode", href))
+
+		return fmt.Errorf("the request to %s is refused, kiosk mode allows only the resources of the lockfile", href)
+	}
+
+	return nil
+}
+
+// sha256Hex returns the SHA-256 hash of the content
+func sha256Hex(content []byte) string {
+	hash := sha256.Sum256(content)
+
+	return hex.EncodeToString(hash[:])
+}
+
+// plainHash returns the SHA-256 hash of the content of the cache file, encrypted files are hashed decrypted
+func plainHash(filename string) (string, error) {
+	content, err := readPlain(filename)
+	if err != nil {
+		return "", err
+	}
+
+	return sha256Hex(content), nil
+}
+
+// checkLockedDescriptor verifies the JNLP file against the lockfile
+func (l *Launch) checkLockedDescriptor(address string, content []byte) error {
+	if l.lock == nil {
+		return nil
+	}
+
+	expected, ok := l.lock.Descriptors[address]
+	if !ok || expected != sha256Hex(content) {
+		return fmt.Errorf("the JNLP file %s does not match the lockfile", address)
+	}
+
+	return nil
+}
+
+// checkLockedResource verifies the downloaded resource against the lockfile
+func (l *Launch) checkLockedResource(address string, path string) error {
+	if l.lock == nil {
+		return nil
+	}
+
+	expected, ok := l.lock.Resources[address]
+	if !ok {
+		return fmt.Errorf("the resource %s is not contained in the lockfile", address)
+	}
+
+	hash, err := plainHash(path)
+	if err != nil {
+		return err
+	}
+
+	if hash != expected {
+		// a tampered file must not be used by the next launch either
+		common.Error(os.Remove(path))
+
+		return fmt.Errorf("the resource %s does not match the lockfile", address)
+	}
+
+	return nil
+}
+
+// runLock resolves and downloads the app including its lazy resources and writes its lockfile into dest
+func runLock(cfg *Config, name string, dest string) error {
+	if dest == "" {
+		return fmt.Errorf("missing lockfile directory, use -dest")
+	}
+
+	l := NewLaunch(cfg, name)
+
+	// the kiosk follows the redirects of the servers, like the ones to a CDN, only to the recorded targets
+	stopRecording := recordRedirects()
+
+	_, err := l.resolve()
+	if err != nil {
+		stopRecording()
+
+		return err
+	}
+
+	err = l.download()
+	if err != nil {
+		stopRecording()
+
+		return err
+	}
+
+	// the lazy resources are prefetched by the app in kiosk mode, so they must be pinned as well
+	l.runTasks(l.lazyTasks)
+
+	targets := stopRecording()
+
+	if l.errors.IsSet() {
+		return l.errors.Get()
+	}
+
+	lock := Lockfile{
+		URL:         l.Address,
+		Created:     time.Now(),
+		Descriptors: make(map[string]string),
+		Resources:   make(map[string]string),
+		Redirects:   targets,
+		Jre:         l.jreURL,
+	}
+
+	for address, entry := range l.recording.Descriptors {
+		lock.Descriptors[address] = sha256Hex(l.recording.content[entry])
+	}
+
+	for _, resource := range l.recording.Resources {
+		hash, err := plainHash(resource.Path)
+		if err != nil {
+			return err
+		}
+
+		lock.Resources[resource.URL] = hash
+	}
+
+	ba, err := json.MarshalIndent(lock, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dest, common.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
+	filename := filepath.Join(dest, sanitizeName(cfg.App(name).Alias)+lockfileSuffix)
+	if cfg.App(name).Alias == "" {
+		filename = filepath.Join(dest, sanitizeName(filepath.Base(l.Address))+lockfileSuffix)
+	}
+
+	err = os.WriteFile(filename, ba, common.DefaultFileMode)
+	if err != nil {
+		return err
+	}
+
+	common.Info(fmt.Sprintf("Lockfile %s written with %d JNLP files and %d resources", filename, len(lock.Descriptors), len(lock.Resources)))
+
+	return nil
+}
+
+// checkAdminControlled refuses lockfiles and lock directories which can be changed by other users than the admins
+func checkAdminControlled(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	err = adminControlled(path, info)
+	if err != nil {
+		logEvent(eventSecurityRejection, err.Error())
+
+		return err
+	}
+
+	return nil
+}
+
+// readLockfile reads the lockfile of the app name from the lock directory, without a name the only lockfile is used
+func readLockfile(lockdir string, name string) (*Lockfile, error) {
+	err := checkAdminControlled(lockdir)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(filepath.Join(lockdir, "*"+lockfileSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(matches)
+
+	var names []string
+	for _, match := range matches {
+		names = append(names, strings.TrimSuffix(filepath.Base(match), lockfileSuffix))
+	}
+
+	filename := ""
+
+	switch {
+	case name != "":
+		filename = filepath.Join(lockdir, sanitizeName(name)+lockfileSuffix)
+	case len(matches) == 1:
+		filename = matches[0]
+	case len(matches) == 0:
+		return nil, fmt.Errorf("no lockfiles in %s", lockdir)
+	default:
+		return nil, fmt.Errorf("%s contains several lockfiles, select one of: %s", lockdir, strings.Join(names, ", "))
+	}
+
+	err = checkAdminControlled(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	ba, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("the app %s is not approved, approved apps are: %s", name, strings.Join(names, ", "))
+	}
+
+	lock := &Lockfile{}
+
+	err = json.Unmarshal(ba, lock)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lockfile %s: %w", filename, err)
+	}
+
+	return lock, nil
+}
+
+// runKiosk launches an approved app of the lock directory, all other requests are refused
+func runKiosk(cfg *Config, lockdir string, name string) error {
+	if lockdir == "" {
+		return fmt.Errorf("missing lock directory, use -lockdir")
+	}
+
+	if isFlagSet("url") {
+		common.Warn("The -url parameter is ignored in kiosk mode")
+	}
+
+	lock, err := readLockfile(lockdir, name)
+	if err != nil {
+		return err
+	}
+
+	var urls []string
+
+	for address := range lock.Descriptors {
+		urls = append(urls, address)
+	}
+
+	for address := range lock.Resources {
+		urls = append(urls, address)
+	}
+
+	urls = append(urls, lock.Redirects...)
+
+	restrictNetwork(urls)
+
+	l := NewLaunch(cfg, lock.URL)
+	l.lock = lock
+
+	// the JRE pinned by the lockfile is neither replaced by -jre nor by the user preferences
+	if lock.Jre != "" && !l.jreFallback {
+		common.Warn(fmt.Sprintf("The JRE %s is ignored in kiosk mode, the lockfile pins the private JRE %s", l.Jre, lock.Jre))
+
+		l.setJre(javaExecutable(l.Console), "the lockfile pins the private JRE")
+		l.jreFallback = true
+	}
+
+	return l.Run()
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// adminControlled checks that the file is owned by root and writable by root only
+func adminControlled(path string, info os.FileInfo) error {
+	if info.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("%s is writable by a group or all users and cannot be used in kiosk mode", path)
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Uid != 0 {
+		return fmt.Errorf("%s is not owned by root and cannot be used in kiosk mode", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"golang.org/x/sys/windows"
+	"os"
+	"unsafe"
+)
+
+const (
+	// trustedInstallerSid owns the system files like the ones of "Program Files"
+	trustedInstallerSid = "S-1-5-80-956008885-3434512322-1835181429-2125226920-1934452710"
+	// writeAccess are the access rights which allow to change a file or the content of a directory
+	writeAccess = windows.FILE_WRITE_DATA | windows.FILE_APPEND_DATA | windows.DELETE | windows.WRITE_DAC | windows.WRITE_OWNER |
+		windows.GENERIC_WRITE | windows.GENERIC_ALL
+)
+
+// isAdminSid checks if the SID is one of the Administrators, the system or the TrustedInstaller
+func isAdminSid(sid *windows.SID) bool {
+	return sid.IsWellKnown(windows.WinBuiltinAdministratorsSid) || sid.IsWellKnown(windows.WinLocalSystemSid) || sid.String() == trustedInstallerSid
+}
+
+// adminControlled checks that the file is owned by the Administrators and that its ACL grants write access to admins only
+func adminControlled(path string, info os.FileInfo) error {
+	sd, err := windows.GetNamedSecurityInfo(path, windows.SE_FILE_OBJECT, windows.OWNER_SECURITY_INFORMATION|windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return err
+	}
+
+	owner, _, err := sd.Owner()
+	if err != nil {
+		return err
+	}
+
+	if !isAdminSid(owner) {
+		return fmt.Errorf("%s is not owned by the Administrators and cannot be used in kiosk mode", path)
+	}
+
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return err
+	}
+
+	// a missing ACL grants full access to everyone
+	if dacl == nil {
+		return fmt.Errorf("%s has no access control list and cannot be used in kiosk mode", path)
+	}
+
+	for i := uint32(0); i < uint32(dacl.AceCount); i++ {
+		var ace *windows.ACCESS_ALLOWED_ACE
+
+		err := windows.GetAce(dacl, i, &ace)
+		if err != nil {
+			return err
+		}
+
+		// inherit-only entries apply to the children only, which are checked by themselves
+		if ace.Header.AceType != windows.ACCESS_ALLOWED_ACE_TYPE || ace.Header.AceFlags&windows.INHERIT_ONLY_ACE != 0 || ace.Mask&writeAccess == 0 {
+			continue
+		}
+
+		sid := (*windows.SID)(unsafe.Pointer(&ace.SidStart))
+
+		if !isAdminSid(sid) {
+			return fmt.Errorf("%s is writable by %s and cannot be used in kiosk mode", path, sid.String())
+		}
+	}
+
+	return nil
+}
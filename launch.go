@@ -0,0 +1,1483 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Task describes the download of a single resource
+type Task struct {
+	URL     string
+	Path    string
+	Unzip   bool
+	Extract bool
+	// Dest is the directory archives are extracted to, the directory of the resource by default
+	Dest string
+	// Origin is the JNLP file which declares the resource with its Href, it provides fresh tokens of signed URLs
+	Origin string
+	Href   string
+	// Checksum is the SHA-256 or SHA-1 of the resource declared by the JNLP file
+	Checksum string
+	// Encrypt encrypts the download before it is written to the cache
+	Encrypt bool
+}
+
+// Launch holds the state of a single launch, so multiple launches can run concurrently in one process
+type Launch struct {
+	// Address is the URL of the JNLP file
+	Address string
+	// ID correlates the logs of the launcher and the app
+	ID string
+	// Config is the espresso config
+	Config *Config
+	// App are the per-app settings
+	App *AppConfig
+	// OS is the JNLP name of the operating system the resources are selected for
+	OS string
+	// OSName is the name of the operating system including its version like the Java os.name, e.g. "Windows 11"
+	OSName string
+	// Arch is the architecture the resources are selected for
+	Arch string
+	// Jre is the path to the java executable
+	Jre string
+	// Console launches the app with an attached console
+	Console bool
+	// Wait waits for the end of the app, always with an ephemeral cache or encryption, which need espresso until then
+	Wait bool
+	// Verify checks the classpath, native library paths and main class instead of starting the JVM
+	Verify bool
+	// StatusPage shows the launch progress on a localhost page in the browser
+	StatusPage bool
+	// JarLaunch launches the main jar with java -jar, in addition to the jar-launch setting of the app
+	JarLaunch bool
+	// JFR launches the app with Java Flight Recorder, in addition to the jfr setting of the app
+	JFR bool
+	// Sandbox is the sandbox the app is launched in, empty for none
+	Sandbox string
+	// Offline launches the app from the cache without contacting the server
+	Offline bool
+
+	jars                []string
+	jarOrigins          []string
+	startupProfile      *Profile
+	mainJar             string
+	mainJarDeclared     bool
+	signatureCheck      bool
+	signer              *x509.Certificate
+	signerErr           error
+	signerVerified      bool
+	javafxRuntime       string
+	javafxPath          string
+	fontsPath           string
+	fontsEnv            []string
+	nativelibs          []string
+	maxheapsize         string
+	initialheapsize     string
+	vmArgs              []string
+	iconpath            string
+	jfrRecording        string
+	tasks               []Task
+	lazyTasks           []Task
+	properties          []Property
+	decisions           []Decision
+	jreReason           string
+	jreFallback         bool
+	jreURL              string
+	jreResolved         bool
+	j2seVersions        []string
+	launcherLog         io.WriteCloser
+	state               string
+	done                int
+	total               int
+	cancelled           bool
+	chain               []string
+	rolledBack          bool
+	keepCached          bool
+	pinned              bool
+	staging             string
+	stagedJars          map[string]string
+	location            string
+	title               string
+	progressClass       string
+	progressFeed        *ProgressFeed
+	codebase            string
+	current             map[string]bool
+	refreshMu           sync.Mutex
+	refreshed           map[string]refreshedJnlp
+	checksumManifest    map[string]string
+	checksumManifestErr error
+	extensions          map[string]bool
+	descriptors         map[string]*descriptor
+	descriptorsDone     int
+	descriptorsTotal    int
+	installers          []Installer
+	lock                *Lockfile
+	forceUpdate         bool
+	backgroundUpdate    bool
+
+	mu              sync.Mutex
+	networkMu       sync.Mutex
+	wg              sync.WaitGroup
+	errors          *ErrorAggregator
+	recording       *Replay
+	replay          *Replay
+	offline         bool
+	handoff         string
+	openPath        string
+	prefs           Prefs
+	vulnerabilities []Vulnerability
+}
+
+// NewLaunch creates the launch of the given JNLP URL with the flags and the per-app settings of the config
+func NewLaunch(cfg *Config, address string) *Launch {
+	app := cfg.App(address)
+
+	l := &Launch{
+		Address:     app.URL,
+		ID:          newLaunchID(),
+		Config:      cfg,
+		App:         app,
+		OS:          operatingsystem,
+		OSName:      osName(),
+		Arch:        *arch,
+		Jre:         *jrepath,
+		Console:     *console || app.Console,
+		Wait:        *wait || app.Wait || !storage.Persistent() || cfg.Encryption.Enabled,
+		StatusPage:  *statusPage,
+		Verify:      *verifyLaunch,
+		JarLaunch:   *jarLaunch,
+		JFR:         *jfr,
+		Sandbox:     *sandbox,
+		Offline:     *offline,
+		errors:      newErrorAggregator(),
+		current:     make(map[string]bool),
+		extensions:  make(map[string]bool),
+		refreshed:   make(map[string]refreshedJnlp),
+		descriptors: make(map[string]*descriptor),
+	}
+
+	if *profileStartup || *profileFile != "" {
+		l.startupProfile = newProfile()
+	}
+
+	if l.Jre == "" {
+		// if not private JRE is provided then do the fallback to default JAVAW executable
+		l.setJre(javaExecutable(l.Console), "no private JRE, no -jre parameter and no installed JRE matching the j2se version, the default java executable of the PATH is used")
+		l.jreFallback = true
+	} else {
+		l.jreReason = "defined by the -jre parameter"
+	}
+
+	// the preferences of former launches are used without repeating their flags
+	if l.Address != "" {
+		common.Error(l.applyPrefs())
+	}
+
+	return l
+}
+
+// addTask registers a resource for the download
+func (l *Launch) addTask(task Task) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tasks = append(l.tasks, task)
+}
+
+// registeredTasks returns the registered downloads
+func (l *Launch) registeredTasks() []Task {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]Task{}, l.tasks...)
+}
+
+// runTasks runs the downloads concurrently and waits for their completion
+func (l *Launch) runTasks(list []Task) {
+	l.mu.Lock()
+	l.done = 0
+	l.total = len(list)
+	l.mu.Unlock()
+
+	for _, task := range list {
+		// inform the WaitGroup that a new resource action will be added
+		l.wg.Add(1)
+
+		// runResource the resource asynch
+		go l.runResource(task)
+	}
+
+	// wait on all registered WaitGroup objects
+	l.wg.Wait()
+}
+
+// runResource operates on the a single resource object and cares about download, runUnzip or extraction
+func (l *Launch) runResource(task Task) {
+	url, path, doUnzip, doExtract := task.URL, task.Path, task.Unzip, task.Extract
+
+	var err error
+
+	span := l.startupProfile.Fork(filepath.Base(path))
+	ctx := withSpan(context.Background(), span)
+
+	defer func() {
+		span.End()
+
+		l.mu.Lock()
+		l.done++
+		done, total := l.done, l.total
+		l.mu.Unlock()
+
+		l.emitEvent(JSONEvent{Event: jsonEventResourceProgress, URL: url, Path: path, Done: done, Total: total})
+		l.feedProgress(task, done, total, err != nil)
+
+		l.wg.Done()
+	}()
+
+	if l.isCancelled() {
+		l.errors.Set(fmt.Errorf("launch cancelled"))
+		return
+	}
+
+	// an offline launch cannot download missing resources
+	err = l.checkCachedOffline(url, path)
+	if err != nil {
+		l.errors.Set(err)
+		return
+	}
+
+	start := time.Now()
+
+	doUnzip = doUnzip || strings.HasSuffix(path, ".zip")
+	doExtract = doExtract || strings.HasSuffix(path, ".exe")
+
+	// plain jars are encrypted at rest, so they reach the cache encrypted only
+	plainJar := !doUnzip && !doExtract && len(l.App.ResourceTypes) == 0
+	task.Encrypt = plainJar && l.Config.Encryption.Enabled
+
+	// first do the download, cached resources are kept as they are if requested ...
+	if !(l.keepCached && common.FileExists(path)) && !l.isCurrent(path) {
+		err = l.downloadRefreshing(ctx, task)
+		if err != nil {
+			l.errors.Set(err)
+			return
+		}
+	}
+
+	// corrupted downloads are detected by the checksums of the JNLP file or the config
+	step := span.Child("checksum")
+	err = l.verifyChecksum(withSpan(ctx, step), task, start)
+	step.End()
+
+	if err != nil {
+		l.errors.Set(err)
+		return
+	}
+
+	// kiosk mode uses only the approved resources
+	err = l.checkLockedResource(url, path)
+	if err != nil {
+		l.errors.Set(err)
+		return
+	}
+
+	// remember the resource for the replay bundle
+	l.recording.AddResource(url, path)
+
+	common.Error(indexUsage(path, l.Address))
+
+	l.logf("Resource %s --> %s", url, path)
+
+	// plain jars are used as they are, or encrypted at rest
+	if plainJar {
+		if !l.Config.Encryption.Enabled {
+			return
+		}
+
+		// files cached before the encryption was enabled
+		err = encryptFile(path)
+		if err != nil {
+			l.errors.Set(err)
+			return
+		}
+
+		// a lazy jar prefetched while the app is running is used from the staging directory
+		err = l.stageLazyJar(path)
+		if err != nil {
+			l.errors.Set(err)
+		}
+
+		return
+	}
+
+	// servers do not always use the proper suffix, so the content decides how the archive is processed
+	fileType, err := l.resourceType(url, path, doUnzip, doExtract)
+	if err != nil {
+		l.errors.Set(err)
+		return
+	}
+
+	if fileType != fileTypeUnknown {
+		l.emitEvent(JSONEvent{Event: jsonEventExtraction, URL: url, Path: path, Message: fileType})
+	}
+
+	dest := task.Dest
+	if dest == "" {
+		dest = filepath.Dir(path)
+	}
+
+	step = span.Child("extract")
+	defer step.End()
+
+	switch fileType {
+	case fileTypeZip:
+		err = runUnzipLinked(path, dest)
+	case fileTypeExe:
+		err = l.checkExecutable(path)
+		if err == nil {
+			err = measureExtraction(path, filepath.Dir(path), func() error {
+				return runSelfextract(path)
+			})
+		}
+	case fileTypeGzip:
+		err = measureExtraction(path, dest, func() error {
+			return runUntar(path, dest)
+		})
+	}
+
+	if err != nil {
+		l.errors.Set(err)
+		return
+	}
+}
+
+// iconOptions returns the JVM options which provide the app icon and name to the taskbar/dock
+func (l *Launch) iconOptions(information Information) []string {
+	var options []string
+
+	if l.iconpath == "" {
+		return options
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		options = append(options, "-Xdock:icon="+l.iconpath)
+
+		if information.Title != "" {
+			options = append(options, "-Xdock:name="+information.Title)
+		}
+	case "windows":
+		// hints for the app to set its window icon and AppUserModelID
+		options = append(options, "-Despresso.icon="+l.iconpath)
+
+		if information.Title != "" {
+			options = append(options, "-Despresso.appUserModelId="+strings.Join(strings.Fields(information.Vendor+" "+information.Title), "."))
+		}
+	}
+
+	return options
+}
+
+// fetchJnlp loads the JNLP file from the server, from the replay bundle or from the last launch if offline
+func (l *Launch) fetchJnlp(address string) ([]byte, error) {
+	if l.replay != nil {
+		return l.replay.Descriptor(address)
+	}
+
+	if l.offline {
+		return cachedDescriptor(address)
+	}
+
+	span := l.startupProfile.Fork(filepath.Base(hrefPath(address)))
+	defer span.End()
+
+	return fetchJnlp(withSpan(context.Background(), span), address)
+}
+
+// isSelected reports if a resource with the given os and arch attributes is relevant for this launch
+func (l *Launch) isSelected(os string, arch string) bool {
+	return matchesArch(arch, l.Arch) && matchesOS(os, l.selectedOS())
+}
+
+// selectedOS returns the os.name the resources are selected for, recordings without it use the JNLP name of the OS
+func (l *Launch) selectedOS() string {
+	if l.OSName == "" {
+		return l.OS
+	}
+
+	return l.OSName
+}
+
+func (l *Launch) runJnlp(address string, doHeader bool, chain []string) *Jnlp {
+	// the JNLP files from the root down to this one
+	chain = append(append([]string{}, chain...), address)
+
+	location := address
+
+	var content []byte
+	var err error
+
+	// a pinned app uses the JNLP of its pinned version
+	if doHeader && l.replay == nil {
+		content, err = l.pinnedJnlp(address)
+		if err != nil {
+			l.errors.Set(err)
+			return nil
+		}
+	}
+
+	if content == nil {
+		// the JNLP is loaded from the discovered server, but cached under its SRV name
+		if l.replay == nil && !l.offline {
+			location, err = resolveSRV(address)
+			if err != nil {
+				l.errors.Set(err)
+				return nil
+			}
+		}
+
+		if doHeader {
+			content, err = l.fetchRootJnlp(location, address)
+
+			// an unreachable server launches the app of the last launch if it allows offline use
+			if err != nil && !l.offline && l.replay == nil && isOfflineError(err) {
+				offlineErr := l.goOffline(fmt.Sprintf("The server is not reachable (%v)", err))
+				if offlineErr != nil {
+					common.Warn(offlineErr.Error())
+				} else {
+					location = address
+					content, err = l.fetchJnlp(address)
+				}
+			}
+		} else {
+			content, err = l.extensionDescriptor(location)
+		}
+		if err != nil {
+			l.errors.Set(err)
+			return nil
+		}
+
+		// the href of the root JNLP file is its canonical location
+		if doHeader && !l.keepCached && l.replay == nil && !l.offline {
+			location, content = l.canonicalJnlp(location, content)
+		}
+	}
+
+	// kiosk mode launches only the approved JNLP files
+	err = l.checkLockedDescriptor(address, content)
+	if err != nil {
+		l.errors.Set(err)
+		return nil
+	}
+
+	// print the JNLP body
+	common.Debug(fmt.Sprintf("JNLP body:\n%s", string(content)))
+
+	// parse the JNLP u
+	u, err := url.Parse(address)
+	if err != nil {
+		l.errors.Set(err)
+		return nil
+	}
+
+	// create the file path in the cache directory for the JNLP file
+	jnlpPath := filepath.Join(*cache, hostDirName(u.Host))
+	// create the app path in the cache directory for the JNLP file
+	appPath := filepath.Join(jnlpPath, "app")
+
+	jnlp, err := parseJnlp(content)
+	if err != nil {
+		l.errors.Set(err)
+		return nil
+	}
+
+	if doHeader {
+		err = checkAnnouncements(jnlp.Espresso)
+		if err != nil {
+			l.errors.Set(err)
+			return nil
+		}
+
+		// the update policy of the JNLP may ask before an update is applied
+		if !l.pinned {
+			content, jnlp, err = l.applyUpdatePolicy(address, content, jnlp)
+			if err != nil {
+				l.errors.Set(err)
+				return nil
+			}
+		}
+
+		// a staged rollout may keep this machine on the cached version
+		if !l.pinned {
+			content, jnlp, err = l.applyRollout(address, content, jnlp)
+			if err != nil {
+				l.errors.Set(err)
+				return nil
+			}
+		}
+	}
+
+	// risky changes of the JNLP file are an early warning of a compromised deployment server
+	err = l.checkJnlpHistory(address, location, content, jnlp)
+	if err != nil {
+		l.errors.Set(err)
+		return nil
+	}
+
+	// the JNLP file is kept for offline launches
+	if l.replay == nil && !l.offline {
+		err = l.cacheDescriptor(address, content)
+		if err != nil {
+			common.Warn(fmt.Sprintf("The JNLP file %s is not kept for offline launches: %v", address, err))
+		}
+	}
+
+	// remember the JNLP file for the replay bundle
+	l.recording.AddDescriptor(address, content)
+
+	codebase := jnlpCodebase(jnlp, location)
+
+	if doHeader {
+		l.location = location
+		l.codebase = codebase
+
+		// the localized title is shown by the status page
+		l.mu.Lock()
+		l.title = jnlp.Information.Title
+		l.mu.Unlock()
+
+		// a custom download progress UI of the app
+		l.progressClass = jnlp.ApplicationDesc.ProgressClass
+		if jnlp.AppletDesc.ProgressClass != "" {
+			l.progressClass = jnlp.AppletDesc.ProgressClass
+		}
+
+		// the extension tree is fetched concurrently, the root descriptor counts as done
+		l.mu.Lock()
+		l.descriptorsDone++
+		l.descriptorsTotal++
+		l.mu.Unlock()
+
+		l.prefetchExtensions(jnlp, u, codebase, 1)
+	}
+
+	// the resources of an installer extension are used by its installer only
+	if !doHeader && jnlp.InstallerDesc != nil {
+		err = l.addInstaller(address, content, jnlp, u, codebase, appPath)
+		if err != nil {
+			l.errors.Set(err)
+			return nil
+		}
+
+		return jnlp
+	}
+
+	if !doHeader && jnlp.ComponentDesc == nil {
+		common.Warn(fmt.Sprintf("Extension %s has no component-desc, its resources are merged anyway", address))
+	}
+
+	// the nested resources of the j2se element which applies to the JRE are resources of the app as well
+	if doHeader {
+		if j2se := l.selectJ2se(jnlp); j2se != nil && len(j2se.Resources) > 0 {
+			l.explain(Decision{Kind: decisionJre, Href: j2se.Version, Origin: address, Included: true, Reason: "j2se element whose nested resources apply to the JRE"})
+			l.logf("Resources of the j2se element with version %s apply", j2se.Version)
+
+			jnlp.Resources = append(jnlp.Resources, j2se.Resources...)
+		}
+	}
+
+	// the signatures of all jars of apps requesting all-permissions are checked before the launch
+	if doHeader {
+		l.signatureCheck = requestsPermissions(jnlp) && !l.isTrusted()
+	}
+
+	// lazy jars of parts with an eager jar are needed at startup
+	eagerParts := l.eagerParts(jnlp)
+
+	// iterate over the JNLP defined resources
+	for _, resource := range jnlp.Resources {
+
+		if len(resource.Arch) > 0 {
+			resource.Arch = common.Capitalize(resource.Arch)
+		}
+
+		// is the resouce relevant for the current architecture and OS?
+		if l.isSelected(resource.Os, resource.Arch) {
+
+			// iterate over the resource JARS
+			for _, jar := range resource.Jars {
+
+				// enrich the jar object with destination filepath and URL
+				jar.Path = filepath.Join(appPath, hrefPath(jar.Href))
+				jar.URL, err = u.Parse(codebase + "/" + jar.Href)
+				if err != nil {
+					l.errors.Set(err)
+					return nil
+				}
+
+				// versioned resources use the version-based download protocol
+				l.applyVersionID(&jar)
+
+				// append to the jars path list the current resource jar
+				l.mu.Lock()
+				l.jars = append(l.jars, jar.Path)
+				l.jarOrigins = append(l.jarOrigins, address)
+
+				// the jar with main="true" of the app JNLP is the main jar, otherwise its first jar
+				isMain := doHeader && (l.mainJar == "" || (jar.Main == "true" && !l.mainJarDeclared))
+				if isMain {
+					l.mainJar = jar.Path
+					l.mainJarDeclared = jar.Main == "true"
+				}
+				l.mu.Unlock()
+
+				lazy := l.isLazy(jar, eagerParts, isMain)
+
+				l.explain(Decision{Kind: decisionJar, Href: jar.Href, Origin: address, Path: jar.Path, Included: true, Reason: l.jarReason(jar, eagerParts, isMain, lazy)})
+
+				// lazy jars stay on the classpath but are not fetched at startup
+				if lazy {
+					l.addLazyTask(Task{URL: jar.URL.String(), Path: jar.Path, Origin: address, Href: jar.Href, Checksum: declaredChecksum(jar.SHA256, jar.SHA1)})
+
+					continue
+				}
+
+				// register the resource for the download
+				l.addTask(Task{URL: jar.URL.String(), Path: jar.Path, Origin: address, Href: jar.Href, Checksum: declaredChecksum(jar.SHA256, jar.SHA1)})
+			}
+
+			// the JavaFX runtime is provided by the JRE or by an OpenJFX SDK
+			for _, fx := range resource.JavafxRuntimes {
+				l.mu.Lock()
+				if l.javafxRuntime == "" {
+					l.javafxRuntime = fx.Version
+				}
+				l.mu.Unlock()
+			}
+
+			// the variables in the values are substituted like the JnlpDownloadServlet does on the server
+			l.mu.Lock()
+			values := l.variables()
+			l.mu.Unlock()
+
+			properties := make([]Property, 0, len(resource.Properties))
+
+			for _, property := range resource.Properties {
+				property.Value = expandVariables(property.Value, values)
+				properties = append(properties, property)
+			}
+
+			for _, property := range properties {
+				l.explain(Decision{Kind: decisionProperty, Href: property.Name, Origin: address, Included: true, Reason: fmt.Sprintf("passed as -D%s=%s", property.Name, property.Value)})
+			}
+
+			// the system properties of the app, later definitions take precedence
+			l.mu.Lock()
+			l.properties = append(l.properties, properties...)
+			l.mu.Unlock()
+
+			// iterate over the resource EXTENSIONS
+			for _, extension := range resource.Extensions {
+
+				// enrich the jar object with destination filepath and URL
+				extension.Path = filepath.Join(appPath, hrefPath(extension.Href))
+				extension.URL, err = u.Parse(codebase + "/" + extension.Href)
+				if err != nil {
+					l.errors.Set(err)
+					return nil
+				}
+
+				// cycles and too deep hierarchies are refused
+				err = checkExtensionChain(chain, extension.URL.String())
+				if err != nil {
+					l.errors.Set(err)
+					return nil
+				}
+
+				// an extension referenced more than once is merged only once
+				l.mu.Lock()
+				merged := l.extensions[extension.URL.String()]
+				l.extensions[extension.URL.String()] = true
+				l.mu.Unlock()
+
+				if merged {
+					l.explain(Decision{Kind: decisionExtension, Href: extension.Href, Origin: address, Reason: "duplicate, the extension is already merged"})
+
+					continue
+				}
+
+				l.explain(Decision{Kind: decisionExtension, Href: extension.Href, Origin: address, Included: true, Reason: "extension JNLP, resolved from " + extension.URL.String()})
+
+				// resolved in place, so the jars of the extension keep their position in the classpath
+				if l.runJnlp(extension.URL.String(), false, chain) == nil {
+					return nil
+				}
+			}
+
+			// iterate over the defined nativelibs
+			for _, nativelib := range resource.Nativelibs {
+
+				// enrich the nativelib object with the destination filepath and URL
+				nativelib.Path = filepath.Join(appPath, hrefPath(nativelib.Href))
+				nativelib.URL, err = u.Parse(codebase + "/" + nativelib.Href)
+				if err != nil {
+					l.errors.Set(err)
+					return nil
+				}
+
+				// versioned resources use the version-based download protocol
+				l.applyVersionID(&nativelib)
+
+				// the nativelibs are unzipped into a directory of the app and platform, so apps sharing the cache
+				// do not overwrite each other's native libraries
+				nativePath, err := l.nativeLibPath()
+				if err != nil {
+					l.errors.Set(err)
+					return nil
+				}
+
+				l.explain(Decision{Kind: decisionNativelib, Href: nativelib.Href, Origin: address, Path: nativelib.Path, Included: true, Reason: "unzipped into " + nativePath + " of the java.library.path"})
+
+				// append to the nativelib path list the current resource nativelib
+				l.mu.Lock()
+				if !slices.Contains(l.nativelibs, nativePath) {
+					l.nativelibs = append(l.nativelibs, nativePath)
+				}
+				l.mu.Unlock()
+
+				// register the resource for the download
+				l.addTask(Task{URL: nativelib.URL.String(), Path: nativelib.Path, Unzip: true, Dest: nativePath, Origin: address, Href: nativelib.Href, Checksum: declaredChecksum(nativelib.SHA256, nativelib.SHA1)})
+			}
+
+			if doHeader {
+				// the j2se versions in their order of preference select an installed JRE
+				for _, j2se := range append(append([]J2se{}, resource.J2se...), resource.Java...) {
+					if j2se.Version != "" {
+						l.j2seVersions = append(l.j2seVersions, j2se.Version)
+					}
+				}
+
+				// get the definition of the maxheapsize from the J2SE element
+				for _, j2se := range resource.J2se {
+					l.maxheapsize = j2se.MaxHeapSize
+				}
+
+				// if no maxheapsize can be found in J2SE element ...
+				if len(l.maxheapsize) == 0 {
+
+					// get the definition of the maxheapsize from the JAVA element
+					for _, java := range resource.Java {
+						l.maxheapsize = java.MaxHeapSize
+					}
+				}
+
+				// get the definition of the initialheapsize from the J2SE element
+				for _, j2se := range resource.J2se {
+					l.initialheapsize = j2se.InitialHeapSize
+				}
+
+				// if no initialheapsize can be found in J2SE element ...
+				if len(l.initialheapsize) == 0 {
+
+					// get the definition of the initialheapsize from the JAVA element
+					for _, java := range resource.Java {
+						l.initialheapsize = java.InitialHeapSize
+					}
+				}
+
+				// the JVM options of the j2se or java element
+				for _, j2se := range append(append([]J2se{}, resource.J2se...), resource.Java...) {
+					if j2se.JavaVMArgs != "" && len(l.vmArgs) == 0 {
+						l.vmArgs = strings.Fields(j2se.JavaVMArgs)
+					}
+				}
+			}
+		} else {
+			l.explainSkipped(address, resource)
+		}
+	}
+
+	// download the app icon for the taskbar/dock
+	icon := jnlp.Information.DefaultIcon()
+
+	if doHeader && icon != nil {
+		iconURL, err := u.Parse(codebase + "/" + icon.Href)
+		if err != nil {
+			l.errors.Set(err)
+			return nil
+		}
+
+		l.mu.Lock()
+		l.iconpath = filepath.Join(appPath, hrefPath(icon.Href))
+		l.mu.Unlock()
+
+		// register the resource for the download
+		l.addTask(Task{URL: iconURL.String(), Path: l.iconpath})
+	}
+
+	// iterate over the private JREs
+	for _, jre := range jnlp.PrivateJres {
+
+		// is the private JRE relevant for the current architecture and OS?
+		if l.isSelected(jre.Os, jre.Arch) {
+
+			reason := "private JRE of the JNLP matching the os/arch of this machine"
+
+			// the private JRE can be overridden per app, but not the one pinned by a lockfile
+			if l.App.PrivateJre != "" && (l.lock == nil || l.lock.Jre == "") {
+				jre.Href = l.App.PrivateJre
+				reason = "private JRE overridden by the private-jre setting of the app config"
+			}
+
+			// Maven coordinates are resolved to the URL of the artifact in the repository
+			if isMavenHref(jre.Href) {
+				// a version range is resolved by the repository
+				if c, err := parseMavenHref(jre.Href); err == nil && isVersionRange(c.Version) {
+					err = l.checkOffline(jre.Href)
+					if err != nil {
+						l.errors.Set(err)
+						return nil
+					}
+				}
+
+				jre.Href, err = resolveMavenHref(l.Config.Maven, jre.Href)
+				if err != nil {
+					l.errors.Set(err)
+					return nil
+				}
+			}
+
+			// get the filename of the self extracting file
+			filename := filepath.Base(hrefPath(jre.Href))
+
+			// enrich the JRE object with the destination filepath and URL
+			jre.Path = filepath.Join(jnlpPath, jre.Arch, filename)
+			jre.URL, err = resolveHref(u, codebase, jre.Href)
+			if err != nil {
+				l.errors.Set(err)
+				return nil
+			}
+
+			if doHeader {
+				// get private JRE path
+				l.mu.Lock()
+				l.setJre(filepath.Join(filepath.Dir(jre.Path), "bin", javaExecutable(l.Console)), reason)
+				l.jreURL = jre.URL.String()
+				l.mu.Unlock()
+			}
+
+			l.explain(Decision{Kind: decisionJre, Href: jre.Href, Origin: address, Path: jre.Path, Included: true, Reason: reason})
+
+			// register the resource for the download
+			l.addTask(Task{URL: jre.URL.String(), Path: jre.Path, Extract: !strings.HasSuffix(jre.Path, ".zip"), Checksum: declaredChecksum(jre.SHA256, jre.SHA1)})
+		} else {
+			l.explain(Decision{Kind: decisionJre, Href: jre.Href, Origin: address, Reason: fmt.Sprintf("os/arch filter: JRE for os=%q arch=%q, this machine is os=%q arch=%q", jre.Os, jre.Arch, l.selectedOS(), l.Arch)})
+		}
+	}
+
+	return jnlp
+}
+
+// Run resolves the JNLP application, downloads its resources and starts the app
+func (l *Launch) Run() error {
+	if l.Address == "" {
+		return fmt.Errorf("missing JNLP URL, use -url")
+	}
+
+	err := l.openLogs()
+	if err != nil {
+		return err
+	}
+
+	defer l.closeLogs()
+
+	logEvent(eventLaunchStart, fmt.Sprintf("%s (launch ID %s)", l.Address, l.ID))
+	l.logf("Launch of %s", l.Address)
+
+	if l.StatusPage {
+		stop, err := l.serveStatusPage()
+		if err != nil {
+			return err
+		}
+
+		defer stop()
+	}
+
+	err = l.launch()
+
+	// failed launches and launches without JVM are reported as well
+	l.reportProfile()
+
+	if err != nil {
+		l.removeStaging()
+		l.removeHandoff()
+
+		logEvent(eventLaunchFailure, fmt.Sprintf("%s (launch ID %s): %v", l.Address, l.ID, err))
+		l.logf("Launch failed: %v", err)
+		l.emitEvent(JSONEvent{Event: jsonEventError, Message: err.Error()})
+		l.setState("failed")
+
+		return err
+	}
+
+	logEvent(eventLaunchSuccess, fmt.Sprintf("%s (launch ID %s)", l.Address, l.ID))
+
+	return nil
+}
+
+// launch runs the steps of the launch
+func (l *Launch) launch() error {
+	err := l.checkMaxInstances()
+	if err != nil {
+		return err
+	}
+
+	l.startupProfile.Phase("requirements")
+
+	if !l.Verify {
+		err = l.startRequirements()
+		if err != nil {
+			return err
+		}
+	}
+
+	if l.Offline && l.replay == nil {
+		err = l.goOffline("Offline mode is requested")
+		if err != nil {
+			return err
+		}
+	}
+
+	l.setState("resolving")
+	l.emitEvent(JSONEvent{Event: jsonEventResolveStart})
+	l.startupProfile.Phase("resolve")
+
+	jnlp, err := l.resolve()
+	if err != nil {
+		return err
+	}
+
+	l.setState("downloading")
+	l.startupProfile.Phase("download")
+
+	err = l.download()
+	if err != nil {
+		return err
+	}
+
+	// the resources of other apps make room for the downloaded ones
+	common.Error(l.enforceCacheQuota())
+
+	l.startupProfile.Phase("checks")
+
+	// encrypted jars are used from a private staging area
+	err = l.stageDecrypted()
+	if err != nil {
+		return err
+	}
+
+	// the policies decide with the downloaded resources at hand
+	err = l.checkPolicies()
+	if err != nil {
+		return err
+	}
+
+	// the security element of the JNLP decides about the permissions of the app
+	err = l.checkPermissions(jnlp)
+	if err != nil {
+		return err
+	}
+
+	// libraries contributed several times by the app and its extensions are deduplicated, conflicts reported
+	err = l.checkClasspath()
+	if err != nil {
+		return err
+	}
+
+	// known vulnerable libraries in the classpath are reported or refused
+	err = l.checkVulnerabilities()
+	if err != nil {
+		return err
+	}
+
+	l.startupProfile.Phase("installers")
+
+	// installer extensions run once before the first launch of their version
+	if !l.Verify && l.Sandbox == "" {
+		err = l.runInstallers()
+		if err != nil {
+			return err
+		}
+
+		// missing shortcuts and file associations do not prevent the launch, an ephemeral cache leaves none behind
+		if storage.Persistent() {
+			common.Error(l.createShortcuts(jnlp.Information))
+			common.Error(l.registerAssociations(jnlp.Information))
+		}
+	}
+
+	// the document of a protocol handler launch is taken over from the browser
+	if !l.Verify {
+		err = l.stageOpenFile()
+		if err != nil {
+			return err
+		}
+	}
+
+	l.startupProfile.Phase("command line")
+
+	cmds, err := l.commandLine(jnlp)
+	if err != nil {
+		return err
+	}
+
+	// CI of deployment servers checks the launch without a JVM
+	if l.Verify {
+		return l.verify(cmds)
+	}
+
+	// the flight recording options precede the classpath
+	options, err := l.jfrOptions()
+	if err != nil {
+		return err
+	}
+
+	// untrusted apps are evaluated in a throwaway environment
+	if l.Sandbox != "" {
+		return l.startSandbox(l.Sandbox, append(options, cmds...))
+	}
+
+	err = l.start(append(options, cmds...))
+
+	// a hung startup is retried
+	for retry := 1; retry <= l.watchdogRetries(); retry++ {
+		var hangErr *HangError
+		if !errors.As(err, &hangErr) {
+			break
+		}
+
+		l.logf("Watchdog: retry %d of %d of the hung app", retry, l.watchdogRetries())
+
+		err = l.start(append(options, cmds...))
+	}
+
+	var startupErr *StartupError
+	if errors.As(err, &startupErr) {
+		return l.rollback(err)
+	}
+
+	return err
+}
+
+// resolve loads the JNLP file and registers its resources
+func (l *Launch) resolve() (*Jnlp, error) {
+	l.recording = newReplay(l)
+
+	jnlp := l.runJnlp(l.Address, true, nil)
+
+	if l.errors.IsSet() {
+		return nil, l.errors.Get()
+	}
+
+	l.selectInstalledJre()
+
+	// JavaFX apps on JREs without JavaFX use an OpenJFX SDK
+	err := l.resolveJavaFX(jnlp)
+	if err != nil {
+		return nil, err
+	}
+
+	// missing fonts and locales leave blank text in Swing apps on minimal Linux installations
+	err = l.preflightFonts()
+	if err != nil {
+		return nil, err
+	}
+
+	return jnlp, nil
+}
+
+// download loads the registered resources into the cache
+func (l *Launch) download() error {
+	list := l.registeredTasks()
+
+	// the index is stored once for all resources
+	err := beginIndexBatch()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		common.Error(endIndexBatch())
+	}()
+
+	// fail early if the resources do not fit into the cache, an offline launch downloads nothing
+	if !l.offline {
+		err = checkDiskSpace(list)
+		if err != nil {
+			return err
+		}
+	}
+
+	// one manifest request revalidates all cached resources
+	l.revalidate(list)
+
+	// the progress class of the app shows the downloads, its jar is downloaded first
+	list = l.startProgressClass(list)
+
+	defer l.stopProgressClass()
+
+	l.runTasks(list)
+
+	if l.errors.IsSet() {
+		return l.errors.Get()
+	}
+
+	if l.replay != nil {
+		l.replay.Compare(l.recording)
+	}
+
+	return nil
+}
+
+// commandLine returns the java command line parameters of the app
+func (l *Launch) commandLine(jnlp *Jnlp) ([]string, error) {
+	// cmd line parameters
+	var cmds []string
+
+	// if maxheapsize is provided then registr it to the cmds
+	if len(l.maxheapsize) > 0 {
+		cmds = append(cmds, "-Xmx"+l.maxheapsize)
+	}
+
+	// the initial heap avoids the warm-up pauses of growing the heap
+	if len(l.initialheapsize) > 0 {
+		cmds = append(cmds, "-Xms"+l.initialheapsize)
+	}
+
+	// the JVM options of the JNLP like --add-opens, sandboxed apps cannot weaken their sandbox
+	cmds = append(cmds, l.javaVMArgs(jnlp)...)
+
+	// the app can correlate its logs with the ones of the launcher
+	cmds = append(cmds, fmt.Sprintf("-D%s=%s", launchIDProperty, l.ID))
+
+	// the persistent data of the app imported from Java Web Start
+	if store, err := muffinStorePath(l.Address); err == nil && common.FileExists(store) {
+		cmds = append(cmds, fmt.Sprintf("-D%s=%s", muffinStoreProperty, store))
+	}
+
+	// let the app show its own icon instead of the generic Java one
+	cmds = append(cmds, l.iconOptions(jnlp.Information)...)
+
+	// legacy Swing/OpenGL apps often need switches of the rendering pipeline
+	cmds = append(cmds, l.graphicsOptions()...)
+
+	// the modules of the OpenJFX SDK for JavaFX apps
+	javafx, err := l.javafxOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	cmds = append(cmds, javafx...)
+
+	if jnlp.JavafxDesc != nil && jnlp.JavafxDesc.PreloaderClass != "" {
+		cmds = append(cmds, "-Djavafx.preloader="+jnlp.JavafxDesc.PreloaderClass)
+	}
+
+	// the JNLP properties configure the app
+	properties := l.appProperties(jnlp)
+
+	for _, property := range properties {
+		cmds = append(cmds, fmt.Sprintf("-D%s=%s", property.Name, property.Value))
+	}
+
+	// the profile of the user preferences
+	cmds = append(cmds, l.prefsOptions()...)
+
+	if len(l.nativelibs) > 0 {
+		// add the nativelib objects to the cmds
+		cmds = append(cmds, "-Djava.library.path="+strings.Join(l.nativelibs, string(filepath.ListSeparator)))
+	}
+
+	// apps without all-permissions run sandboxed, the last definition of a system property wins
+	options, err := l.sandboxOptions(jnlp, properties)
+	if err != nil {
+		return nil, err
+	}
+
+	cmds = append(cmds, options...)
+
+	// values of the $$name and ${name} variables in the app arguments
+	values := l.variables()
+
+	// applets are the only alternative to apps, an application-desc without main-class is allowed
+	if jnlp.ApplicationDesc.XMLName.Local != "" || jnlp.AppletDesc.MainClass == "" {
+		if l.App.JarLaunch || l.JarLaunch {
+			// java -jar fails late without a Main-Class in the manifest of the main jar
+			_, err := manifestMainClass(l.mainJar)
+			if err != nil {
+				return nil, err
+			}
+
+			// the main jar is launched with its own manifest Class-Path
+			cmds = append(cmds, "-jar", l.mainJar)
+		} else {
+			// add the jars to the cmds
+			cmds = append(cmds, "-cp")
+			cmds = append(cmds, strings.Join(l.jars, string(filepath.ListSeparator)))
+
+			mainClass := jnlp.ApplicationDesc.MainClass
+
+			// the JavaFX launcher of the JRE starts the Application class of a javafx-desc
+			if mainClass == "" && jnlp.JavafxDesc != nil {
+				mainClass = jnlp.JavafxDesc.MainClass
+			}
+
+			if mainClass == "" {
+				// take the main class from the manifest of the main jar
+				var err error
+
+				mainClass, err = manifestMainClass(l.mainJar)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			// add the execution main class to the cmds
+			cmds = append(cmds, mainClass)
+		}
+
+		// add the provided app arguments to the cmds
+		for _, argument := range jnlp.ApplicationDesc.Arguments {
+			cmds = append(cmds, expandVariables(argument.Text, values))
+		}
+
+		// the additional arguments of the user preferences
+		cmds = append(cmds, l.prefs.Args...)
+
+		// a file opened by a file association is passed like Java Web Start did
+		cmds = append(cmds, l.openOptions()...)
+	} else {
+		// the applet runner hosts the applet with the size and params of the applet-desc
+		runner, err := l.appletRunnerJar()
+		if err != nil {
+			common.Warn(fmt.Sprintf("The applet is started by its main class, which works for applets with a main method only: %v", err))
+		}
+
+		if runner != "" {
+			cmds = append(cmds, "-cp")
+			cmds = append(cmds, strings.Join(append(append([]string{}, l.jars...), runner), string(filepath.ListSeparator)))
+			cmds = append(cmds, appletRunnerClass)
+
+			args, err := l.appletArguments(jnlp.AppletDesc, values)
+			if err != nil {
+				return nil, err
+			}
+
+			cmds = append(cmds, args...)
+		} else {
+			// add the jars to the cmds
+			cmds = append(cmds, "-cp")
+			cmds = append(cmds, strings.Join(l.jars, string(filepath.ListSeparator)))
+
+			// add the execution main class to the cmds
+			cmds = append(cmds, jnlp.AppletDesc.MainClass)
+
+			// add the provided app arguments to the cmds
+			for _, param := range jnlp.AppletDesc.Params {
+				cmds = append(cmds, expandVariables(param.Text, values))
+			}
+		}
+
+		// the additional arguments of the user preferences, "name=value" ones are applet params for the applet runner
+		cmds = append(cmds, l.prefs.Args...)
+	}
+
+	return cmds, nil
+}
+
+// start executes the app with the given java command line parameters
+func (l *Launch) start(cmds []string) error {
+	common.Debug(fmt.Sprintf("Command line: %s %s", l.Jre, strings.Join(cmds, " ")))
+	l.logf("Command line: %s %s", l.Jre, strings.Join(cmds, " "))
+
+	// store the resolved inputs of this launch for later replays
+	l.recording.Jre = l.Jre
+	l.recording.CommandLine = cmds
+
+	appPath, err := appCachePath(l.Address)
+	if err != nil {
+		return err
+	}
+
+	err = l.recording.Save(filepath.Join(appPath, "replay.zip"))
+	if err != nil {
+		return err
+	}
+
+	// initialize the app cmd
+	cmd := exec.Command(l.Jre, cmds...)
+
+	if l.Console {
+		// console apps get the IO streams of espresso and run in the foreground
+		err := attachConsole()
+		if err != nil {
+			return err
+		}
+
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	} else {
+		// capture the output of the app for "espresso logs"
+		appLog, err := l.createAppLog()
+		if err != nil {
+			return err
+		}
+
+		// the app keeps its own handle of the log file
+		defer func() {
+			common.Error(appLog.Close())
+		}()
+
+		cmd.Stdout = appLog
+		cmd.Stderr = appLog
+	}
+
+	// hybrid-GPU machines render the app with the preferred GPU
+	env, err := l.gpuPreference()
+	if err != nil {
+		return err
+	}
+
+	// the fallback fonts and the locale of the preflight
+	fontsEnv, err := l.fontsEnvironment()
+	if err != nil {
+		return err
+	}
+
+	env = append(env, fontsEnv...)
+
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	// a hung startup of a waited app is diagnosed by thread dumps
+	watchdog, err := l.newWatchdog()
+	if err != nil {
+		return err
+	}
+
+	// provide the network drives the app relies on
+	mounted, err := mountShares(l.App.Mounts)
+	if err != nil {
+		return err
+	}
+
+	l.startupProfile.Phase("jvm start")
+
+	// execute the app cmd
+	err = cmd.Start()
+	if common.Error(err) {
+		unmountShares(mounted)
+
+		return err
+	}
+
+	l.logf("Started app with PID %d", cmd.Process.Pid)
+	l.setState("started")
+	l.emitEvent(JSONEvent{Event: jsonEventLaunch, PID: cmd.Process.Pid})
+
+	watchdog.watch(cmd.Process)
+
+	// the lazy resources are fetched and the app is updated while the app is running
+	prefetched := l.prefetchLazy()
+	updated := l.updateInBackground()
+
+	// the registry entry is removed after the end of the app or as soon as the process is detected as ended
+	common.Error(registerInstance(l.Address, cmd.Process.Pid))
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	// progress displays end when the app becomes visible instead of on a timer
+	if !l.Console && (l.StatusPage || *jsonEvents || l.startupProfile != nil) {
+		l.awaitFirstWindow(cmd.Process.Pid)
+	}
+
+	// the startup ends with the first app window, console apps with their start
+	l.reportProfile()
+
+	exited := false
+
+	if l.App.Rollback.Enabled {
+		// an app which fails during its startup window is rolled back
+		exited, err = l.awaitStartup(done)
+		if err != nil {
+			// an app killed by the watchdog is no failed update
+			if hangErr := watchdog.Stop(); hangErr != nil {
+				err = hangErr
+			}
+
+			l.appEnded(cmd.ProcessState)
+
+			common.Error(unregisterInstance(l.Address, cmd.Process.Pid))
+
+			unmountShares(mounted)
+
+			return err
+		}
+
+		if !l.rolledBack {
+			common.Error(l.saveLastGood(cmds))
+		}
+	}
+
+	if !l.Console && !l.Wait {
+		<-prefetched
+		<-updated
+
+		return nil
+	}
+
+	// wait for the end of the app
+	if !exited {
+		err = <-done
+	}
+
+	l.appEnded(cmd.ProcessState)
+
+	common.Error(unregisterInstance(l.Address, cmd.Process.Pid))
+
+	unmountShares(mounted)
+
+	<-prefetched
+	<-updated
+
+	// the staged resources are kept for the retry of a hung app
+	if hangErr := watchdog.Stop(); hangErr != nil {
+		return hangErr
+	}
+
+	l.removeStaging()
+	l.removeHandoff()
+
+	common.Error(l.uploadRecording())
+
+	return err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+)
+
+// launchIDProperty is the system property which passes the launch ID to the app
+const launchIDProperty = "espresso.launch.id"
+
+// newLaunchID creates a random UUID (version 4) which correlates the logs of the launcher and the app
+func newLaunchID() string {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// withLaunchID returns the command line with the launch ID of this launch, e.g. for a recorded command line
+func (l *Launch) withLaunchID(cmds []string) []string {
+	option := fmt.Sprintf("-D%s=%s", launchIDProperty, l.ID)
+
+	result := make([]string, 0, len(cmds)+1)
+
+	replaced := false
+
+	for _, cmd := range cmds {
+		if strings.HasPrefix(cmd, "-D"+launchIDProperty+"=") {
+			cmd = option
+			replaced = true
+		}
+
+		result = append(result, cmd)
+	}
+
+	if !replaced {
+		result = append([]string{option}, result...)
+	}
+
+	return result
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"github.com/mpetavy/common"
+)
+
+const (
+	downloadLazy = "lazy"
+)
+
+// Package element mapping Java packages to a part
+type Package struct {
+	Name      string `xml:"name,attr"`
+	Part      string `xml:"part,attr"`
+	Recursive bool   `xml:"recursive,attr"`
+}
+
+// eagerParts returns the parts of the selected resources which contain an eager jar, such parts are downloaded as a whole
+func (l *Launch) eagerParts(jnlp *Jnlp) map[string]bool {
+	parts := make(map[string]bool)
+
+	for _, resource := range jnlp.Resources {
+		if !l.isSelected(resource.Os, resource.Arch) {
+			continue
+		}
+
+		for _, jar := range resource.Jars {
+			if jar.Part != "" && jar.Download != downloadLazy {
+				parts[jar.Part] = true
+			}
+		}
+	}
+
+	return parts
+}
+
+// isLazy checks if the jar is fetched after the launch instead of at startup
+func (l *Launch) isLazy(jar Jar, eagerParts map[string]bool, isMain bool) bool {
+	// the main jar is needed at startup, a verification and the signature check of all-permissions apps need all jars,
+	// the app setting "prefetch-lazy" fetches them at startup as well
+	if isMain || l.Verify || l.signatureCheck || l.App.PrefetchLazy {
+		return false
+	}
+
+	return jar.Download == downloadLazy && !eagerParts[jar.Part]
+}
+
+// addLazyTask registers a resource for the prefetch after the launch
+func (l *Launch) addLazyTask(task Task) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lazyTasks = append(l.lazyTasks, task)
+}
+
+// prefetchLazy downloads the lazy resources in the background, since they are on the classpath the app needs them as
+// soon as it loads their classes. The returned channel is closed after the prefetch.
+func (l *Launch) prefetchLazy() chan struct{} {
+	done := make(chan struct{})
+
+	l.mu.Lock()
+	list := append([]Task{}, l.lazyTasks...)
+	l.mu.Unlock()
+
+	if len(list) == 0 {
+		close(done)
+
+		return done
+	}
+
+	go func() {
+		defer close(done)
+
+		// the index is stored once for all lazy resources
+		err := beginIndexBatch()
+		if common.Error(err) {
+			return
+		}
+
+		defer func() {
+			common.Error(endIndexBatch())
+		}()
+
+		l.mu.Lock()
+		l.done = 0
+		l.total = len(list)
+		l.mu.Unlock()
+
+		// one after the other, so the prefetch does not compete with the running app for the bandwidth
+		for _, task := range list {
+			l.wg.Add(1)
+			l.runResource(task)
+		}
+
+		// the app is already running, so failures are only logged
+		if l.errors.IsSet() {
+			l.logf("Prefetch of lazy resources failed: %v", l.errors.Get())
+
+			return
+		}
+
+		l.logf("Prefetched %d lazy resources", len(list))
+	}()
+
+	return done
+}
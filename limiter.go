@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mpetavy/common"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// hostLimit is the adaptive download limit of a single host
+type hostLimit struct {
+	limit      float64
+	active     int
+	throughput float64
+}
+
+// Limiter limits the concurrent downloads globally and per host. The per host limit adapts to the host: it grows
+// slowly with successful downloads and is halved on errors or a collapsing throughput, so a slow or overloaded host
+// does not starve the downloads from other hosts.
+type Limiter struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	global  int
+	perHost int
+	active  int
+	hosts   map[string]*hostLimit
+}
+
+var (
+	downloadLimiterOnce  sync.Once
+	downloadLimiterValue *Limiter
+)
+
+// newLimiter creates a limiter with the given global and per host limits, 0 means unlimited
+func newLimiter(global int, perHost int) *Limiter {
+	limiter := &Limiter{
+		global:  global,
+		perHost: perHost,
+		hosts:   make(map[string]*hostLimit),
+	}
+
+	limiter.cond = sync.NewCond(&limiter.mu)
+
+	return limiter
+}
+
+// downloadLimiter returns the limiter shared by all launches of the process
+func downloadLimiter() *Limiter {
+	downloadLimiterOnce.Do(func() {
+		downloadLimiterValue = newLimiter(*maxDownloads, *maxHostDownloads)
+	})
+
+	return downloadLimiterValue
+}
+
+// host returns the limit of the host, new hosts start with half of the per host limit
+func (limiter *Limiter) host(name string) *hostLimit {
+	h, ok := limiter.hosts[name]
+	if !ok {
+		h = &hostLimit{limit: max(1, float64(limiter.perHost)/2)}
+
+		limiter.hosts[name] = h
+	}
+
+	return h
+}
+
+// acquire waits for a free download slot of the host of href
+func (limiter *Limiter) acquire(href string) string {
+	name := href
+	if u, err := url.Parse(href); err == nil {
+		name = u.Host
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	h := limiter.host(name)
+
+	for (limiter.global > 0 && limiter.active >= limiter.global) || (limiter.perHost > 0 && float64(h.active) >= h.limit) {
+		limiter.cond.Wait()
+	}
+
+	limiter.active++
+	h.active++
+
+	return name
+}
+
+// release frees the download slot and adapts the limit of the host by the outcome of the download
+func (limiter *Limiter) release(name string, size int64, elapsed time.Duration, err error) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	h := limiter.host(name)
+
+	limiter.active--
+	h.active--
+
+	if limiter.perHost > 0 {
+		previous := h.limit
+
+		switch {
+		case err != nil && isOverloadError(err):
+			h.limit = max(1, h.limit/2)
+		case err == nil && size > 0 && elapsed > 0:
+			throughput := float64(size) / elapsed.Seconds()
+
+			// a collapsing throughput indicates a saturated host or link
+			if h.throughput > 0 && throughput < h.throughput/4 {
+				h.limit = max(1, h.limit/2)
+			} else {
+				h.limit = min(float64(limiter.perHost), h.limit+1/h.limit)
+			}
+
+			if h.throughput == 0 {
+				h.throughput = throughput
+			} else {
+				h.throughput = 0.8*h.throughput + 0.2*throughput
+			}
+		}
+
+		if int(previous) != int(h.limit) {
+			common.Debug(fmt.Sprintf("Download limit of %s: %d", name, int(h.limit)))
+		}
+	}
+
+	limiter.cond.Broadcast()
+}
+
+// isOverloadError checks if the error indicates an overloaded host or network
+func isOverloadError(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	return isConnectivityError(err)
+}
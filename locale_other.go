@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// userLocale returns the locale of the user like "de_DE"
+func userLocale() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(env)
+
+		if value != "" && value != "C" && value != "POSIX" {
+			return localeOf(value)
+		}
+	}
+
+	return "en_US"
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetUserDefaultLocaleName = kernel32.NewProc("GetUserDefaultLocaleName")
+
+// localeNameMaxLength is the LOCALE_NAME_MAX_LENGTH of the Windows API
+const localeNameMaxLength = 85
+
+// userLocale returns the locale of the user like "de_DE"
+func userLocale() string {
+	buf := make([]uint16, localeNameMaxLength)
+
+	r, _, _ := procGetUserDefaultLocaleName.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if r == 0 {
+		return "en_US"
+	}
+
+	return localeOf(syscall.UTF16ToString(buf))
+}
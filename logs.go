@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// appLogFile captures stdout/stderr of the most recent launch of the app
+	appLogFile = "app.log"
+	// launcherLogFile holds the launcher messages of the most recent launch of the app
+	launcherLogFile = "launcher.log"
+)
+
+// encryptedLogMagic marks a log of encrypted records, each record is the big-endian length of the sealed content
+// followed by it
+var encryptedLogMagic = []byte("ESPLOG1\n")
+
+// encryptedLog encrypts every write to the log as a record of its own, so the log can be followed while it is written
+type encryptedLog struct {
+	f       *os.File
+	written bool
+}
+
+func (w *encryptedLog) Write(p []byte) (int, error) {
+	sealed, err := seal(p)
+	if err != nil {
+		return 0, err
+	}
+
+	var record []byte
+
+	// an empty log stays empty, so the header is written with the first record
+	if !w.written {
+		record = append(record, encryptedLogMagic...)
+	}
+
+	record = binary.BigEndian.AppendUint32(record, uint32(len(sealed)))
+	record = append(record, sealed...)
+
+	_, err = w.f.Write(record)
+	if err != nil {
+		return 0, err
+	}
+
+	w.written = true
+
+	return len(p), nil
+}
+
+func (w *encryptedLog) Close() error {
+	return w.f.Close()
+}
+
+// createLog creates the log file, with the cache encryption its content is encrypted as well
+func (l *Launch) createLog(filename string) (io.WriteCloser, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if !l.Config.Encryption.Enabled {
+		return f, nil
+	}
+
+	return &encryptedLog{f: f}, nil
+}
+
+// readLog returns the plain content of the log from the offset on and the offset of its end. Encrypted logs are read up
+// to their last complete record, the offsets count the bytes of the file.
+func readLog(filename string, offset int64) ([]byte, int64, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset = min(offset, int64(len(content)))
+
+	if !bytes.HasPrefix(content, encryptedLogMagic) {
+		// the header of an encrypted log is not completely written yet
+		if len(content) < len(encryptedLogMagic) && bytes.HasPrefix(encryptedLogMagic, content) {
+			return nil, 0, nil
+		}
+
+		return content[offset:], int64(len(content)), nil
+	}
+
+	offset = max(offset, int64(len(encryptedLogMagic)))
+
+	var plain []byte
+
+	for int64(len(content))-offset >= 4 {
+		size := int64(binary.BigEndian.Uint32(content[offset:]))
+		if int64(len(content))-offset-4 < size {
+			break
+		}
+
+		record, err := unseal(content[offset+4 : offset+4+size])
+		if err != nil {
+			return nil, 0, fmt.Errorf("cannot decrypt %s: %w", filename, err)
+		}
+
+		plain = append(plain, record...)
+		offset += 4 + size
+	}
+
+	return plain, offset, nil
+}
+
+// openLogs creates the log files of the launch in the app log directory
+func (l *Launch) openLogs() error {
+	logPath, err := appLogPath(l.Address)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(logPath, common.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
+	l.launcherLog, err = l.createLog(filepath.Join(logPath, launcherLogFile))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// closeLogs closes the launcher log
+func (l *Launch) closeLogs() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.launcherLog != nil {
+		common.Error(l.launcherLog.Close())
+
+		l.launcherLog = nil
+	}
+}
+
+// logf writes a timestamped message to the launcher log
+func (l *Launch) logf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.launcherLog == nil {
+		return
+	}
+
+	_, err := fmt.Fprintf(l.launcherLog, "%s %s %s\n", time.Now().Format(time.DateTime), l.ID, fmt.Sprintf(format, args...))
+	common.Error(err)
+}
+
+// createAppLog creates the file which captures stdout/stderr of the app
+func (l *Launch) createAppLog() (io.WriteCloser, error) {
+	logPath, err := appLogPath(l.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.createLog(filepath.Join(logPath, appLogFile))
+}
+
+// runLogs prints the app or launcher log of the most recent launch of the app, in follow mode new content is printed continuously
+func runLogs(cfg *Config, name string, follow bool, launcher bool) error {
+	app := cfg.App(name)
+
+	logPath, err := appLogPath(app.URL)
+	if err != nil {
+		return err
+	}
+
+	filename := filepath.Join(logPath, appLogFile)
+	if launcher {
+		filename = filepath.Join(logPath, launcherLogFile)
+	}
+
+	if !common.FileExists(filename) {
+		return fmt.Errorf("there is no log of %s available", name)
+	}
+
+	var offset int64
+
+	for {
+		size, err := common.FileSize(filename)
+		if err != nil {
+			return err
+		}
+
+		// the log has been recreated by a new launch
+		if size < offset {
+			offset = 0
+		}
+
+		if size > offset {
+			plain, end, err := readLog(filename, offset)
+			if err != nil {
+				return err
+			}
+
+			_, err = os.Stdout.Write(plain)
+			if err != nil {
+				return err
+			}
+
+			offset = end
+		}
+
+		if !follow {
+			return nil
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+}
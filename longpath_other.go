@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// longPath returns the path as it is, only Windows limits the path length to MAX_PATH
+func longPath(path string) string {
+	return path
+}
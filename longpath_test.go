@@ -0,0 +1,155 @@
+package main
+
+import (
+	"archive/zip"
+	"github.com/mpetavy/common"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// longTestPath is the min. length of the paths of the tests, beyond the MAX_PATH limit of Windows
+const longTestPath = 300
+
+// deepDir returns a directory below base whose path is longer than length characters
+func deepDir(base string, length int) string {
+	dir := base
+
+	for i := 0; len(dir) <= length; i++ {
+		dir = filepath.Join(dir, strings.Repeat(string(rune('a'+i%26)), 40))
+	}
+
+	return dir
+}
+
+func TestLongPathFiles(t *testing.T) {
+	dir := deepDir(t.TempDir(), longTestPath)
+
+	tests := []struct {
+		name    string
+		path    string
+		content string
+	}{
+		{"jar", filepath.Join(dir, "lib", "app.jar"), "jar"},
+		{"nested", filepath.Join(dir, strings.Repeat("x", 40), "native", "lib.so"), "native"},
+		{"long name", filepath.Join(dir, strings.Repeat("n", 200)+".jar"), "long name"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if len(test.path) <= longTestPath {
+				t.Fatalf("the path of %d characters is too short", len(test.path))
+			}
+
+			err := os.MkdirAll(filepath.Dir(test.path), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			unlock, err := lockFile(test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = writeFileAtomic(test.path, []byte(test.content))
+
+			unlock()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ba, err := storage.ReadFile(test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(ba) != test.content {
+				t.Errorf("read %q, want %q", ba, test.content)
+			}
+
+			renamed := test.path + ".old"
+
+			err = os.Rename(test.path, renamed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !common.FileExists(renamed) || common.FileExists(test.path) {
+				t.Errorf("%s was not renamed", test.path)
+			}
+		})
+	}
+
+	err := os.RemoveAll(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLongPathUnzip(t *testing.T) {
+	base := useMemoryStorage(t)
+
+	archive := filepath.Join(deepDir(base, longTestPath), "natives.zip")
+
+	err := os.MkdirAll(filepath.Dir(archive), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := map[string]string{
+		"lib.so":                           "lib",
+		"sub/dir/other.so":                 "other",
+		strings.Repeat("d", 60) + "/a.dll": "dll",
+	}
+
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := zip.NewWriter(f)
+
+	for name, content := range entries {
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = entry.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := deepDir(filepath.Join(base, "app"), longTestPath)
+
+	err = runUnzipLinked(archive, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range entries {
+		path := filepath.Join(dest, filepath.FromSlash(name))
+
+		ba, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(ba) != content {
+			t.Errorf("%s has %q, want %q", name, ba, content)
+		}
+	}
+}
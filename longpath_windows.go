@@ -0,0 +1,25 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxPath is the MAX_PATH limit of the Windows API, directories are limited to 248 characters
+const maxPath = 248
+
+// longPath returns the \\?\ form of a long absolute path, the cache files and external tools are accessed by it
+// beyond MAX_PATH
+func longPath(path string) string {
+	if len(path) < maxPath || strings.HasPrefix(path, `\\?\`) || !filepath.IsAbs(path) {
+		return path
+	}
+
+	path = filepath.Clean(path)
+
+	if strings.HasPrefix(path, `\\`) {
+		return `\\?\UNC\` + path[2:]
+	}
+
+	return `\\?\` + path
+}
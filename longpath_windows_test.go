@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLongPath(t *testing.T) {
+	long := strings.Repeat(`\abcdefghij`, 30)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"short", `C:\cache\app.jar`, `C:\cache\app.jar`},
+		{"drive", `C:` + long + `\app.jar`, `\\?\C:` + long + `\app.jar`},
+		{"unc", `\\server\share` + long + `\app.jar`, `\\?\UNC\server\share` + long + `\app.jar`},
+		{"prefixed", `\\?\C:` + long, `\\?\C:` + long},
+		{"relative", `cache` + long, `cache` + long},
+		{"cleaned", `C:` + long + `\sub\..\app.jar`, `\\?\C:` + long + `\app.jar`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.name != "short" && len(test.path) <= longTestPath {
+				t.Fatalf("the path of %d characters is too short", len(test.path))
+			}
+
+			got := longPath(test.path)
+			if got != test.want {
+				t.Errorf("longPath(%q) = %q, want %q", test.path, got, test.want)
+			}
+		})
+	}
+}
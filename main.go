@@ -1,9 +1,11 @@
 package main
 
 import (
-	"archive/zip"
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"encoding/xml"
 	"flag"
 	"fmt"
@@ -18,7 +20,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 )
 
 // Jnlp element
@@ -26,33 +28,79 @@ type Jnlp struct {
 	XMLName         xml.Name
 	Spec            string          `xml:"spec,attr"`
 	Codebase        string          `xml:"codebase,attr"`
-	Information     Information     `xml:"information"`
+	Href            string          `xml:"href,attr"`
+	Informations    []Information   `xml:"information"`
+	Information     Information     `xml:"-"`
+	Security        Security        `xml:"security"`
 	Resources       []Resource      `xml:"resources"`
 	PrivateJres     []PrivateJre    `xml:"private_jre"`
 	ApplicationDesc ApplicationDesc `xml:"application-desc"`
 	AppletDesc      AppletDesc      `xml:"applet-desc"`
+	ComponentDesc   *struct{}       `xml:"component-desc"`
+	InstallerDesc   *InstallerDesc  `xml:"installer-desc"`
+	JavafxDesc      *JavafxDesc     `xml:"javafx-desc"`
+	Update          *Update         `xml:"update"`
+	Espresso        Espresso        `xml:"espresso"`
+}
+
+// Espresso element with server announcements for espresso
+type Espresso struct {
+	MinVersion   string        `xml:"min-version,attr"`
+	Maintenances []Maintenance `xml:"maintenance"`
+	Rollout      *Rollout      `xml:"rollout"`
+}
+
+// Maintenance element announcing a maintenance window
+type Maintenance struct {
+	From    string `xml:"from,attr"`
+	To      string `xml:"to,attr"`
+	Block   bool   `xml:"block,attr"`
+	Message string `xml:",chardata"`
+}
+
+// Security element
+type Security struct {
+	AllPermissions                   *struct{} `xml:"all-permissions"`
+	J2eeApplicationClientPermissions *struct{} `xml:"j2ee-application-client-permissions"`
 }
 
 // Information element
 type Information struct {
-	XMLName     xml.Name
-	Title       string `xml:"title"`
-	Vendor      string `xml:"vendor"`
-	Homepage    string `xml:"homepage"`
-	Description string `xml:"description"`
-	Icon        Icon   `xml:"icon"`
+	XMLName        xml.Name
+	Locale         string        `xml:"locale,attr"`
+	Title          string        `xml:"title"`
+	Vendor         string        `xml:"vendor"`
+	Homepage       string        `xml:"homepage"`
+	Description    string        `xml:"description"`
+	Icons          []Icon        `xml:"icon"`
+	Shortcut       *Shortcut     `xml:"shortcut"`
+	Associations   []Association `xml:"association"`
+	OfflineAllowed *struct{}     `xml:"offline-allowed"`
 }
 
 // Icon element
 type Icon struct {
 	Href string `xml:"href,attr"`
+	Kind string `xml:"kind,attr"`
+}
+
+// DefaultIcon returns the icon of kind "default" or without kind, nil if there is none
+func (information *Information) DefaultIcon() *Icon {
+	for i := range information.Icons {
+		if information.Icons[i].Kind == "" || information.Icons[i].Kind == "default" {
+			return &information.Icons[i]
+		}
+	}
+
+	return nil
 }
 
 // ApplicationDesc element
 type ApplicationDesc struct {
-	XMLName   xml.Name
-	MainClass string     `xml:"main-class,attr"`
-	Arguments []Argument `xml:"argument"`
+	XMLName       xml.Name
+	MainClass     string     `xml:"main-class,attr"`
+	ProgressClass string     `xml:"progress-class,attr"`
+	Arguments     []Argument `xml:"argument"`
 }
 
 // Argument element
@@ -63,14 +111,21 @@ type Argument struct {
 
 // AppletDesc element
 type AppletDesc struct {
-	XMLName   xml.Name
-	MainClass string  `xml:"main-class,attr"`
-	Params    []Param `xml:"param"`
+	XMLName       xml.Name
+	MainClass     string  `xml:"main-class,attr"`
+	ProgressClass string  `xml:"progress-class,attr"`
+	Name          string  `xml:"name,attr"`
+	DocumentBase  string  `xml:"documentbase,attr"`
+	Width         string  `xml:"width,attr"`
+	Height        string  `xml:"height,attr"`
+	Params        []Param `xml:"param"`
 }
 
 // Param element
 type Param struct {
 	XMLName xml.Name
+	Name    string `xml:"name,attr"`
+	Value   string `xml:"value,attr"`
 	Text    string `xml:",chardata"`
 }
 
@@ -84,6 +139,16 @@ type Resource struct {
 	Jars       []Jar       `xml:"jar"`
 	Nativelibs []Jar       `xml:"nativelib"`
 	Extensions []Extension `xml:"extension"`
+	Packages   []Package   `xml:"package"`
+	Properties []Property  `xml:"property"`
+	// JavafxRuntimes of the JavaFX extension, the namespace prefix "jfx" is ignored
+	JavafxRuntimes []JavafxRuntime `xml:"javafx-runtime"`
+}
+
+// Property element defining a system property of the app
+type Property struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
 }
 
 // PrivateJre element
@@ -92,24 +157,35 @@ type PrivateJre struct {
 	Os      string `xml:"os,attr"`
 	Arch    string `xml:"arch,attr"`
 	Href    string `xml:"href,attr"`
+	SHA256  string `xml:"sha256,attr"`
+	SHA1    string `xml:"sha1,attr"`
 	Path    string
 	URL     *url.URL
 }
 
 // J2se element
 type J2se struct {
-	XMLName     xml.Name
-	Href        string `xml:"href,attr"`
-	Version     string `xml:"version,attr"`
-	MaxHeapSize string `xml:"max-heap-size,attr"`
+	XMLName         xml.Name
+	Href            string     `xml:"href,attr"`
+	Version         string     `xml:"version,attr"`
+	MaxHeapSize     string     `xml:"max-heap-size,attr"`
+	InitialHeapSize string     `xml:"initial-heap-size,attr"`
+	JavaVMArgs      string     `xml:"java-vm-args,attr"`
+	Resources       []Resource `xml:"resources"`
 }
 
 // Jar element
 type Jar struct {
-	XMLName xml.Name
-	Href    string `xml:"href,attr"`
-	Path    string
-	URL     *url.URL
+	XMLName  xml.Name
+	Href     string `xml:"href,attr"`
+	Version  string `xml:"version,attr"`
+	Download string `xml:"download,attr"`
+	Part     string `xml:"part,attr"`
+	Main     string `xml:"main,attr"`
+	SHA256   string `xml:"sha256,attr"`
+	SHA1     string `xml:"sha1,attr"`
+	Path     string
+	URL      *url.URL
 }
 
 // Extension element
@@ -121,18 +197,62 @@ type Extension struct {
 }
 
 var (
-	address *string
-	jrepath *string
-	arch    *string
-	cache   *string
+	address          *string
+	jrepath          *string
+	arch             *string
+	cache            *string
+	sessionCache     *string
+	storageMode      *string
+	config           *string
+	console          *bool
+	jarLaunch        *bool
+	skew             *time.Duration
+	dest             *string
+	mirrorURL        *string
+	osList           *string
+	allPlatforms     *bool
+	extractFactor    *float64
+	wait             *bool
+	adminURL         *string
+	adminKey         *string
+	adminTTL         *time.Duration
+	osEventLog       *bool
+	exposeProps      *bool
+	requireHTTPS     *string
+	jfr              *bool
+	follow           *bool
+	windowTimeout    *time.Duration
+	sandbox          *string
+	verifyLaunch     *bool
+	listen           *string
+	jsonEvents       *bool
+	networkWait      *time.Duration
+	ipFamilyFlag     *string
+	fallbackDelay    *time.Duration
+	offline          *bool
+	trust            *bool
+	appArgs          *string
+	profile          *string
+	jnlpHistoryMax   *int
+	maxDownloads     *int
+	maxHostDownloads *int
+	statusPage       *bool
+	launcherLogs     *bool
+	shortcuts        *bool
+	lockdir          *string
+	pattern          *string
+	catalogURL       *string
+	fontCheck        *string
+	signKey          *string
+	associations     *bool
+	openFile         *string
+	updateTimeout    *time.Duration
+	profileStartup   *bool
+	profileFile      *string
+	cacheQuotaFlag   *string
+	agentInterval    *time.Duration
 
 	operatingsystem string
-	jars            string
-	nativelibs      string
-	maxheapsize     string
-	wg              sync.WaitGroup
-	mutex           = &sync.Mutex{}
-	channelError    = common.NewSync[error]()
 )
 
 //go:embed go.mod
@@ -145,22 +265,85 @@ func init() {
 
 	address = flag.String("url", "", "URL to JNLP file")
 	jrepath = flag.String("jre", "", "Path to the java executable file")
+	appArgs = flag.String("args", "", "Additional app arguments separated by spaces, remembered in the user preferences of the app")
+	profile = flag.String("profile", "", "Profile which is passed to the app as system property espresso.profile, remembered in the user preferences of the app")
 	arch = flag.String("arch", runtime.GOARCH, "Used architecture")
 	cache = flag.String("cache", fmt.Sprintf("%s%c%s", usr.HomeDir, os.PathSeparator, ".espresso"), "Cache path for permanent caching")
+	cacheQuotaFlag = flag.String("cache-quota", "", "Max. size of the cache like 10GB, the resources of the least recently launched apps are evicted (default: cache-quota of the config)")
+	sessionCache = flag.String("session-cache", sessionCacheAuto, "Cache handling on Citrix/RDS servers: off, auto (default cache on a network profile is moved to the local profile), session (additionally one cache per session)")
+	storageMode = flag.String("storage", storageDisk, "Storage of the cache: disk or memory (ephemeral cache in a tmpfs which is removed at the end, for containers and tests)")
+	config = flag.String("config", "", "Path to the espresso config file (default: espresso.json in the cache path)")
+	adminURL = flag.String("admin-config-url", "", "URL to the centrally hosted admin config")
+	adminKey = flag.String("admin-config-key", "", "Base64 encoded ed25519 public key to verify the admin config signature")
+	adminTTL = flag.Duration("admin-config-ttl", time.Hour, "Time how long the cached admin config is used before it is fetched again")
+	osEventLog = flag.Bool("eventlog", false, "Report launch events to the OS event log (Windows event log, syslog/journald)")
+	exposeProps = flag.Bool("expose-jnlp-props", false, "Report the system properties, environment, classpath and security settings of Java Webstart and espresso instead of launching the app")
+	requireHTTPS = flag.String("require-https", "", "Handling of plain HTTP URLs: true (refuse), upgrade (upgrade to HTTPS) or allow (default: security.require-https of the config)")
+	jfr = flag.Bool("jfr", false, "Launch the app with Java Flight Recorder enabled")
+	statusPage = flag.Bool("status-page", false, "Shows the launch progress on a localhost page in the browser (experimental)")
+	updateTimeout = flag.Duration("update-timeout", 1500*time.Millisecond, "Max. time of the update check of apps with the JNLP update check \"timeout\"")
+	networkWait = flag.Duration("network-wait", 5*time.Minute, "Max. time downloads are paused and retried after a lost network connection, 0 fails immediately")
+	ipFamilyFlag = flag.String("ip-family", ipFamilyAuto, "IP family of the connections: auto, prefer-ipv4, prefer-ipv6, ipv4 or ipv6")
+	fallbackDelay = flag.Duration("fallback-delay", 0, "Delay before the connection via the other IP family is tried (Happy Eyeballs), 0 uses the default of 300ms, negative disables the fallback")
+	offline = flag.Bool("offline", false, "Launches the app from the cache without contacting the server, requires the JNLP offline-allowed element")
+	trust = flag.Bool("trust", false, "Trusts the app, it runs with full permissions without verifying the JAR signatures")
+	maxDownloads = flag.Int("max-downloads", 16, "Max. number of concurrent downloads, 0 is unlimited")
+	maxHostDownloads = flag.Int("max-host-downloads", 6, "Max. number of concurrent downloads per host, adapted to the latency and errors of the host, 0 is unlimited")
+	jnlpHistoryMax = flag.Int("jnlp-history", 10, "Number of historical versions of the JNLP files kept per app, 0 disables the history")
+	jsonEvents = flag.Bool("json-events", false, "Writes the launch progress as newline-delimited JSON events to stdout")
+	listen = flag.String("listen", ":8080", "Listen address of the serve command")
+	verifyLaunch = flag.Bool("verify", false, "Verifies the launch without starting a JVM: classpath, native library paths and main class")
+	sandbox = flag.String("sandbox", "", "Launches the app inside a sandbox: windows-sandbox")
+	windowTimeout = flag.Duration("window-timeout", 30*time.Second, "Max. time to wait for the first app window with -status-page or -json-events")
+	follow = flag.Bool("f", false, "Follow the log of the logs command")
+	launcherLogs = flag.Bool("launcher", false, "Show the launcher log instead of the app log with the logs command")
+	shortcuts = flag.Bool("shortcuts", true, "Creates the desktop and menu shortcuts requested by the JNLP shortcut element with the first launch")
+	associations = flag.Bool("associations", true, "Registers the file associations of the JNLP association elements with the first launch")
+	openFile = flag.String("open", "", "File which is passed to the app with -open, used by the file associations")
+	console = flag.Bool("console", false, "Launch the app with an attached console (java instead of javaw)")
+	jarLaunch = flag.Bool("jar-launch", false, "Launch the main jar with java -jar and the Class-Path of its manifest")
+	wait = flag.Bool("wait", false, "Wait for the end of the app")
+	profileStartup = flag.Bool("profile-startup", false, "Writes a timing breakdown of the launch phases, downloads and the JVM start until the first app window")
+	profileFile = flag.String("profile-file", "", "File of the startup profile, Chrome trace event format with the suffix .json, folded stacks otherwise")
+	lockdir = flag.String("lockdir", "", "Directory of the approved lockfiles of the kiosk command")
+	pattern = flag.String("pattern", "", "Glob of the resources of the cache invalidate command, like lib/updater*.jar")
+	catalogURL = flag.String("catalog", "", "URL of the app catalog of the catalog command, overrides catalog of the config")
+	fontCheck = flag.String("font-check", "", "Preflight of the fonts and the locale before the launch: off, warn or install, overrides fonts.check of the app config")
+	signKey = flag.String("sign-key", "", "ed25519 private key file (PEM or base64) which signs the archive of the export-config command")
+	dest = flag.String("dest", "", "Destination directory of the mirror command")
+	mirrorURL = flag.String("codebase", "", "Codebase URL under which the mirror directory is served")
+	osList = flag.String("os", "", "Comma separated operating systems the mirror is restricted to")
+	allPlatforms = flag.Bool("all-platforms", false, "Mirrors the resources of all operating systems and architectures")
+	extractFactor = flag.Float64("extract-factor", 3, "Factor of the download size which is reserved on disk for extracting archives")
+	skew = flag.Duration("clock-skew", 5*time.Minute, "Tolerated clock skew between client and server")
+	agentInterval = flag.Duration("agent-interval", time.Hour, "Interval in which the agent command updates the apps of the config")
 }
 
-// download loads a remote resource via http(s) and stores it to the given filename
-func download(href string, filename string) error {
+// download loads a remote resource via http(s) and stores it to the given filename, encrypted if requested. A cached
+// file is revalidated by a conditional GET with the ETag and Last-Modified of the cache index, the server answers 304
+// if it is unchanged.
+func download(ctx context.Context, href string, filename string, encrypt bool) error {
 	var mustDownload = true
 
+	header := http.Header{}
+	validated := false
+
 	if common.FileExists(filename) {
-		client := &http.Client{}
+		header, validated = cachedValidators(href, filename)
+	}
 
-		response, err := client.Head(href)
+	// files without validators, e.g. outside of the cache, are compared by their size
+	if common.FileExists(filename) && !validated {
+		span := spanFrom(ctx).Child("HEAD")
+		defer span.End()
+
+		response, err := httpRequestContext(span.traced(ctx), http.MethodHead, href, nil)
 		if err != nil {
-			return err
+			return explainTLSError(err)
 		}
 
+		checkClockSkew(response)
+
 		// care about the final close of the response body
 		defer func() {
 			common.Error(response.Body.Close())
@@ -168,7 +351,7 @@ func download(href string, filename string) error {
 
 		contentLength, _ := strconv.ParseInt(response.Header.Get("Content-Length"), 10, 64)
 
-		fs, err := common.FileSize(filename)
+		fs, err := plainSize(filename)
 		if err != nil {
 			return err
 		}
@@ -179,74 +362,74 @@ func download(href string, filename string) error {
 	if mustDownload {
 		common.Debug(fmt.Sprintf("Download %s --> %s", href, filename))
 
-		client := &http.Client{}
-
 		// get a response from the remote source
-		response, err := client.Get(href)
+		span := spanFrom(ctx).Child("GET")
+
+		response, err := httpRequestContext(span.traced(ctx), http.MethodGet, href, header)
+
+		span.End()
+
 		if err != nil {
-			return err
+			return explainTLSError(err)
 		}
 
+		checkClockSkew(response)
+
 		// care about final cleanup of reponse body
 		defer func() {
 			common.Error(response.Body.Close())
 		}()
 
-		// create all parent directories for the given filename
-		err = os.MkdirAll(filepath.Dir(filename), common.DefaultDirMode)
-		if err != nil {
-			return err
+		// the cached file is still current
+		if response.StatusCode == http.StatusNotModified {
+			common.Debug(fmt.Sprintf("Not modified %s --> %s", href, filename))
+
+			return indexRevalidation(filename, response)
+		}
+
+		// check for a maintenance of the server
+		if response.StatusCode == http.StatusServiceUnavailable {
+			return unavailableError(href, response)
 		}
 
-		err = common.FileStore(filename, response.Body)
+		if response.StatusCode < 200 || response.StatusCode >= 300 {
+			return &StatusError{URL: href, StatusCode: response.StatusCode, Status: response.Status}
+		}
+
+		checkVersionID(href, response)
+
+		// create all parent directories for the given filename
+		err = os.MkdirAll(longPath(filepath.Dir(filename)), common.DefaultDirMode)
 		if err != nil {
 			return err
 		}
-	}
 
-	return nil
-}
+		// the hash is computed while streaming, so the file is not read again for the cache index
+		hash := sha256.New()
 
-// runUnzip extract all files to the given path from the given filename
-func runUnzip(filename string, path string) error {
-	r, err := zip.OpenReader(filename)
-	if err != nil {
-		return err
-	}
+		span = spanFrom(ctx).Child("transfer")
 
-	// care about closing the ZIP file
-	defer func() {
-		common.Error(r.Close())
-	}()
+		// the file is replaced instead of overwritten, so hardlinks to the old content stay intact. The plain content
+		// of encrypted caches never reaches the disk.
+		store := storage.Store
+		if encrypt {
+			store = storeEncrypted
+		}
+
+		err = store(filename, io.TeeReader(response.Body, hash))
 
-	// loop over the ZIP content
-	for _, f := range r.File {
-		path := filepath.Join(path, f.Name)
+		span.End()
 
-		// create the destination path
-		err := os.MkdirAll(filepath.Dir(path), common.DefaultDirMode)
 		if err != nil {
 			return err
 		}
 
-		// open the source file inside the ZIP file
-		zipfile, err := f.Open()
+		err = indexDownload(href, filename, response, hex.EncodeToString(hash.Sum(nil)))
 		if err != nil {
 			return err
 		}
 
-		// source is directory?
-		if !f.FileInfo().IsDir() {
-
-			// Use os.Create() since Zip don't store file permissions.
-			err := common.FileStore(path, zipfile)
-			if err != nil {
-				return err
-			}
-		}
-
-		// closes the zipfile file
-		common.Error(zipfile.Close())
+		logEvent(eventUpdateApplied, fmt.Sprintf("%s downloaded to %s", href, filename))
 	}
 
 	return nil
@@ -254,7 +437,7 @@ func runUnzip(filename string, path string) error {
 
 // runSelfextract explodes the content of the 7zip self extracting executable file
 func runSelfextract(filename string) error {
-	cmd := exec.Command(filename, "-y", "-o"+filepath.Dir(filename))
+	cmd := exec.Command(longPath(filename), "-y", "-o"+longPath(filepath.Dir(filename)))
 	cmd.Stderr = os.Stderr
 
 	err := cmd.Run()
@@ -262,92 +445,77 @@ func runSelfextract(filename string) error {
 	return err
 }
 
-// runResource operates on the a single resource object and cares about download, runUnzip or extraction
-func runResource(wg *sync.WaitGroup, url string, path string, doUnzip bool, doExtract bool) {
-	defer wg.Done()
-
-	// first do the download ...
-	err := download(url, path)
+// appCachePath returns the cache directory of the app with the given JNLP URL
+func appCachePath(address string) (string, error) {
+	u, err := url.Parse(address)
 	if err != nil {
-		channelError.Set(err)
-		return
+		return "", err
 	}
 
-	doUnzip = doUnzip || strings.HasSuffix(path, ".zip")
-	doExtract = doExtract || strings.HasSuffix(path, ".exe")
+	return filepath.Join(*cache, hostDirName(u.Host)), nil
+}
 
-	// must the resource be unzipped?
-	if doUnzip {
-		err = runUnzip(path, filepath.Dir(path))
-		if err != nil {
-			channelError.Set(err)
-			return
-		}
+// appLogPath returns the log directory of the app with the given JNLP URL
+func appLogPath(address string) (string, error) {
+	appPath, err := appCachePath(address)
+	if err != nil {
+		return "", err
 	}
 
-	// must the resource be extracted?
-	if doExtract {
-		err := runSelfextract(path)
-		if err != nil {
-			channelError.Set(err)
-			return
-		}
+	return filepath.Join(appPath, "logs"), nil
+}
+
+// javaExecutable returns the name of the java executable, on Windows javaw is used for apps without a console
+func javaExecutable(withConsole bool) string {
+	if common.IsWindows() && !withConsole {
+		return "javaw"
 	}
+
+	return "java"
 }
 
 func CompareIgnoreCase(s0 string, s1 string) bool {
 	return strings.ToLower(s0) == strings.ToLower(s1)
 }
 
-func runJnlp(address string, doHeader bool) *Jnlp {
+// fetchJnlp loads the JNLP file from the server
+func fetchJnlp(ctx context.Context, address string) ([]byte, error) {
 	// try to get the JNLP file
-	client := &http.Client{}
-
-	response, err := client.Get(address)
+	response, err := httpRequestContext(spanFrom(ctx).traced(ctx), http.MethodGet, address, nil)
 	if err != nil {
-		channelError.Set(err)
-		return nil
+		return nil, explainTLSError(err)
 	}
 
+	checkClockSkew(response)
+
 	// care about the final close of the response body
 	defer func() {
 		common.Error(response.Body.Close())
 	}()
 
-	// load the JNLP file
-	content, err := io.ReadAll(response.Body)
-	if err != nil {
-		channelError.Set(err)
-		return nil
+	// check for a maintenance of the server
+	if response.StatusCode == http.StatusServiceUnavailable {
+		return nil, unavailableError(address, response)
 	}
 
-	// convert []byte to string
-	body := string(content)
-
 	// check for the HTTP status code
 	if response.StatusCode != http.StatusOK {
-		os.Exit(1)
-	}
-
-	// print the JNLP body
-	common.Debug(fmt.Sprintf("JNLP body:\n%s", body))
-
-	// parse the JNLP u
-	u, err := url.Parse(address)
-	if err != nil {
-		channelError.Set(err)
-		return nil
+		return nil, fmt.Errorf("cannot load JNLP file %s: %s", address, response.Status)
 	}
 
-	// create the file path in the cache directory for the JNLP file
-	jnlpPath := filepath.Join(*cache, common.Trim4Path(u.Host))
-	// create the app path in the cache directory for the JNLP file
-	appPath := filepath.Join(jnlpPath, "app")
+	// load the JNLP file
+	return io.ReadAll(response.Body)
+}
 
+// parseJnlp decodes the ISO8859 encoded content of a JNLP file
+func parseJnlp(content []byte) (*Jnlp, error) {
 	// create empty jnlp object
 	jnlp := Jnlp{}
 
-	content, err = common.ToUTF8(content, common.ISO_8859_1)
+	content, err := common.ToUTF8(content, common.ISO_8859_1)
+	if err != nil {
+		return nil, err
+	}
 
 	// decode ISO8859 encoded JNLP file
 	reader := bytes.NewReader(content)
@@ -356,252 +524,311 @@ func runJnlp(address string, doHeader bool) *Jnlp {
 	// decode the content of the JNLP content
 	err = decoder.Decode(&jnlp)
 	if err != nil {
-		channelError.Set(err)
-		return nil
+		return nil, err
 	}
 
-	codebase := jnlp.Codebase
+	// the information elements are merged due to the locale of the user
+	jnlp.Information = localizedInformation(jnlp.Informations, userLocale())
 
-	if codebase == "" {
-		codebase = address[:strings.LastIndex(address, "/")]
+	return &jnlp, nil
+}
+
+// resolveHref returns the URL of a href, relative hrefs are resolved against the codebase
+func resolveHref(u *url.URL, codebase string, href string) (*url.URL, error) {
+	ref, err := url.Parse(href)
+	if err == nil && ref.IsAbs() {
+		return ref, nil
 	}
 
-	// iterate over the JNLP defined resources
-	for _, resource := range jnlp.Resources {
+	return u.Parse(codebase + "/" + href)
+}
 
-		if len(resource.Arch) > 0 {
-			resource.Arch = common.Capitalize(resource.Arch)
-		}
+// jnlpCodebase returns the codebase of the JNLP file, by default the directory of the JNLP URL
+func jnlpCodebase(jnlp *Jnlp, address string) string {
+	if jnlp.Codebase != "" {
+		return jnlp.Codebase
+	}
 
-		if len(resource.Os) > 0 {
-			resource.Os = strings.ToTitle(resource.Os)
-		}
+	return address[:strings.LastIndex(address, "/")]
+}
+
+func run() error {
+	// if not parameters are provided then show the usage
+	if len(os.Args) == 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
 
-		// is the resouce relevant for the current architecture and OS?
-		if (len(resource.Arch) == 0 || CompareIgnoreCase(resource.Arch, *arch)) && (len(resource.Os) == 0 || CompareIgnoreCase(resource.Os, operatingsystem)) {
+	command := ""
+	args := flag.Args()
 
-			// iterate over the resource JARS
-			for _, jar := range resource.Jars {
+	if len(args) > 0 && isCommand(args[0]) {
+		command = args[0]
 
-				// inform the WaitGroup that a new resource action will be added
-				wg.Add(1)
+		// the flags of a command follow the command name and may be mixed with its arguments
+		err := flag.CommandLine.Parse(args[1:])
+		if err != nil {
+			return err
+		}
 
-				// enrich the jar object with destination filepath and URL
-				jar.Path = filepath.Join(appPath, jar.Href)
-				jar.URL, err = u.Parse(codebase + "/" + jar.Href)
-				if err != nil {
-					channelError.Set(err)
-					return nil
-				}
+		args = nil
 
-				// append to the jars path list the current resource jar
-				mutex.Lock()
-				jars = strings.Join([]string{jars, jar.Path}, string(filepath.ListSeparator))
-				mutex.Unlock()
+		for flag.NArg() > 0 {
+			args = append(args, flag.Arg(0))
 
-				// runResource the resource asynch
-				go runResource(&wg, jar.URL.String(), jar.Path, false, false)
+			err := flag.CommandLine.Parse(flag.Args()[1:])
+			if err != nil {
+				return err
 			}
+		}
+	}
 
-			// iterate over the resource EXTENSIONS
-			for _, extension := range resource.Extensions {
+	if (command == "" || command == "run" || command == "why" || command == "lock" || command == "validate-server" || command == "doctor") && len(args) == 1 {
+		*address = args[0]
+	}
 
-				// inform the WaitGroup that a new resource action will be added
-				//wg.Add(1)
+	// browsers pass the jnlp:// and jnlps:// URLs of protocol handlers
+	var err error
 
-				// enrich the jar object with destination filepath and URL
-				extension.Path = filepath.Join(appPath, extension.Href)
-				extension.URL, err = u.Parse(codebase + "/" + extension.Href)
-				if err != nil {
-					channelError.Set(err)
-					return nil
-				}
+	*address, err = protocolURL(*address)
+	if err != nil {
+		return err
+	}
 
-				go runJnlp(extension.URL.String(), false)
-			}
+	// locked-down desktops pin the cache path by policy
+	err = applyCachePolicy()
+	if err != nil {
+		return err
+	}
 
-			// iterate over the defined nativelibs
-			for _, nativelib := range resource.Nativelibs {
+	// avoid collisions of launches on shared profiles of terminal servers
+	path, err := sessionCachePath(*cache, *sessionCache)
+	if err != nil {
+		return err
+	}
 
-				// inform the WaitGroup that a new resource action will be added
-				wg.Add(1)
+	// Go handles paths beyond MAX_PATH only if they are absolute
+	*cache, err = filepath.Abs(path)
+	if err != nil {
+		return err
+	}
 
-				// enrich the nativelib object with the destination filepath and URL
-				nativelib.Path = filepath.Join(appPath, nativelib.Href)
-				nativelib.URL, err = u.Parse(codebase + "/" + nativelib.Href)
-				if err != nil {
-					channelError.Set(err)
-					return nil
-				}
+	// an ephemeral cache still uses the config file of the persistent cache
+	if *config == "" && common.FileExists(configPath()) {
+		*config = configPath()
+	}
 
-				// append to the nativelib path list the current resource nativelib
-				mutex.Lock()
-				nativelibs = strings.Join([]string{nativelibs, filepath.Dir(nativelib.Path)}, string(filepath.ListSeparator))
-				mutex.Unlock()
+	// decrypted jars and ephemeral caches of killed espresso processes do not stay behind
+	purgeStaging()
 
-				// runResource the resource asynch
-				go runResource(&wg, nativelib.URL.String(), nativelib.Path, true, false)
-			}
+	storage, err = newStorage(*storageMode, *cache)
+	if err != nil {
+		return err
+	}
 
-			if doHeader {
-				// get the definition of the maxheapsize from the J2SE element
-				for _, j2se := range resource.J2se {
-					maxheapsize = j2se.MaxHeapSize
-				}
+	defer func() {
+		common.Error(storage.Close())
+	}()
 
-				// if no maxheapsize can be found in J2SE element ...
-				if len(maxheapsize) == 0 {
+	*cache = storage.Path()
 
-					// get the definition of the maxheapsize from the JAVA element
-					for _, java := range resource.Java {
-						maxheapsize = java.MaxHeapSize
-					}
-				}
-			}
-		}
+	// IPv6-only and dual-stack networks with broken routes need a tuned dialer, already for the admin config
+	err = configureDialer(*ipFamilyFlag, *fallbackDelay)
+	if err != nil {
+		return err
 	}
 
-	// iterate over the private JREs
-	for _, jre := range jnlp.PrivateJres {
+	// the admin config is fetched with the HTTPS policy of the parameters, the one of the config applies afterwards
+	err = setHTTPSPolicy(*requireHTTPS)
+	if err != nil {
+		return err
+	}
 
-		// is the private JRE relevant for the current architecture and OS?
-		if (len(jre.Arch) == 0 || CompareIgnoreCase(jre.Arch, *arch)) && (len(jre.Os) == 0 || CompareIgnoreCase(jre.Os, operatingsystem)) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
 
-			// inform the WaitGroup that a new resource action will be added
-			wg.Add(1)
+	err = applyConfig(cfg)
+	if err != nil {
+		return err
+	}
 
-			var filename string
+	// initialize variables due to OS
+	operatingsystem = operatingsystemOf(runtime.GOOS)
 
-			// get the filename of the self extracting file
-			p := strings.LastIndex(jre.Href, "/")
+	switch command {
+	case "replay":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: espresso replay <bundle>")
+		}
 
-			if p != -1 {
-				filename = jre.Href[p+1:]
-			} else {
-				filename = jre.Href
-			}
+		return runReplay(args[0])
+	case "mirror":
+		var osFilter, archFilter []string
 
-			// enrich the JRE object with the destination filepath and URL
-			jre.Path = filepath.Join(jnlpPath, jre.Arch, filename)
-			jre.URL, err = u.Parse(codebase + "/" + jre.Href)
-			if err != nil {
-				channelError.Set(err)
-				return nil
-			}
+		if !*allPlatforms {
+			osFilter, archFilter = platformFilters()
+		}
 
-			if doHeader {
-				// get private JRE path
-				mutex.Lock()
-				*jrepath = filepath.Join(filepath.Dir(jre.Path), "bin", "javaw")
-				mutex.Unlock()
-			}
+		return runMirror(*address, *dest, *mirrorURL, osFilter, archFilter)
+	case "serve":
+		return runServe(*dest, *listen)
+	case "pin":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("usage: espresso pin <alias> [version-id]")
+		}
 
-			// runResource the resource asynch
-			runResource(&wg, jre.URL.String(), jre.Path, false, true)
+		version := ""
+		if len(args) == 2 {
+			version = args[1]
 		}
-	}
 
-	return &jnlp
-}
+		return runPin(cfg, args[0], version)
+	case "unpin":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: espresso unpin <alias>")
+		}
 
-func run() error {
-	// if not parameters are provided then show the usage
-	if len(os.Args) == 1 {
-		flag.Usage()
-		os.Exit(1)
-	}
+		return runUnpin(cfg, args[0])
+	case "logs":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: espresso logs <alias> [-f] [-launcher]")
+		}
 
-	if len(os.Args) == 2 {
-		address = &os.Args[1]
-	}
+		return runLogs(cfg, args[0], *follow, *launcherLogs)
+	case "why":
+		return runWhy(cfg, *address, os.Stdout)
+	case "uninstall":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: espresso uninstall <alias>")
+		}
 
-	// check if the catch path exists
-	if !common.FileExists(*cache) {
-		err := os.MkdirAll(*cache, common.DefaultDirMode)
-		if err != nil {
-			return err
+		return runUninstall(cfg, args[0])
+	case "lock":
+		return runLock(cfg, *address, *dest)
+	case "validate-server":
+		return runValidateServer(cfg, *address, os.Stdout)
+	case "cache":
+		return runCache(cfg, args, os.Stdout)
+	case "doctor":
+		return runDoctor(cfg, *address, os.Stdout)
+	case "catalog":
+		return runCatalog(cfg, args, os.Stdout)
+	case "export-config":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: espresso export-config <file> -sign-key <file>")
 		}
-	}
 
-	// initialize variables due to OS
-	switch runtime.GOOS {
-	case "linux":
-		operatingsystem = strings.ToTitle("Linux")
-	case "windows":
-		operatingsystem = strings.ToTitle("Windows")
-	case "darwin":
-		operatingsystem = strings.ToTitle("Mac OS X")
-	}
+		return runExportConfig(cfg, args[0], os.Stdout)
+	case "import-config":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: espresso import-config <file>")
+		}
 
-	if len(*jrepath) == 0 {
-		// if not private JRE is provided then do the fallback to default JAVAW executable
-		if common.IsWindows() {
-			*jrepath = "javaw"
-		} else {
-			*jrepath = "java"
+		return runImportConfig(args[0], os.Stdout)
+	case "migrate-cache":
+		return runMigrateCache(args, os.Stdout)
+	case "agent":
+		return runAgent(cfg)
+	case "prefs":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: espresso prefs show|edit <alias>")
+		}
+
+		return runPrefs(cfg, args[0], args[1], os.Stdout)
+	case "import-muffins":
+		if len(args) > 1 {
+			return fmt.Errorf("usage: espresso import-muffins [alias or url]")
 		}
-	}
 
-	channelError = common.NewSync[error]()
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
 
-	jnlp := runJnlp(*address, true)
+		return runImportMuffins(cfg, name)
+	case "kiosk":
+		if len(args) > 1 {
+			return fmt.Errorf("usage: espresso kiosk -lockdir <directory> [app]")
+		}
 
-	// wait on all registered WaitGroup objects
-	wg.Wait()
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
 
-	if channelError.IsSet() {
-		return channelError.Get()
+		return runKiosk(cfg, *lockdir, name)
 	}
 
-	// cmd line parameters
-	var cmds []string
+	if *exposeProps {
+		return NewLaunch(cfg, *address).ExposeProps(os.Stdout)
+	}
 
-	// if maxheapsize is provided then registr it to the cmds
-	if len(maxheapsize) > 0 {
-		cmds = append(cmds, "-Xmx"+maxheapsize)
+	// the preferences given on the command line are reused by subsequent launches
+	err = rememberPrefs(cfg.App(*address).URL)
+	if err != nil {
+		return err
 	}
 
-	if nativelibs != "" {
-		// add the nativelib objects to the cmds
-		cmds = append(cmds, "-Djava.library.path="+nativelibs)
+	return NewLaunch(cfg, *address).Run()
+}
+
+// operatingsystemOf returns the JNLP name of the given GOOS
+func operatingsystemOf(goos string) string {
+	switch goos {
+	case "linux":
+		return strings.ToTitle("Linux")
+	case "windows":
+		return strings.ToTitle("Windows")
+	case "darwin":
+		return strings.ToTitle("Mac OS X")
 	}
 
-	// add the jars to the cmds
-	cmds = append(cmds, "-cp")
-	cmds = append(cmds, jars)
+	return ""
+}
 
-	if jnlp.ApplicationDesc.MainClass != "" {
-		// add the execution main class to the cmds
-		cmds = append(cmds, jnlp.ApplicationDesc.MainClass)
+// platformFilters returns the operating systems and architectures given by -os and an explicit -arch
+func platformFilters() ([]string, []string) {
+	var osFilter, archFilter []string
 
-		// add the provided app arguments to the cmds
-		for _, argument := range jnlp.ApplicationDesc.Arguments {
-			cmds = append(cmds, argument.Text)
+	for _, item := range strings.Split(*osList, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
 		}
-	} else {
-		// add the execution main class to the cmds
-		cmds = append(cmds, jnlp.AppletDesc.MainClass)
 
-		// add the provided app arguments to the cmds
-		for _, param := range jnlp.AppletDesc.Params {
-			cmds = append(cmds, param.Text)
+		// Go OS names are mapped to their JNLP names, JNLP names are taken as they are
+		if name := operatingsystemOf(strings.ToLower(item)); name != "" {
+			item = name
 		}
+
+		osFilter = append(osFilter, item)
 	}
 
-	common.Debug(fmt.Sprintf("Command line: %s %s", *jrepath, strings.Join(cmds, " ")))
+	// the -arch default is the architecture of this machine which must not restrict a mirror
+	if isFlagSet("arch") {
+		for _, item := range strings.Split(*arch, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				archFilter = append(archFilter, item)
+			}
+		}
+	}
 
-	// initialize the app cmd
-	cmd := exec.Command(*jrepath, cmds...)
+	return osFilter, archFilter
+}
 
-	// execute the app cmd
-	err := cmd.Start()
-	if common.Error(err) {
-		return err
+// isCommand reports if the given argument is an espresso command
+func isCommand(arg string) bool {
+	switch arg {
+	case "run", "replay", "mirror", "serve", "pin", "unpin", "logs", "why", "uninstall", "lock", "kiosk", "import-muffins", "validate-server", "prefs", "cache", "doctor", "catalog", "export-config", "import-config", "migrate-cache", "agent":
+		return true
 	}
 
-	return nil
+	return false
 }
 
 func main() {
-	common.Run([]string{"url"})
+	common.Run(nil)
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkAnnouncements shows the maintenance windows and checks the minimum launcher version announced by the server
+func checkAnnouncements(announcements Espresso) error {
+	if announcements.MinVersion != "" {
+		version := launcherVersion()
+
+		if version != "" && compareVersions(version, announcements.MinVersion) < 0 {
+			return fmt.Errorf("the server requires espresso version %s or newer, this is version %s. Please update espresso", announcements.MinVersion, version)
+		}
+	}
+
+	now := time.Now()
+
+	for _, maintenance := range announcements.Maintenances {
+		from, err := time.Parse(time.RFC3339, maintenance.From)
+		if err != nil {
+			return fmt.Errorf("invalid maintenance window start %s: %w", maintenance.From, err)
+		}
+
+		to, err := time.Parse(time.RFC3339, maintenance.To)
+		if err != nil {
+			return fmt.Errorf("invalid maintenance window end %s: %w", maintenance.To, err)
+		}
+
+		message := strings.TrimSpace(maintenance.Message)
+		window := fmt.Sprintf("%s - %s", from.Local().Format(time.DateTime), to.Local().Format(time.DateTime))
+
+		switch {
+		case now.Before(from):
+			common.Info(fmt.Sprintf("Planned maintenance %s: %s", window, message))
+		case now.Before(to):
+			if maintenance.Block {
+				return fmt.Errorf("the app is not available during the maintenance %s: %s", window, message)
+			}
+
+			common.Warn(fmt.Sprintf("Maintenance in progress %s: %s", window, message))
+		}
+	}
+
+	return nil
+}
+
+// unavailableError describes a 503 response of a server in maintenance
+func unavailableError(address string, response *http.Response) error {
+	retryAfter := response.Header.Get("Retry-After")
+
+	if retryAfter == "" {
+		return fmt.Errorf("the server of %s is currently unavailable, probably due to a maintenance. Please try again later", address)
+	}
+
+	if seconds, err := strconv.Atoi(retryAfter); err == nil {
+		return fmt.Errorf("the server of %s is currently unavailable, probably due to a maintenance. Please try again in %v", address, time.Duration(seconds)*time.Second)
+	}
+
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		return fmt.Errorf("the server of %s is currently unavailable, probably due to a maintenance. Please try again after %s", address, date.Local().Format(time.DateTime))
+	}
+
+	return fmt.Errorf("the server of %s is currently unavailable, probably due to a maintenance. Please try again later", address)
+}
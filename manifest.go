@@ -0,0 +1,90 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"github.com/mpetavy/common"
+	"strings"
+)
+
+// manifestName is the path of the manifest inside a jar
+const manifestName = "META-INF/MANIFEST.MF"
+
+// readManifest returns the main section attributes of the manifest of the jar
+func readManifest(path string) (map[string]string, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// care about closing the jar
+	defer func() {
+		common.Error(r.Close())
+	}()
+
+	for _, f := range r.File {
+		if !strings.EqualFold(f.Name, manifestName) {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		// care about closing the manifest
+		defer func() {
+			common.Error(rc.Close())
+		}()
+
+		attributes := make(map[string]string)
+		var key string
+
+		scanner := bufio.NewScanner(rc)
+		for scanner.Scan() {
+			line := strings.TrimRight(scanner.Text(), "\r")
+
+			// the main section ends with the first empty line
+			if line == "" {
+				break
+			}
+
+			// long values are continued in lines starting with a space
+			if strings.HasPrefix(line, " ") {
+				if key != "" {
+					attributes[key] += line[1:]
+				}
+
+				continue
+			}
+
+			name, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+
+			key = strings.TrimSpace(name)
+			attributes[key] = strings.TrimSpace(value)
+		}
+
+		return attributes, scanner.Err()
+	}
+
+	return nil, fmt.Errorf("%s has no manifest", path)
+}
+
+// manifestMainClass returns the Main-Class declared in the manifest of the jar
+func manifestMainClass(path string) (string, error) {
+	attributes, err := readManifest(path)
+	if err != nil {
+		return "", err
+	}
+
+	mainClass := attributes["Main-Class"]
+	if mainClass == "" {
+		return "", fmt.Errorf("%s declares no Main-Class in its manifest", path)
+	}
+
+	return mainClass, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// mavenPrefix marks a href with Maven coordinates
+const mavenPrefix = "mvn:"
+
+// MavenConfig defines the Maven repository (e.g. Nexus, Artifactory) private JREs can be resolved from
+type MavenConfig struct {
+	Repository string `json:"repository"`
+	Username   string `json:"username"`
+	// Password of the repository user, by default taken from the environment variable ESPRESSO_MAVEN_PASSWORD
+	Password string `json:"password"`
+}
+
+// MavenMetadata is the maven-metadata.xml of an artifact
+type MavenMetadata struct {
+	XMLName    xml.Name `xml:"metadata"`
+	Versioning struct {
+		Latest   string   `xml:"latest"`
+		Release  string   `xml:"release"`
+		Versions []string `xml:"versions>version"`
+	} `xml:"versioning"`
+}
+
+// MavenCoordinates identify an artifact in a Maven repository
+type MavenCoordinates struct {
+	GroupId    string
+	ArtifactId string
+	Version    string
+	Type       string
+	Classifier string
+}
+
+// isMavenHref reports if the href defines Maven coordinates like "mvn:com.example:jre:[17,18):zip:windows-x64"
+func isMavenHref(href string) bool {
+	return strings.HasPrefix(href, mavenPrefix)
+}
+
+// parseMavenHref parses Maven coordinates "mvn:groupId:artifactId:version[:type[:classifier]]"
+func parseMavenHref(href string) (*MavenCoordinates, error) {
+	parts := strings.Split(strings.TrimPrefix(href, mavenPrefix), ":")
+
+	if len(parts) < 3 || len(parts) > 5 {
+		return nil, fmt.Errorf("invalid Maven coordinates %s, expected mvn:groupId:artifactId:version[:type[:classifier]]", href)
+	}
+
+	c := &MavenCoordinates{
+		GroupId:    parts[0],
+		ArtifactId: parts[1],
+		Version:    parts[2],
+		Type:       "jar",
+	}
+
+	if len(parts) > 3 {
+		c.Type = parts[3]
+	}
+
+	if len(parts) > 4 {
+		c.Classifier = parts[4]
+	}
+
+	return c, nil
+}
+
+// artifactPath returns the path of the artifact directory inside the repository
+func (c *MavenCoordinates) artifactPath() string {
+	return strings.ReplaceAll(c.GroupId, ".", "/") + "/" + c.ArtifactId
+}
+
+// Filename returns the filename of the artifact in the given version
+func (c *MavenCoordinates) Filename(version string) string {
+	filename := c.ArtifactId + "-" + version
+
+	if c.Classifier != "" {
+		filename += "-" + c.Classifier
+	}
+
+	return filename + "." + c.Type
+}
+
+// isVersionRange reports if the version is a range like "[17,18)" or a LATEST/RELEASE keyword
+func isVersionRange(version string) bool {
+	return strings.ContainsAny(version, "[](),") || version == "LATEST" || version == "RELEASE"
+}
+
+// splitVersionRanges splits a Maven version spec like "(,1.0],[1.2,)" into its ranges, false if it is malformed
+func splitVersionRanges(spec string) ([]string, bool) {
+	var ranges []string
+
+	rest := strings.TrimSpace(spec)
+
+	for rest != "" {
+		if rest[0] != '[' && rest[0] != '(' {
+			return nil, false
+		}
+
+		end := strings.IndexAny(rest, "])")
+		if end < 0 {
+			return nil, false
+		}
+
+		ranges = append(ranges, rest[:end+1])
+		rest = strings.TrimSpace(rest[end+1:])
+
+		// the ranges are separated by commas
+		if next, ok := strings.CutPrefix(rest, ","); ok {
+			rest = strings.TrimSpace(next)
+
+			if rest == "" {
+				return nil, false
+			}
+		} else if rest != "" {
+			return nil, false
+		}
+	}
+
+	return ranges, len(ranges) > 0
+}
+
+// matchesVersionRange reports if the version is inside the Maven version spec like "[1.0,2.0)", "(,1.5]", "[1.5,)" or
+// the union of several ranges like "(,1.0],[1.2,)". A malformed spec matches no version.
+func matchesVersionRange(version string, versionRange string) bool {
+	if !strings.ContainsAny(versionRange, "[]()") {
+		return compareVersions(version, versionRange) == 0
+	}
+
+	ranges, ok := splitVersionRanges(versionRange)
+	if !ok {
+		return false
+	}
+
+	for _, r := range ranges {
+		if matchesRange(version, r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesRange reports if the version is inside the single range like "[1.0,2.0)" or "[1.5]"
+func matchesRange(version string, versionRange string) bool {
+	lower, upper, ok := strings.Cut(versionRange[1:len(versionRange)-1], ",")
+
+	lower = strings.TrimSpace(lower)
+	upper = strings.TrimSpace(upper)
+
+	if !ok {
+		// "[1.5]" is an exact version
+		return lower != "" && versionRange[0] == '[' && versionRange[len(versionRange)-1] == ']' && compareVersions(version, lower) == 0
+	}
+
+	if strings.Contains(upper, ",") {
+		return false
+	}
+
+	if lower != "" {
+		c := compareVersions(version, lower)
+
+		if c < 0 || (c == 0 && versionRange[0] == '(') {
+			return false
+		}
+	}
+
+	if upper != "" {
+		c := compareVersions(version, upper)
+
+		if c > 0 || (c == 0 && versionRange[len(versionRange)-1] == ')') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// resolveMavenHref resolves Maven coordinates to the URL of the artifact, version ranges are resolved by the maven-metadata.xml
+func resolveMavenHref(maven MavenConfig, href string) (string, error) {
+	if maven.Repository == "" {
+		return "", fmt.Errorf("cannot resolve %s, no Maven repository is configured", href)
+	}
+
+	c, err := parseMavenHref(href)
+	if err != nil {
+		return "", err
+	}
+
+	repository := strings.TrimSuffix(maven.Repository, "/")
+	version := c.Version
+
+	if isVersionRange(version) {
+		ba, err := fetchURL(repository + "/" + c.artifactPath() + "/maven-metadata.xml")
+		if err != nil {
+			return "", err
+		}
+
+		metadata := MavenMetadata{}
+
+		err = xml.Unmarshal(ba, &metadata)
+		if err != nil {
+			return "", err
+		}
+
+		switch version {
+		case "LATEST":
+			version = metadata.Versioning.Latest
+		case "RELEASE":
+			version = metadata.Versioning.Release
+		default:
+			version = ""
+
+			for _, v := range metadata.Versioning.Versions {
+				if matchesVersionRange(v, c.Version) && (version == "" || compareVersions(v, version) > 0) {
+					version = v
+				}
+			}
+		}
+
+		if version == "" {
+			return "", fmt.Errorf("no version of %s matches %s", c.artifactPath(), c.Version)
+		}
+	}
+
+	return repository + "/" + c.artifactPath() + "/" + url.PathEscape(version) + "/" + c.Filename(version), nil
+}
+
+// registerMavenCredentials provides the credentials of the Maven repository to the HTTP requests
+func registerMavenCredentials(maven MavenConfig) error {
+	if maven.Repository == "" || maven.Username == "" {
+		return nil
+	}
+
+	password := maven.Password
+	if password == "" {
+		password = os.Getenv("ESPRESSO_MAVEN_PASSWORD")
+	}
+
+	return registerCredentials(maven.Repository, maven.Username, password)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMatchesVersionRange(t *testing.T) {
+	tests := []struct {
+		version      string
+		versionRange string
+		want         bool
+	}{
+		{"1.5", "1.5", true},
+		{"1.6", "1.5", false},
+		{"1.0", "[1.0,2.0)", true},
+		{"2.0", "[1.0,2.0)", false},
+		{"1.9.9", "[1.0,2.0)", true},
+		{"1.0", "(1.0,2.0]", false},
+		{"2.0", "(1.0,2.0]", true},
+		{"1.5", "(,1.5]", true},
+		{"1.6", "(,1.5]", false},
+		{"17.0.2", "[17,)", true},
+		{"1.5", "[1.5]", true},
+		{"1.6", "[1.5]", false},
+		{"0.9", "(,1.0],[1.2,)", true},
+		{"1.1", "(,1.0],[1.2,)", false},
+		{"1.3", "(,1.0],[1.2,)", true},
+		{"1.1", "[1.0,1.1) , [1.1,1.2)", true},
+		{"1.0", "[", false},
+		{"1.0", "]", false},
+		{"1.0", "[]", false},
+		{"1.0", "[1.0", false},
+		{"1.0", "(1.0)", false},
+		{"1.0", "[1.0,2.0,3.0]", false},
+		{"1.0", "[1.0,2.0),", false},
+		{"1.0", "[1.0,2.0)x", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version+" "+test.versionRange, func(t *testing.T) {
+			got := matchesVersionRange(test.version, test.versionRange)
+			if got != test.want {
+				t.Errorf("matchesVersionRange(%q, %q) = %v, want %v", test.version, test.versionRange, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// cacheIndexBackup returns the path of the cache index before the last migration
+func cacheIndexBackup() string {
+	return cacheIndexPath() + ".pre-migration"
+}
+
+// MigrationReport counts the changes of a cache migration
+type MigrationReport struct {
+	Added     int
+	Updated   int
+	Removed   int
+	Unindexed []string
+}
+
+// knownResources returns the URLs and apps of the cached resources recorded by the replay bundles of the last launches
+func knownResources() (map[string]ReplayResource, map[string]string, error) {
+	resources := make(map[string]ReplayResource)
+	apps := make(map[string]string)
+
+	bundles, err := filepath.Glob(filepath.Join(*cache, "*", "replay.zip"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, bundle := range bundles {
+		replay, err := loadReplay(bundle)
+		if err != nil {
+			common.Warn(fmt.Sprintf("Replay bundle %s is skipped: %v", bundle, err))
+
+			continue
+		}
+
+		for _, resource := range replay.Resources {
+			resources[resource.Path] = resource
+			apps[resource.Path] = replay.URL
+		}
+	}
+
+	return resources, apps, nil
+}
+
+// migrateEntry brings an entry of a former version of espresso up to date, false is returned if nothing changed
+func migrateEntry(entry *CacheEntry) bool {
+	before := *entry
+
+	// the tokens of signed URLs are not kept
+	entry.URL = stripTokens(entry.URL)
+	entry.FinalURL = stripTokens(entry.FinalURL)
+
+	if entry.Version == "" {
+		if u, err := url.Parse(entry.URL); err == nil {
+			entry.Version = u.Query().Get("version-id")
+		}
+	}
+
+	return before.URL != entry.URL || before.FinalURL != entry.FinalURL || before.Version != entry.Version
+}
+
+// newMigratedEntry creates the entry of a cached resource without one, the hash is computed from its plain content
+func newMigratedEntry(filename string, resource ReplayResource, app string) (*CacheEntry, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := readPlain(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &CacheEntry{
+		URL:        resource.URL,
+		SHA256:     sha256Hex(content),
+		Size:       int64(len(content)),
+		Downloaded: info.ModTime(),
+		LastUsed:   info.ModTime(),
+		References: []string{app},
+	}
+
+	migrateEntry(entry)
+
+	return entry, nil
+}
+
+// migrateCache converts the cache of a former version of espresso in place. Resources without an entry get one by the
+// replay bundles of the last launches, so they are revalidated instead of downloaded again, outdated entries are
+// updated and entries of removed files are dropped. The index is only written if the whole migration succeeds, the
+// former index is kept for a rollback.
+func migrateCache(w io.Writer) (*MigrationReport, error) {
+	resources, apps, err := knownResources()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &MigrationReport{}
+
+	err = updateCacheIndex(func(index *CacheIndex) error {
+		if common.FileExists(cacheIndexPath()) {
+			ba, err := os.ReadFile(cacheIndexPath())
+			if err != nil {
+				return err
+			}
+
+			err = writeFileAtomic(cacheIndexBackup(), ba)
+			if err != nil {
+				return err
+			}
+		}
+
+		keys := make([]string, 0, len(index.Entries))
+		for key := range index.Entries {
+			keys = append(keys, key)
+		}
+
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			if !common.FileExists(filepath.Join(*cache, filepath.FromSlash(key))) {
+				fmt.Fprintf(w, "Removed entry of the missing file %s\n", key)
+
+				delete(index.Entries, key)
+				report.Removed++
+
+				continue
+			}
+
+			updated := migrateEntry(index.Entries[key])
+
+			// entries of former versions have no hash
+			if index.Entries[key].SHA256 == "" {
+				content, err := readPlain(filepath.Join(*cache, filepath.FromSlash(key)))
+				if err != nil {
+					return fmt.Errorf("cannot index %s: %w", key, err)
+				}
+
+				index.Entries[key].SHA256 = sha256Hex(content)
+				index.Entries[key].Size = int64(len(content))
+
+				updated = true
+			}
+
+			if updated {
+				fmt.Fprintf(w, "Updated entry %s\n", key)
+
+				report.Updated++
+			}
+		}
+
+		paths := make([]string, 0, len(resources))
+		for path := range resources {
+			paths = append(paths, path)
+		}
+
+		slices.Sort(paths)
+
+		for i, path := range paths {
+			key, ok := cacheKey(path)
+			if !ok || index.Entries[key] != nil || !common.FileExists(path) {
+				continue
+			}
+
+			fmt.Fprintf(w, "[%d/%d] Indexing %s\n", i+1, len(paths), key)
+
+			entry, err := newMigratedEntry(path, resources[path], apps[path])
+			if err != nil {
+				return fmt.Errorf("cannot index %s: %w", path, err)
+			}
+
+			index.Entries[key] = entry
+			report.Added++
+		}
+
+		// the remaining resources of the apps are revalidated by their size, they are indexed by their next download
+		return filepath.WalkDir(*cache, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() || !isAppResource(path) {
+				return nil
+			}
+
+			if key, ok := cacheKey(path); ok && index.Entries[key] == nil {
+				report.Unindexed = append(report.Unindexed, key)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cache migration failed, the cache is left unchanged: %w", err)
+	}
+
+	return report, nil
+}
+
+// isAppResource checks if the file is a resource of the "app" directory of an app cache directory
+func isAppResource(path string) bool {
+	rel, err := filepath.Rel(*cache, path)
+	if err != nil {
+		return false
+	}
+
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+
+	return len(parts) > 2 && parts[1] == "app"
+}
+
+// rollbackCacheMigration restores the cache index of the time before the last migration
+func rollbackCacheMigration() error {
+	ba, err := os.ReadFile(cacheIndexBackup())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("there is no cache migration to roll back")
+		}
+
+		return err
+	}
+
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	unlock, err := lockFile(cacheIndexPath())
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	err = writeFileAtomic(cacheIndexPath(), ba)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(cacheIndexBackup())
+}
+
+// runMigrateCache migrates the cache of a former version of espresso or rolls the last migration back
+func runMigrateCache(args []string, w io.Writer) error {
+	if len(args) == 1 && args[0] == "rollback" {
+		err := rollbackCacheMigration()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "Cache index of the time before the migration restored\n")
+
+		return nil
+	}
+
+	if len(args) != 0 {
+		return fmt.Errorf("usage: espresso migrate-cache [rollback]")
+	}
+
+	report, err := migrateCache(w)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Cache migrated: %d entries added, %d updated, %d removed\n", report.Added, report.Updated, report.Removed)
+
+	if len(report.Unindexed) > 0 {
+		fmt.Fprintf(w, "%d resources are not indexed, they are revalidated by their size and indexed by their next download\n", len(report.Unindexed))
+	}
+
+	if common.FileExists(cacheIndexBackup()) {
+		fmt.Fprintf(w, "The former index is kept in %s, \"espresso migrate-cache rollback\" restores it\n", cacheIndexBackup())
+	}
+
+	return nil
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/mpetavy/common"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// jnlpRegex matches the root JNLP element
+	jnlpRegex = regexp.MustCompile(`<jnlp\b`)
+	// codebaseRegex matches the codebase attribute of the root JNLP element
+	codebaseRegex = regexp.MustCompile(`(<jnlp\b[^>]*?\scodebase\s*=\s*)("[^"]*"|'[^']*')`)
+	// hrefRegex matches the href attribute of the root JNLP element
+	hrefRegex = regexp.MustCompile(`(<jnlp\b[^>]*?\shref\s*=\s*)("[^"]*"|'[^']*')`)
+)
+
+// Mirror copies a JNLP application with all its resources into a local directory
+type Mirror struct {
+	// Dest is the directory of the mirror
+	Dest string
+	// Codebase is the URL under which the mirror directory is served
+	Codebase string
+	// OS restricts the mirrored resources to these JNLP operating systems, empty means all
+	OS []string
+	// Arch restricts the mirrored resources to these architectures, empty means all
+	Arch []string
+
+	origin  string
+	visited map[string]bool
+	wg      sync.WaitGroup
+	errors  *ErrorAggregator
+}
+
+// MirrorManifest records the origin and the platform subsets a mirror contains
+type MirrorManifest struct {
+	Origin       string    `json:"origin"`
+	Codebase     string    `json:"codebase"`
+	AllPlatforms bool      `json:"all-platforms"`
+	OS           []string  `json:"os,omitempty"`
+	Arch         []string  `json:"arch,omitempty"`
+	Updated      time.Time `json:"updated"`
+}
+
+// mirrorManifestName is the name of the manifest file in the mirror directory
+const mirrorManifestName = "espresso-mirror.json"
+
+// runMirror downloads all resources of the selected platforms (all if no filter is given) of the JNLP application into the mirror directory
+func runMirror(address string, dest string, codebase string, osFilter []string, archFilter []string) error {
+	if address == "" || dest == "" || codebase == "" {
+		return fmt.Errorf("usage: espresso mirror -url <jnlp> -dest <directory> -codebase <url of the mirror>")
+	}
+
+	m := &Mirror{
+		Dest:     dest,
+		Codebase: strings.TrimSuffix(codebase, "/"),
+		OS:       osFilter,
+		Arch:     archFilter,
+		visited:  make(map[string]bool),
+		errors:   newErrorAggregator(),
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return err
+	}
+
+	err = m.mirrorJnlp(address, path.Base(u.Path))
+	if err != nil {
+		return err
+	}
+
+	m.wg.Wait()
+
+	if m.errors.IsSet() {
+		return m.errors.Get()
+	}
+
+	err = m.writeManifest()
+	if err != nil {
+		return err
+	}
+
+	common.Info(fmt.Sprintf("Mirror of %s is available in %s", address, dest))
+
+	return nil
+}
+
+// isSelected reports if a resource with the given os and arch attributes matches the platform filters
+func (m *Mirror) isSelected(os string, arch string) bool {
+	// a filter like "Windows" mirrors the resources of all Windows versions like os="Windows\ 10"
+	osMatches := len(m.OS) == 0 || slices.ContainsFunc(m.OS, func(f string) bool {
+		return matchesOS(os, f) || slices.ContainsFunc(splitPlatformList(os), func(value string) bool {
+			return strings.HasPrefix(strings.ToLower(value), strings.ToLower(f))
+		})
+	})
+
+	archMatches := len(m.Arch) == 0 || slices.ContainsFunc(m.Arch, func(f string) bool {
+		return matchesArch(arch, f)
+	})
+
+	return osMatches && archMatches
+}
+
+// writeManifest records which platform subsets the mirror contains
+func (m *Mirror) writeManifest() error {
+	manifest := MirrorManifest{
+		Origin:       m.origin,
+		Codebase:     m.Codebase,
+		AllPlatforms: len(m.OS) == 0 && len(m.Arch) == 0,
+		OS:           m.OS,
+		Arch:         m.Arch,
+		Updated:      time.Now(),
+	}
+
+	ba, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(m.Dest, mirrorManifestName), ba, common.DefaultFileMode)
+}
+
+// relPath returns the path of an origin URL relative to the origin codebase
+func (m *Mirror) relPath(resource string) (string, bool) {
+	u, err := url.Parse(resource)
+	if err != nil {
+		return "", false
+	}
+
+	u.RawQuery = ""
+
+	rel, ok := strings.CutPrefix(u.String(), m.origin+"/")
+
+	return rel, ok
+}
+
+// mirrorJnlp stores the JNLP file with a rewritten codebase and mirrors its resources
+func (m *Mirror) mirrorJnlp(address string, rel string) error {
+	if m.visited[address] {
+		return nil
+	}
+
+	m.visited[address] = true
+
+	location, err := resolveSRV(address)
+	if err != nil {
+		return err
+	}
+
+	content, err := fetchJnlp(context.Background(), location)
+	if err != nil {
+		return err
+	}
+
+	jnlp, err := parseJnlp(content)
+	if err != nil {
+		return err
+	}
+
+	codebase := strings.TrimSuffix(jnlpCodebase(jnlp, location), "/")
+
+	// the codebase of the initial JNLP file defines the origin of the mirror
+	if m.origin == "" {
+		m.origin = codebase
+	}
+
+	mirrorCodebase := m.Codebase + strings.TrimPrefix(codebase, m.origin)
+
+	err = os.MkdirAll(filepath.Dir(filepath.Join(m.Dest, rel)), common.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(m.Dest, rel), rewriteCodebase(content, mirrorCodebase, m.Codebase+"/"+rel), common.DefaultFileMode)
+	if err != nil {
+		return err
+	}
+
+	var hrefs []string
+
+	// the resources of all selected platforms are mirrored
+	for _, resource := range jnlp.Resources {
+		if !m.isSelected(resource.Os, resource.Arch) {
+			continue
+		}
+
+		for _, jar := range resource.Jars {
+			hrefs = append(hrefs, jar.Href)
+		}
+
+		for _, nativelib := range resource.Nativelibs {
+			hrefs = append(hrefs, nativelib.Href)
+		}
+
+		for _, extension := range resource.Extensions {
+			extensionURL := codebase + "/" + extension.Href
+
+			extensionRel, ok := m.relPath(extensionURL)
+			if !ok {
+				common.Warn(fmt.Sprintf("Mirror: extension %s is outside of the codebase %s and is not mirrored", extensionURL, m.origin))
+
+				continue
+			}
+
+			err := m.mirrorJnlp(extensionURL, extensionRel)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, jre := range jnlp.PrivateJres {
+		if !m.isSelected(jre.Os, jre.Arch) {
+			continue
+		}
+
+		// Maven hosted JREs are resolved from the repository by the clients
+		if !isMavenHref(jre.Href) {
+			hrefs = append(hrefs, jre.Href)
+		}
+	}
+
+	// the icons of all locales are mirrored
+	for _, information := range jnlp.Informations {
+		for _, icon := range information.Icons {
+			hrefs = append(hrefs, icon.Href)
+		}
+	}
+
+	for _, href := range hrefs {
+		resourceURL := codebase + "/" + href
+
+		resourceRel, ok := m.relPath(resourceURL)
+		if !ok {
+			common.Warn(fmt.Sprintf("Mirror: resource %s is outside of the codebase %s and is not mirrored", resourceURL, m.origin))
+
+			continue
+		}
+
+		m.wg.Add(1)
+
+		go func(resourceURL string, filename string) {
+			defer m.wg.Done()
+
+			// download only loads new or changed resources, so re-runs keep the mirror in sync
+			err := download(context.Background(), resourceURL, filename, false)
+			if err != nil {
+				m.errors.Set(err)
+			}
+		}(resourceURL, filepath.Join(m.Dest, filepath.FromSlash(resourceRel)))
+	}
+
+	return nil
+}
+
+// rewriteCodebase sets the codebase attribute of the root JNLP element, and its href, so clients reload the JNLP file
+// from the mirror instead of the origin
+func rewriteCodebase(content []byte, codebase string, href string) []byte {
+	content = setJnlpAttribute(content, codebaseRegex, "codebase", codebase)
+
+	if hrefRegex.Match(content) {
+		content = setJnlpAttribute(content, hrefRegex, "href", href)
+	}
+
+	return content
+}
+
+// setJnlpAttribute sets the attribute of the root JNLP element matched by the regexp, a missing one is added. The
+// value is inserted literally and XML escaped, it is no template of the regexp.
+func setJnlpAttribute(content []byte, regex *regexp.Regexp, name string, value string) []byte {
+	quoted := &bytes.Buffer{}
+	quoted.WriteByte('"')
+	common.Error(xml.EscapeText(quoted, []byte(value)))
+	quoted.WriteByte('"')
+
+	if loc := regex.FindSubmatchIndex(content); loc != nil {
+		return slices.Concat(content[:loc[4]], quoted.Bytes(), content[loc[5]:])
+	}
+
+	if loc := jnlpRegex.FindIndex(content); loc != nil {
+		return slices.Concat(content[:loc[1]], []byte(" "+name+"="), quoted.Bytes(), content[loc[1]:])
+	}
+
+	return content
+}
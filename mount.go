@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Mount defines a network share which is mounted before the launch of the app
+type Mount struct {
+	// Share is the SMB share like "\\server\config" or "//server/config"
+	Share string `json:"share"`
+	// Target is the drive letter like "X:" or the mount point directory
+	Target string `json:"target"`
+	// Username is the user of the share, the password is taken from the OS keychain. On Windows the credentials of the
+	// server stored in the Credential Manager are used.
+	Username string `json:"username"`
+}
+
+// shareHost returns the host name of the share
+func (m *Mount) shareHost() string {
+	share := strings.TrimLeft(strings.ReplaceAll(m.Share, "\\", "/"), "/")
+
+	host, _, _ := strings.Cut(share, "/")
+
+	return host
+}
+
+// isMounted reports if the target of the share is already available
+func (m *Mount) isMounted() bool {
+	if runtime.GOOS == "windows" {
+		_, err := os.Stat(m.Target + "\\")
+
+		return err == nil
+	}
+
+	ba, err := exec.Command("mount").Output()
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(ba), "\n") {
+		if strings.Contains(line, " on "+m.Target+" ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keychainPassword returns the password of the share user stored in the Linux secret service
+func (m *Mount) keychainPassword() string {
+	ba, err := exec.Command("secret-tool", "lookup", "protocol", "smb", "server", m.shareHost(), "user", m.Username).Output()
+	if err != nil {
+		common.Debug(fmt.Sprintf("No keychain password for %s@%s: %v", m.Username, m.shareHost(), err))
+
+		return ""
+	}
+
+	return strings.TrimSpace(string(ba))
+}
+
+// checkKeychain checks that the macOS keychain holds the password of the share user, mount_smbfs takes it from there
+// but cannot ask for it
+func (m *Mount) checkKeychain() error {
+	if runtime.GOOS != "darwin" || m.Username == "" {
+		return nil
+	}
+
+	err := exec.Command("security", "find-internet-password", "-r", "smb ", "-s", m.shareHost(), "-a", m.Username).Run()
+	if err != nil {
+		return fmt.Errorf("the keychain has no password of %s for the share %s, store it with \"security add-internet-password -r 'smb ' -s %s -a %s -w\"", m.Username, m.Share, m.shareHost(), m.Username)
+	}
+
+	return nil
+}
+
+// mountCmd returns the OS command to mount the share
+func (m *Mount) mountCmd() *exec.Cmd {
+	switch runtime.GOOS {
+	case "windows":
+		// net use prompts for the password of a given user, without one the Windows Credential Manager supplies the
+		// stored credentials of the server
+		return exec.Command("net", "use", m.Target, strings.ReplaceAll(m.Share, "/", "\\"), "/persistent:no")
+	case "darwin":
+		share := strings.TrimLeft(strings.ReplaceAll(m.Share, "\\", "/"), "/")
+		if m.Username != "" {
+			share = url.PathEscape(m.Username) + "@" + share
+		}
+
+		return exec.Command("mount_smbfs", "-N", "//"+share, m.Target)
+	default:
+		share := "//" + strings.TrimLeft(strings.ReplaceAll(m.Share, "\\", "/"), "/")
+
+		cmd := exec.Command("mount.cifs", share, m.Target)
+		if m.Username != "" {
+			cmd.Args = append(cmd.Args, "-o", "username="+m.Username)
+		}
+
+		// mount.cifs takes the password from the environment, so it does not show up in the process list
+		if password := m.keychainPassword(); password != "" {
+			cmd.Env = append(os.Environ(), "PASSWD="+password)
+		}
+
+		return cmd
+	}
+}
+
+// unmountCmd returns the OS command to unmount the share
+func (m *Mount) unmountCmd() *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("net", "use", m.Target, "/delete", "/y")
+	}
+
+	return exec.Command("umount", m.Target)
+}
+
+// mountShares mounts the shares which are not available yet and returns them
+func mountShares(mounts []Mount) ([]Mount, error) {
+	var mounted []Mount
+
+	for _, m := range mounts {
+		if m.isMounted() {
+			common.Debug(fmt.Sprintf("Share %s is already available on %s", m.Share, m.Target))
+
+			continue
+		}
+
+		if runtime.GOOS != "windows" {
+			err := os.MkdirAll(m.Target, common.DefaultDirMode)
+			if err != nil {
+				unmountShares(mounted)
+
+				return nil, err
+			}
+		}
+
+		err := m.checkKeychain()
+		if err != nil {
+			unmountShares(mounted)
+
+			return nil, err
+		}
+
+		common.Debug(fmt.Sprintf("Mount share %s on %s", m.Share, m.Target))
+
+		ba, err := m.mountCmd().CombinedOutput()
+		if err != nil {
+			unmountShares(mounted)
+
+			return nil, fmt.Errorf("cannot mount share %s on %s: %w: %s", m.Share, m.Target, err, strings.TrimSpace(string(ba)))
+		}
+
+		mounted = append(mounted, m)
+	}
+
+	return mounted, nil
+}
+
+// unmountShares unmounts the given shares in reverse order
+func unmountShares(mounted []Mount) {
+	for i := len(mounted) - 1; i >= 0; i-- {
+		m := mounted[i]
+
+		common.Debug(fmt.Sprintf("Unmount share %s from %s", m.Share, m.Target))
+
+		ba, err := m.unmountCmd().CombinedOutput()
+		if err != nil {
+			common.Warn(fmt.Sprintf("Cannot unmount share %s from %s: %v: %s", m.Share, m.Target, err, strings.TrimSpace(string(ba))))
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// muffinStoreProperty is the system property which passes the muffin store of the app host to the app
+const muffinStoreProperty = "espresso.muffins"
+
+// Muffin is a PersistenceService entry imported from Java Web Start
+type Muffin struct {
+	URL      string    `json:"url"`
+	File     string    `json:"file"`
+	Source   string    `json:"source"`
+	Imported time.Time `json:"imported"`
+}
+
+// muffinStorePath returns the muffin store of the host of the URL, the muffins are keyed by their URL in its index
+func muffinStorePath(address string) (string, error) {
+	appPath, err := appCachePath(address)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appPath, "muffins"), nil
+}
+
+// deploymentCaches returns the possible cache directories of Java Web Start
+func deploymentCaches() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		return []string{
+			filepath.Join(home, "AppData", "LocalLow", "Sun", "Java", "Deployment", "cache"),
+			filepath.Join(home, "Application Data", "Sun", "Java", "Deployment", "cache"),
+		}
+	case "darwin":
+		return []string{
+			filepath.Join(home, "Library", "Application Support", "Oracle", "Java", "Deployment", "cache"),
+			filepath.Join(home, "Library", "Caches", "Java Applets", "cache"),
+		}
+	default:
+		return []string{
+			filepath.Join(home, ".java", "deployment", "cache"),
+			filepath.Join(home, ".javaws", "cache"),
+		}
+	}
+}
+
+// muffinURLOf returns the URL stored in the ".muf" attribute file of a Java 6+ muffin
+func muffinURLOf(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		common.Error(f.Close())
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") || strings.HasPrefix(line, "file:") {
+			return line, nil
+		}
+	}
+
+	return "", fmt.Errorf("no muffin URL in %s", filename)
+}
+
+// legacyMuffinURL reconstructs the URL of a muffin of the legacy javaws cache layout
+// "muffins/<protocol>/<host>/P<port>/DM<dir>/.../DM<name>"
+func legacyMuffinURL(rel string) (string, bool) {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 4 || !strings.HasPrefix(parts[2], "P") {
+		return "", false
+	}
+
+	var path []string
+
+	for _, part := range parts[3:] {
+		name, ok := strings.CutPrefix(part, "DM")
+		if !ok {
+			return "", false
+		}
+
+		path = append(path, name)
+	}
+
+	host := parts[1]
+	if port := strings.TrimPrefix(parts[2], "P"); port != "" && port != "-1" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	u := url.URL{Scheme: parts[0], Host: host, Path: "/" + strings.Join(path, "/")}
+
+	return u.String(), true
+}
+
+// findMuffins returns the muffins of the Java Web Start caches as URL and data file
+func findMuffins() map[string]string {
+	muffins := make(map[string]string)
+
+	for _, cache := range deploymentCaches() {
+		// Java 6 and later: data file and ".muf" attribute file in "6.0/muffin"
+		matches, _ := filepath.Glob(filepath.Join(cache, "6.0", "muffin", "*.muf"))
+
+		for _, match := range matches {
+			address, err := muffinURLOf(match)
+			if err != nil {
+				common.Debug(err.Error())
+
+				continue
+			}
+
+			data := strings.TrimSuffix(match, ".muf")
+			if common.FileExists(data) {
+				muffins[address] = data
+			}
+		}
+
+		// Java 1.4/5: muffins are stored by their URL path
+		for _, legacy := range []string{filepath.Join(cache, "javaws", "muffins"), filepath.Join(cache, "muffins")} {
+			_ = filepath.WalkDir(legacy, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return nil
+				}
+
+				rel, err := filepath.Rel(legacy, path)
+				if err != nil {
+					return nil
+				}
+
+				if address, ok := legacyMuffinURL(rel); ok {
+					muffins[address] = path
+				}
+
+				return nil
+			})
+		}
+	}
+
+	return muffins
+}
+
+// readMuffinIndex returns the imported muffins of the store
+func readMuffinIndex(store string) (map[string]Muffin, error) {
+	index := make(map[string]Muffin)
+
+	ba, err := storage.ReadFile(filepath.Join(store, "index.json"))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(ba, &index)
+	if err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// runImportMuffins copies the muffins of Java Web Start into the muffin stores of espresso. Without a filter all
+// muffins are imported, otherwise only the ones below the codebase of the app. Muffins which have been imported before
+// are kept, so data written by the app since then is not overwritten.
+func runImportMuffins(cfg *Config, name string) error {
+	prefix := ""
+
+	if name != "" {
+		address := cfg.App(name).URL
+
+		u, err := url.Parse(address)
+		if err != nil {
+			return err
+		}
+
+		u.Path = filepath.ToSlash(filepath.Dir(u.Path))
+		u.RawQuery = ""
+
+		prefix = strings.TrimSuffix(u.String(), "/") + "/"
+	}
+
+	imported := 0
+
+	for address, data := range findMuffins() {
+		if prefix != "" && !strings.HasPrefix(address, prefix) {
+			continue
+		}
+
+		store, err := muffinStorePath(address)
+		if err != nil {
+			common.Warn(fmt.Sprintf("Skip muffin %s: %v", address, err))
+
+			continue
+		}
+
+		index, err := readMuffinIndex(store)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := index[address]; ok {
+			continue
+		}
+
+		err = os.MkdirAll(store, common.DefaultDirMode)
+		if err != nil {
+			return err
+		}
+
+		ba, err := os.ReadFile(data)
+		if err != nil {
+			return err
+		}
+
+		file := sha256Hex([]byte(address))
+
+		err = storage.WriteFile(filepath.Join(store, file), ba)
+		if err != nil {
+			return err
+		}
+
+		index[address] = Muffin{URL: address, File: file, Source: data, Imported: time.Now()}
+
+		ba, err = json.MarshalIndent(index, "", "    ")
+		if err != nil {
+			return err
+		}
+
+		err = storage.WriteFile(filepath.Join(store, "index.json"), ba)
+		if err != nil {
+			return err
+		}
+
+		imported++
+
+		common.Info(fmt.Sprintf("Imported muffin %s", address))
+	}
+
+	common.Info(fmt.Sprintf("%d muffins imported", imported))
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/mpetavy/common"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// nativeBlobGrace protects the stored files of a running extraction, which are not linked yet, from the garbage
+// collection of the store
+const nativeBlobGrace = time.Hour
+
+// nativeStorePath returns the directory of the content-addressed store of extracted files
+func nativeStorePath() string {
+	return filepath.Join(*cache, "natives")
+}
+
+// nativeLibPath returns the directory the nativelibs of the app are extracted to, keyed by the app and its platform
+func (l *Launch) nativeLibPath() (string, error) {
+	appPath, err := appCachePath(l.Address)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(l.Address)
+	if err != nil {
+		return "", err
+	}
+
+	app := sanitizeName(strings.Trim(u.Path, "/"))
+	if u.RawQuery != "" {
+		app += "_" + sanitizeName(u.RawQuery)
+	}
+
+	platform := sanitizeName(strings.ToLower(l.OS) + "-" + l.Arch)
+
+	return filepath.Join(appPath, "app", "native", app, platform), nil
+}
+
+// storeContent stores the content in the content-addressed store and returns the path of the stored file
+func storeContent(r io.Reader) (string, error) {
+	err := os.MkdirAll(nativeStorePath(), common.DefaultDirMode)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(nativeStorePath(), "tmp-*")
+	if err != nil {
+		return "", err
+	}
+
+	// care about removing the temporary file if it is not moved into the store
+	defer func() {
+		common.Error(tmp.Close())
+
+		if common.FileExists(tmp.Name()) {
+			common.Error(os.Remove(tmp.Name()))
+		}
+	}()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		return "", err
+	}
+
+	blob := filepath.Join(nativeStorePath(), hex.EncodeToString(hash.Sum(nil)))
+
+	// the files stored before the cache index are indexed by their next use
+	if common.FileExists(blob) {
+		entry, err := lookupCacheEntry(blob)
+		if err != nil || entry != nil {
+			return blob, err
+		}
+
+		return blob, indexBlob(blob)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Rename(tmp.Name(), blob)
+	if err != nil {
+		return "", err
+	}
+
+	return blob, indexBlob(blob)
+}
+
+// linkContent hardlinks the stored file to the destination, if hardlinks are not supported the file is copied
+func linkContent(blob string, dest string) error {
+	blobInfo, err := os.Stat(blob)
+	if err != nil {
+		return err
+	}
+
+	// already linked?
+	if destInfo, err := os.Stat(dest); err == nil {
+		if os.SameFile(blobInfo, destInfo) {
+			return nil
+		}
+
+		err = os.Remove(dest)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Link(blob, dest)
+	if err == nil {
+		return nil
+	}
+
+	f, err := os.Open(blob)
+	if err != nil {
+		return err
+	}
+
+	// care about closing the stored file
+	defer func() {
+		common.Error(f.Close())
+	}()
+
+	return common.FileStore(dest, f)
+}
+
+// runUnzipLinked extracts all files of the ZIP file into the content-addressed store and hardlinks them
+// to the given path, so unchanged files of different versions share the same disk space
+func runUnzipLinked(filename string, path string) error {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+
+	// care about closing the ZIP file
+	defer func() {
+		common.Error(r.Close())
+	}()
+
+	// loop over the ZIP content
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || strings.Contains(f.Name, "..") {
+			continue
+		}
+
+		dest := longPath(filepath.Join(path, f.Name))
+
+		// create the destination path
+		err := os.MkdirAll(filepath.Dir(dest), common.DefaultDirMode)
+		if err != nil {
+			return err
+		}
+
+		// open the source file inside the ZIP file
+		zipfile, err := f.Open()
+		if err != nil {
+			return err
+		}
+
+		blob, err := storeContent(zipfile)
+
+		// closes the zipfile file
+		common.Error(zipfile.Close())
+
+		if err != nil {
+			return err
+		}
+
+		// keep executables executable
+		if f.Mode()&0111 != 0 {
+			err = os.Chmod(blob, 0755)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = linkContent(blob, dest)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// gcNativeStore removes the files of the content-addressed store which are not linked by any app anymore, together with
+// their cache index entries, and returns the freed disk space
+func gcNativeStore() (int64, error) {
+	entries, err := os.ReadDir(nativeStorePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	var removed []string
+	var freed int64
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || time.Since(info.ModTime()) < nativeBlobGrace {
+			continue
+		}
+
+		blob := filepath.Join(nativeStorePath(), entry.Name())
+
+		// the store itself holds one link
+		links, err := linkCount(blob)
+		if err != nil || links > 1 {
+			continue
+		}
+
+		err = storage.RemoveAll(blob)
+		if err != nil {
+			break
+		}
+
+		removed = append(removed, blob)
+		freed += info.Size()
+	}
+
+	if len(removed) == 0 {
+		return 0, err
+	}
+
+	indexErr := updateCacheIndex(func(index *CacheIndex) error {
+		for _, blob := range removed {
+			if key, ok := cacheKey(blob); ok {
+				delete(index.Entries, key)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return freed, err
+	}
+
+	return freed, indexErr
+}
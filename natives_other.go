@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// linkCount returns the number of hardlinks of the file
+func linkCount(filename string) (uint64, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("no link count of %s", filename)
+	}
+
+	return uint64(stat.Nlink), nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/mpetavy/common"
+	"os"
+	"syscall"
+)
+
+// linkCount returns the number of hardlinks of the file
+func linkCount(filename string) (uint64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	// care about closing the file
+	defer func() {
+		common.Error(f.Close())
+	}()
+
+	var info syscall.ByHandleFileInformation
+
+	err = syscall.GetFileInformationByHandle(syscall.Handle(f.Fd()), &info)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(info.NumberOfLinks), nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	// networkPollInterval is the interval in which a lost network connection is checked for its return
+	networkPollInterval = 2 * time.Second
+	// downloadAttempts is the max. number of attempts of a download which is interrupted by connectivity errors
+	downloadAttempts = 8
+	// downloadBackoff is the delay before the first retry of an interrupted download, it doubles with every retry
+	downloadBackoff = time.Second
+	// downloadMaxBackoff limits the delay between the retries of an interrupted download
+	downloadMaxBackoff = 30 * time.Second
+)
+
+// isConnectivityError checks if the error is caused by a lost network connection rather than by the server
+func isConnectivityError(err error) bool {
+	if errors.Is(err, syscall.ENETUNREACH) || errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETDOWN) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// hostAddress returns the host:port of the URL
+func hostAddress(href string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// isReachable checks if a TCP connection to the host of the URL can be established
+func isReachable(href string) bool {
+	address, err := hostAddress(href)
+	if err != nil {
+		return false
+	}
+
+	conn, err := dialTimeout("tcp", address, 3*time.Second)
+	if err != nil {
+		return false
+	}
+
+	common.Error(conn.Close())
+
+	return true
+}
+
+// awaitNetwork pauses until the host of the URL is reachable again or the deadline has passed
+func (l *Launch) awaitNetwork(href string, deadline time.Time) error {
+	// only one download watches the network, the others resume as soon as it has returned
+	l.networkMu.Lock()
+	defer l.networkMu.Unlock()
+
+	if isReachable(href) {
+		return nil
+	}
+
+	common.Warn(fmt.Sprintf("Network connection lost, downloads are paused for max. %v", time.Until(deadline).Round(time.Second)))
+	l.logf("Network connection lost, downloads are paused")
+	l.setState("paused")
+
+	for time.Now().Before(deadline) {
+		if l.isCancelled() {
+			return fmt.Errorf("launch cancelled")
+		}
+
+		time.Sleep(networkPollInterval)
+
+		if isReachable(href) {
+			common.Info("Network connection is back, downloads are resumed")
+			l.logf("Network connection is back, downloads are resumed")
+			l.setState("downloading")
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("network connection did not return within %v", *networkWait)
+}
+
+// downloadResuming downloads the resource and retries after a lost network connection has returned. All retries
+// happen within the max. waiting time of -network-wait, with an exponential backoff and a max. number of attempts, so
+// a server which accepts connections but keeps breaking the transfers fails the download with its last error.
+func (l *Launch) downloadResuming(ctx context.Context, href string, filename string, encrypt bool) error {
+	err := l.checkOffline(href)
+	if err != nil {
+		return err
+	}
+
+	limiter := downloadLimiter()
+
+	deadline := time.Now().Add(*networkWait)
+	backoff := downloadBackoff
+
+	for attempt := 1; ; attempt++ {
+		span := spanFrom(ctx).Child("queued")
+		host := limiter.acquire(href)
+		span.End()
+
+		start := time.Now()
+
+		err = download(ctx, href, filename, encrypt)
+
+		limiter.release(host, downloadedSize(filename, start), time.Since(start), err)
+
+		if err == nil || !isConnectivityError(err) || *networkWait <= 0 {
+			return err
+		}
+
+		common.Debug(fmt.Sprintf("Download of %s interrupted: %v", href, err))
+
+		if attempt == downloadAttempts || !time.Now().Before(deadline) {
+			return fmt.Errorf("download of %s failed after %d attempts: %w", href, attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(backoff, time.Until(deadline))):
+		}
+
+		backoff = min(2*backoff, downloadMaxBackoff)
+
+		waitErr := l.awaitNetwork(href, deadline)
+		if waitErr != nil {
+			return fmt.Errorf("download of %s failed, %v: %w", href, waitErr, err)
+		}
+	}
+}
+
+// downloadedSize returns the size of the file if it has been downloaded since start, cached files count 0
+func downloadedSize(filename string, start time.Time) int64 {
+	info, err := os.Stat(longPath(filename))
+	if err != nil || info.ModTime().Before(start) {
+		return 0
+	}
+
+	return info.Size()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mpetavy/common"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// checkOffline refuses the requests of an offline launch, the app is launched from the cache only
+func (l *Launch) checkOffline(href string) error {
+	if l.offline {
+		return fmt.Errorf("the request to %s is refused in offline mode", href)
+	}
+
+	return nil
+}
+
+// isOfflineError checks if the server could not be reached at all
+func isOfflineError(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+
+	return isConnectivityError(err) || errors.As(err, &opErr) || errors.As(err, &dnsErr)
+}
+
+// descriptorPath returns the cache path of a JNLP file, the JNLP files of the last launch are kept for offline launches
+func descriptorPath(address string) (string, error) {
+	appPath, err := appCachePath(address)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appPath, "jnlp", hrefPath(u.RequestURI())), nil
+}
+
+// cacheDescriptor stores the JNLP file of the launch in the cache and records it in the cache index
+func (l *Launch) cacheDescriptor(address string, content []byte) error {
+	path, err := descriptorPath(address)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), common.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(path, content)
+	if err != nil {
+		return err
+	}
+
+	key, ok := cacheKey(path)
+	if !ok {
+		return nil
+	}
+
+	return updateCacheIndex(func(index *CacheIndex) error {
+		now := time.Now()
+
+		index.Entries[key] = &CacheEntry{
+			URL:        stripTokens(address),
+			SHA256:     sha256Hex(content),
+			Size:       int64(len(content)),
+			Downloaded: now,
+			LastUsed:   now,
+			References: []string{l.Address},
+		}
+
+		return nil
+	})
+}
+
+// cachedDescriptor returns the JNLP file of the last launch, which must be recorded unchanged in the cache index
+func cachedDescriptor(address string) ([]byte, error) {
+	path, err := descriptorPath(address)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := lookupCacheEntry(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil || entry.URL != stripTokens(address) {
+		return nil, fmt.Errorf("the JNLP file %s is not cached", address)
+	}
+
+	content, err := storage.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if sha256Hex(content) != entry.SHA256 {
+		return nil, fmt.Errorf("the cached JNLP file %s was modified", address)
+	}
+
+	return content, nil
+}
+
+// goOffline switches the launch to the JNLP files and resources of the last launch, provided the app allows
+// offline use with the JNLP offline-allowed element
+func (l *Launch) goOffline(reason string) error {
+	content, err := cachedDescriptor(l.Address)
+	if err != nil {
+		return fmt.Errorf("%s, but %s has not been launched before and cannot be launched offline: %v", reason, l.Address, err)
+	}
+
+	jnlp, err := parseJnlp(content)
+	if err != nil {
+		return err
+	}
+
+	if jnlp.Information.OfflineAllowed == nil {
+		return fmt.Errorf("%s, but %s does not allow offline use", reason, l.Address)
+	}
+
+	message := fmt.Sprintf("%s, the app is launched offline from the cache", reason)
+
+	common.Info(message)
+	l.logf("%s", message)
+
+	l.offline = true
+	l.keepCached = true
+
+	return nil
+}
+
+// checkCachedOffline fails if the resource is missing in the cache of an offline launch
+func (l *Launch) checkCachedOffline(url string, path string) error {
+	if !l.offline || common.FileExists(path) {
+		return nil
+	}
+
+	return fmt.Errorf("resource %s is not cached, the app cannot be launched offline", url)
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package main
+
+import "runtime"
+
+// osName returns the name of the operating system like the Java system property os.name
+func osName() string {
+	switch runtime.GOOS {
+	case "linux":
+		return "Linux"
+	case "darwin":
+		return "Mac OS X"
+	}
+
+	return runtime.GOOS
+}
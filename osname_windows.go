@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"golang.org/x/sys/windows"
+)
+
+// verNtWorkstation is the product type of Windows client editions
+const verNtWorkstation = 1
+
+// windowsServers maps the build numbers of Windows Server to their names
+var windowsServers = map[uint32]string{
+	14393: "2016",
+	17763: "2019",
+	20348: "2022",
+	26100: "2025",
+}
+
+// osName returns the name of the operating system like the Java system property os.name, e.g. "Windows 11"
+func osName() string {
+	info := windows.RtlGetVersion()
+
+	if info.ProductType != verNtWorkstation {
+		if name, ok := windowsServers[info.BuildNumber]; ok {
+			return "Windows Server " + name
+		}
+
+		return "Windows Server"
+	}
+
+	switch {
+	case info.MajorVersion == 10 && info.BuildNumber >= 22000:
+		return "Windows 11"
+	case info.MajorVersion == 10:
+		return "Windows 10"
+	case info.MajorVersion == 6 && info.MinorVersion == 3:
+		return "Windows 8.1"
+	case info.MajorVersion == 6 && info.MinorVersion == 2:
+		return "Windows 8"
+	case info.MajorVersion == 6 && info.MinorVersion == 1:
+		return "Windows 7"
+	}
+
+	return fmt.Sprintf("Windows %d.%d", info.MajorVersion, info.MinorVersion)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"github.com/mpetavy/common"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sandboxPolicyFile is the generated Java policy file of sandboxed apps in the app cache directory
+const sandboxPolicyFile = "sandbox.policy"
+
+// sandboxProperties are the system properties sandboxed apps may read, like in Java Web Start
+var sandboxProperties = []string{
+	"java.version", "java.vendor", "java.vendor.url", "java.class.version",
+	"java.specification.version", "java.specification.vendor", "java.specification.name",
+	"java.vm.version", "java.vm.vendor", "java.vm.name",
+	"java.vm.specification.version", "java.vm.specification.vendor", "java.vm.specification.name",
+	"os.name", "os.version", "os.arch",
+	"file.separator", "path.separator", "line.separator",
+	"browser", "browser.version", "browser.vendor", "http.agent",
+	launchIDProperty, muffinStoreProperty,
+}
+
+// secureProperties are the system properties which sandboxed apps may set besides the "jnlp." and "javaws." ones, like
+// the secure properties of Java Web Start
+var secureProperties = []string{
+	"awt.useSystemAAFontSettings", "http.agent", "http.keepAlive",
+	"java.awt.syncLWRequests", "java.awt.Window.locationByPlatform",
+	"sun.awt.erasebackgroundonresize", "sun.awt.keepWorkingSetOnMinimize", "sun.awt.noerasebackground",
+	"sun.java2d.d3d", "sun.java2d.dpiaware", "sun.java2d.noddraw", "sun.java2d.opengl",
+	"swing.aatext", "swing.boldMetal", "swing.metalTheme", "swing.noxp", "swing.useSystemFontSettings",
+}
+
+// propertyNameRegex matches the names of system properties which are passed to the app, other characters could
+// break the command line or the generated policy
+var propertyNameRegex = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// requestsPermissions reports if the JNLP file requests more than the sandbox
+func requestsPermissions(jnlp *Jnlp) bool {
+	return jnlp.Security.AllPermissions != nil || jnlp.Security.J2eeApplicationClientPermissions != nil
+}
+
+// isTrusted reports if the app is trusted explicitly and runs with full permissions without any checks
+func (l *Launch) isTrusted() bool {
+	return *trust || l.App.Trust
+}
+
+// checkPermissions enforces the security element of the JNLP file: apps requesting all-permissions need jars signed
+// by one trusted certificate, sandboxed apps need a JRE with a security manager
+func (l *Launch) checkPermissions(jnlp *Jnlp) error {
+	if l.isTrusted() {
+		l.logf("The app is trusted explicitly and runs with full permissions")
+
+		return nil
+	}
+
+	if !requestsPermissions(jnlp) {
+		return l.checkSecurityManager()
+	}
+
+	_, err := l.jarsSigner()
+	if err != nil {
+		message := fmt.Sprintf("%s requests all-permissions, but %v", l.Address, err)
+
+		logEvent(eventSecurityRejection, message)
+
+		return fmt.Errorf("%s. Use -trust to launch it anyway", message)
+	}
+
+	l.logf("The jars are signed by a trusted certificate, the app runs with all-permissions")
+
+	return nil
+}
+
+// isSandboxed reports if the app runs with the security manager and the generated sandbox policy
+func (l *Launch) isSandboxed(jnlp *Jnlp) bool {
+	return !l.isTrusted() && !requestsPermissions(jnlp)
+}
+
+// isSecureProperty reports if a sandboxed app may set the system property
+func isSecureProperty(name string) bool {
+	return strings.HasPrefix(name, "jnlp.") || strings.HasPrefix(name, "javaws.") || slices.Contains(secureProperties, name)
+}
+
+// appProperties returns the JNLP properties which are passed to the app, sandboxed apps may set the secure properties
+// only
+func (l *Launch) appProperties(jnlp *Jnlp) []Property {
+	sandboxed := l.isSandboxed(jnlp)
+
+	var properties []Property
+
+	for _, property := range l.properties {
+		switch {
+		case property.Name == "":
+		case !propertyNameRegex.MatchString(property.Name):
+			common.Warn(fmt.Sprintf("The JNLP property %q has an invalid name and is ignored", property.Name))
+		case sandboxed && !isSecureProperty(property.Name):
+			common.Warn(fmt.Sprintf("The JNLP property %s of the sandboxed app is not a secure property and is ignored", property.Name))
+		default:
+			properties = append(properties, property)
+		}
+	}
+
+	return properties
+}
+
+// jarsSigner verifies the signatures of all jars of the classpath and returns the certificate which signed all of
+// them, the result is kept for the launch
+func (l *Launch) jarsSigner() (*x509.Certificate, error) {
+	if l.signerVerified {
+		return l.signer, l.signerErr
+	}
+
+	l.signerVerified = true
+
+	for _, jar := range l.jars {
+		cert, err := verifyJar(jar)
+		if err != nil {
+			l.signer, l.signerErr = nil, err
+
+			break
+		}
+
+		if l.signer != nil && !l.signer.Equal(cert) {
+			l.signer, l.signerErr = nil, fmt.Errorf("its jars are signed by different certificates")
+
+			break
+		}
+
+		l.signer = cert
+	}
+
+	if l.signer == nil && l.signerErr == nil {
+		l.signerErr = fmt.Errorf("it has no jars")
+	}
+
+	return l.signer, l.signerErr
+}
+
+// sandboxEscapes are the JVM options which would weaken the sandbox of an app
+var sandboxEscapes = []string{"java.security", "-javaagent", "-agentlib", "-agentpath", "-Xbootclasspath", "--patch-module", "-XX:Flags", "-XX:VMOptionsFile"}
+
+// javaVMArgs returns the JVM options of the java-vm-args attribute, without the ones which weaken the sandbox. Argument
+// files could contain any option, the system properties are restricted to the secure ones.
+func (l *Launch) javaVMArgs(jnlp *Jnlp) []string {
+	if !l.isSandboxed(jnlp) {
+		return l.vmArgs
+	}
+
+	var args []string
+
+	for _, arg := range l.vmArgs {
+		name, isProperty := strings.CutPrefix(arg, "-D")
+		name, _, _ = strings.Cut(name, "=")
+
+		if strings.HasPrefix(arg, "@") || (isProperty && (!propertyNameRegex.MatchString(name) || !isSecureProperty(name))) || slices.ContainsFunc(sandboxEscapes, func(escape string) bool {
+			return strings.Contains(arg, escape)
+		}) {
+			common.Warn(fmt.Sprintf("The JVM option %s of the sandboxed app is ignored", arg))
+
+			continue
+		}
+
+		args = append(args, arg)
+	}
+
+	return args
+}
+
+// jreHome returns the home directory of the JRE of the launch, a java executable of the PATH is resolved
+func (l *Launch) jreHome() (string, error) {
+	executable, err := exec.LookPath(l.Jre)
+	if err != nil {
+		return "", err
+	}
+
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Dir(filepath.Dir(executable)), nil
+}
+
+// jreMajorVersion returns the feature version of the JRE of the launch, e.g. 8 for "1.8.0_391" or 17 for "17.0.2"
+func (l *Launch) jreMajorVersion() (int, error) {
+	home, err := l.jreHome()
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := jreVersion(home)
+	if err != nil {
+		return 0, err
+	}
+
+	version = strings.TrimPrefix(version, "1.")
+
+	major, _, _ := strings.Cut(version, ".")
+	major, _, _ = strings.Cut(major, "_")
+
+	return strconv.Atoi(major)
+}
+
+// checkSecurityManager refuses the launch of sandboxed apps with a JRE whose security manager was removed
+func (l *Launch) checkSecurityManager() error {
+	major, err := l.jreMajorVersion()
+	if err != nil {
+		common.Warn(fmt.Sprintf("Cannot determine the version of the JRE %s: %v", l.Jre, err))
+
+		return nil
+	}
+
+	if major >= 24 {
+		return fmt.Errorf("%s runs sandboxed, but the security manager was removed with Java 24 and the JRE has version %d. Use an older JRE or -trust to launch it with full permissions", l.Address, major)
+	}
+
+	return nil
+}
+
+// sandboxPolicy returns the Java policy of a sandboxed app, which may connect back to its codebase host only
+func (l *Launch) sandboxPolicy(properties []Property) string {
+	sb := strings.Builder{}
+
+	sb.WriteString("// generated by espresso, the sandbox of apps without all-permissions\n")
+	sb.WriteString("grant {\n")
+
+	codebase := l.codebase
+	if codebase == "" {
+		codebase = l.Address
+	}
+
+	if u, err := url.Parse(codebase); err == nil && u.Hostname() != "" {
+		host := u.Hostname()
+
+		// Java expects IPv6 literals in brackets
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		sb.WriteString(fmt.Sprintf("    permission java.net.SocketPermission \"%s\", \"connect,accept\";\n", host))
+	}
+
+	for _, property := range sandboxProperties {
+		sb.WriteString(fmt.Sprintf("    permission java.util.PropertyPermission \"%s\", \"read\";\n", property))
+	}
+
+	sb.WriteString("    permission java.util.PropertyPermission \"jnlp.*\", \"read,write\";\n")
+	sb.WriteString("    permission java.util.PropertyPermission \"javaws.*\", \"read,write\";\n")
+
+	// the JNLP properties are readable by the app which defines them, their names are validated by appProperties
+	for _, property := range properties {
+		sb.WriteString(fmt.Sprintf("    permission java.util.PropertyPermission \"%s\", \"read\";\n", property.Name))
+	}
+
+	// the muffins are the persistent storage of sandboxed apps
+	if store, err := muffinStorePath(l.Address); err == nil {
+		path := strings.ReplaceAll(store+string(filepath.Separator)+"-", `\`, `\\`)
+
+		sb.WriteString(fmt.Sprintf("    permission java.io.FilePermission \"%s\", \"read,write,delete\";\n", path))
+	}
+
+	// the document the app is launched with
+	if l.openPath != "" {
+		sb.WriteString(fmt.Sprintf("    permission java.io.FilePermission \"%s\", \"read\";\n", strings.ReplaceAll(l.openPath, `\`, `\\`)))
+	}
+
+	sb.WriteString("};\n")
+
+	return sb.String()
+}
+
+// sandboxOptions returns the JVM options which run apps without all-permissions with a security manager and
+// the generated sandbox policy, they must be the last system properties of the command line
+func (l *Launch) sandboxOptions(jnlp *Jnlp, properties []Property) ([]string, error) {
+	if !l.isSandboxed(jnlp) {
+		return nil, nil
+	}
+
+	appPath, err := appCachePath(l.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(appPath, sandboxPolicyFile)
+
+	err = os.MkdirAll(appPath, common.DefaultDirMode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = storage.WriteFile(path, []byte(l.sandboxPolicy(properties)))
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{"-Djava.security.manager", "-Djava.security.policy=" + path}, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PinState records the version an app is pinned to
+type PinState struct {
+	Version string    `json:"version"`
+	Pinned  time.Time `json:"pinned"`
+	Jnlp    string    `json:"jnlp"`
+}
+
+// pinStatePath returns the path of the pin state of the app
+func pinStatePath(address string) (string, error) {
+	appPath, err := appCachePath(address)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appPath, "pin.json"), nil
+}
+
+// runPin freezes the app at its currently cached version
+func runPin(cfg *Config, name string, version string) error {
+	app := cfg.App(name)
+
+	path, err := rolloutStatePath(app.URL)
+	if err != nil {
+		return err
+	}
+
+	ba, err := storage.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s has no cached version, please launch it first", name)
+	}
+
+	current := &RolloutState{}
+
+	err = json.Unmarshal(ba, current)
+	if err != nil {
+		return err
+	}
+
+	if version != "" && version != current.Version {
+		return fmt.Errorf("the cached version of %s is %q, not %q", name, current.Version, version)
+	}
+
+	ba, err = json.MarshalIndent(PinState{Version: current.Version, Pinned: time.Now(), Jnlp: current.Jnlp}, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	path, err = pinStatePath(app.URL)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(path, ba)
+	if err != nil {
+		return err
+	}
+
+	common.Info(fmt.Sprintf("%s is pinned to its cached version %s", name, current.Version))
+
+	return nil
+}
+
+// runUnpin allows the updates of the app again
+func runUnpin(cfg *Config, name string) error {
+	path, err := pinStatePath(cfg.App(name).URL)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s is not pinned", name)
+	}
+	if err != nil {
+		return err
+	}
+
+	common.Info(fmt.Sprintf("%s is unpinned and will be updated with the next launch", name))
+
+	return nil
+}
+
+// pinnedJnlp returns the JNLP of the pinned version of the app or nil if the app is not pinned.
+// The resources of a pinned app are neither revalidated nor updated.
+func (l *Launch) pinnedJnlp(address string) ([]byte, error) {
+	path, err := pinStatePath(address)
+	if err != nil {
+		return nil, err
+	}
+
+	ba, err := storage.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := &PinState{}
+
+	err = json.Unmarshal(ba, state)
+	if err != nil {
+		return nil, err
+	}
+
+	common.Info(fmt.Sprintf("%s is pinned to version %s since %s", address, state.Version, state.Pinned.Format(time.DateTime)))
+	l.logf("Pinned to version %s", state.Version)
+
+	l.pinned = true
+	l.keepCached = true
+
+	return []byte(state.Jnlp), nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"strings"
+)
+
+// splitPlatformList splits an os or arch attribute into its values. The values are separated by spaces, a space
+// escaped by a backslash is part of the value like in "Mac\ OS\ X".
+func splitPlatformList(attribute string) []string {
+	var values []string
+
+	sb := strings.Builder{}
+	escaped := false
+
+	for _, r := range attribute {
+		switch {
+		case escaped:
+			sb.WriteRune(r)
+
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if sb.Len() > 0 {
+				values = append(values, sb.String())
+				sb.Reset()
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	if sb.Len() > 0 {
+		values = append(values, sb.String())
+	}
+
+	return values
+}
+
+// matchesOS reports if the os attribute of a JNLP element selects the operating system. Like in the JNLP
+// specification each value is a prefix of the os.name, so "Windows" matches "Windows 10" and "Mac" matches "Mac OS X".
+func matchesOS(attribute string, name string) bool {
+	if strings.TrimSpace(attribute) == "" {
+		return true
+	}
+
+	for _, value := range splitPlatformList(attribute) {
+		if strings.HasPrefix(strings.ToLower(norm.NFC.String(name)), strings.ToLower(norm.NFC.String(value))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// archAliases maps the architecture names of JNLP files, Java and Go to the Go names
+var archAliases = map[string]string{
+	"amd64":   "amd64",
+	"x86_64":  "amd64",
+	"x86-64":  "amd64",
+	"x64":     "amd64",
+	"em64t":   "amd64",
+	"arm64":   "arm64",
+	"aarch64": "arm64",
+	"386":     "386",
+	"x86":     "386",
+	"i386":    "386",
+	"i486":    "386",
+	"i586":    "386",
+	"i686":    "386",
+	"arm":     "arm",
+	"armv7":   "arm",
+	"armv7l":  "arm",
+	"aarch32": "arm",
+	"ppc64le": "ppc64le",
+	"ppc64el": "ppc64le",
+}
+
+// normalizeArch returns the Go name of the architecture, unknown names are returned in lower case
+func normalizeArch(arch string) string {
+	arch = strings.ToLower(strings.TrimSpace(norm.NFC.String(arch)))
+
+	if name, ok := archAliases[arch]; ok {
+		return name
+	}
+
+	return arch
+}
+
+// matchesArch reports if one of the values of the arch attribute of a JNLP element is an alias of the architecture,
+// so "x86_64", "amd64" and "x64" select amd64 and "aarch64" and "arm64" select arm64
+func matchesArch(attribute string, arch string) bool {
+	if strings.TrimSpace(attribute) == "" {
+		return true
+	}
+
+	for _, value := range splitPlatformList(attribute) {
+		if normalizeArch(value) == normalizeArch(arch) {
+			return true
+		}
+	}
+
+	return false
+}
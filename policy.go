@@ -0,0 +1,479 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os/user"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// policy actions
+const (
+	policyAllow = "allow"
+	policyDeny  = "deny"
+)
+
+// Policy is a rule which allows or denies a launch if its expression is true
+type Policy struct {
+	Name    string `json:"name"`
+	When    string `json:"when"`
+	Action  string `json:"action"`
+	Message string `json:"message"`
+}
+
+// policyValues returns the variables the policy expressions can access
+func (l *Launch) policyValues() (map[string]any, error) {
+	values := map[string]any{
+		"url":     l.Address,
+		"os":      l.OS,
+		"arch":    l.Arch,
+		"signed":  false,
+		"signer":  "",
+		"user":    "",
+		"host":    "",
+		"zone":    "internet",
+		"hour":    float64(time.Now().Hour()),
+		"weekday": strings.ToLower(time.Now().Weekday().String()),
+	}
+
+	if u, err := user.Current(); err == nil {
+		values["user"] = u.Username
+	}
+
+	codebase := l.codebase
+	if codebase == "" {
+		codebase = l.Address
+	}
+
+	values["codebase"] = codebase
+
+	if u, err := url.Parse(codebase); err == nil {
+		values["host"] = u.Hostname()
+
+		addrs, err := net.LookupIP(u.Hostname())
+		if err == nil {
+			values["zone"] = networkZone(addrs)
+		}
+	}
+
+	// all jars must be signed by one trusted certificate, like for all-permissions
+	if signer, err := l.jarsSigner(); err == nil {
+		values["signed"] = true
+		values["signer"] = signer.Subject.String()
+	}
+
+	return values, nil
+}
+
+// networkZone returns "intranet" if all addresses of a host are private or loopback ones, otherwise "internet". A host
+// with mixed records is no intranet host, whatever the order of its DNS records.
+func networkZone(addrs []net.IP) string {
+	if len(addrs) == 0 {
+		return "internet"
+	}
+
+	for _, addr := range addrs {
+		if !addr.IsPrivate() && !addr.IsLoopback() {
+			return "internet"
+		}
+	}
+
+	return "intranet"
+}
+
+// decidePolicy returns the first policy whose expression is true, without one the default policy decides. The default
+// action is "deny" unless configured otherwise, so a launch no policy allows is denied.
+func decidePolicy(security SecurityConfig, values map[string]any) (Policy, error) {
+	for _, policy := range security.Policies {
+		result, err := evalPolicy(policy.When, values)
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid policy %q: %w", policy.Name, err)
+		}
+
+		if !result {
+			continue
+		}
+
+		if policy.Action != policyAllow && policy.Action != policyDeny {
+			return Policy{}, fmt.Errorf("invalid action %q of policy %q, use %s or %s", policy.Action, policy.Name, policyAllow, policyDeny)
+		}
+
+		return policy, nil
+	}
+
+	action := security.PolicyDefault
+	if action == "" {
+		action = policyDeny
+	}
+
+	if action != policyAllow && action != policyDeny {
+		return Policy{}, fmt.Errorf("invalid security.policy-default %q, use %s or %s", action, policyAllow, policyDeny)
+	}
+
+	return Policy{Name: "policy-default", Action: action, Message: "no policy allows the launch"}, nil
+}
+
+// checkPolicies evaluates the security policies in their order, the first matching policy decides, otherwise the
+// default action
+func (l *Launch) checkPolicies() error {
+	security := l.Config.Security
+
+	if len(security.Policies) == 0 && security.PolicyDefault == "" {
+		return nil
+	}
+
+	values, err := l.policyValues()
+	if err != nil {
+		return err
+	}
+
+	policy, err := decidePolicy(security, values)
+	if err != nil {
+		return err
+	}
+
+	if policy.Action == policyAllow {
+		return nil
+	}
+
+	message := fmt.Sprintf("launch of %s denied by policy %q", l.Address, policy.Name)
+	if policy.Message != "" {
+		message += ": " + policy.Message
+	}
+
+	logEvent(eventSecurityRejection, message)
+
+	return fmt.Errorf("%s", message)
+}
+
+// policyOperators are the operators of the policy expressions
+var policyOperators = map[string]bool{
+	"&&": true, "||": true, "==": true, "!=": true, "<=": true, ">=": true,
+	"<": true, ">": true, "!": true, "(": true, ")": true, ",": true,
+}
+
+// policyToken is a token of a policy expression
+type policyToken struct {
+	kind  string
+	value string
+}
+
+// tokenizePolicy splits the expression into identifiers, numbers, strings and operators
+func tokenizePolicy(expr string) ([]policyToken, error) {
+	var tokens []policyToken
+
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+
+			tokens = append(tokens, policyToken{"ident", string(runes[start:i])})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+
+			tokens = append(tokens, policyToken{"number", string(runes[start:i])})
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+
+			tokens = append(tokens, policyToken{"string", string(runes[i+1 : end])})
+			i = end + 1
+		default:
+			op := string(r)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "&&", "||", "==", "!=", "<=", ">=":
+					op = two
+				}
+			}
+
+			if !policyOperators[op] {
+				return nil, fmt.Errorf("unexpected %q at %d", op, i)
+			}
+
+			tokens = append(tokens, policyToken{"op", op})
+			i += len(op)
+		}
+	}
+
+	return tokens, nil
+}
+
+// policyParser evaluates a tokenized policy expression by recursive descent
+type policyParser struct {
+	tokens []policyToken
+	pos    int
+	values map[string]any
+}
+
+// evalPolicy evaluates the boolean policy expression with the given variables.
+//
+// Expressions support ||, &&, !, ==, !=, <, <=, >, >=, parentheses, string and number literals, true/false
+// and the functions glob(s, pattern), contains(s, sub), startsWith(s, prefix), endsWith(s, suffix) and lower(s).
+func evalPolicy(expr string, values map[string]any) (bool, error) {
+	tokens, err := tokenizePolicy(expr)
+	if err != nil {
+		return false, err
+	}
+
+	p := &policyParser{tokens: tokens, values: values}
+
+	value, err := p.or()
+	if err != nil {
+		return false, err
+	}
+
+	if p.pos != len(p.tokens) {
+		return false, fmt.Errorf("unexpected %q", p.tokens[p.pos].value)
+	}
+
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression is not boolean")
+	}
+
+	return result, nil
+}
+
+// accept consumes the next token if it is the given operator
+func (p *policyParser) accept(op string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == "op" && p.tokens[p.pos].value == op {
+		p.pos++
+
+		return true
+	}
+
+	return false
+}
+
+func (p *policyParser) or() (any, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+
+		l, lok := left.(bool)
+		r, rok := right.(bool)
+		if !lok || !rok {
+			return nil, fmt.Errorf("|| needs boolean operands")
+		}
+
+		left = l || r
+	}
+
+	return left, nil
+}
+
+func (p *policyParser) and() (any, error) {
+	left, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("&&") {
+		right, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+
+		l, lok := left.(bool)
+		r, rok := right.(bool)
+		if !lok || !rok {
+			return nil, fmt.Errorf("&& needs boolean operands")
+		}
+
+		left = l && r
+	}
+
+	return left, nil
+}
+
+func (p *policyParser) comparison() (any, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if !p.accept(op) {
+			continue
+		}
+
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case "==":
+			return left == right, nil
+		case "!=":
+			return left != right, nil
+		}
+
+		l, lok := left.(float64)
+		r, rok := right.(float64)
+		if !lok || !rok {
+			return nil, fmt.Errorf("%s needs number operands", op)
+		}
+
+		switch op {
+		case "<":
+			return l < r, nil
+		case "<=":
+			return l <= r, nil
+		case ">":
+			return l > r, nil
+		default:
+			return l >= r, nil
+		}
+	}
+
+	return left, nil
+}
+
+func (p *policyParser) unary() (any, error) {
+	if p.accept("!") {
+		value, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("! needs a boolean operand")
+		}
+
+		return !b, nil
+	}
+
+	return p.primary()
+}
+
+func (p *policyParser) primary() (any, error) {
+	if p.pos == len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	token := p.tokens[p.pos]
+	p.pos++
+
+	switch token.kind {
+	case "number":
+		return strconv.ParseFloat(token.value, 64)
+	case "string":
+		return token.value, nil
+	case "op":
+		if token.value != "(" {
+			return nil, fmt.Errorf("unexpected %q", token.value)
+		}
+
+		value, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+
+		return value, nil
+	}
+
+	switch token.value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+
+	if p.accept("(") {
+		return p.call(token.value)
+	}
+
+	value, ok := p.values[token.value]
+	if !ok {
+		return nil, fmt.Errorf("unknown variable %q", token.value)
+	}
+
+	return value, nil
+}
+
+// call evaluates the arguments and calls the function
+func (p *policyParser) call(name string) (any, error) {
+	var args []string
+
+	for !p.accept(")") {
+		if len(args) > 0 && !p.accept(",") {
+			return nil, fmt.Errorf("missing , in %s()", name)
+		}
+
+		value, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s() needs string arguments", name)
+		}
+
+		args = append(args, s)
+	}
+
+	want := 2
+
+	switch name {
+	case "lower":
+		want = 1
+	case "glob", "contains", "startsWith", "endsWith":
+	default:
+		return nil, fmt.Errorf("unknown function %s()", name)
+	}
+
+	if len(args) != want {
+		return nil, fmt.Errorf("%s() needs %d arguments", name, want)
+	}
+
+	switch name {
+	case "glob":
+		return path.Match(strings.ToLower(args[1]), strings.ToLower(args[0]))
+	case "contains":
+		return strings.Contains(args[0], args[1]), nil
+	case "startsWith":
+		return strings.HasPrefix(args[0], args[1]), nil
+	case "endsWith":
+		return strings.HasSuffix(args[0], args[1]), nil
+	default:
+		return strings.ToLower(args[0]), nil
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+// policyTestValues are the variables of the policy tests
+var policyTestValues = map[string]any{
+	"host":    "app.intra.example.com",
+	"url":     "https://app.intra.example.com/app.jnlp",
+	"signed":  false,
+	"signer":  "CN=Example Corp,O=Example Corp,C=DE",
+	"zone":    "intranet",
+	"hour":    float64(9),
+	"weekday": "monday",
+}
+
+func TestEvalPolicy(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// literals and variables
+		{"true", true},
+		{"false", false},
+		{"!signed", true},
+		{"!!signed", false},
+		{"zone == 'intranet'", true},
+		{`zone == "internet"`, false},
+		{"zone != 'internet'", true},
+		// comparisons of numbers
+		{"hour < 9", false},
+		{"hour <= 9", true},
+		{"hour > 8.5", true},
+		{"hour >= 10", false},
+		{"hour == 9", true},
+		// precedence: && binds stronger than ||, ! stronger than both
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"!signed && zone == 'intranet'", true},
+		{"!(signed || zone == 'intranet')", false},
+		{"false || false || true", true},
+		{"true && true && false", false},
+		// functions
+		{"glob(host, '*.INTRA.example.com')", true},
+		{"glob(host, '*.example.org')", false},
+		{"contains(signer, 'O=Example Corp')", true},
+		{"contains(signer, 'O=Other')", false},
+		{"startsWith(url, 'https://')", true},
+		{"startsWith(url, 'http://')", false},
+		{"endsWith(url, '.jnlp')", true},
+		{"endsWith(url, '.jar')", false},
+		{"lower('MONDAY') == weekday", true},
+		{"contains(lower(signer), 'example corp')", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			result, err := evalPolicy(test.expr, policyTestValues)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result != test.want {
+				t.Errorf("evalPolicy(%q) = %v, want %v", test.expr, result, test.want)
+			}
+		})
+	}
+}
+
+func TestEvalPolicyMalformed(t *testing.T) {
+	tests := []string{
+		"",
+		"signed &&",
+		"|| signed",
+		"(signed",
+		"signed)",
+		"'unterminated",
+		"signed & zone",
+		"signed = true",
+		"hour < 'nine'",
+		"signed || 'text'",
+		"!hour",
+		"hour",
+		"unknown",
+		"glob(host)",
+		"glob(host, '*', '*')",
+		"glob(host '*')",
+		"glob(host, hour)",
+		"lower(host",
+		"upper(host)",
+		"1.2.3 == hour",
+		"glob(host, '[')",
+		"true true",
+	}
+
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			_, err := evalPolicy(test, policyTestValues)
+			if err == nil {
+				t.Errorf("evalPolicy(%q) succeeded, want an error", test)
+			}
+		})
+	}
+}
+
+func TestDecidePolicy(t *testing.T) {
+	deny := Policy{Name: "deny-unsigned", When: "!signed && zone != 'intranet'", Action: policyDeny}
+	allow := Policy{Name: "allow-intranet", When: "zone == 'intranet'", Action: policyAllow}
+
+	tests := []struct {
+		name     string
+		security SecurityConfig
+		zone     string
+		want     string
+		wantErr  bool
+	}{
+		{"first match allows", SecurityConfig{Policies: []Policy{deny, allow}}, "intranet", "allow-intranet", false},
+		{"first match denies", SecurityConfig{Policies: []Policy{deny, allow}}, "internet", "deny-unsigned", false},
+		{"no match denies by default", SecurityConfig{Policies: []Policy{allow}}, "internet", "policy-default", false},
+		{"configured default", SecurityConfig{Policies: []Policy{allow}, PolicyDefault: policyAllow}, "internet", "policy-default", false},
+		{"invalid default", SecurityConfig{Policies: []Policy{allow}, PolicyDefault: "maybe"}, "internet", "", true},
+		{"invalid action", SecurityConfig{Policies: []Policy{{Name: "bad", When: "true", Action: "maybe"}}}, "internet", "", true},
+		{"invalid expression", SecurityConfig{Policies: []Policy{{Name: "bad", When: "signed &&", Action: policyDeny}}}, "internet", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := map[string]any{"signed": false, "zone": test.zone}
+
+			policy, err := decidePolicy(test.security, values)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("decidePolicy() succeeded, want an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if policy.Name != test.want {
+				t.Errorf("decidePolicy() = %q, want %q", policy.Name, test.want)
+			}
+
+			if policy.Name == "policy-default" {
+				want := test.security.PolicyDefault
+				if want == "" {
+					want = policyDeny
+				}
+
+				if policy.Action != want {
+					t.Errorf("default action = %q, want %q", policy.Action, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNetworkZone(t *testing.T) {
+	tests := []struct {
+		name  string
+		addrs []string
+		want  string
+	}{
+		{"none", nil, "internet"},
+		{"private", []string{"10.0.0.1", "192.168.1.1"}, "intranet"},
+		{"loopback", []string{"127.0.0.1", "::1"}, "intranet"},
+		{"private IPv6", []string{"fd00::1"}, "intranet"},
+		{"public", []string{"93.184.216.34"}, "internet"},
+		{"private first", []string{"10.0.0.1", "93.184.216.34"}, "internet"},
+		{"public first", []string{"93.184.216.34", "10.0.0.1"}, "internet"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var addrs []net.IP
+			for _, addr := range test.addrs {
+				addrs = append(addrs, net.ParseIP(addr))
+			}
+
+			if zone := networkZone(addrs); zone != test.want {
+				t.Errorf("networkZone(%v) = %q, want %q", test.addrs, zone, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// profileProperty is the system property which passes the profile of the user preferences to the app
+const profileProperty = "espresso.profile"
+
+// Prefs are the user preferences of an app which are reused by subsequent launches
+type Prefs struct {
+	Jre     string   `json:"jre,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Profile string   `json:"profile,omitempty"`
+}
+
+// prefsPath returns the file of the user preferences in the app cache directory
+func prefsPath(address string) (string, error) {
+	appPath, err := appCachePath(address)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appPath, "prefs.json"), nil
+}
+
+// readPrefs returns the user preferences of the app, empty ones if there are none
+func readPrefs(address string) (*Prefs, error) {
+	prefs := &Prefs{}
+
+	path, err := prefsPath(address)
+	if err != nil {
+		return nil, err
+	}
+
+	ba, err := storage.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return prefs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(ba, prefs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid preferences %s: %w", path, err)
+	}
+
+	return prefs, nil
+}
+
+// writePrefs stores the user preferences of the app
+func writePrefs(address string, prefs *Prefs) error {
+	path, err := prefsPath(address)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), common.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
+	ba, err := json.MarshalIndent(prefs, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, ba)
+}
+
+// rememberPrefs stores the preferences given on the command line, so subsequent launches reuse them
+func rememberPrefs(address string) error {
+	if address == "" || (!isFlagSet("jre") && !isFlagSet("args") && !isFlagSet("profile")) {
+		return nil
+	}
+
+	path, err := prefsPath(address)
+	if err != nil {
+		return err
+	}
+
+	// concurrent launches must not lose each other's preferences
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	prefs, err := readPrefs(address)
+	if err != nil {
+		return err
+	}
+
+	if isFlagSet("jre") {
+		prefs.Jre = *jrepath
+	}
+
+	if isFlagSet("args") {
+		prefs.Args = strings.Fields(*appArgs)
+	}
+
+	if isFlagSet("profile") {
+		prefs.Profile = *profile
+	}
+
+	return writePrefs(address, prefs)
+}
+
+// applyPrefs uses the user preferences of the app for the settings which are not given on the command line
+func (l *Launch) applyPrefs() error {
+	prefs, err := readPrefs(l.Address)
+	if err != nil {
+		return err
+	}
+
+	if prefs.Jre != "" && !isFlagSet("jre") {
+		l.setJre(prefs.Jre, "JRE of the user preferences of the app (espresso prefs)")
+	}
+
+	l.prefs = *prefs
+
+	return nil
+}
+
+// prefsOptions returns the JVM options of the user preferences
+func (l *Launch) prefsOptions() []string {
+	if l.prefs.Profile == "" {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("-D%s=%s", profileProperty, l.prefs.Profile)}
+}
+
+// editor returns the editor of the user, VISUAL or EDITOR before the OS default
+func editor() string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if value := os.Getenv(env); value != "" {
+			return value
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+
+	return "vi"
+}
+
+// runPrefs shows or edits the user preferences of the app
+func runPrefs(cfg *Config, action string, name string, w io.Writer) error {
+	address := cfg.App(name).URL
+
+	switch action {
+	case "show":
+		prefs, err := readPrefs(address)
+		if err != nil {
+			return err
+		}
+
+		ba, err := json.MarshalIndent(prefs, "", "    ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "%s\n", string(ba))
+
+		return nil
+	case "edit":
+		path, err := prefsPath(address)
+		if err != nil {
+			return err
+		}
+
+		// the editor starts with the empty preferences of an app without any
+		if !common.FileExists(path) {
+			err = writePrefs(address, &Prefs{})
+			if err != nil {
+				return err
+			}
+		}
+
+		args := strings.Fields(editor())
+
+		cmd := exec.Command(args[0], append(args[1:], path)...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		err = cmd.Run()
+		if err != nil {
+			return err
+		}
+
+		// refuse to leave broken preferences behind for the next launch
+		_, err = readPrefs(address)
+
+		return err
+	default:
+		return fmt.Errorf("usage: espresso prefs show|edit <alias>")
+	}
+}
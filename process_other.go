@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive checks if a process with the PID is running
+func processAlive(pid int) bool {
+	// signal 0 only checks for the existence of the process
+	err := syscall.Kill(pid, 0)
+
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// dumpThreadsSignal asks the JVM to write a thread dump to its output
+func dumpThreadsSignal(pid int) error {
+	return syscall.Kill(pid, syscall.SIGQUIT)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"golang.org/x/sys/windows"
+)
+
+// stillActive is the exit code of a process which has not ended yet
+const stillActive = 259
+
+// processAlive checks if a process with the PID is running
+func processAlive(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+
+	defer func() {
+		_ = windows.CloseHandle(h)
+	}()
+
+	var code uint32
+
+	err = windows.GetExitCodeProcess(h, &code)
+
+	return err == nil && code == stillActive
+}
+
+// dumpThreadsSignal asks the JVM to write a thread dump to its output, Windows has no signal for it
+func dumpThreadsSignal(pid int) error {
+	return fmt.Errorf("thread dumps by signal are not supported on Windows")
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Profile records the timing spans of the launch pipeline, a nil profile records nothing
+type Profile struct {
+	mu       sync.Mutex
+	start    time.Time
+	spans    []*Span
+	phase    *Span
+	tracks   int
+	reported bool
+}
+
+// Span is a timed step of the launch, phases have no parent, forked spans run concurrently on their own track
+type Span struct {
+	profile *Profile
+	parent  *Span
+	name    string
+	track   int
+	forked  bool
+	start   time.Time
+	end     time.Time
+}
+
+type spanKey struct{}
+
+// newProfile creates the profile of the startup
+func newProfile() *Profile {
+	return &Profile{start: time.Now()}
+}
+
+// add registers a started span
+func (p *Profile) add(parent *Span, name string, forked bool) *Span {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := &Span{profile: p, parent: parent, name: strings.ReplaceAll(name, ";", ","), forked: forked, start: time.Now()}
+
+	switch {
+	case forked:
+		p.tracks++
+		s.track = p.tracks
+	case parent != nil:
+		s.track = parent.track
+	}
+
+	p.spans = append(p.spans, s)
+
+	return s
+}
+
+// Phase ends the current phase and starts the next one
+func (p *Profile) Phase(name string) {
+	if p == nil {
+		return
+	}
+
+	p.Finish()
+
+	s := p.add(nil, name, false)
+
+	p.mu.Lock()
+	p.phase = s
+	p.mu.Unlock()
+}
+
+// Finish ends the current phase
+func (p *Profile) Finish() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	phase := p.phase
+	p.phase = nil
+	p.mu.Unlock()
+
+	phase.End()
+}
+
+// Fork starts a span of the current phase which runs concurrently to the other ones
+func (p *Profile) Fork(name string) *Span {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	phase := p.phase
+	p.mu.Unlock()
+
+	return p.add(phase, name, true)
+}
+
+// Child starts a sub-span
+func (s *Span) Child(name string) *Span {
+	if s == nil {
+		return nil
+	}
+
+	return s.profile.add(s, name, false)
+}
+
+// End ends the span, ending it again keeps the first end
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.profile.mu.Lock()
+	defer s.profile.mu.Unlock()
+
+	if s.end.IsZero() {
+		s.end = time.Now()
+	}
+}
+
+// withSpan returns the context which carries the span to the network functions
+func withSpan(ctx context.Context, s *Span) context.Context {
+	if s == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// spanFrom returns the span carried by the context
+func spanFrom(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+
+	return s
+}
+
+// traced returns the context whose HTTP request records the DNS lookup, connect, TLS handshake and the wait for the
+// first response byte as sub-spans
+func (s *Span) traced(ctx context.Context) context.Context {
+	if s == nil {
+		return ctx
+	}
+
+	var (
+		mu       sync.Mutex
+		dns      *Span
+		tlsSpan  *Span
+		wait     *Span
+		connects = make(map[string]*Span)
+	)
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			dns = s.Child("dns")
+			mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			mu.Lock()
+			dns.End()
+			mu.Unlock()
+		},
+		// the dual-stack dialer connects to several addresses at once
+		ConnectStart: func(network string, addr string) {
+			mu.Lock()
+			connects[addr] = s.Child("connect")
+			mu.Unlock()
+		},
+		ConnectDone: func(network string, addr string, err error) {
+			mu.Lock()
+			connects[addr].End()
+			mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			tlsSpan = s.Child("tls")
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			mu.Lock()
+			tlsSpan.End()
+			mu.Unlock()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			mu.Lock()
+			wait = s.Child("wait")
+			mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			mu.Lock()
+			wait.End()
+			mu.Unlock()
+		},
+	}
+
+	return httptrace.WithClientTrace(ctx, trace)
+}
+
+// snapshot returns the recorded spans, spans which have not ended yet end now
+func (p *Profile) snapshot() []Span {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+
+	spans := make([]Span, 0, len(p.spans))
+	for _, s := range p.spans {
+		span := *s
+		if span.end.IsZero() {
+			span.end = now
+		}
+
+		spans = append(spans, span)
+	}
+
+	return spans
+}
+
+// profileNode is a span with its sub-spans
+type profileNode struct {
+	span     Span
+	children []*profileNode
+}
+
+// tree returns the phases with their sub-spans, ordered by their start
+func (p *Profile) tree() []*profileNode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+
+	var roots []*profileNode
+
+	// the parents are registered before their sub-spans
+	nodes := make(map[*Span]*profileNode, len(p.spans))
+	for _, s := range p.spans {
+		node := &profileNode{span: *s}
+		if node.span.end.IsZero() {
+			node.span.end = now
+		}
+
+		nodes[s] = node
+
+		if parent := nodes[s.parent]; parent != nil {
+			parent.children = append(parent.children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	return roots
+}
+
+// duration returns the time of the span
+func (n *profileNode) duration() time.Duration {
+	return n.span.end.Sub(n.span.start)
+}
+
+// self returns the time of the span which is not covered by its sub-spans
+func (n *profileNode) self() time.Duration {
+	self := n.duration()
+	for _, child := range n.children {
+		self -= child.duration()
+	}
+
+	return max(self, 0)
+}
+
+// Report writes the timing breakdown as a tree of the phases and their sub-spans, followed by the cumulated time of
+// the network, download, extraction and check steps
+func (p *Profile) Report(w io.Writer) error {
+	roots := p.tree()
+
+	var total time.Duration
+	for _, root := range roots {
+		total = max(total, root.span.end.Sub(p.start))
+	}
+
+	_, err := fmt.Fprintf(w, "Startup profile (total %s)\n\n", millis(total))
+	if err != nil {
+		return err
+	}
+
+	var walk func(nodes []*profileNode, depth int) error
+	walk = func(nodes []*profileNode, depth int) error {
+		for _, node := range nodes {
+			_, err := fmt.Fprintf(w, "%12s %6.1f%%  %s%s\n", millis(node.duration()), percent(node.duration(), total), strings.Repeat("  ", depth), node.span.name)
+			if err != nil {
+				return err
+			}
+
+			err = walk(node.children, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	err = walk(roots, 0)
+	if err != nil {
+		return err
+	}
+
+	// the steps of concurrent resources are summed up, so they may exceed the total
+	steps := make(map[string]time.Duration)
+	for _, s := range p.snapshot() {
+		if s.parent != nil && !s.forked {
+			steps[s.name] += s.end.Sub(s.start)
+		}
+	}
+
+	if len(steps) == 0 {
+		return nil
+	}
+
+	_, err = fmt.Fprintf(w, "\nCumulated steps of all resources\n\n")
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(steps))
+	for name := range steps {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return steps[names[i]] > steps[names[j]]
+	})
+
+	for _, name := range names {
+		_, err = fmt.Fprintf(w, "%12s  %s\n", millis(steps[name]), name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// millis returns the duration in milliseconds
+func millis(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+// percent returns the share of d of the total
+func percent(d time.Duration, total time.Duration) float64 {
+	if total <= 0 {
+		return 0
+	}
+
+	return 100 * float64(d) / float64(total)
+}
+
+// WriteFolded writes the self time of the spans in microseconds as folded stacks for flamegraph tools
+func (p *Profile) WriteFolded(w io.Writer) error {
+	var walk func(nodes []*profileNode, stack string) error
+	walk = func(nodes []*profileNode, stack string) error {
+		for _, node := range nodes {
+			frames := node.span.name
+			if stack != "" {
+				frames = stack + ";" + node.span.name
+			}
+
+			if self := node.self(); self > 0 {
+				_, err := fmt.Fprintf(w, "%s %d\n", frames, self.Microseconds())
+				if err != nil {
+					return err
+				}
+			}
+
+			err := walk(node.children, frames)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return walk(p.tree(), "")
+}
+
+// TraceEvent is a complete event of the Chrome trace event format
+type TraceEvent struct {
+	Name  string `json:"name"`
+	Phase string `json:"ph"`
+	Start int64  `json:"ts"`
+	Dur   int64  `json:"dur"`
+	PID   int    `json:"pid"`
+	TID   int    `json:"tid"`
+}
+
+// WriteTrace writes the spans in the Chrome trace event format for chrome://tracing and Perfetto, concurrent
+// resources are shown on their own threads
+func (p *Profile) WriteTrace(w io.Writer) error {
+	events := []TraceEvent{}
+
+	for _, s := range p.snapshot() {
+		events = append(events, TraceEvent{
+			Name:  s.name,
+			Phase: "X",
+			Start: s.start.Sub(p.start).Microseconds(),
+			Dur:   s.end.Sub(s.start).Microseconds(),
+			PID:   os.Getpid(),
+			TID:   s.track,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(struct {
+		TraceEvents     []TraceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{events, "ms"})
+}
+
+// reportProfile writes the timing breakdown of the startup once, and the trace file requested by -profile-file
+func (l *Launch) reportProfile() {
+	p := l.startupProfile
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	reported := p.reported
+	p.reported = true
+	p.mu.Unlock()
+
+	if reported {
+		return
+	}
+
+	p.Finish()
+
+	// the JSON events own stdout
+	var w io.Writer = os.Stdout
+	if *jsonEvents {
+		w = os.Stderr
+	}
+
+	common.Error(p.Report(w))
+
+	if *profileFile == "" {
+		return
+	}
+
+	write := p.WriteFolded
+	if strings.EqualFold(filepath.Ext(*profileFile), ".json") {
+		write = p.WriteTrace
+	}
+
+	f, err := os.Create(*profileFile)
+	if common.Error(err) {
+		return
+	}
+
+	err = write(f)
+
+	common.Error(f.Close())
+
+	if common.Error(err) {
+		return
+	}
+
+	l.logf("Startup profile written to %s", *profileFile)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressRunnerSource hosts the progress-class of a JNLP file and feeds it with the progress of the downloads
+//
+//go:embed ProgressRunner.java
+var progressRunnerSource []byte
+
+// downloadServiceListenerSource is the interface of progress classes for JREs without the JNLP API
+//
+//go:embed DownloadServiceListener.java
+var downloadServiceListenerSource []byte
+
+// progressRunnerClass is the main class of the progress runner
+const progressRunnerClass = "espresso.ProgressRunner"
+
+// progressRunnerLinger is the max. time the progress runner gets to end after the downloads
+const progressRunnerLinger = 5 * time.Second
+
+// ProgressFeed writes the progress of the downloads to the stdin of the progress runner
+type ProgressFeed struct {
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+}
+
+// write sends a line of the progress protocol, a progress runner which has ended is ignored
+func (f *ProgressFeed) write(fields ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.stdin == nil {
+		return
+	}
+
+	_, err := fmt.Fprintf(f.stdin, "%s\n", strings.Join(fields, "\t"))
+	if err != nil {
+		common.Debug(fmt.Sprintf("Progress runner does not accept progress: %v", err))
+
+		common.Error(f.stdin.Close())
+		f.stdin = nil
+	}
+}
+
+// startProgressClass downloads the main jar and starts the progress-class of the app, which shows the remaining
+// downloads. The remaining downloads are returned. Without a JRE or a JDK to build the progress runner the downloads
+// run without the progress class.
+func (l *Launch) startProgressClass(list []Task) []Task {
+	if l.progressClass == "" || l.Verify || l.Sandbox != "" {
+		return list
+	}
+
+	// the progress class is loaded from the main jar, encrypted jars are only staged after the downloads
+	if l.Config.Encryption.Enabled {
+		l.logf("Progress class %s is not shown, the jars are encrypted at rest", l.progressClass)
+
+		return list
+	}
+
+	var first, rest []Task
+
+	for _, task := range list {
+		if task.Path == l.mainJar {
+			first = append(first, task)
+		} else {
+			rest = append(rest, task)
+		}
+	}
+
+	if len(first) == 0 {
+		return list
+	}
+
+	java, err := exec.LookPath(l.Jre)
+	if err != nil {
+		l.logf("Progress class %s is not shown, the JRE %s is not available yet", l.progressClass, l.Jre)
+
+		return list
+	}
+
+	l.runTasks(first)
+
+	if l.errors.IsSet() {
+		return rest
+	}
+
+	runner, err := l.runnerJar("progress runner", progressRunnerClass, map[string][]byte{
+		"ProgressRunner.java":          progressRunnerSource,
+		"DownloadServiceListener.java": downloadServiceListenerSource,
+	})
+	if err != nil {
+		common.Warn(fmt.Sprintf("Progress class %s is not shown: %v", l.progressClass, err))
+
+		return rest
+	}
+
+	feed := &ProgressFeed{}
+
+	// the progress class is loaded from the main jar
+	feed.cmd = exec.Command(java, "-cp", strings.Join([]string{l.mainJar, runner}, string(filepath.ListSeparator)), progressRunnerClass, l.progressClass)
+	feed.cmd.Stderr = &feed.stderr
+
+	feed.stdin, err = feed.cmd.StdinPipe()
+	if err == nil {
+		err = feed.cmd.Start()
+	}
+
+	if err != nil {
+		common.Warn(fmt.Sprintf("Progress class %s is not shown: %v", l.progressClass, err))
+
+		return rest
+	}
+
+	l.logf("Progress class %s shows the downloads (PID %d)", l.progressClass, feed.cmd.Process.Pid)
+
+	l.progressFeed = feed
+
+	return rest
+}
+
+// feedProgress reports a finished or failed download to the progress class
+func (l *Launch) feedProgress(task Task, done int, total int, failed bool) {
+	feed := l.progressFeed
+	if feed == nil {
+		return
+	}
+
+	if failed {
+		feed.write("failed", task.URL, "")
+
+		return
+	}
+
+	var size int64
+
+	if info, err := os.Stat(task.Path); err == nil {
+		size = info.Size()
+	}
+
+	percent := 100
+	if total > 0 {
+		percent = done * 100 / total
+	}
+
+	feed.write("progress", task.URL, "", fmt.Sprintf("%d", size), fmt.Sprintf("%d", size), fmt.Sprintf("%d", percent))
+}
+
+// stopProgressClass ends the progress class after the downloads, a progress class which does not end is killed
+func (l *Launch) stopProgressClass() {
+	feed := l.progressFeed
+	if feed == nil {
+		return
+	}
+
+	l.progressFeed = nil
+
+	feed.write("done")
+
+	feed.mu.Lock()
+	if feed.stdin != nil {
+		common.Error(feed.stdin.Close())
+		feed.stdin = nil
+	}
+	feed.mu.Unlock()
+
+	ended := make(chan error, 1)
+
+	go func() {
+		ended <- feed.cmd.Wait()
+	}()
+
+	select {
+	case err := <-ended:
+		if err != nil {
+			l.logf("Progress class %s ended: %v %s", l.progressClass, err, strings.TrimSpace(feed.stderr.String()))
+		}
+	case <-time.After(progressRunnerLinger):
+		l.logf("Progress class %s does not end and is killed", l.progressClass)
+
+		common.Error(feed.cmd.Process.Kill())
+	}
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// confirm asks the user a yes/no question by a dialog of the desktop
+func confirm(title string, message string) (bool, error) {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf(`display dialog %q with title %q buttons {"No", "Yes"} default button "Yes"`, message, title)
+		cmd = exec.Command("osascript", "-e", script)
+	default:
+		path, err := exec.LookPath("zenity")
+		if err != nil {
+			return false, fmt.Errorf("no dialog available, zenity is not installed")
+		}
+
+		cmd = exec.Command(path, "--question", "--title", title, "--text", message)
+	}
+
+	ba, err := cmd.Output()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// "No" or a closed dialog
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return runtime.GOOS != "darwin" || strings.Contains(string(ba), "Yes"), nil
+}
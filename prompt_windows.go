@@ -0,0 +1,34 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	mbYesNo        = 0x00000004
+	mbIconQuestion = 0x00000020
+	idYes          = 6
+)
+
+var procMessageBox = user32.NewProc("MessageBoxW")
+
+// confirm asks the user a yes/no question in a message box
+func confirm(title string, message string) (bool, error) {
+	t, err := syscall.UTF16PtrFromString(title)
+	if err != nil {
+		return false, err
+	}
+
+	m, err := syscall.UTF16PtrFromString(message)
+	if err != nil {
+		return false, err
+	}
+
+	r, _, err := procMessageBox.Call(0, uintptr(unsafe.Pointer(m)), uintptr(unsafe.Pointer(t)), mbYesNo|mbIconQuestion)
+	if r == 0 {
+		return false, err
+	}
+
+	return r == idYes, nil
+}
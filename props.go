@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// javawsVersion is the Java Webstart version the report compares with
+const javawsVersion = "javaws-1.8.0"
+
+// systemProperties extracts the -D system properties of a java command line
+func systemProperties(cmds []string) map[string]string {
+	props := make(map[string]string)
+
+	for _, cmd := range cmds {
+		if !strings.HasPrefix(cmd, "-D") {
+			continue
+		}
+
+		key, value, _ := strings.Cut(cmd[2:], "=")
+
+		props[key] = value
+	}
+
+	return props
+}
+
+// javawsProperties returns the system properties the legacy javaws would set for the JNLP application
+func (l *Launch) javawsProperties(jnlp *Jnlp) map[string]string {
+	initial, maximum := "NULL", "NULL"
+	if l.initialheapsize != "" {
+		initial = l.initialheapsize
+	}
+	if l.maxheapsize != "" {
+		maximum = l.maxheapsize
+	}
+
+	heapsize := initial + "," + maximum
+
+	props := map[string]string{
+		"javawebstart.version":       javawsVersion,
+		"jnlpx.home":                 filepath.Join("<java.home>", "bin"),
+		"jnlpx.jvm":                  l.Jre,
+		"jnlpx.origFilenameArg":      l.Address,
+		"jnlpx.remove":               "false",
+		"jnlpx.heapsize":             heapsize,
+		"jnlpx.splashport":           "<random port>",
+		"java.protocol.handler.pkgs": "com.sun.jnlp",
+	}
+
+	// javaws sets the properties of the JNLP resources as well
+	for _, property := range l.properties {
+		if property.Name != "" {
+			props[property.Name] = property.Value
+		}
+	}
+
+	// apps without all-permissions run sandboxed
+	if jnlp.Security.AllPermissions == nil {
+		props["java.security.manager"] = ""
+		props["java.security.policy"] = "<javaws sandbox policy>"
+	}
+
+	return props
+}
+
+// ExposeProps writes a report of the system properties, environment, classpath and security settings
+// which the legacy javaws would create for the JNLP application versus the ones espresso creates
+func (l *Launch) ExposeProps(w io.Writer) error {
+	jnlp, err := l.resolve()
+	if err != nil {
+		return err
+	}
+
+	cmds, err := l.commandLine(jnlp)
+	if err != nil {
+		return err
+	}
+
+	javaws := l.javawsProperties(jnlp)
+	espresso := systemProperties(cmds)
+
+	keys := make(map[string]bool)
+	for key := range javaws {
+		keys[key] = true
+	}
+	for key := range espresso {
+		keys[key] = true
+	}
+
+	var sorted []string
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+
+	sort.Strings(sorted)
+
+	fmt.Fprintf(w, "JNLP: %s\n\n", l.Address)
+	fmt.Fprintf(w, "System properties (* = difference):\n")
+
+	for _, key := range sorted {
+		javawsValue, inJavaws := javaws[key]
+		espressoValue, inEspresso := espresso[key]
+
+		marker := " "
+		if inJavaws != inEspresso || javawsValue != espressoValue {
+			marker = "*"
+		}
+
+		if !inJavaws {
+			javawsValue = "<not set>"
+		}
+
+		if !inEspresso {
+			espressoValue = "<not set>"
+		}
+
+		fmt.Fprintf(w, "%s %s\n    javaws:   %s\n    espresso: %s\n", marker, key, javawsValue, espressoValue)
+	}
+
+	fmt.Fprintf(w, "\nJVM options:\n")
+	for _, cmd := range cmds {
+		if strings.HasPrefix(cmd, "-X") {
+			fmt.Fprintf(w, "  %s\n", cmd)
+		}
+	}
+
+	fmt.Fprintf(w, "\nClasspath:\n")
+	fmt.Fprintf(w, "  javaws:   loaded by the JNLPClassLoader from the javaws cache\n")
+	fmt.Fprintf(w, "  espresso: -cp with %d entries\n", len(l.jars))
+	for _, jar := range l.jars {
+		fmt.Fprintf(w, "    %s\n", jar)
+	}
+
+	fmt.Fprintf(w, "\nNative libraries:\n")
+	fmt.Fprintf(w, "  javaws:   loaded by the JNLPClassLoader from the nativelib JARs\n")
+	fmt.Fprintf(w, "  espresso: java.library.path with %d entries\n", len(l.nativelibs))
+
+	fmt.Fprintf(w, "\nEnvironment:\n")
+	for _, env := range []string{"JAVA_HOME", "JAVA_TOOL_OPTIONS", "_JAVA_OPTIONS", "JDK_JAVA_OPTIONS", "CLASSPATH"} {
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			value = "<not set>"
+		}
+
+		fmt.Fprintf(w, "  %s=%s\n", env, value)
+	}
+	fmt.Fprintf(w, "  (CLASSPATH is ignored by both, the JAVA options variables are applied by both)\n")
+
+	fmt.Fprintf(w, "\nSecurity:\n")
+	switch {
+	case jnlp.Security.AllPermissions != nil:
+		fmt.Fprintf(w, "  requested: all-permissions\n")
+		fmt.Fprintf(w, "  javaws:    full permissions after verifying the JAR signatures\n")
+	case jnlp.Security.J2eeApplicationClientPermissions != nil:
+		fmt.Fprintf(w, "  requested: j2ee-application-client-permissions\n")
+		fmt.Fprintf(w, "  javaws:    J2EE client permissions after verifying the JAR signatures\n")
+	default:
+		fmt.Fprintf(w, "  requested: sandbox\n")
+		fmt.Fprintf(w, "  javaws:    sandbox with security manager\n")
+	}
+	switch {
+	case l.isTrusted():
+		fmt.Fprintf(w, "  espresso:  full permissions, the app is trusted explicitly\n")
+	case requestsPermissions(jnlp):
+		fmt.Fprintf(w, "  espresso:  full permissions after verifying the JAR signatures\n")
+	default:
+		fmt.Fprintf(w, "  espresso:  sandbox with security manager and the generated policy %s\n", sandboxPolicyFile)
+	}
+
+	return nil
+}
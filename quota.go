@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// parseBytes parses a size like "500MB", "10GB" or "1.5G", the units are powers of 1024 like the ones of formatBytes
+func parseBytes(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+
+	factor := int64(1)
+
+	if n := len(value); n > 0 {
+		if exp := strings.IndexByte("KMGTPE", value[n-1]); exp >= 0 {
+			value = strings.TrimSpace(value[:n-1])
+			factor = int64(1) << (10 * (exp + 1))
+		}
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 500MB or 10GB", s)
+	}
+
+	return int64(f * float64(factor)), nil
+}
+
+// cacheQuota returns the max. size of the cache, the -cache-quota parameter overrides the config, 0 is unlimited
+func cacheQuota(cfg *Config) (int64, error) {
+	quota := cfg.CacheQuota
+	if *cacheQuotaFlag != "" {
+		quota = *cacheQuotaFlag
+	}
+
+	if quota == "" {
+		return 0, nil
+	}
+
+	return parseBytes(quota)
+}
+
+// enforceCacheQuota evicts the resources of the least recently launched apps until the cache fits into the quota. The
+// directory of the launched app, the shared directories and the directories of running apps are never evicted, the
+// user data of the evicted apps is kept. The size is the one of the cache index, so the natives hardlinked into
+// several app directories count once by their file of the natives store, which is freed when no app links it anymore.
+func (l *Launch) enforceCacheQuota() error {
+	quota, err := cacheQuota(l.Config)
+	if err != nil || quota == 0 {
+		return err
+	}
+
+	dirs, err := cacheDirs(l.Config)
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for _, dir := range dirs {
+		size += dir.Size
+	}
+
+	if size <= quota {
+		return nil
+	}
+
+	appPath, err := appCachePath(l.Address)
+	if err != nil {
+		return err
+	}
+
+	// the least recently launched first
+	slices.SortFunc(dirs, func(a, b CacheDir) int {
+		return a.LastUsed.Compare(b.LastUsed)
+	})
+
+	for _, dir := range dirs {
+		if size <= quota {
+			return nil
+		}
+
+		if dir.Name == filepath.Base(appPath) || slices.Contains(sharedCacheDirs, dir.Name) {
+			continue
+		}
+
+		freed, err := cleanCacheDir(filepath.Join(*cache, dir.Name))
+
+		// the natives of the evicted app are freed if no other app links them
+		if freed > 0 {
+			released, gcErr := gcNativeStore()
+			common.Error(gcErr)
+
+			freed += released
+		}
+
+		size -= freed
+
+		if err != nil {
+			common.Debug(fmt.Sprintf("Cache quota: %s is not evicted: %v", dir.Name, err))
+
+			continue
+		}
+
+		if freed > 0 {
+			l.logf("Cache quota: evicted %s (%s, last used %s) of %s", dir.Name, formatBytes(uint64(freed)), formatTime(dir.LastUsed), strings.Join(dir.Apps, ", "))
+		}
+	}
+
+	if size > quota {
+		common.Warn(fmt.Sprintf("The cache %s of %s exceeds the cache quota of %s, nothing more can be evicted", *cache, formatBytes(uint64(size)), formatBytes(uint64(quota))))
+	}
+
+	return nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReplayResource describes a downloaded resource of a launch
+type ReplayResource struct {
+	URL  string `json:"url"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Replay describes the resolved inputs of a launch
+type Replay struct {
+	Timestamp   time.Time         `json:"timestamp"`
+	URL         string            `json:"url"`
+	LaunchID    string            `json:"launchId"`
+	OS          string            `json:"os"`
+	OSName      string            `json:"osName,omitempty"`
+	Arch        string            `json:"arch"`
+	Jre         string            `json:"jre"`
+	Console     bool              `json:"console"`
+	App         *AppConfig        `json:"app,omitempty"`
+	Descriptors map[string]string `json:"descriptors"`
+	Resources   []ReplayResource  `json:"resources"`
+	CommandLine []string          `json:"commandLine"`
+
+	mu      sync.Mutex
+	content map[string][]byte
+}
+
+const replayLaunchFile = "launch.json"
+
+// newReplay creates an empty recording of the given launch
+func newReplay(l *Launch) *Replay {
+	return &Replay{
+		Timestamp:   time.Now(),
+		URL:         l.Address,
+		LaunchID:    l.ID,
+		OS:          l.OS,
+		OSName:      l.OSName,
+		Arch:        l.Arch,
+		Console:     l.Console,
+		App:         l.App,
+		Descriptors: make(map[string]string),
+		content:     make(map[string][]byte),
+	}
+}
+
+// AddDescriptor records the content of a loaded JNLP file
+func (r *Replay) AddDescriptor(address string, content []byte) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.Descriptors[address]; ok {
+		return
+	}
+
+	name := fmt.Sprintf("jnlp/%d.jnlp", len(r.Descriptors))
+
+	r.Descriptors[address] = name
+	r.content[name] = content
+}
+
+// AddResource records a downloaded resource
+func (r *Replay) AddResource(address string, path string) {
+	if r == nil {
+		return
+	}
+
+	size, err := common.FileSize(path)
+	if common.Error(err) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Resources = append(r.Resources, ReplayResource{
+		URL:  address,
+		Path: path,
+		Size: size,
+	})
+}
+
+// Descriptor returns the recorded content of a JNLP file
+func (r *Replay) Descriptor(address string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name, ok := r.Descriptors[address]
+	if !ok {
+		return nil, fmt.Errorf("JNLP file %s is not part of the replay bundle", address)
+	}
+
+	return r.content[name], nil
+}
+
+// Compare warns about resources which differ between the replay bundle and the current launch
+func (r *Replay) Compare(current *Replay) {
+	sizes := make(map[string]int64)
+	for _, resource := range current.Resources {
+		sizes[resource.URL] = resource.Size
+	}
+
+	for _, resource := range r.Resources {
+		size, ok := sizes[resource.URL]
+
+		switch {
+		case !ok:
+			common.Warn(fmt.Sprintf("Replay: resource %s was not loaded", resource.URL))
+		case size != resource.Size:
+			common.Warn(fmt.Sprintf("Replay: resource %s has changed, size %d instead of %d", resource.URL, size, resource.Size))
+		}
+	}
+}
+
+// Save writes the replay bundle as ZIP file
+func (r *Replay) Save(filename string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// keep the bundle content in a stable order
+	sort.Slice(r.Resources, func(i, j int) bool {
+		return r.Resources[i].URL < r.Resources[j].URL
+	})
+
+	err := os.MkdirAll(filepath.Dir(filename), common.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	// care about closing the bundle file
+	defer func() {
+		common.Error(f.Close())
+	}()
+
+	zw := zip.NewWriter(f)
+
+	w, err := zw.Create(replayLaunchFile)
+	if err != nil {
+		return err
+	}
+
+	ba, err := json.MarshalIndent(r, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(ba)
+	if err != nil {
+		return err
+	}
+
+	for name, content := range r.content {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// loadReplay reads a replay bundle from the given ZIP file
+func loadReplay(filename string) (*Replay, error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// care about closing the bundle file
+	defer func() {
+		common.Error(zr.Close())
+	}()
+
+	r := &Replay{
+		content: make(map[string][]byte),
+	}
+
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		ba, err := io.ReadAll(rc)
+
+		common.Error(rc.Close())
+
+		if err != nil {
+			return nil, err
+		}
+
+		if f.Name == replayLaunchFile {
+			err = json.Unmarshal(ba, r)
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		r.content[f.Name] = ba
+	}
+
+	if r.URL == "" {
+		return nil, fmt.Errorf("%s is not a valid replay bundle", filename)
+	}
+
+	return r, nil
+}
+
+// runReplay re-runs the launch recorded in the given replay bundle
+func runReplay(filename string) error {
+	r, err := loadReplay(filename)
+	if err != nil {
+		return err
+	}
+
+	common.Info(fmt.Sprintf("Replay launch of %s recorded at %s on %s/%s", r.URL, r.Timestamp.Format(time.RFC3339), r.OS, r.Arch))
+
+	// use the recorded settings instead of the local ones
+	cfg := &Config{}
+
+	if r.App != nil {
+		cfg.Apps = append(cfg.Apps, *r.App)
+	}
+
+	l := NewLaunch(cfg, r.URL)
+
+	// use the recorded inputs instead of the local ones
+	l.replay = r
+	l.Arch = r.Arch
+	l.OS = r.OS
+	l.OSName = r.OSName
+	l.Console = r.Console
+
+	if r.Jre != "" && r.Jre != javaExecutable(r.Console) {
+		if _, err := os.Stat(r.Jre); err == nil {
+			l.setJre(r.Jre, "recorded JRE of the replay bundle")
+		} else {
+			common.Warn(fmt.Sprintf("Replay: recorded JRE %s is not available, using the local one", r.Jre))
+		}
+	}
+
+	if r.OS != "" && r.OS != operatingsystemOf(runtime.GOOS) {
+		common.Warn(fmt.Sprintf("Replay: launch was recorded on %s", r.OS))
+	}
+
+	return l.Run()
+}
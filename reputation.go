@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// handling of downloaded executables before they are run
+const (
+	executablesOff    = "off"
+	executablesWarn   = "warn"
+	executablesStrict = "strict"
+)
+
+// reputation verdicts of executables
+const (
+	verdictClean     = "clean"
+	verdictMalicious = "malicious"
+	verdictUnknown   = "unknown"
+)
+
+// Reputation is the answer of a reputation service, either the generic verdict or the VirusTotal file report
+type Reputation struct {
+	Verdict string `json:"verdict"`
+	Data    struct {
+		Attributes struct {
+			LastAnalysisStats struct {
+				Malicious int `json:"malicious"`
+			} `json:"last_analysis_stats"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// lookupReputation asks the reputation service for the verdict of the SHA-256 hash
+func lookupReputation(security SecurityConfig, sum string) (string, error) {
+	if security.ReputationURL == "" {
+		return verdictUnknown, nil
+	}
+
+	request, err := http.NewRequest(http.MethodGet, strings.ReplaceAll(security.ReputationURL, "{sha256}", sum), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if security.ReputationKey != "" {
+		request.Header.Set("x-apikey", security.ReputationKey)
+	}
+
+	// the lookup is subject to the network and HTTPS policies like every request
+	response, err := httpDo(request)
+	if err != nil {
+		return "", err
+	}
+
+	// care about the final close of the response body
+	defer func() {
+		common.Error(response.Body.Close())
+	}()
+
+	if response.StatusCode == http.StatusNotFound {
+		return verdictUnknown, nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reputation service answered %s", response.Status)
+	}
+
+	ba, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+
+	reputation := &Reputation{}
+
+	err = json.Unmarshal(ba, reputation)
+	if err != nil {
+		return "", err
+	}
+
+	if reputation.Verdict != "" {
+		return strings.ToLower(reputation.Verdict), nil
+	}
+
+	if reputation.Data.Attributes.LastAnalysisStats.Malicious > 0 {
+		return verdictMalicious, nil
+	}
+
+	return verdictClean, nil
+}
+
+// checkExecutable checks the downloaded executable against the allowlist and the reputation service before it is run
+func (l *Launch) checkExecutable(path string) error {
+	security := l.Config.Security
+
+	mode := security.Executables
+	if mode == "" || mode == executablesOff {
+		return nil
+	}
+
+	if mode != executablesWarn && mode != executablesStrict {
+		return fmt.Errorf("invalid security.executables %q, use %s, %s or %s", mode, executablesOff, executablesWarn, executablesStrict)
+	}
+
+	sum, err := fileHash(path)
+	if err != nil {
+		return err
+	}
+
+	if slices.ContainsFunc(security.ExecutableAllowlist, func(allowed string) bool {
+		return strings.EqualFold(allowed, sum)
+	}) {
+		return nil
+	}
+
+	verdict, err := lookupReputation(security, sum)
+	if err != nil {
+		common.Warn(fmt.Sprintf("Reputation lookup of %s failed: %v", path, err))
+
+		verdict = verdictUnknown
+	}
+
+	switch {
+	case verdict == verdictClean:
+		return nil
+	case verdict == verdictUnknown && mode == executablesWarn:
+		common.Warn(fmt.Sprintf("Executable %s with SHA-256 %s is unknown", path, sum))
+
+		return nil
+	}
+
+	message := fmt.Sprintf("executable %s with SHA-256 %s is refused, its reputation is %s", path, sum, verdict)
+
+	logEvent(eventSecurityRejection, message)
+
+	return fmt.Errorf("%s", message)
+}
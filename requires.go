@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultReadyTimeout is the time how long the readiness of a required app is awaited
+const defaultReadyTimeout = time.Minute
+
+// Probe defines how the readiness of an app is detected
+type Probe struct {
+	// URL is polled until it answers with a 2xx HTTP status
+	URL string `json:"url"`
+	// Address is a TCP host:port which is polled until it accepts connections
+	Address string `json:"address"`
+	// Timeout is the max. time to wait for the readiness, e.g. "30s"
+	Timeout string `json:"timeout"`
+}
+
+// isReady checks the probe once
+func (p *Probe) isReady() bool {
+	if p.URL != "" {
+		client := &http.Client{Timeout: time.Second * 5}
+
+		response, err := client.Get(p.URL)
+		if err != nil {
+			return false
+		}
+
+		common.Error(response.Body.Close())
+
+		if response.StatusCode < 200 || response.StatusCode >= 300 {
+			return false
+		}
+	}
+
+	if p.Address != "" {
+		conn, err := net.DialTimeout("tcp", p.Address, time.Second*5)
+		if err != nil {
+			return false
+		}
+
+		common.Error(conn.Close())
+	}
+
+	return true
+}
+
+// waitReady waits until the app is running and its readiness probe succeeds
+func waitReady(app *AppConfig) error {
+	timeout := defaultReadyTimeout
+
+	if app.Ready.Timeout != "" {
+		d, err := time.ParseDuration(app.Ready.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid ready timeout of %s: %w", app.URL, err)
+		}
+
+		timeout = d
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		pids, err := runningInstances(app.URL)
+		if err != nil {
+			return err
+		}
+
+		if len(pids) > 0 && app.Ready.isReady() {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("required app %s is not ready after %v", app.URL, timeout)
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// startRequirements starts the apps this app requires unless they are already running and waits for their readiness
+func (l *Launch) startRequirements() error {
+	chain := append(slices.Clone(l.chain), l.Address)
+
+	for _, name := range l.App.Requires {
+		required := l.Config.App(name)
+
+		if slices.Contains(chain, required.URL) {
+			return fmt.Errorf("cyclic app requirement: %s --> %s", strings.Join(chain, " --> "), required.URL)
+		}
+
+		pids, err := runningInstances(required.URL)
+		if err != nil {
+			return err
+		}
+
+		if len(pids) == 0 {
+			l.logf("Start of required app %s", required.URL)
+
+			dependency := NewLaunch(l.Config, required.URL)
+
+			// the required app runs in the background of this app with its own settings, the launch parameters
+			// of this app are not passed on except the offline mode
+			dependency.Console = false
+			dependency.Wait = false
+			dependency.StatusPage = false
+			dependency.JarLaunch = false
+			dependency.JFR = false
+			dependency.Sandbox = ""
+			dependency.Offline = l.Offline
+			dependency.chain = chain
+
+			err := dependency.Run()
+			if err != nil {
+				return fmt.Errorf("required app %s cannot be started: %w", required.URL, err)
+			}
+		}
+
+		err = waitReady(required)
+		if err != nil {
+			return err
+		}
+
+		l.logf("Required app %s is ready", required.URL)
+	}
+
+	return nil
+}
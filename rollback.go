@@ -0,0 +1,408 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultStartupWindow is the time in which an exiting app is regarded as failed to start
+const defaultStartupWindow = 10 * time.Second
+
+// Rollback defines the automatic rollback to the last successfully started version of the app
+type Rollback struct {
+	Enabled bool   `json:"enabled"`
+	Window  string `json:"window"`
+}
+
+// LastGood describes the last successfully started version of the app
+type LastGood struct {
+	Timestamp   time.Time         `json:"timestamp"`
+	Fingerprint string            `json:"fingerprint"`
+	Jre         string            `json:"jre"`
+	CommandLine []string          `json:"commandLine"`
+	Staged      map[string]string `json:"staged,omitempty"`
+}
+
+// StartupError reports an app which has ended with an error within the startup window
+type StartupError struct {
+	Err error
+}
+
+func (e *StartupError) Error() string {
+	return fmt.Sprintf("app failed to start: %v", e.Err)
+}
+
+func (e *StartupError) Unwrap() error {
+	return e.Err
+}
+
+// lastGoodPath returns the directory of the last successfully started version of the app
+func lastGoodPath(address string) (string, error) {
+	appPath, err := appCachePath(address)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appPath, "lastgood"), nil
+}
+
+// startupWindow returns the configured startup window
+func (l *Launch) startupWindow() (time.Duration, error) {
+	if l.App.Rollback.Window == "" {
+		return defaultStartupWindow, nil
+	}
+
+	return time.ParseDuration(l.App.Rollback.Window)
+}
+
+// awaitStartup waits for the startup window, it reports if the app has already ended and a StartupError if it has failed
+func (l *Launch) awaitStartup(done chan error) (bool, error) {
+	window, err := l.startupWindow()
+	if err != nil {
+		return false, err
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return true, &StartupError{Err: err}
+		}
+
+		return true, nil
+	case <-time.After(window):
+		return false, nil
+	}
+}
+
+// fingerprint identifies the version of the resolved resources by their hashes in the cache index
+func (l *Launch) fingerprint() (string, error) {
+	index, err := readCacheIndex()
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+
+	for _, resource := range l.recording.Resources {
+		key, ok := cacheKey(resource.Path)
+		if !ok {
+			continue
+		}
+
+		sum := ""
+		if entry, ok := index.Entries[key]; ok {
+			sum = entry.SHA256
+		}
+
+		lines = append(lines, key+"="+sum)
+	}
+
+	sort.Strings(lines)
+
+	hash := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// pathDelimiters end a path inside a command line argument like "-cp" or "-Dname=path"
+const pathDelimiters = string(os.PathListSeparator) + `=,"`
+
+// lastGoodRoots returns the files and directories of the cache referenced by the argument, each one at the second level
+// of the cache, like the "app" directory of the app or the directory of a JavaFX SDK
+func lastGoodRoots(arg string) []string {
+	prefix := filepath.Clean(*cache) + string(filepath.Separator)
+
+	var roots []string
+
+	for rest := arg; ; {
+		i := strings.Index(rest, prefix)
+		if i < 0 {
+			return roots
+		}
+
+		rest = rest[i+len(prefix):]
+
+		rel := rest
+		if end := strings.IndexAny(rest, pathDelimiters); end >= 0 {
+			rel = rest[:end]
+		}
+
+		parts := strings.SplitN(rel, string(filepath.Separator), 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" || parts[1] == "lastgood" {
+			continue
+		}
+
+		roots = append(roots, filepath.Join(prefix, parts[0], parts[1]))
+	}
+}
+
+// replacePath replaces the path inside the argument where it is followed by a path separator, a delimiter or the end
+func replacePath(arg string, path string, replacement string) string {
+	var sb strings.Builder
+
+	for {
+		i := strings.Index(arg, path)
+		if i < 0 {
+			sb.WriteString(arg)
+
+			return sb.String()
+		}
+
+		end := i + len(path)
+
+		if end == len(arg) || arg[end] == filepath.Separator || strings.ContainsRune(pathDelimiters, rune(arg[end])) {
+			sb.WriteString(arg[:i])
+			sb.WriteString(replacement)
+		} else {
+			sb.WriteString(arg[:end])
+		}
+
+		arg = arg[end:]
+	}
+}
+
+// snapshotLastGood keeps the file or directory of the cache in the last good directory. The files of directories are
+// hardlinked, since downloads and extractions replace files instead of overwriting them, single files like the sandbox
+// policy are rewritten in place and copied.
+func snapshotLastGood(root string, dest string) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		err = os.MkdirAll(filepath.Dir(dest), common.DefaultDirMode)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(root)
+		if err != nil {
+			return err
+		}
+
+		// care about closing the file
+		defer func() {
+			common.Error(f.Close())
+		}()
+
+		return common.FileStore(dest, f)
+	}
+
+	return filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(filepath.Dir(filepath.Join(dest, rel)), common.DefaultDirMode)
+		if err != nil {
+			return err
+		}
+
+		return linkContent(file, filepath.Join(dest, rel))
+	})
+}
+
+// saveLastGood keeps everything the command line references in the cache in the last good directory, so later updates
+// do not touch them: the resources of the app with its private JRE and nativelibs, whose hardlinks also pin the files
+// of the natives store, and the shared directories like the JavaFX SDK. Decrypted jars are not kept, their encrypted
+// files are staged again by the rollback.
+func (l *Launch) saveLastGood(cmds []string) error {
+	path, err := lastGoodPath(l.Address)
+	if err != nil {
+		return err
+	}
+
+	fingerprint, err := l.fingerprint()
+	if err != nil {
+		return err
+	}
+
+	// the current version is already the last good one
+	if lastGood, err := loadLastGood(path); err == nil && lastGood.Fingerprint == fingerprint {
+		return nil
+	}
+
+	err = os.RemoveAll(path)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	staged := maps.Clone(l.stagedJars)
+	l.mu.Unlock()
+
+	var roots []string
+
+	for _, arg := range append([]string{l.Jre}, cmds...) {
+		roots = append(roots, lastGoodRoots(arg)...)
+	}
+
+	for jar := range staged {
+		roots = append(roots, lastGoodRoots(jar)...)
+	}
+
+	slices.Sort(roots)
+	roots = slices.Compact(roots)
+
+	// the roots are replaced in the command line by their copies
+	replacements := make(map[string]string)
+
+	for _, root := range roots {
+		rel, err := filepath.Rel(*cache, root)
+		if err != nil {
+			return err
+		}
+
+		dest := filepath.Join(path, rel)
+
+		err = snapshotLastGood(root, dest)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		replacements[root] = dest
+	}
+
+	relocate := func(s string) string {
+		for root, dest := range replacements {
+			s = replacePath(s, root, dest)
+		}
+
+		return s
+	}
+
+	lastGood := LastGood{
+		Timestamp:   time.Now(),
+		Fingerprint: fingerprint,
+		Jre:         relocate(l.Jre),
+	}
+
+	for _, cmd := range cmds {
+		lastGood.CommandLine = append(lastGood.CommandLine, relocate(cmd))
+	}
+
+	for jar, dest := range staged {
+		if lastGood.Staged == nil {
+			lastGood.Staged = make(map[string]string)
+		}
+
+		lastGood.Staged[dest] = relocate(jar)
+	}
+
+	ba, err := json.MarshalIndent(lastGood, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(path, "lastgood.json"), ba)
+}
+
+// stageLastGood decrypts the kept jars of the last good version into a new staging directory and returns the command
+// line using them
+func (l *Launch) stageLastGood(lastGood *LastGood) ([]string, error) {
+	cmds := slices.Clone(lastGood.CommandLine)
+
+	if len(lastGood.Staged) == 0 {
+		return cmds, nil
+	}
+
+	// the decrypted jars of the failed version are not used anymore
+	l.removeStaging()
+
+	stage, err := newStagingDir("jars-")
+	if err != nil {
+		return nil, err
+	}
+
+	l.staging = stage
+
+	for staged, jar := range lastGood.Staged {
+		dest := filepath.Join(stage, filepath.Base(staged))
+
+		err := stageJar(jar, dest)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range cmds {
+			cmds[i] = replacePath(cmds[i], staged, dest)
+		}
+	}
+
+	return cmds, nil
+}
+
+// loadLastGood reads the description of the last good version
+func loadLastGood(path string) (*LastGood, error) {
+	ba, err := storage.ReadFile(filepath.Join(path, "lastgood.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	lastGood := &LastGood{}
+
+	err = json.Unmarshal(ba, lastGood)
+	if err != nil {
+		return nil, err
+	}
+
+	return lastGood, nil
+}
+
+// rollback starts the last good version of the app after the current version has failed to start
+func (l *Launch) rollback(cause error) error {
+	path, err := lastGoodPath(l.Address)
+	if err != nil {
+		return err
+	}
+
+	lastGood, err := loadLastGood(path)
+	if err != nil {
+		return fmt.Errorf("%w, no previous version for a rollback available", cause)
+	}
+
+	fingerprint, err := l.fingerprint()
+	if err != nil {
+		return err
+	}
+
+	if lastGood.Fingerprint == fingerprint {
+		return fmt.Errorf("%w, the previous version is the same", cause)
+	}
+
+	message := fmt.Sprintf("%s: %v, rollback to the version of %s", l.Address, cause, lastGood.Timestamp.Format(time.DateTime))
+
+	common.Warn(message)
+	l.logf("Rollback: %s", message)
+	logEvent(eventRollback, message)
+
+	cmds, err := l.stageLastGood(lastGood)
+	if err != nil {
+		return err
+	}
+
+	l.rolledBack = true
+	l.setJre(lastGood.Jre, "JRE of the last good version")
+
+	return l.start(l.withLaunchID(cmds))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rollout element, announces a staged rollout of a new version of the app
+type Rollout struct {
+	Version    string `xml:"version,attr"`
+	Percentage int    `xml:"percentage,attr"`
+	Rings      string `xml:"rings,attr"`
+}
+
+// RolloutState records the JNLP of the version the machine currently runs
+type RolloutState struct {
+	Version string `json:"version"`
+	Jnlp    string `json:"jnlp"`
+}
+
+// rolloutStatePath returns the path of the rollout state of the app
+func rolloutStatePath(address string) (string, error) {
+	appPath, err := appCachePath(address)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appPath, "rollout.json"), nil
+}
+
+// machineBucket assigns the machine to one of 100 buckets by the hash of its hostname
+func machineBucket() int {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return 0
+	}
+
+	hash := sha256.Sum256([]byte(strings.ToLower(hostname)))
+
+	return int(binary.BigEndian.Uint32(hash[:4]) % 100)
+}
+
+// selects checks if the machine of the given ring takes part in the rollout
+func (r *Rollout) selects(ring string) bool {
+	if ring != "" {
+		for _, item := range strings.Split(r.Rings, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), ring) {
+				return true
+			}
+		}
+	}
+
+	return machineBucket() < r.Percentage
+}
+
+// applyRollout returns the JNLP of the version this machine has to run. Machines which do not take part in
+// a staged rollout keep the cached version and its cached resources.
+func (l *Launch) applyRollout(address string, content []byte, jnlp *Jnlp) ([]byte, *Jnlp, error) {
+	path, err := rolloutStatePath(address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version := ""
+	if jnlp.Espresso.Rollout != nil {
+		version = jnlp.Espresso.Rollout.Version
+	}
+
+	state := &RolloutState{}
+
+	ba, err := storage.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(ba, state)
+	}
+
+	if err != nil || jnlp.Espresso.Rollout == nil || state.Version == version || jnlp.Espresso.Rollout.selects(l.Config.Ring) {
+		// remember the version as the current one
+		ba, err := json.MarshalIndent(RolloutState{Version: version, Jnlp: string(content)}, "", "    ")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = os.MkdirAll(filepath.Dir(path), common.DefaultDirMode)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = writeFileAtomic(path, ba)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return content, jnlp, nil
+	}
+
+	cached, err := parseJnlp([]byte(state.Jnlp))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	common.Info(fmt.Sprintf("Version %s is rolled out to %d%% of the machines, this machine keeps the cached version %s", version, jnlp.Espresso.Rollout.Percentage, state.Version))
+	l.logf("Rollout of version %s does not include this machine, the cached version %s is used", version, state.Version)
+
+	// the resources of the cached version are not updated
+	l.keepCached = true
+
+	return []byte(state.Jnlp), cached, nil
+}
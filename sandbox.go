@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/mpetavy/common"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// sandboxWindows launches the app inside Windows Sandbox
+const sandboxWindows = "windows-sandbox"
+
+const (
+	// sandboxCachePath is the folder of the read-only mapped cache inside Windows Sandbox
+	sandboxCachePath = `C:\espresso\cache`
+	// sandboxJrePath is the folder of the read-only mapped JRE inside Windows Sandbox
+	sandboxJrePath = `C:\espresso\jre`
+)
+
+// WindowsSandbox is the .wsb configuration of Windows Sandbox
+type WindowsSandbox struct {
+	XMLName       xml.Name              `xml:"Configuration"`
+	Networking    string                `xml:"Networking"`
+	MappedFolders []SandboxMappedFolder `xml:"MappedFolders>MappedFolder"`
+	LogonCommand  string                `xml:"LogonCommand>Command"`
+}
+
+// SandboxMappedFolder maps a host folder into Windows Sandbox
+type SandboxMappedFolder struct {
+	HostFolder    string `xml:"HostFolder"`
+	SandboxFolder string `xml:"SandboxFolder"`
+	ReadOnly      bool   `xml:"ReadOnly"`
+}
+
+// quoteArg quotes a command line argument with spaces
+func quoteArg(arg string) string {
+	if arg == "" || strings.ContainsAny(arg, " \t\"") {
+		return `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+	}
+
+	return arg
+}
+
+// sandboxConfig creates the Windows Sandbox configuration which runs the command line with the cache and JRE mapped read-only
+func (l *Launch) sandboxConfig(cmds []string) (*WindowsSandbox, error) {
+	if !filepath.IsAbs(l.Jre) {
+		return nil, fmt.Errorf("Windows Sandbox has no Java installed, the app needs a private JRE or -jre")
+	}
+
+	// <jre>/bin/javaw.exe
+	jreHome := filepath.Dir(filepath.Dir(l.Jre))
+
+	rel, err := filepath.Rel(jreHome, l.Jre)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+
+	args = append(args, quoteArg(filepath.Join(sandboxJrePath, rel)))
+
+	for _, cmd := range cmds {
+		args = append(args, quoteArg(strings.ReplaceAll(cmd, *cache, sandboxCachePath)))
+	}
+
+	return &WindowsSandbox{
+		Networking: "Enable",
+		MappedFolders: []SandboxMappedFolder{
+			{HostFolder: *cache, SandboxFolder: sandboxCachePath, ReadOnly: true},
+			{HostFolder: jreHome, SandboxFolder: sandboxJrePath, ReadOnly: true},
+		},
+		LogonCommand: strings.Join(args, " "),
+	}, nil
+}
+
+// startSandbox launches the app inside the sandbox of the given mode
+func (l *Launch) startSandbox(mode string, cmds []string) error {
+	if mode != sandboxWindows {
+		return fmt.Errorf("invalid sandbox %q, use %s", mode, sandboxWindows)
+	}
+
+	if runtime.GOOS != "windows" {
+		return fmt.Errorf("%s is only available on Windows", sandboxWindows)
+	}
+
+	config, err := l.sandboxConfig(cmds)
+	if err != nil {
+		return err
+	}
+
+	ba, err := xml.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	appPath, err := appCachePath(l.Address)
+	if err != nil {
+		return err
+	}
+
+	filename := filepath.Join(appPath, "sandbox.wsb")
+
+	err = storage.WriteFile(filename, ba)
+	if err != nil {
+		return err
+	}
+
+	common.Debug(fmt.Sprintf("Windows Sandbox configuration %s:\n%s", filename, string(ba)))
+	l.logf("Launch inside Windows Sandbox: %s", config.LogonCommand)
+
+	cmd := exec.Command("WindowsSandbox.exe", filename)
+
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("cannot start Windows Sandbox, please enable the Windows feature \"Windows Sandbox\": %w", err)
+	}
+
+	l.setState("started")
+
+	if !l.Wait {
+		return nil
+	}
+
+	return cmd.Wait()
+}
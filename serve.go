@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serveManifestName is the name of the resource manifest which the serve command provides in the served directory
+const serveManifestName = "espresso-manifest.json"
+
+// ServeManifestEntry describes a served resource
+type ServeManifestEntry struct {
+	SHA256   string    `json:"sha256"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// ServeManifest lists all served resources by their path relative to the served directory
+type ServeManifest struct {
+	Files map[string]ServeManifestEntry `json:"files"`
+}
+
+// Server serves a directory with JNLP applications and generates the resource manifest
+type Server struct {
+	// Dir is the served directory
+	Dir string
+
+	mu     sync.Mutex
+	hashes map[string]ServeManifestEntry
+}
+
+// runServe serves the directory, for example a mirror, on the listen address
+func runServe(dir string, listen string) error {
+	if dir == "" {
+		return fmt.Errorf("usage: espresso serve -dest <directory> [-listen <address>]")
+	}
+
+	s := &Server{
+		Dir:    dir,
+		hashes: make(map[string]ServeManifestEntry),
+	}
+
+	common.Info(fmt.Sprintf("Serving %s on %s", dir, listen))
+
+	return http.ListenAndServe(listen, s)
+}
+
+// manifest generates the manifest of the served directory, hashes of unchanged files are reused
+func (s *Server) manifest() (*ServeManifest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	manifest := &ServeManifest{
+		Files: make(map[string]ServeManifestEntry),
+	}
+
+	err := filepath.WalkDir(s.Dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.Dir, file)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if rel == serveManifestName {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		entry, ok := s.hashes[rel]
+		if !ok || entry.Size != info.Size() || !entry.Modified.Equal(info.ModTime()) {
+			sum, err := fileHash(file)
+			if err != nil {
+				return err
+			}
+
+			entry = ServeManifestEntry{
+				SHA256:   sum,
+				Size:     info.Size(),
+				Modified: info.ModTime(),
+			}
+
+			s.hashes[rel] = entry
+		}
+
+		manifest.Files[rel] = entry
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// ServeHTTP serves the manifest and the files, both with validators so clients can revalidate cheaply
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	manifest, err := s.manifest()
+	if common.Error(err) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	rel := strings.TrimPrefix(r.URL.Path, "/")
+
+	// clients always revalidate, the ETag makes unchanged content a cheap 304
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if rel == serveManifestName {
+		ba, err := json.MarshalIndent(manifest, "", "    ")
+		if common.Error(err) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		hash := sha256.Sum256(ba)
+		etag := `"` + hex.EncodeToString(hash[:]) + `"`
+
+		w.Header().Set("ETag", etag)
+
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		_, err = w.Write(ba)
+		common.Error(err)
+
+		return
+	}
+
+	if entry, ok := manifest.Files[rel]; ok {
+		w.Header().Set("ETag", `"`+entry.SHA256+`"`)
+	}
+
+	if strings.HasSuffix(rel, ".jnlp") {
+		w.Header().Set("Content-Type", "application/x-java-jnlp-file")
+	}
+
+	http.ServeFile(w, r, filepath.Join(s.Dir, filepath.FromSlash(rel)))
+}
+
+// fetchServeManifest loads the resource manifest of the codebase, servers without manifest are reported by an error
+func fetchServeManifest(codebase string) (*ServeManifest, error) {
+	ba, err := fetchURL(strings.TrimSuffix(codebase, "/") + "/" + serveManifestName)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &ServeManifest{}
+
+	err = json.Unmarshal(ba, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// revalidate marks the cached resources which are unchanged according to the manifest of the codebase,
+// so a warm launch needs a single request instead of one per resource
+func (l *Launch) revalidate(list []Task) {
+	// kiosk mode verifies each resource by the lockfile, offline mode uses the cached resources as they are
+	if l.codebase == "" || l.lock != nil || l.offline {
+		return
+	}
+
+	manifest, err := fetchServeManifest(l.codebase)
+	if err != nil {
+		common.Debug(fmt.Sprintf("No resource manifest available: %v", err))
+
+		return
+	}
+
+	index, err := readCacheIndex()
+	if common.Error(err) {
+		return
+	}
+
+	prefix := strings.TrimSuffix(l.codebase, "/") + "/"
+
+	for _, task := range list {
+		rel, ok := strings.CutPrefix(task.URL, prefix)
+		if !ok {
+			continue
+		}
+
+		served, ok := manifest.Files[rel]
+		if !ok {
+			continue
+		}
+
+		key, ok := cacheKey(task.Path)
+		if !ok {
+			continue
+		}
+
+		cached, ok := index.Entries[key]
+		if !ok || cached.SHA256 != served.SHA256 || !common.FileExists(task.Path) {
+			continue
+		}
+
+		l.mu.Lock()
+		l.current[task.Path] = true
+		l.mu.Unlock()
+	}
+}
+
+// isCurrent checks if the cached resource has been revalidated as unchanged
+func (l *Launch) isCurrent(path string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.current[path]
+}
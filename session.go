@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// sessionCacheOff uses the cache path as it is
+	sessionCacheOff = "off"
+	// sessionCacheAuto moves a default cache on a UNC path (redirected profile) to the local profile
+	sessionCacheAuto = "auto"
+	// sessionCacheSession additionally keys the cache by the remote session
+	sessionCacheSession = "session"
+)
+
+// isUNCPath checks if the path is a network path like \\server\share
+func isUNCPath(path string) bool {
+	return strings.HasPrefix(path, `\\`) || strings.HasPrefix(path, "//")
+}
+
+// isFlagSet checks if the flag has been given on the command line
+func isFlagSet(name string) bool {
+	set := false
+
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
+
+// sessionCachePath returns the cache path which avoids collisions of launches on Citrix/RDS servers according to the mode
+func sessionCachePath(path string, mode string) (string, error) {
+	switch mode {
+	case sessionCacheOff:
+		return path, nil
+	case sessionCacheAuto, sessionCacheSession:
+	default:
+		return "", fmt.Errorf("invalid session cache mode %q, use %s, %s or %s", mode, sessionCacheOff, sessionCacheAuto, sessionCacheSession)
+	}
+
+	// a classpath on a redirected UNC profile breaks the JVM, so the default cache is moved to the local profile
+	if isUNCPath(path) && !isFlagSet("cache") && !cachePinned {
+		local, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+
+		common.Debug(fmt.Sprintf("Cache path %s is a network path, the local profile is used", path))
+
+		path = filepath.Join(local, "espresso")
+	}
+
+	kind, id, remote := remoteSession()
+
+	if remote {
+		common.Debug(fmt.Sprintf("Running in %s session %d", kind, id))
+	}
+
+	if mode == sessionCacheSession && remote {
+		path = filepath.Join(path, fmt.Sprintf("session-%d", id))
+	}
+
+	return path, nil
+}
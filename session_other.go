@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// remoteSession reports no terminal server session, Citrix and RDS sessions only exist on Windows
+func remoteSession() (string, uint32, bool) {
+	return "", 0, false
+}
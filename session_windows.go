@@ -0,0 +1,30 @@
+package main
+
+import (
+	"golang.org/x/sys/windows"
+	"os"
+	"strings"
+)
+
+// remoteSession reports the kind ("Citrix" or "RDS") and the id of the terminal server session espresso runs in
+func remoteSession() (string, uint32, bool) {
+	name := os.Getenv("SESSIONNAME")
+
+	if name == "" || strings.EqualFold(name, "Console") {
+		return "", 0, false
+	}
+
+	var id uint32
+
+	err := windows.ProcessIdToSessionId(windows.GetCurrentProcessId(), &id)
+	if err != nil {
+		return "", 0, false
+	}
+
+	// Citrix sessions use the ICA protocol, RDS sessions the RDP protocol
+	if strings.HasPrefix(strings.ToUpper(name), "ICA") {
+		return "Citrix", id, true
+	}
+
+	return "RDS", id, true
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"github.com/mpetavy/common"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Shortcut element of the information element
+type Shortcut struct {
+	Online  string        `xml:"online,attr"`
+	Install string        `xml:"install,attr"`
+	Desktop *struct{}     `xml:"desktop"`
+	Menu    *ShortcutMenu `xml:"menu"`
+}
+
+// ShortcutMenu element of the shortcut element
+type ShortcutMenu struct {
+	Submenu string `xml:"submenu,attr"`
+}
+
+// ShortcutTarget describes a shortcut which re-invokes espresso with the JNLP URL
+type ShortcutTarget struct {
+	Name       string
+	Executable string
+	Args       []string
+	Icon       string
+	Comment    string
+	Desktop    bool
+	Menu       bool
+	Submenu    string
+}
+
+// shortcutName returns the title of the app as a valid file name
+func shortcutName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || r < ' ' {
+			return '_'
+		}
+
+		return r
+	}, strings.TrimSpace(title))
+
+	if name == "" {
+		name = "espresso app"
+	}
+
+	return name
+}
+
+// shortcutMarkerPath returns the file which records the creation of the shortcuts of the app
+func shortcutMarkerPath(address string) (string, error) {
+	appPath, err := appCachePath(address)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(appPath, "shortcuts.created"), nil
+}
+
+// createShortcuts creates the desktop and menu shortcuts requested by the JNLP once, so shortcuts deleted by the
+// user are not created again
+func (l *Launch) createShortcuts(information Information) error {
+	shortcut := information.Shortcut
+
+	if !*shortcuts || shortcut == nil || (shortcut.Desktop == nil && shortcut.Menu == nil) {
+		return nil
+	}
+
+	marker, err := shortcutMarkerPath(l.Address)
+	if err != nil {
+		return err
+	}
+
+	if common.FileExists(marker) {
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	target := ShortcutTarget{
+		Name:       shortcutName(information.Title),
+		Executable: executable,
+		Args:       []string{"-url", l.Address},
+		Icon:       l.iconpath,
+		Comment:    information.Description,
+		Desktop:    shortcut.Desktop != nil,
+		Menu:       shortcut.Menu != nil,
+	}
+
+	if shortcut.Menu != nil {
+		target.Submenu = shortcutName(shortcut.Menu.Submenu)
+		if strings.TrimSpace(shortcut.Menu.Submenu) == "" {
+			target.Submenu = ""
+		}
+	}
+
+	err = createShortcut(target)
+	if err != nil {
+		return err
+	}
+
+	l.logf("Created the shortcuts of %s", target.Name)
+
+	return os.WriteFile(marker, []byte(time.Now().Format(time.RFC3339)), common.DefaultFileMode)
+}
@@ -0,0 +1,176 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// desktopPath returns the desktop directory of the user
+func desktopPath() (string, error) {
+	if runtime.GOOS == "linux" {
+		ba, err := exec.Command("xdg-user-dir", "DESKTOP").Output()
+		if err == nil && strings.TrimSpace(string(ba)) != "" {
+			return strings.TrimSpace(string(ba)), nil
+		}
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, "Desktop"), nil
+}
+
+// shellQuote quotes the argument for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// desktopQuote quotes the argument for the Exec key of a .desktop file
+func desktopQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\\\`, `"`, `\\"`, "`", "\\\\`", "$", `\\$`, "%", "%%").Replace(s) + `"`
+}
+
+// xmlEscape escapes the text for XML content
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+
+	_ = xml.EscapeText(&buf, []byte(s))
+
+	return buf.String()
+}
+
+// createShortcut creates the shortcuts as .desktop files on Linux and as an app bundle on macOS
+func createShortcut(target ShortcutTarget) error {
+	if runtime.GOOS == "darwin" {
+		return createAppBundle(target)
+	}
+
+	args := []string{desktopQuote(target.Executable)}
+	for _, arg := range target.Args {
+		args = append(args, desktopQuote(arg))
+	}
+
+	categories := "Application;"
+	if target.Submenu != "" {
+		categories += "X-" + sanitizeName(target.Submenu) + ";"
+	}
+
+	content := fmt.Sprintf("[Desktop Entry]\nType=Application\nName=%s\nComment=%s\nExec=%s\nIcon=%s\nTerminal=false\nCategories=%s\n",
+		target.Name, target.Comment, strings.Join(args, " "), target.Icon, categories)
+
+	filename := sanitizeName(target.Name) + ".desktop"
+
+	if target.Menu {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+
+		dir := filepath.Join(home, ".local", "share", "applications")
+
+		err = os.MkdirAll(dir, common.DefaultDirMode)
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(filepath.Join(dir, filename), []byte(content), 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	if target.Desktop {
+		dir, err := desktopPath()
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, filename)
+
+		err = os.WriteFile(path, []byte(content), 0755)
+		if err != nil {
+			return err
+		}
+
+		// GNOME starts desktop files only if they are trusted
+		_ = exec.Command("gio", "set", path, "metadata::trusted", "true").Run()
+	}
+
+	return nil
+}
+
+// createAppBundle creates a minimal app bundle in ~/Applications which starts espresso, the desktop gets a link to it
+func createAppBundle(target ShortcutTarget) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	bundle := filepath.Join(home, "Applications", target.Name+".app")
+	macOS := filepath.Join(bundle, "Contents", "MacOS")
+
+	err = os.MkdirAll(macOS, common.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
+	args := []string{shellQuote(target.Executable)}
+	for _, arg := range target.Args {
+		args = append(args, shellQuote(arg))
+	}
+
+	err = os.WriteFile(filepath.Join(macOS, "launch"), []byte("#!/bin/sh\nexec "+strings.Join(args, " ")+"\n"), 0755)
+	if err != nil {
+		return err
+	}
+
+	plist := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+    <key>CFBundleName</key>
+    <string>%s</string>
+    <key>CFBundleExecutable</key>
+    <string>launch</string>
+    <key>CFBundleIdentifier</key>
+    <string>espresso.%s</string>
+    <key>CFBundlePackageType</key>
+    <string>APPL</string>
+</dict>
+</plist>
+`, xmlEscape(target.Name), sanitizeName(target.Name))
+
+	err = os.WriteFile(filepath.Join(bundle, "Contents", "Info.plist"), []byte(plist), common.DefaultFileMode)
+	if err != nil {
+		return err
+	}
+
+	if target.Desktop {
+		dir, err := desktopPath()
+		if err != nil {
+			return err
+		}
+
+		link := filepath.Join(dir, target.Name+".app")
+
+		_ = os.Remove(link)
+
+		err = os.Symlink(bundle, link)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
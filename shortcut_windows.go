@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// psQuote quotes the string for a PowerShell single quoted literal
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// createShortcut creates .lnk files on the desktop and in the start menu by the WScript.Shell COM object
+func createShortcut(target ShortcutTarget) error {
+	var args []string
+	for _, arg := range target.Args {
+		args = append(args, syscall.EscapeArg(arg))
+	}
+
+	// .lnk files only support .ico icons, otherwise the icon of espresso is used
+	icon := target.Executable
+	if strings.EqualFold(filepath.Ext(target.Icon), ".ico") {
+		icon = target.Icon
+	}
+
+	var folders []string
+
+	if target.Desktop {
+		folders = append(folders, "[Environment]::GetFolderPath('Desktop')")
+	}
+
+	if target.Menu {
+		folder := "[Environment]::GetFolderPath('Programs')"
+		if target.Submenu != "" {
+			folder = fmt.Sprintf("(Join-Path %s %s)", folder, psQuote(target.Submenu))
+		}
+
+		folders = append(folders, folder)
+	}
+
+	var script strings.Builder
+
+	script.WriteString("$shell = New-Object -ComObject WScript.Shell;")
+
+	for _, folder := range folders {
+		fmt.Fprintf(&script, "$folder = %s;", folder)
+		script.WriteString("New-Item -ItemType Directory -Force -Path $folder | Out-Null;")
+		fmt.Fprintf(&script, "$link = $shell.CreateShortcut((Join-Path $folder %s));", psQuote(target.Name+".lnk"))
+		fmt.Fprintf(&script, "$link.TargetPath = %s;", psQuote(target.Executable))
+		fmt.Fprintf(&script, "$link.Arguments = %s;", psQuote(strings.Join(args, " ")))
+		fmt.Fprintf(&script, "$link.IconLocation = %s;", psQuote(icon))
+		fmt.Fprintf(&script, "$link.Description = %s;", psQuote(target.Comment))
+		script.WriteString("$link.Save();")
+	}
+
+	ba, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script.String()).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot create the shortcuts: %v %s", err, strings.TrimSpace(string(ba)))
+	}
+
+	return nil
+}
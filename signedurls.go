@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultTokenParams are the query parameters of the signed URLs of CloudFront and S3
+var defaultTokenParams = []string{
+	"Expires", "Signature", "Key-Pair-Id", "Policy",
+	"X-Amz-Algorithm", "X-Amz-Credential", "X-Amz-Date", "X-Amz-Expires", "X-Amz-SignedHeaders", "X-Amz-Signature", "X-Amz-Security-Token",
+}
+
+// defaultMaxRefreshes is the number of token refreshes of a resource
+const defaultMaxRefreshes = 2
+
+// signedURLReuse is the time in which a refreshed JNLP file is reused for the other resources of the launch
+const signedURLReuse = 10 * time.Second
+
+// tokenParams are the query parameters of the tokens of signed URLs
+var tokenParams = defaultTokenParams
+
+// SignedURLsConfig defines the handling of short-lived signed resource URLs of CDNs
+type SignedURLsConfig struct {
+	// Refresh fetches the JNLP file again for fresh tokens if a download is refused with 403
+	Refresh bool `json:"refresh"`
+	// MaxRefreshes is the number of token refreshes of a resource (default 2)
+	MaxRefreshes int `json:"max-refreshes"`
+	// TokenParams are the query parameters of the tokens, which do not belong to the cache names
+	TokenParams []string `json:"token-params"`
+}
+
+// refreshedJnlp is a JNLP file fetched again for fresh tokens
+type refreshedJnlp struct {
+	jnlp    *Jnlp
+	fetched time.Time
+}
+
+// setTokenParams configures the query parameters of the tokens, the default ones are used without
+func setTokenParams(params []string) {
+	tokenParams = defaultTokenParams
+
+	if len(params) > 0 {
+		tokenParams = params
+	}
+}
+
+// isTokenParam checks if the query parameter is a token of signed URLs
+func isTokenParam(param string) bool {
+	name, _, _ := strings.Cut(param, "=")
+
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		name = unescaped
+	}
+
+	return slices.ContainsFunc(tokenParams, func(token string) bool {
+		return strings.EqualFold(token, name)
+	})
+}
+
+// splitTokens splits the href into the href without the tokens and the token parameters, the order of the remaining
+// query parameters is kept
+func splitTokens(href string) (string, []string) {
+	base, query, ok := strings.Cut(href, "?")
+	if !ok {
+		return href, nil
+	}
+
+	fragment := ""
+	if i := strings.Index(query, "#"); i != -1 {
+		query, fragment = query[:i], query[i:]
+	}
+
+	var params, tokens []string
+
+	for _, param := range strings.Split(query, "&") {
+		switch {
+		case param == "":
+		case isTokenParam(param):
+			tokens = append(tokens, param)
+		default:
+			params = append(params, param)
+		}
+	}
+
+	if len(params) > 0 {
+		base += "?" + strings.Join(params, "&")
+	}
+
+	return base + fragment, tokens
+}
+
+// stripTokens returns the href without the tokens of signed URLs, so the cache name of a resource stays the same
+// when its tokens change
+func stripTokens(href string) string {
+	stripped, _ := splitTokens(href)
+
+	return stripped
+}
+
+// replaceTokens replaces the tokens of the URL by the tokens of the refreshed href
+func replaceTokens(address string, refreshed string) string {
+	stripped, _ := splitTokens(address)
+	_, tokens := splitTokens(refreshed)
+
+	if len(tokens) == 0 {
+		return stripped
+	}
+
+	fragment := ""
+	if i := strings.Index(stripped, "#"); i != -1 {
+		stripped, fragment = stripped[:i], stripped[i:]
+	}
+
+	separator := "?"
+	if strings.Contains(stripped, "?") {
+		separator = "&"
+	}
+
+	return stripped + separator + strings.Join(tokens, "&") + fragment
+}
+
+// isRefusedToken checks if the download has been refused like CDNs refuse expired tokens
+func isRefusedToken(err error) bool {
+	var statusErr *StatusError
+
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusForbidden
+}
+
+// maxRefreshes returns the number of token refreshes of a resource, 0 if refreshes are disabled
+func (l *Launch) maxRefreshes() int {
+	settings := l.Config.SignedURLs
+
+	switch {
+	case !settings.Refresh:
+		return 0
+	case settings.MaxRefreshes <= 0:
+		return defaultMaxRefreshes
+	default:
+		return settings.MaxRefreshes
+	}
+}
+
+// downloadRefreshing downloads the resource, a download refused with 403 is retried with the fresh tokens of the JNLP
+// file which declares the resource
+func (l *Launch) downloadRefreshing(ctx context.Context, task Task) error {
+	address := task.URL
+
+	for refresh := 1; ; refresh++ {
+		err := l.downloadResuming(ctx, address, task.Path, task.Encrypt)
+		if err == nil || !isRefusedToken(err) || task.Origin == "" || refresh > l.maxRefreshes() {
+			return err
+		}
+
+		l.logf("Signed URL: %s is refused, refresh %d of the tokens by %s", stripTokens(address), refresh, stripTokens(task.Origin))
+
+		address, err = l.refreshSignedURL(task)
+		if err != nil {
+			return fmt.Errorf("%s: the tokens cannot be refreshed: %w", stripTokens(task.URL), err)
+		}
+	}
+}
+
+// refreshSignedURL returns the URL of the resource with the tokens of the JNLP file fetched again
+func (l *Launch) refreshSignedURL(task Task) (string, error) {
+	l.refreshMu.Lock()
+	defer l.refreshMu.Unlock()
+
+	refreshed, ok := l.refreshed[task.Origin]
+
+	// the resources of a JNLP file expire together, so the JNLP file is fetched once for all of them
+	if !ok || time.Since(refreshed.fetched) > signedURLReuse {
+		content, err := l.fetchJnlp(task.Origin)
+		if err != nil {
+			return "", err
+		}
+
+		jnlp, err := parseJnlp(content)
+		if err != nil {
+			return "", err
+		}
+
+		refreshed = refreshedJnlp{jnlp: jnlp, fetched: time.Now()}
+
+		l.refreshed[task.Origin] = refreshed
+	}
+
+	resources := refreshed.jnlp.Resources
+
+	for _, resource := range refreshed.jnlp.Resources {
+		for _, j2se := range append(append([]J2se{}, resource.J2se...), resource.Java...) {
+			resources = append(resources, j2se.Resources...)
+		}
+	}
+
+	for _, resource := range resources {
+		for _, jar := range append(append([]Jar{}, resource.Jars...), resource.Nativelibs...) {
+			if stripTokens(jar.Href) == stripTokens(task.Href) {
+				return replaceTokens(task.URL, jar.Href), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("the resource is no longer declared by %s", stripTokens(task.Origin))
+}
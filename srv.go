@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// srvScheme is the URL scheme of deployment servers which are discovered by DNS SRV records
+const srvScheme = "srv"
+
+// resolveSRV resolves a srv://_service._proto.domain/path URL to the URL of the first reachable SRV target,
+// targets are tried in the order of their priority and weight. Other URLs are returned as they are.
+func resolveSRV(address string) (string, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != srvScheme {
+		return address, nil
+	}
+
+	// the record name is used as it is, e.g. _jnlp._tcp.example.com
+	_, records, err := net.LookupSRV("", "", u.Hostname())
+	if err != nil {
+		return "", fmt.Errorf("cannot discover the deployment server of %s: %w", address, err)
+	}
+
+	for _, record := range records {
+		target := *u
+
+		target.Scheme = "https"
+		if record.Port == 80 {
+			target.Scheme = "http"
+		}
+
+		target.Host = net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port)))
+
+		location := target.String()
+
+		if isReachable(location) {
+			common.Debug(fmt.Sprintf("SRV discovery: %s --> %s", address, location))
+
+			return location, nil
+		}
+
+		common.Debug(fmt.Sprintf("SRV discovery: %s is not reachable", location))
+	}
+
+	return "", fmt.Errorf("no deployment server of %s is reachable", address)
+}
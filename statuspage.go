@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"net"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// statusPageLinger keeps the status page available after the launch so the browser can show the final state
+const statusPageLinger = 3 * time.Second
+
+// statusPageLogLimit is the max. number of launcher log bytes shown on the status page
+const statusPageLogLimit = 64 * 1024
+
+// Status is the launch progress reported to the status page
+type Status struct {
+	Address  string `json:"address"`
+	Title    string `json:"title,omitempty"`
+	LaunchID string `json:"launchId"`
+	State    string `json:"state"`
+	Done     int    `json:"done"`
+	Total    int    `json:"total"`
+	Log      string `json:"log"`
+}
+
+// statusPageHTML polls the status of the launch and offers cancelling it
+const statusPageHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>espresso</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+progress { width: 100%; height: 1.5em; }
+pre { background: #f4f4f4; padding: 1em; height: 20em; overflow: auto; }
+</style>
+</head>
+<body>
+<h2 id="address"></h2>
+<p id="state"></p>
+<progress id="progress" value="0" max="1"></progress>
+<p><button id="cancel" onclick="fetch('/cancel', {method: 'POST'})">Cancel</button></p>
+<pre id="log"></pre>
+<script>
+async function update() {
+  try {
+    const status = await (await fetch('/status')).json();
+    document.getElementById('address').textContent = status.title || status.address;
+    document.title = status.title || 'espresso';
+    document.getElementById('state').textContent = status.state + ' (' + status.done + '/' + status.total + ')';
+    document.getElementById('progress').max = Math.max(status.total, 1);
+    document.getElementById('progress').value = status.done;
+    document.getElementById('log').textContent = status.log;
+    document.getElementById('cancel').disabled = status.state !== 'resolving' && status.state !== 'downloading' && status.state !== 'paused';
+    setTimeout(update, 500);
+  } catch (e) {
+    document.getElementById('state').textContent = 'espresso has finished';
+    document.getElementById('cancel').disabled = true;
+  }
+}
+update();
+</script>
+</body>
+</html>
+`
+
+// setState sets the state of the launch shown on the status page
+func (l *Launch) setState(state string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.state = state
+}
+
+// cancel cancels the pending downloads of the launch
+func (l *Launch) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cancelled = true
+}
+
+// isCancelled checks if the launch has been cancelled
+func (l *Launch) isCancelled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.cancelled
+}
+
+// status returns the current progress of the launch
+func (l *Launch) status() Status {
+	l.mu.Lock()
+	status := Status{
+		Address:  l.Address,
+		Title:    l.title,
+		LaunchID: l.ID,
+		State:    l.state,
+		Done:     l.done,
+		Total:    l.total,
+	}
+	l.mu.Unlock()
+
+	logPath, err := appLogPath(l.Address)
+	if err == nil {
+		ba, _, err := readLog(filepath.Join(logPath, launcherLogFile), 0)
+		if err == nil {
+			if len(ba) > statusPageLogLimit {
+				ba = ba[len(ba)-statusPageLogLimit:]
+			}
+
+			status.Log = string(ba)
+		}
+	}
+
+	return status
+}
+
+// serveStatusPage serves the status page of the launch on localhost and opens it in the browser, the returned func stops the server
+func (l *Launch) serveStatusPage() (func(), error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		_, err := w.Write([]byte(statusPageHTML))
+		common.Error(err)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		common.Error(json.NewEncoder(w).Encode(l.status()))
+	})
+	mux.HandleFunc("/cancel", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		l.logf("Launch cancelled on the status page")
+		l.cancel()
+	})
+
+	server := &http.Server{Handler: mux}
+
+	go func() {
+		err := server.Serve(listener)
+		if err != http.ErrServerClosed {
+			common.Error(err)
+		}
+	}()
+
+	address := fmt.Sprintf("http://%s/", listener.Addr().String())
+
+	common.Info(fmt.Sprintf("Status page: %s", address))
+
+	common.Error(openBrowser(address))
+
+	return func() {
+		time.Sleep(statusPageLinger)
+
+		common.Error(server.Shutdown(context.Background()))
+	}, nil
+}
+
+// openBrowser opens the URL in the default browser of the OS
+func openBrowser(address string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", address)
+	case "darwin":
+		cmd = exec.Command("open", address)
+	default:
+		cmd = exec.Command("xdg-open", address)
+	}
+
+	return cmd.Start()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// storageDisk keeps the cache on the persistent disk
+	storageDisk = "disk"
+	// storageMemory keeps the cache in a tmpfs which is removed at the end of espresso
+	storageMemory = "memory"
+)
+
+// Storage is the backend of the cache, the cache files are read, replaced and removed through it. The JVM loads the
+// jars from files, so every backend provides a directory.
+type Storage interface {
+	// Path returns the root directory of the cache
+	Path() string
+	// Persistent reports if the cache survives the end of espresso
+	Persistent() bool
+	// ReadFile returns the content of the file
+	ReadFile(filename string) ([]byte, error)
+	// WriteFile replaces the file atomically by the content
+	WriteFile(filename string, content []byte) error
+	// Store replaces the file atomically by the content of the reader, hardlinks keep the old content
+	Store(filename string, r io.Reader) error
+	// RemoveAll removes the file or directory with its content
+	RemoveAll(path string) error
+	// Key returns the named 256 bit key of the cache, like the key of the cache encryption
+	Key(name string) ([]byte, error)
+	// Close releases the storage, ephemeral storages are removed
+	Close() error
+}
+
+// storage is the backend of the cache of the running espresso
+var storage Storage = &diskStorage{fileStorage: fileStorage{durable: true}}
+
+// fileStorage implements the file operations of the storages in a directory
+type fileStorage struct {
+	path    string
+	durable bool
+	mu      sync.Mutex
+	keys    map[string]storageKey
+}
+
+// storageKey is a key of the storage, or the error why there is none
+type storageKey struct {
+	key []byte
+	err error
+}
+
+// key returns the named key created by newKey once
+func (s *fileStorage) key(name string, newKey func() ([]byte, error)) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[name]
+	if !ok {
+		k.key, k.err = newKey()
+
+		if s.keys == nil {
+			s.keys = make(map[string]storageKey)
+		}
+
+		s.keys[name] = k
+	}
+
+	return k.key, k.err
+}
+
+func (s *fileStorage) Path() string {
+	return s.path
+}
+
+func (s *fileStorage) ReadFile(filename string) ([]byte, error) {
+	return os.ReadFile(longPath(filename))
+}
+
+func (s *fileStorage) WriteFile(filename string, content []byte) error {
+	return s.Store(filename, bytes.NewReader(content))
+}
+
+// Store writes a temporary file in the same directory, which replaces the file. Concurrent readers see either the old
+// or the new content but never a partially written file. Durable storages flush the content to the disk before.
+func (s *fileStorage) Store(filename string, r io.Reader) error {
+	// the temporary file name is even longer than the file name
+	filename = longPath(filename)
+
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if err == nil && s.durable {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Chmod(f.Name(), common.DefaultFileMode)
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+
+	if err != nil {
+		common.Error(os.Remove(f.Name()))
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *fileStorage) RemoveAll(path string) error {
+	return os.RemoveAll(longPath(path))
+}
+
+// diskStorage is the default cache in a directory of the persistent disk
+type diskStorage struct {
+	fileStorage
+}
+
+func (s *diskStorage) Persistent() bool {
+	return true
+}
+
+// Key returns the key from the OS keychain, it is created on first use
+func (s *diskStorage) Key(name string) ([]byte, error) {
+	return s.key(name, func() ([]byte, error) {
+		return keychainKey(name)
+	})
+}
+
+func (s *diskStorage) Close() error {
+	return nil
+}
+
+// memoryStorage is an ephemeral cache in a tmpfs, for containers and tests which must not touch the persistent disk.
+// Its files are not flushed and its keys are random ones which are not stored in the OS keychain, they do not survive
+// espresso anyway.
+type memoryStorage struct {
+	fileStorage
+}
+
+func (s *memoryStorage) Persistent() bool {
+	return false
+}
+
+func (s *memoryStorage) Key(name string) ([]byte, error) {
+	return s.key(name, func() ([]byte, error) {
+		key := make([]byte, 32)
+
+		_, err := rand.Read(key)
+
+		return key, err
+	})
+}
+
+func (s *memoryStorage) Close() error {
+	return os.RemoveAll(s.path)
+}
+
+// newStorage returns the storage backend of the cache due to the mode. A cache path pinned by a policy is always
+// used, the ephemeral cache cannot bypass it.
+func newStorage(mode string, path string) (Storage, error) {
+	if mode == storageMemory && cachePinned {
+		common.Warn(fmt.Sprintf("The cache path is pinned to %s by a policy, -storage %s is ignored", path, mode))
+
+		mode = storageDisk
+	}
+
+	switch mode {
+	case storageDisk:
+		err := os.MkdirAll(longPath(path), common.DefaultDirMode)
+		if err != nil {
+			return nil, err
+		}
+
+		return &diskStorage{fileStorage: fileStorage{path: path, durable: true}}, nil
+	case storageMemory:
+		base := stagingBase()
+
+		// without a tmpfs the ephemeral cache reaches the disk, it is removed at the end of espresso
+		if base != "/dev/shm" {
+			common.Warn(fmt.Sprintf("No tmpfs available, the ephemeral cache is written to the disk in %s and removed at the end of espresso", base))
+		}
+
+		path, err := newStagingDir("cache-")
+		if err != nil {
+			return nil, err
+		}
+
+		common.Debug(fmt.Sprintf("Ephemeral cache in %s", path))
+
+		return &memoryStorage{fileStorage: fileStorage{path: path}}, nil
+	default:
+		return nil, fmt.Errorf("invalid storage %q, use %s or %s", mode, storageDisk, storageMemory)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"github.com/mpetavy/common"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useMemoryStorage runs the test on an ephemeral cache, so it touches neither the persistent cache nor the OS keychain
+func useMemoryStorage(t *testing.T) string {
+	t.Helper()
+
+	s, err := newStorage(storageMemory, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	savedStorage, savedCache := storage, *cache
+
+	storage = s
+	*cache = s.Path()
+
+	t.Cleanup(func() {
+		storage = savedStorage
+		*cache = savedCache
+
+		err := s.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	return s.Path()
+}
+
+func TestNewStorage(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		pinned     bool
+		persistent bool
+		wantErr    bool
+	}{
+		{"disk", storageDisk, false, true, false},
+		{"memory", storageMemory, false, false, false},
+		{"memory pinned", storageMemory, true, true, false},
+		{"invalid", "cloud", false, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			saved := cachePinned
+			cachePinned = test.pinned
+
+			defer func() {
+				cachePinned = saved
+			}()
+
+			path := filepath.Join(t.TempDir(), "cache")
+
+			s, err := newStorage(test.mode, path)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("newStorage(%q) succeeded", test.mode)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s.Persistent() != test.persistent {
+				t.Errorf("Persistent() = %v, want %v", s.Persistent(), test.persistent)
+			}
+
+			// the pinned cache path is used by every storage
+			if test.persistent && s.Path() != path {
+				t.Errorf("Path() = %s, want %s", s.Path(), path)
+			}
+
+			if !common.FileExists(s.Path()) {
+				t.Errorf("%s does not exist", s.Path())
+			}
+
+			err = s.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if common.FileExists(s.Path()) == !test.persistent {
+				t.Errorf("%s exists %v after Close, want %v", s.Path(), !test.persistent, test.persistent)
+			}
+		})
+	}
+}
+
+func TestStorageFiles(t *testing.T) {
+	path := useMemoryStorage(t)
+
+	filename := filepath.Join(path, "example.com", "app", "app.jar")
+
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = storage.WriteFile(filename, []byte("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a hardlink keeps the old content when the file is replaced
+	link := filename + ".link"
+
+	err = os.Link(filename, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = storage.Store(filename, strings.NewReader("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{filename: "new", link: "old"} {
+		ba, err := storage.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(ba) != want {
+			t.Errorf("%s has %q, want %q", name, ba, want)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Errorf("%d files in %s, want no temporary ones", len(entries), filepath.Dir(filename))
+	}
+
+	err = storage.RemoveAll(filepath.Join(path, "example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if common.FileExists(filename) {
+		t.Errorf("%s was not removed", filename)
+	}
+}
+
+func TestStorageKey(t *testing.T) {
+	useMemoryStorage(t)
+
+	key, err := storage.Key("index")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := storage.Key("index")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := storage.Key("cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(key) != 32 || string(key) != string(again) || string(key) == string(other) {
+		t.Errorf("the keys of the ephemeral storage are not stable per name")
+	}
+}
+
+func TestCacheIndexSignature(t *testing.T) {
+	path := useMemoryStorage(t)
+
+	filename := filepath.Join(path, "example.com", "app", "app.jar")
+
+	err := updateCacheIndex(func(index *CacheIndex) error {
+		index.Entries["example.com/app/app.jar"] = &CacheEntry{URL: "https://example.com/app.jar", SHA256: "abc", Size: 3}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := lookupCacheEntry(filename)
+	if err != nil || entry == nil {
+		t.Fatalf("the entry is missing: %v", err)
+	}
+
+	ba, err := os.ReadFile(cacheIndexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an edited index is discarded
+	err = os.WriteFile(cacheIndexPath(), []byte(strings.Replace(string(ba), `"abc"`, `"def"`, 1)), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err = lookupCacheEntry(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry != nil {
+		t.Errorf("the edited entry %+v is used", entry)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"time"
+)
+
+// update checks and policies of the JNLP update element
+const (
+	updateCheckTimeout       = "timeout"
+	updateCheckBackground    = "background"
+	updatePolicyPromptUpdate = "prompt-update"
+	updatePolicyPromptRun    = "prompt-run"
+)
+
+// Update element of the JNLP file
+type Update struct {
+	Check  string `xml:"check,attr"`
+	Policy string `xml:"policy,attr"`
+}
+
+// cachedJnlp returns the JNLP file of the last launch, nil if there is none
+func cachedJnlp(address string) ([]byte, *Jnlp) {
+	path, err := rolloutStatePath(address)
+	if err != nil {
+		return nil, nil
+	}
+
+	ba, err := storage.ReadFile(path)
+	if err != nil {
+		return nil, nil
+	}
+
+	state := &RolloutState{}
+
+	err = json.Unmarshal(ba, state)
+	if err != nil || state.Jnlp == "" {
+		return nil, nil
+	}
+
+	jnlp, err := parseJnlp([]byte(state.Jnlp))
+	if err != nil {
+		return nil, nil
+	}
+
+	return []byte(state.Jnlp), jnlp
+}
+
+// useCached launches the cached version without updating its resources
+func (l *Launch) useCached(content []byte, message string) []byte {
+	common.Info(message)
+	l.logf("%s", message)
+
+	l.keepCached = true
+
+	return content
+}
+
+// fetchRootJnlp loads the JNLP file of the app due to the update check of the cached version: "background" launches
+// the cached version and updates it after the start, "timeout" falls back to the cached version if the JNLP file
+// cannot be loaded in time, "always" (default) loads the JNLP file in any case
+func (l *Launch) fetchRootJnlp(location string, address string) ([]byte, error) {
+	cachedContent, cached := cachedJnlp(address)
+
+	if l.forceUpdate || l.replay != nil || l.offline || l.Verify || cached == nil || cached.Update == nil {
+		return l.fetchJnlp(location)
+	}
+
+	switch cached.Update.Check {
+	case updateCheckBackground:
+		l.backgroundUpdate = true
+
+		return l.useCached(cachedContent, "The cached version is launched and updated in the background"), nil
+	case updateCheckTimeout:
+		type result struct {
+			content []byte
+			err     error
+		}
+
+		ch := make(chan result, 1)
+
+		go func() {
+			content, err := l.fetchJnlp(location)
+
+			ch <- result{content, err}
+		}()
+
+		select {
+		case r := <-ch:
+			if r.err != nil {
+				return l.useCached(cachedContent, fmt.Sprintf("The update check failed, the cached version is launched: %v", r.err)), nil
+			}
+
+			return r.content, nil
+		case <-time.After(*updateTimeout):
+			return l.useCached(cachedContent, "The update check timed out, the cached version is launched"), nil
+		}
+	default:
+		return l.fetchJnlp(location)
+	}
+}
+
+// applyUpdatePolicy decides about an available update due to the update policy of the JNLP file: "always" (default)
+// applies it, "prompt-update" asks and launches the cached version if the update is declined, "prompt-run" asks and
+// cancels the launch if the update is declined
+func (l *Launch) applyUpdatePolicy(address string, content []byte, jnlp *Jnlp) ([]byte, *Jnlp, error) {
+	if l.forceUpdate || l.replay != nil || l.offline || l.Verify || jnlp.Update == nil {
+		return content, jnlp, nil
+	}
+
+	policy := jnlp.Update.Policy
+	if policy != updatePolicyPromptUpdate && policy != updatePolicyPromptRun {
+		return content, jnlp, nil
+	}
+
+	cachedContent, cached := cachedJnlp(address)
+	if cached == nil || string(cachedContent) == string(content) {
+		return content, jnlp, nil
+	}
+
+	title := jnlp.Information.Title
+	if title == "" {
+		title = address
+	}
+
+	ok, err := confirm("espresso", fmt.Sprintf("An update of %s is available. Do you want to update now?", title))
+	if err != nil {
+		common.Warn(fmt.Sprintf("Cannot ask for the update, it is applied: %v", err))
+
+		return content, jnlp, nil
+	}
+
+	if ok {
+		return content, jnlp, nil
+	}
+
+	if policy == updatePolicyPromptRun {
+		return nil, nil, fmt.Errorf("the update was declined, the launch is cancelled")
+	}
+
+	return l.useCached(cachedContent, "The update was declined, the cached version is launched"), cached, nil
+}
+
+// updateInBackground updates the app after its start if requested by the update check "background", the returned
+// channel is closed after the update
+func (l *Launch) updateInBackground() chan struct{} {
+	done := make(chan struct{})
+
+	if !l.backgroundUpdate {
+		close(done)
+
+		return done
+	}
+
+	go func() {
+		defer close(done)
+
+		update := NewLaunch(l.Config, l.Address)
+		update.ID = l.ID
+		update.forceUpdate = true
+
+		_, err := update.resolve()
+		if err == nil {
+			err = update.download()
+		}
+
+		if err != nil {
+			l.logf("Background update failed: %v", err)
+
+			return
+		}
+
+		l.logf("Background update finished, the update is used with the next launch")
+	}()
+
+	return done
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// results of a conformance check
+const (
+	checkPass        = "pass"
+	checkFail        = "FAIL"
+	checkWarn        = "warn"
+	checkUnsupported = "unsupported"
+	checkSkipped     = "skipped"
+)
+
+// mime types of the deployment server
+const (
+	mimeJnlp     = "application/x-java-jnlp-file"
+	mimeJar      = "application/java-archive"
+	mimeJarX     = "application/x-java-archive"
+	mimeJarDiff  = "application/x-java-archive-diff"
+	encodingPack = "pack200-gzip"
+)
+
+// ConformanceCheck is the result of a single check of the deployment server
+type ConformanceCheck struct {
+	Name   string
+	Result string
+	Detail string
+}
+
+// Conformance collects the checks of a deployment server
+type Conformance struct {
+	Checks []ConformanceCheck
+}
+
+// add records the result of a check
+func (c *Conformance) add(name string, result string, detail string, args ...any) {
+	c.Checks = append(c.Checks, ConformanceCheck{
+		Name:   name,
+		Result: result,
+		Detail: fmt.Sprintf(detail, args...),
+	})
+}
+
+// failed returns the number of failed checks
+func (c *Conformance) failed() int {
+	count := 0
+
+	for _, check := range c.Checks {
+		if check.Result == checkFail {
+			count++
+		}
+	}
+
+	return count
+}
+
+// mediaType returns the media type of the response without parameters like the charset
+func mediaType(response *http.Response) string {
+	mediatype, _, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil {
+		return response.Header.Get("Content-Type")
+	}
+
+	return mediatype
+}
+
+// probe sends a request for a conformance check and discards the response body
+func probe(method string, href string, header http.Header) (*http.Response, error) {
+	response, err := httpRequestHeader(method, href, header)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.Copy(io.Discard, response.Body)
+
+	common.Error(response.Body.Close())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// probeJars returns the first jar and the first versioned jar of the app, "" if there is none
+func probeJars(tasks []Task) (string, string) {
+	jar := ""
+	versioned := ""
+
+	for _, task := range tasks {
+		u, err := url.Parse(task.URL)
+		if err != nil || !strings.HasSuffix(strings.ToLower(u.Path), ".jar") {
+			continue
+		}
+
+		if jar == "" {
+			jar = task.URL
+		}
+
+		if versioned == "" && u.Query().Get("version-id") != "" {
+			versioned = task.URL
+		}
+	}
+
+	return jar, versioned
+}
+
+// checkJnlpMime checks the mime type of the JNLP file
+func (c *Conformance) checkJnlpMime(location string) {
+	response, err := probe(http.MethodGet, location, nil)
+	if err != nil {
+		c.add("JNLP mime type", checkFail, "%v", err)
+
+		return
+	}
+
+	if mediaType(response) != mimeJnlp {
+		c.add("JNLP mime type", checkFail, "%q instead of %q, browsers do not pass the file to the launcher", mediaType(response), mimeJnlp)
+
+		return
+	}
+
+	c.add("JNLP mime type", checkPass, "%s", mimeJnlp)
+}
+
+// checkHead checks HEAD requests which the launcher uses to compare cached resources without ETag or Last-Modified
+func (c *Conformance) checkHead(jar string) *http.Response {
+	response, err := probe(http.MethodHead, jar, nil)
+	if err != nil {
+		c.add("HEAD support", checkFail, "%v", err)
+
+		return nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		c.add("HEAD support", checkFail, "status %s", response.Status)
+
+		return nil
+	}
+
+	if response.ContentLength < 0 {
+		c.add("HEAD support", checkFail, "no Content-Length, cached resources without ETag or Last-Modified are loaded again with every launch")
+
+		return response
+	}
+
+	c.add("HEAD support", checkPass, "Content-Length %d", response.ContentLength)
+
+	return response
+}
+
+// checkJarMime checks the mime type of the jar files
+func (c *Conformance) checkJarMime(response *http.Response) {
+	switch mediaType(response) {
+	case mimeJar, mimeJarX:
+		c.add("Jar mime type", checkPass, "%s", mediaType(response))
+	default:
+		c.add("Jar mime type", checkWarn, "%q instead of %q, proxies may alter the content", mediaType(response), mimeJar)
+	}
+}
+
+// checkRange checks range requests which let interrupted downloads resume
+func (c *Conformance) checkRange(jar string) {
+	response, err := probe(http.MethodGet, jar, http.Header{"Range": {"bytes=0-0"}})
+	if err != nil {
+		c.add("Range support", checkFail, "%v", err)
+
+		return
+	}
+
+	if response.StatusCode != http.StatusPartialContent || response.Header.Get("Content-Range") == "" {
+		c.add("Range support", checkUnsupported, "status %s, interrupted downloads start from the beginning", response.Status)
+
+		return
+	}
+
+	c.add("Range support", checkPass, "Content-Range %s", response.Header.Get("Content-Range"))
+}
+
+// checkCacheHeaders checks the validators and conditional requests which make unchanged resources a cheap 304
+func (c *Conformance) checkCacheHeaders(jar string, head *http.Response) {
+	header := http.Header{}
+
+	etag := head.Header.Get("ETag")
+	lastModified := head.Header.Get("Last-Modified")
+
+	switch {
+	case etag != "":
+		header.Set("If-None-Match", etag)
+	case lastModified != "":
+		header.Set("If-Modified-Since", lastModified)
+	default:
+		c.add("Cache headers", checkWarn, "neither ETag nor Last-Modified, changes are detected by the size only")
+
+		return
+	}
+
+	detail := fmt.Sprintf("ETag %q, Last-Modified %q, Cache-Control %q", etag, lastModified, head.Header.Get("Cache-Control"))
+
+	response, err := probe(http.MethodGet, jar, header)
+	if err != nil {
+		c.add("Cache headers", checkFail, "%v", err)
+
+		return
+	}
+
+	if response.StatusCode != http.StatusNotModified {
+		c.add("Cache headers", checkWarn, "%s, but the conditional request returned %s instead of 304", detail, response.Status)
+
+		return
+	}
+
+	c.add("Cache headers", checkPass, "%s, conditional requests return 304", detail)
+}
+
+// checkVersionProtocol checks the JNLP version-based download protocol
+func (c *Conformance) checkVersionProtocol(versioned string) {
+	if versioned == "" {
+		c.add("Version protocol", checkSkipped, "the app has no jar with a version attribute")
+
+		return
+	}
+
+	response, err := probe(http.MethodHead, versioned, nil)
+	if err != nil {
+		c.add("Version protocol", checkFail, "%v", err)
+
+		return
+	}
+
+	u, err := url.Parse(versioned)
+	if err != nil {
+		c.add("Version protocol", checkFail, "%v", err)
+
+		return
+	}
+
+	requested := u.Query().Get("version-id")
+	returned := response.Header.Get(versionIDHeader)
+
+	switch {
+	case response.StatusCode != http.StatusOK:
+		c.add("Version protocol", checkFail, "%s: status %s", versioned, response.Status)
+	case returned == "":
+		c.add("Version protocol", checkFail, "%s: no %s header, the server ignores the version-id", versioned, versionIDHeader)
+	case isExactVersion(requested) && returned != requested:
+		c.add("Version protocol", checkFail, "%s: version %s returned instead of %s", versioned, returned, requested)
+	default:
+		c.add("Version protocol", checkPass, "%s %s", versionIDHeader, returned)
+	}
+}
+
+// checkJarDiff checks if the server delivers incremental updates of versioned jars
+func (c *Conformance) checkJarDiff(versioned string) {
+	if versioned == "" {
+		c.add("JarDiff", checkSkipped, "the app has no jar with a version attribute")
+
+		return
+	}
+
+	u, err := url.Parse(versioned)
+	if err != nil {
+		c.add("JarDiff", checkFail, "%v", err)
+
+		return
+	}
+
+	query := u.Query()
+	query.Set("current-version-id", query.Get("version-id"))
+	u.RawQuery = query.Encode()
+
+	response, err := probe(http.MethodHead, u.String(), nil)
+	if err != nil {
+		c.add("JarDiff", checkFail, "%v", err)
+
+		return
+	}
+
+	if mediaType(response) != mimeJarDiff {
+		c.add("JarDiff", checkUnsupported, "no %s response, espresso always loads complete jars", mimeJarDiff)
+
+		return
+	}
+
+	c.add("JarDiff", checkPass, "%s, espresso always loads complete jars", mimeJarDiff)
+}
+
+// checkPack200 checks if the server delivers pack200 compressed jars
+func (c *Conformance) checkPack200(jar string) {
+	response, err := probe(http.MethodHead, jar, http.Header{"Accept-Encoding": {encodingPack + ",gzip"}})
+	if err != nil {
+		c.add("Pack200", checkFail, "%v", err)
+
+		return
+	}
+
+	if response.Header.Get("Content-Encoding") != encodingPack {
+		c.add("Pack200", checkUnsupported, "no %s encoding, pack200 was removed with Java 14 and is not used by espresso", encodingPack)
+
+		return
+	}
+
+	c.add("Pack200", checkPass, "%s, pack200 was removed with Java 14 and is not used by espresso", encodingPack)
+}
+
+// checkManifest checks the resource manifest which lets warm launches revalidate with a single request
+func (c *Conformance) checkManifest(codebase string) {
+	manifest, err := fetchServeManifest(codebase)
+	if err != nil {
+		c.add("Resource manifest", checkUnsupported, "no %s, every cached resource is revalidated separately", serveManifestName)
+
+		return
+	}
+
+	c.add("Resource manifest", checkPass, "%s with %d files", serveManifestName, len(manifest.Files))
+}
+
+// runValidateServer probes the deployment server of the app and writes the conformance report
+func runValidateServer(cfg *Config, name string, w io.Writer) error {
+	l := NewLaunch(cfg, name)
+
+	if l.Address == "" {
+		return fmt.Errorf("usage: espresso validate-server <alias or url>")
+	}
+
+	location, err := resolveSRV(l.Address)
+	if err != nil {
+		return err
+	}
+
+	c := &Conformance{}
+
+	c.checkJnlpMime(location)
+
+	_, err = l.resolve()
+	if err != nil {
+		return err
+	}
+
+	jar, versioned := probeJars(append(l.registeredTasks(), l.lazyTasks...))
+
+	if jar == "" {
+		c.add("HEAD support", checkSkipped, "the app has no jar")
+	} else if head := c.checkHead(jar); head != nil {
+		c.checkJarMime(head)
+		c.checkRange(jar)
+		c.checkCacheHeaders(jar, head)
+		c.checkPack200(jar)
+	}
+
+	c.checkVersionProtocol(versioned)
+	c.checkJarDiff(versioned)
+	c.checkManifest(l.codebase)
+
+	fmt.Fprintf(w, "Server conformance of %s\n\n", l.Address)
+
+	for _, check := range c.Checks {
+		fmt.Fprintf(w, "%-12s %-18s %s\n", check.Result, check.Name, check.Detail)
+	}
+
+	if c.failed() > 0 {
+		return fmt.Errorf("the server of %s failed %d conformance checks", l.Address, c.failed())
+	}
+
+	return nil
+}
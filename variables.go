@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// variableRegex matches the ${name} substitution variables in JNLP arguments and properties
+var variableRegex = regexp.MustCompile(`\$\{([a-zA-Z][a-zA-Z0-9.]*)\}`)
+
+// variables returns the values of the substitution variables usable in JNLP arguments
+func variables() map[string]string {
+	m := map[string]string{
+		"locale":   userLocale(),
+		"timezone": userTimezone(),
+		"os":       runtime.GOOS,
+		"arch":     *arch,
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		m["hostname"] = hostname
+	}
+
+	if usr, err := user.Current(); err == nil {
+		m["user.name"] = usr.Username
+		m["user.home"] = usr.HomeDir
+	}
+
+	return m
+}
+
+// servletVariableRegex matches the $$name variables of the JnlpDownloadServlet in JNLP arguments and properties
+var servletVariableRegex = regexp.MustCompile(`\$\$(codebase|hostname|name|site)`)
+
+// servletVariables returns the values of the $$name variables for the location of the JNLP file, as the
+// JnlpDownloadServlet would have substituted them on the server
+func servletVariables(location string) map[string]string {
+	u, err := url.Parse(location)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	return map[string]string{
+		"$$codebase": location[:strings.LastIndex(location, "/")+1],
+		"$$hostname": u.Hostname(),
+		"$$name":     path.Base(u.Path),
+		"$$site":     u.Scheme + "://" + u.Host,
+	}
+}
+
+// variables returns the values of the substitution variables of the launch, including the $$name variables of the
+// root JNLP file and the JNLP properties defined so far as ${name} system property placeholders
+func (l *Launch) variables() map[string]string {
+	m := variables()
+
+	m["user.dir"], _ = os.Getwd()
+	m["java.io.tmpdir"] = os.TempDir()
+	m["file.separator"] = string(filepath.Separator)
+	m["path.separator"] = string(filepath.ListSeparator)
+
+	for _, property := range l.properties {
+		if property.Name != "" {
+			m[property.Name] = property.Value
+		}
+	}
+
+	for name, value := range servletVariables(l.location) {
+		m[name] = value
+	}
+
+	return m
+}
+
+// expandVariables replaces the known $$name and ${name} variables in the given text, unknown ones are kept untouched
+func expandVariables(text string, values map[string]string) string {
+	text = servletVariableRegex.ReplaceAllStringFunc(text, func(match string) string {
+		value, ok := values[match]
+		if !ok {
+			return match
+		}
+
+		return value
+	})
+
+	return variableRegex.ReplaceAllStringFunc(text, func(match string) string {
+		value, ok := values[variableRegex.FindStringSubmatch(match)[1]]
+		if !ok {
+			return match
+		}
+
+		return value
+	})
+}
+
+// localeOf converts a POSIX locale like "de_DE.UTF-8@euro" or a Windows locale like "de-DE" to "de_DE"
+func localeOf(s string) string {
+	s, _, _ = strings.Cut(s, ".")
+	s, _, _ = strings.Cut(s, "@")
+
+	return strings.ReplaceAll(s, "-", "_")
+}
+
+// userTimezone returns the IANA name of the local timezone if available, otherwise its abbreviation
+func userTimezone() string {
+	if tz := os.Getenv("TZ"); tz != "" {
+		return strings.TrimPrefix(tz, ":")
+	}
+
+	if link, err := os.Readlink("/etc/localtime"); err == nil {
+		if _, name, ok := strings.Cut(filepath.ToSlash(link), "zoneinfo/"); ok {
+			return name
+		}
+	}
+
+	name, _ := time.Now().Zone()
+
+	return name
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestExpandVariables(t *testing.T) {
+	values := map[string]string{
+		"locale":     "de_DE",
+		"timezone":   "Europe/Berlin",
+		"user.name":  "jdoe",
+		"hostname":   "ws042",
+		"app.mode":   "test",
+		"$$codebase": "https://example.com/app/",
+		"$$hostname": "example.com",
+		"$$name":     "app.jnlp",
+		"$$site":     "https://example.com",
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", "-debug", "-debug"},
+		{"locale", "-lang=${locale}", "-lang=de_DE"},
+		{"several", "${user.name}@${hostname}", "jdoe@ws042"},
+		{"property", "-mode=${app.mode}", "-mode=test"},
+		{"unknown kept", "${unknown}", "${unknown}"},
+		{"invalid name kept", "${1locale}", "${1locale}"},
+		{"unterminated kept", "${locale", "${locale"},
+		{"servlet codebase", "$$codebaseupdate.xml", "https://example.com/app/update.xml"},
+		{"servlet site", "$$site/help", "https://example.com/help"},
+		{"servlet name", "-jnlp=$$name", "-jnlp=app.jnlp"},
+		{"servlet and property", "$$hostname:${timezone}", "example.com:Europe/Berlin"},
+		{"value not expanded again", "${literal}", "${locale}"},
+	}
+
+	values["literal"] = "${locale}"
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := expandVariables(test.text, values)
+			if got != test.want {
+				t.Errorf("expandVariables(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestServletVariables(t *testing.T) {
+	tests := []struct {
+		location string
+		want     map[string]string
+	}{
+		{"https://example.com:8443/apps/demo/app.jnlp", map[string]string{
+			"$$codebase": "https://example.com:8443/apps/demo/",
+			"$$hostname": "example.com",
+			"$$name":     "app.jnlp",
+			"$$site":     "https://example.com:8443",
+		}},
+		{"relative/app.jnlp", nil},
+		{"", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.location, func(t *testing.T) {
+			got := servletVariables(test.location)
+			if len(got) != len(test.want) {
+				t.Fatalf("servletVariables(%q) = %v, want %v", test.location, got, test.want)
+			}
+
+			for name, value := range test.want {
+				if got[name] != value {
+					t.Errorf("servletVariables(%q)[%s] = %q, want %q", test.location, name, got[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestLocaleOf(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"de_DE.UTF-8", "de_DE"},
+		{"de_DE.UTF-8@euro", "de_DE"},
+		{"de_DE@euro", "de_DE"},
+		{"de-DE", "de_DE"},
+		{"en", "en"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.locale, func(t *testing.T) {
+			got := localeOf(test.locale)
+			if got != test.want {
+				t.Errorf("localeOf(%q) = %q, want %q", test.locale, got, test.want)
+			}
+		})
+	}
+}
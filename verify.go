@@ -0,0 +1,99 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// verify checks the command line like a JVM would without starting one: the classpath entries must be readable
+// jars, the native library paths must exist and the main class must be contained in the jars
+func (l *Launch) verify(cmds []string) error {
+	errs := newErrorAggregator()
+
+	var classpath []string
+	mainClass := ""
+
+	// the app arguments follow the main class or the main jar
+loop:
+	for i := 0; i < len(cmds); i++ {
+		switch {
+		case cmds[i] == "-cp" && i+1 < len(cmds):
+			i++
+			classpath = strings.Split(cmds[i], string(filepath.ListSeparator))
+		case cmds[i] == "-jar" && i+1 < len(cmds):
+			classpath = []string{cmds[i+1]}
+
+			name, err := manifestMainClass(cmds[i+1])
+			if err != nil {
+				errs.Set(err)
+			}
+
+			mainClass = name
+
+			break loop
+		case (cmds[i] == "--module-path" || cmds[i] == "--add-modules") && i+1 < len(cmds):
+			// the modules of the OpenJFX SDK
+			i++
+		case strings.HasPrefix(cmds[i], "-"):
+		default:
+			mainClass = cmds[i]
+
+			// the applet runner is followed by the main class of the applet
+			if mainClass == appletRunnerClass && i+1 < len(cmds) {
+				mainClass = cmds[i+1]
+			}
+
+			break loop
+		}
+	}
+
+	for _, path := range strings.Split(systemProperties(cmds)["java.library.path"], string(filepath.ListSeparator)) {
+		if path == "" {
+			continue
+		}
+
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			errs.Set(fmt.Errorf("native library path %s does not exist", path))
+		}
+	}
+
+	found := false
+	entry := strings.ReplaceAll(mainClass, ".", "/") + ".class"
+
+	for _, jar := range classpath {
+		r, err := zip.OpenReader(jar)
+		if err != nil {
+			errs.Set(fmt.Errorf("classpath entry %s is not a readable jar: %w", jar, err))
+
+			continue
+		}
+
+		for _, f := range r.File {
+			if f.Name == entry {
+				found = true
+
+				break
+			}
+		}
+
+		common.Error(r.Close())
+	}
+
+	if mainClass == "" {
+		errs.Set(fmt.Errorf("no main class defined"))
+	} else if !found {
+		errs.Set(fmt.Errorf("main class %s is not contained in the classpath", mainClass))
+	}
+
+	if errs.IsSet() {
+		return errs.Get()
+	}
+
+	common.Info(fmt.Sprintf("Verification of %s succeeded: %d classpath entries, main class %s, %d known vulnerable libraries", l.Address, len(classpath), mainClass, len(l.vulnerabilities)))
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// launcherVersion returns the module version of espresso, empty for development builds
+func launcherVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" || info.Main.Version == "(devel)" {
+		return ""
+	}
+
+	return strings.TrimPrefix(info.Main.Version, "v")
+}
+
+// splitVersion splits a version string into its parts separated by '.', '-' or '_'
+func splitVersion(version string) []string {
+	return strings.FieldsFunc(version, func(r rune) bool {
+		return r == '.' || r == '-' || r == '_'
+	})
+}
+
+// compareVersions compares two version strings part by part, numeric parts are compared as numbers
+func compareVersions(v0 string, v1 string) int {
+	p0 := splitVersion(v0)
+	p1 := splitVersion(v1)
+
+	for i := 0; i < len(p0) || i < len(p1); i++ {
+		var s0, s1 string
+
+		if i < len(p0) {
+			s0 = p0[i]
+		}
+
+		if i < len(p1) {
+			s1 = p1[i]
+		}
+
+		n0, err0 := strconv.Atoi(s0)
+		n1, err1 := strconv.Atoi(s1)
+
+		switch {
+		case err0 == nil && err1 == nil:
+			if n0 != n1 {
+				if n0 < n1 {
+					return -1
+				}
+
+				return 1
+			}
+		case s0 == "":
+			return -1
+		case s1 == "":
+			return 1
+		default:
+			if c := strings.Compare(s0, s1); c != 0 {
+				return c
+			}
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mpetavy/common"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// versionIDHeader is the response header of the version-based download protocol with the returned version
+const versionIDHeader = "x-java-jnlp-version-id"
+
+// isExactVersion checks if the version is a single version and not a range like "1.2+" or "1.2*" or a list
+func isExactVersion(version string) bool {
+	return version != "" && !strings.ContainsAny(version, "+* ")
+}
+
+// versionedPath returns the cache path of a specific version of the resource, e.g. lib/a__V1.2.jar
+func versionedPath(path string, version string) string {
+	ext := filepath.Ext(path)
+
+	return strings.TrimSuffix(path, ext) + "__V" + sanitizeName(version) + ext
+}
+
+// applyVersionID switches a versioned jar to the version-based download protocol. Exact versions are cached
+// per version and never revalidated, since the content of a version does not change.
+func (l *Launch) applyVersionID(jar *Jar) {
+	if jar.Version == "" {
+		return
+	}
+
+	query := jar.URL.Query()
+	query.Set("version-id", jar.Version)
+	jar.URL.RawQuery = query.Encode()
+
+	jar.Path = versionedPath(jar.Path, jar.Version)
+
+	if isExactVersion(jar.Version) && common.FileExists(jar.Path) {
+		l.mu.Lock()
+		l.current[jar.Path] = true
+		l.mu.Unlock()
+	}
+}
+
+// checkVersionID warns if the server returns another version than the requested exact one
+func checkVersionID(href string, response *http.Response) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return
+	}
+
+	requested := u.Query().Get("version-id")
+	returned := response.Header.Get(versionIDHeader)
+
+	if isExactVersion(requested) && returned != "" && returned != requested {
+		common.Warn(fmt.Sprintf("%s: requested version %s, but the server returned version %s", href, requested, returned))
+	}
+}
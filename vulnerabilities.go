@@ -0,0 +1,350 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// handling of known vulnerable libraries in the classpath
+const (
+	vulnerabilitiesOff    = "off"
+	vulnerabilitiesWarn   = "warn"
+	vulnerabilitiesStrict = "strict"
+)
+
+// bundledAdvisories is the offline subset of the OSV advisories of widely exploited Java libraries
+//
+//go:embed advisories.json
+var bundledAdvisories []byte
+
+// jarNameRegex splits the file name of a jar like "log4j-core-2.14.1.jar" into artifact and version
+var jarNameRegex = regexp.MustCompile(`^(.+?)-(\d[^-]*(?:-[A-Za-z0-9.]+)?)\.jar$`)
+
+// Advisory is an OSV advisory, only the fields used by espresso are declared
+type Advisory struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Summary  string   `json:"summary"`
+	Affected []struct {
+		Package struct {
+			Ecosystem string `json:"ecosystem"`
+			Name      string `json:"name"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string `json:"type"`
+			Events []struct {
+				Introduced   string `json:"introduced"`
+				Fixed        string `json:"fixed"`
+				LastAffected string `json:"last_affected"`
+			} `json:"events"`
+		} `json:"ranges"`
+		Versions []string `json:"versions"`
+		// DatabaseSpecific may list the SHA-256 hashes of affected jars which carry no Maven metadata
+		DatabaseSpecific struct {
+			SHA256 []string `json:"sha256"`
+		} `json:"database_specific"`
+	} `json:"affected"`
+}
+
+// Library is a library contained in a jar, identified by its Maven metadata or by the file name of the jar
+type Library struct {
+	Group    string
+	Artifact string
+	Version  string
+}
+
+// Vulnerability is a known vulnerable library found in the classpath
+type Vulnerability struct {
+	Jar      string
+	Library  Library
+	Advisory *Advisory
+}
+
+func (v Vulnerability) String() string {
+	name := v.Library.Artifact
+	if v.Library.Group != "" {
+		name = v.Library.Group + ":" + name
+	}
+
+	id := v.Advisory.ID
+	if len(v.Advisory.Aliases) > 0 {
+		id += " (" + strings.Join(v.Advisory.Aliases, ", ") + ")"
+	}
+
+	return fmt.Sprintf("%s %s in %s is vulnerable, %s: %s", name, v.Library.Version, filepath.Base(v.Jar), id, v.Advisory.Summary)
+}
+
+// loadAdvisories returns the bundled advisories and the ones of the advisory database of the config
+func loadAdvisories(database string) ([]*Advisory, error) {
+	var advisories []*Advisory
+
+	err := json.Unmarshal(bundledAdvisories, &advisories)
+	if err != nil {
+		return nil, err
+	}
+
+	if database == "" {
+		return advisories, nil
+	}
+
+	ba, err := os.ReadFile(database)
+	if err != nil {
+		return nil, err
+	}
+
+	var additional []*Advisory
+
+	err = json.Unmarshal(ba, &additional)
+	if err != nil {
+		return nil, fmt.Errorf("invalid advisory database %s: %w", database, err)
+	}
+
+	return append(advisories, additional...), nil
+}
+
+// releaseQualifiers are the qualifiers of release versions like "5.2.20.RELEASE"
+var releaseQualifiers = []string{"release", "final", "ga"}
+
+// releaseParts returns the numeric parts of the version before its qualifier and if the qualifier marks a pre-release,
+// "2.0-beta9" has the release parts "2.0" and is a pre-release
+func releaseParts(version string) (string, bool) {
+	parts := splitVersion(version)
+
+	for i, part := range parts {
+		if _, err := strconv.Atoi(part); err != nil {
+			return strings.Join(parts[:i], "."), !slices.Contains(releaseQualifiers, strings.ToLower(part))
+		}
+	}
+
+	return strings.Join(parts, "."), false
+}
+
+// compareLibraryVersions compares Maven versions, a pre-release like "2.0-beta9" precedes its release "2.0"
+func compareLibraryVersions(v0 string, v1 string) int {
+	r0, pre0 := releaseParts(v0)
+	r1, pre1 := releaseParts(v1)
+
+	if c := compareVersions(r0, r1); c != 0 {
+		return c
+	}
+
+	switch {
+	case pre0 && !pre1:
+		return -1
+	case !pre0 && pre1:
+		return 1
+	case !pre0 && !pre1:
+		return 0
+	}
+
+	return compareVersions(v0, v1)
+}
+
+// affects reports if the advisory applies to the library or to the jar with the SHA-256 hash
+func (advisory *Advisory) affects(library Library, sum string) bool {
+	for _, affected := range advisory.Affected {
+		if sum != "" && slices.ContainsFunc(affected.DatabaseSpecific.SHA256, func(s string) bool {
+			return strings.EqualFold(s, sum)
+		}) {
+			return true
+		}
+
+		if affected.Package.Ecosystem != "" && affected.Package.Ecosystem != "Maven" {
+			continue
+		}
+
+		group, artifact, ok := strings.Cut(affected.Package.Name, ":")
+		if !ok {
+			group, artifact = "", group
+		}
+
+		// libraries identified by their file name have no group
+		if artifact != library.Artifact || (library.Group != "" && group != library.Group) {
+			continue
+		}
+
+		if slices.Contains(affected.Versions, library.Version) {
+			return true
+		}
+
+		for _, r := range affected.Ranges {
+			if r.Type != "" && r.Type != "ECOSYSTEM" {
+				continue
+			}
+
+			// the events are ordered pairs of introduced and fixed or last_affected
+			introduced := ""
+			for _, event := range r.Events {
+				switch {
+				case event.Introduced != "":
+					introduced = event.Introduced
+				case event.Fixed != "" && introduced != "":
+					if (introduced == "0" || compareLibraryVersions(library.Version, introduced) >= 0) && compareLibraryVersions(library.Version, event.Fixed) < 0 {
+						return true
+					}
+
+					introduced = ""
+				case event.LastAffected != "" && introduced != "":
+					if (introduced == "0" || compareLibraryVersions(library.Version, introduced) >= 0) && compareLibraryVersions(library.Version, event.LastAffected) <= 0 {
+						return true
+					}
+
+					introduced = ""
+				}
+			}
+
+			// an introduced version without a fix affects all later versions
+			if introduced != "" && (introduced == "0" || compareLibraryVersions(library.Version, introduced) >= 0) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// jarLibraries returns the libraries contained in the jar, by the Maven metadata of all (also shaded) libraries or
+// by the file name of the jar
+func jarLibraries(jar string) ([]Library, error) {
+	var libraries []Library
+
+	r, err := zip.OpenReader(jar)
+	if err != nil {
+		return nil, err
+	}
+
+	// care about closing the jar
+	defer func() {
+		common.Error(r.Close())
+	}()
+
+	for _, f := range r.File {
+		if !strings.HasPrefix(f.Name, "META-INF/maven/") || path.Base(f.Name) != "pom.properties" {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		library := Library{}
+
+		scanner := bufio.NewScanner(rc)
+		for scanner.Scan() {
+			key, value, _ := strings.Cut(scanner.Text(), "=")
+
+			switch strings.TrimSpace(key) {
+			case "groupId":
+				library.Group = strings.TrimSpace(value)
+			case "artifactId":
+				library.Artifact = strings.TrimSpace(value)
+			case "version":
+				library.Version = strings.TrimSpace(value)
+			}
+		}
+
+		common.Error(rc.Close())
+
+		if library.Artifact != "" && library.Version != "" {
+			libraries = append(libraries, library)
+		}
+	}
+
+	if len(libraries) == 0 {
+		if match := jarNameRegex.FindStringSubmatch(filepath.Base(jar)); match != nil {
+			libraries = append(libraries, Library{Artifact: match[1], Version: match[2]})
+		}
+	}
+
+	return libraries, nil
+}
+
+// checkVulnerabilities scans the jars of the classpath against the advisories. Findings are reported in the launcher
+// log and the JSON events, with security.vulnerabilities "strict" they refuse the launch.
+func (l *Launch) checkVulnerabilities() error {
+	security := l.Config.Security
+
+	mode := security.Vulnerabilities
+	if mode == "" || mode == vulnerabilitiesOff {
+		return nil
+	}
+
+	if mode != vulnerabilitiesWarn && mode != vulnerabilitiesStrict {
+		return fmt.Errorf("invalid security.vulnerabilities %q, use %s, %s or %s", mode, vulnerabilitiesOff, vulnerabilitiesWarn, vulnerabilitiesStrict)
+	}
+
+	advisories, err := loadAdvisories(security.AdvisoryDatabase)
+	if err != nil {
+		return err
+	}
+
+	l.vulnerabilities = nil
+
+	for _, jar := range l.jars {
+		libraries, err := jarLibraries(jar)
+		if err != nil {
+			common.Warn(fmt.Sprintf("Cannot scan %s for vulnerable libraries: %v", jar, err))
+
+			continue
+		}
+
+		sum, err := fileHash(jar)
+		if err != nil {
+			return err
+		}
+
+		if len(libraries) == 0 {
+			libraries = append(libraries, Library{Artifact: filepath.Base(jar)})
+		}
+
+		for _, advisory := range advisories {
+			for _, library := range libraries {
+				if !advisory.affects(library, sum) {
+					continue
+				}
+
+				vulnerability := Vulnerability{Jar: jar, Library: library, Advisory: advisory}
+
+				l.vulnerabilities = append(l.vulnerabilities, vulnerability)
+
+				l.logf("Vulnerable library: %s", vulnerability)
+				l.emitEvent(JSONEvent{Event: jsonEventVulnerability, Path: jar, Message: vulnerability.String()})
+
+				// a shaded jar is reported once per advisory
+				break
+			}
+		}
+	}
+
+	if len(l.vulnerabilities) == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("%s ships %d known vulnerable libraries", l.Address, len(l.vulnerabilities))
+
+	logEvent(eventVulnerableLibrary, message)
+
+	for _, vulnerability := range l.vulnerabilities {
+		common.Warn(vulnerability.String())
+	}
+
+	if mode == vulnerabilitiesStrict {
+		logEvent(eventSecurityRejection, message)
+
+		return fmt.Errorf("%s, the launch is refused", message)
+	}
+
+	return nil
+}
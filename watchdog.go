@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/mpetavy/common"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// actions of the watchdog on a hung startup
+const (
+	watchdogDump  = "dump"
+	watchdogKill  = "kill"
+	watchdogRetry = "retry"
+)
+
+// defaultWatchdogTimeout is the time in which the app must show a window or write output
+const defaultWatchdogTimeout = 2 * time.Minute
+
+// watchdogToolTimeout is the max. time of a diagnostic tool, the attach of a hung JVM may hang as well
+const watchdogToolTimeout = 30 * time.Second
+
+// watchdogSignalDelay is the time the JVM gets to write the thread dump requested by a signal
+const watchdogSignalDelay = 2 * time.Second
+
+// WatchdogConfig defines the detection of a hung startup of the app in wait mode
+type WatchdogConfig struct {
+	Enabled bool `json:"enabled"`
+	// Timeout is the time in which the app must show a window or write output (default "2m")
+	Timeout string `json:"timeout"`
+	// Action is "dump" (default), "kill" or "retry"
+	Action string `json:"action"`
+	// Retries is the number of restarts of a hung app with "retry" (default 1)
+	Retries int `json:"retries"`
+}
+
+// HangError reports an app which hung during its startup and has been killed by the watchdog
+type HangError struct {
+	Timeout     time.Duration
+	Diagnostics string
+}
+
+func (e *HangError) Error() string {
+	return fmt.Sprintf("app startup hung for %v and has been killed, diagnostics in %s", e.Timeout, e.Diagnostics)
+}
+
+// Watchdog observes the startup of the app
+type Watchdog struct {
+	launch      *Launch
+	timeout     time.Duration
+	action      string
+	stop        chan struct{}
+	ended       chan struct{}
+	diagnostics string
+	killed      bool
+}
+
+// newWatchdog returns the watchdog of the app config, nil if it is disabled or the launch does not wait for the app
+func (l *Launch) newWatchdog() (*Watchdog, error) {
+	settings := l.App.Watchdog
+
+	if !settings.Enabled || (!l.Wait && !l.Console) {
+		return nil, nil
+	}
+
+	timeout := defaultWatchdogTimeout
+
+	if settings.Timeout != "" {
+		var err error
+
+		timeout, err = time.ParseDuration(settings.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid watchdog timeout %q: %w", settings.Timeout, err)
+		}
+	}
+
+	action := settings.Action
+
+	switch action {
+	case "":
+		action = watchdogDump
+	case watchdogDump, watchdogKill, watchdogRetry:
+	default:
+		return nil, fmt.Errorf("invalid watchdog action %q, use %s, %s or %s", action, watchdogDump, watchdogKill, watchdogRetry)
+	}
+
+	return &Watchdog{launch: l, timeout: timeout, action: action}, nil
+}
+
+// watchdogRetries returns the number of restarts of a hung app
+func (l *Launch) watchdogRetries() int {
+	if l.App.Watchdog.Action != watchdogRetry {
+		return 0
+	}
+
+	if l.App.Watchdog.Retries <= 0 {
+		return 1
+	}
+
+	return l.App.Watchdog.Retries
+}
+
+// watch observes the started app until it shows a window or writes output, ends or the timeout elapses
+func (w *Watchdog) watch(process *os.Process) {
+	if w == nil {
+		return
+	}
+
+	w.stop = make(chan struct{})
+	w.ended = make(chan struct{})
+
+	go func() {
+		defer close(w.ended)
+
+		deadline := time.NewTimer(w.timeout)
+		defer deadline.Stop()
+
+		ticker := time.NewTicker(windowPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				if !processAlive(process.Pid) {
+					return
+				}
+
+				if w.launch.hasOutput() || hasWindow(process.Pid) {
+					w.launch.logf("Watchdog: the app has started")
+
+					return
+				}
+			case <-deadline.C:
+				w.hung(process)
+
+				return
+			}
+		}
+	}()
+}
+
+// hung collects the diagnostics of the hung app and kills it if requested
+func (w *Watchdog) hung(process *os.Process) {
+	l := w.launch
+
+	message := fmt.Sprintf("%s: no window and no output of the app within %v", l.Address, w.timeout)
+
+	common.Warn(message)
+	l.logf("Watchdog: %s", message)
+
+	diagnostics, err := l.collectDiagnostics(process.Pid)
+	if err != nil {
+		common.Warn(fmt.Sprintf("Watchdog: cannot collect the diagnostics of the app: %v", err))
+	} else {
+		l.logf("Watchdog: diagnostics written to %s", diagnostics)
+	}
+
+	w.diagnostics = diagnostics
+
+	logEvent(eventHungStartup, fmt.Sprintf("%s, diagnostics in %s", message, diagnostics))
+
+	if w.action == watchdogDump {
+		return
+	}
+
+	l.logf("Watchdog: the app with PID %d is killed", process.Pid)
+
+	err = process.Kill()
+	if common.Error(err) {
+		return
+	}
+
+	w.killed = true
+}
+
+// Stop ends the observation and returns the HangError of an app which has been killed by the watchdog
+func (w *Watchdog) Stop() error {
+	if w == nil || w.stop == nil {
+		return nil
+	}
+
+	close(w.stop)
+	<-w.ended
+
+	w.stop = nil
+
+	if !w.killed {
+		return nil
+	}
+
+	return &HangError{Timeout: w.timeout, Diagnostics: w.diagnostics}
+}
+
+// hasOutput checks if the app has written to its log, console apps write to the console which is not observed
+func (l *Launch) hasOutput() bool {
+	if l.Console {
+		return false
+	}
+
+	logPath, err := appLogPath(l.Address)
+	if err != nil {
+		return false
+	}
+
+	size, err := common.FileSize(filepath.Join(logPath, appLogFile))
+
+	return err == nil && size > 0
+}
+
+// jdkTool returns the JDK tool of the JRE of the launch, otherwise the one of the PATH
+func (l *Launch) jdkTool(name string) string {
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+
+	if home, err := l.jreHome(); err == nil {
+		if path := filepath.Join(home, "bin", name); common.FileExists(path) {
+			return path
+		}
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+
+	return path
+}
+
+// runTool runs a diagnostic tool with a timeout and appends its output to the buffer
+func runTool(buf *bytes.Buffer, tool string, args ...string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), watchdogToolTimeout)
+	defer cancel()
+
+	fmt.Fprintf(buf, "\n===== %s %v\n\n", filepath.Base(tool), args)
+
+	ba, err := exec.CommandContext(ctx, tool, args...).CombinedOutput()
+
+	buf.Write(ba)
+
+	if err != nil {
+		fmt.Fprintf(buf, "\n%s failed: %v\n", filepath.Base(tool), err)
+
+		return false
+	}
+
+	return true
+}
+
+// collectDiagnostics writes the thread dump and the heap summary of the JVM to the log directory of the app. jcmd
+// and jstack of a JDK are used, without them the JVM is asked by a signal to write the thread dump to its output.
+func (l *Launch) collectDiagnostics(pid int) (string, error) {
+	logPath, err := appLogPath(l.Address)
+	if err != nil {
+		return "", err
+	}
+
+	filename := filepath.Join(logPath, fmt.Sprintf("hang-%s.txt", time.Now().Format("20060102-150405")))
+
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "App: %s\nLaunch ID: %s\nPID: %d\nJRE: %s\nTime: %s\n", l.Address, l.ID, pid, l.Jre, time.Now().Format(time.RFC3339))
+
+	dumped := false
+
+	if jcmd := l.jdkTool("jcmd"); jcmd != "" {
+		dumped = runTool(buf, jcmd, fmt.Sprintf("%d", pid), "Thread.print", "-l")
+
+		runTool(buf, jcmd, fmt.Sprintf("%d", pid), "GC.heap_info")
+	}
+
+	if jstack := l.jdkTool("jstack"); !dumped && jstack != "" {
+		dumped = runTool(buf, jstack, "-l", fmt.Sprintf("%d", pid))
+	}
+
+	if !dumped {
+		err := dumpThreadsSignal(pid)
+		if err != nil {
+			fmt.Fprintf(buf, "\nNo thread dump available, there is no jcmd or jstack: %v\n", err)
+		} else {
+			// the app log is recreated by a retry, so the thread dump is copied
+			time.Sleep(watchdogSignalDelay)
+
+			fmt.Fprintf(buf, "\n===== app output with the thread dump of the JVM\n\n")
+
+			// the output of the app is not copied out of its encrypted log
+			if l.Config.Encryption.Enabled {
+				fmt.Fprintf(buf, "The thread dump is in the encrypted app log, see \"espresso logs\"\n")
+			} else if ba, err := os.ReadFile(filepath.Join(logPath, appLogFile)); err == nil && !l.Console {
+				buf.Write(ba)
+			}
+		}
+	}
+
+	return filename, writeFileAtomic(filename, buf.Bytes())
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	decisionJar       = "jar"
+	decisionNativelib = "nativelib"
+	decisionExtension = "extension"
+	decisionProperty  = "property"
+	decisionJre       = "jre"
+	decisionJavaFX    = "javafx"
+)
+
+// Decision records why a resource of the JNLP was included or skipped
+type Decision struct {
+	Kind     string
+	Href     string
+	Origin   string
+	Path     string
+	Included bool
+	Reason   string
+}
+
+// explain records a resolution decision
+func (l *Launch) explain(decision Decision) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.decisions = append(l.decisions, decision)
+}
+
+// explainSkipped records the resources of a resource block which does not match the platform
+func (l *Launch) explainSkipped(origin string, resource Resource) {
+	reason := fmt.Sprintf("os/arch filter: resources for os=%q arch=%q, this machine is os=%q arch=%q", resource.Os, resource.Arch, l.selectedOS(), l.Arch)
+
+	for _, jar := range resource.Jars {
+		l.explain(Decision{Kind: decisionJar, Href: jar.Href, Origin: origin, Reason: reason})
+	}
+
+	for _, nativelib := range resource.Nativelibs {
+		l.explain(Decision{Kind: decisionNativelib, Href: nativelib.Href, Origin: origin, Reason: reason})
+	}
+
+	for _, extension := range resource.Extensions {
+		l.explain(Decision{Kind: decisionExtension, Href: extension.Href, Origin: origin, Reason: reason})
+	}
+
+	for _, property := range resource.Properties {
+		l.explain(Decision{Kind: decisionProperty, Href: property.Name, Origin: origin, Reason: reason})
+	}
+}
+
+// jarReason explains why a jar is part of the classpath
+func (l *Launch) jarReason(jar Jar, eagerParts map[string]bool, isMain bool, lazy bool) string {
+	var reasons []string
+
+	switch {
+	case isMain && jar.Main == "true":
+		reasons = append(reasons, "main jar (main=\"true\"), downloaded at startup")
+	case isMain:
+		reasons = append(reasons, "main jar (first jar of the JNLP), downloaded at startup")
+	case lazy:
+		reasons = append(reasons, "lazy, on the classpath but fetched after the launch")
+	case jar.Download == downloadLazy && eagerParts[jar.Part]:
+		reasons = append(reasons, fmt.Sprintf("lazy, but part %q contains an eager jar, downloaded at startup", jar.Part))
+	case jar.Download == downloadLazy && l.App.PrefetchLazy:
+		reasons = append(reasons, "lazy, downloaded at startup due to the app setting prefetch-lazy")
+	case jar.Download == downloadLazy && l.signatureCheck:
+		reasons = append(reasons, "lazy, downloaded at startup for the signature check of all-permissions")
+	case jar.Download == downloadLazy:
+		reasons = append(reasons, "lazy, downloaded at startup for the verification")
+	default:
+		reasons = append(reasons, "eager, downloaded at startup")
+	}
+
+	if jar.Version != "" {
+		reasons = append(reasons, fmt.Sprintf("version %s", jar.Version))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count := 0
+	for _, path := range l.jars {
+		if path == jar.Path {
+			count++
+		}
+	}
+
+	if count > 1 {
+		reasons = append(reasons, "duplicate, the jar is listed more than once")
+	}
+
+	return strings.Join(reasons, ", ")
+}
+
+// setJre selects the java executable and remembers the rule which chose it
+func (l *Launch) setJre(jre string, reason string) {
+	l.Jre = jre
+	l.jreReason = reason
+	l.jreFallback = false
+}
+
+// runWhy explains the resolution of the app without downloading or launching it
+func runWhy(cfg *Config, name string, w io.Writer) error {
+	l := NewLaunch(cfg, name)
+
+	_, err := l.resolve()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "JNLP: %s\n", l.Address)
+
+	fmt.Fprintf(w, "\nJRE: %s\n  %s\n", l.Jre, l.jreReason)
+
+	origins := make(map[string]Decision)
+
+	for _, kind := range []string{decisionJar, decisionNativelib, decisionExtension, decisionProperty, decisionJre, decisionJavaFX} {
+		title := map[string]string{
+			decisionJar:       "Jars",
+			decisionNativelib: "Native libraries",
+			decisionExtension: "Extensions",
+			decisionProperty:  "Properties",
+			decisionJre:       "JREs",
+			decisionJavaFX:    "JavaFX runtime",
+		}[kind]
+
+		fmt.Fprintf(w, "\n%s:\n", title)
+
+		for _, decision := range l.decisions {
+			if decision.Kind != kind {
+				continue
+			}
+
+			marker := "-"
+			if decision.Included {
+				marker = "+"
+			}
+
+			fmt.Fprintf(w, "%s %s\n    from:   %s\n    reason: %s\n", marker, decision.Href, decision.Origin, decision.Reason)
+
+			if decision.Kind == decisionJar && decision.Included {
+				if _, ok := origins[decision.Path]; !ok {
+					origins[decision.Path] = decision
+				}
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\nClasspath:\n")
+
+	for _, jar := range l.jars {
+		decision := origins[jar]
+
+		fmt.Fprintf(w, "  %s\n    %s from %s\n", jar, decision.Href, decision.Origin)
+	}
+
+	fmt.Fprintf(w, "\n+ included, - skipped\n")
+
+	return nil
+}
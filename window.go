@@ -0,0 +1,29 @@
+package main
+
+import (
+	"time"
+)
+
+// windowPollInterval is the interval in which the first window of the app is looked for
+const windowPollInterval = 250 * time.Millisecond
+
+// awaitFirstWindow waits until the app shows its first window, so progress displays end exactly when the app becomes visible
+func (l *Launch) awaitFirstWindow(pid int) bool {
+	deadline := time.Now().Add(*windowTimeout)
+
+	for time.Now().Before(deadline) && processAlive(pid) {
+		if hasWindow(pid) {
+			l.logf("App window is visible")
+			l.setState("visible")
+			l.emitEvent(JSONEvent{Event: jsonEventWindow, PID: pid})
+
+			return true
+		}
+
+		time.Sleep(windowPollInterval)
+	}
+
+	l.logf("No app window detected within %v", *windowTimeout)
+
+	return false
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// hasWindow checks if the process owns a visible window. On macOS the System Events are asked,
+// on X11 xdotool is used. Wayland has no way to detect the windows of other processes.
+func hasWindow(pid int) bool {
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf(`tell application "System Events" to count windows of (first process whose unix id is %d)`, pid)
+
+		ba, err := exec.Command("osascript", "-e", script).Output()
+		if err != nil {
+			return false
+		}
+
+		count, err := strconv.Atoi(strings.TrimSpace(string(ba)))
+
+		return err == nil && count > 0
+	default:
+		ba, err := exec.Command("xdotool", "search", "--onlyvisible", "--pid", strconv.Itoa(pid)).Output()
+
+		return err == nil && strings.TrimSpace(string(ba)) != ""
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	user32                       = syscall.NewLazyDLL("user32.dll")
+	procEnumWindows              = user32.NewProc("EnumWindows")
+	procGetWindowThreadProcessId = user32.NewProc("GetWindowThreadProcessId")
+	procIsWindowVisible          = user32.NewProc("IsWindowVisible")
+	procGetWindow                = user32.NewProc("GetWindow")
+)
+
+// gwOwner is the GW_OWNER value of GetWindow
+const gwOwner = 4
+
+// hasWindow checks if the process owns a visible top-level window
+func hasWindow(pid int) bool {
+	found := false
+
+	callback := syscall.NewCallback(func(hwnd uintptr, _ uintptr) uintptr {
+		var windowPid uint32
+
+		procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&windowPid)))
+
+		if int(windowPid) != pid {
+			return 1
+		}
+
+		visible, _, _ := procIsWindowVisible.Call(hwnd)
+		owner, _, _ := procGetWindow.Call(hwnd, gwOwner)
+
+		// top-level windows have no owner
+		if visible != 0 && owner == 0 {
+			found = true
+
+			return 0
+		}
+
+		return 1
+	})
+
+	procEnumWindows.Call(callback, 0)
+
+	return found
+}